@@ -0,0 +1,139 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AGGridWriter writes a block of rows for the ag-Grid server-side row model:
+//
+//	{"rows":[
+//	{"widget_id":"abc123","name":"First One"}
+//	,{"widget_id":"def456","name":"Next One"}
+//	],"lastRow":2}
+//
+// lastRow is only written once the end of the result set is reached, which is found by reading
+// one more row than the block, so the rows should come from a query with LIMIT req.Limit() OFFSET
+// req.Offset() (see AGGridRequest).  It embeds RowsWriter, so the column and value options apply
+// the same way.
+type AGGridWriter struct {
+	RowsWriter
+
+	StartRow int // the index of the first row of the block, from the request
+	EndRow   int // the index after the last row of the block, from the request
+}
+
+// NewAGGridWriter is the same as: return &AGGridWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, StartRow: startRow, EndRow: endRow}
+func NewAGGridWriter(w io.Writer, rows RowsLike, startRow, endRow int) *AGGridWriter {
+	return &AGGridWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, StartRow: startRow, EndRow: endRow}
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (gw *AGGridWriter) WriteTo(w io.Writer) (int64, error) {
+	return gw.writeTo(w, gw.WriteResponse)
+}
+
+// WriteResponse writes the block of rows.  MaxRows is set to the block size for the duration
+// of the call.  If the io.Writer in the Writer field is an http.ResponseWriter the Content-Type
+// is set the same as RowsWriter.WriteResponse.
+func (gw *AGGridWriter) WriteResponse() error {
+
+	if ok, err := gw.withOutput(true, gw.WriteResponse); ok {
+		return err
+	}
+
+	if gw.EndRow <= gw.StartRow || gw.StartRow < 0 {
+		return fmt.Errorf("AGGridWriter requires EndRow after StartRow")
+	}
+
+	gw.setJSONContentType()
+
+	prevMaxRows := gw.MaxRows
+	gw.MaxRows = gw.EndRow - gw.StartRow
+	defer func() { gw.MaxRows = prevMaxRows }()
+
+	return gw.writeEnvelope([]byte("{\"rows\":[\n"), gw.WriteCommaRows, func(err error) []byte {
+		buf := []byte{']'}
+		if !gw.truncated && err == nil {
+			buf = append(buf, ",\"lastRow\":"...)
+			buf = strconv.AppendInt(buf, int64(gw.StartRow+gw.rowCount), 10)
+		}
+		return append(buf, "}\n"...)
+	})
+}
+
+// AGGridRequest is the request for a block of rows from the ag-Grid server-side row model.
+type AGGridRequest struct {
+	StartRow    int             `json:"startRow"`
+	EndRow      int             `json:"endRow"`
+	SortModel   []AGGridSort    `json:"sortModel"`
+	FilterModel json.RawMessage `json:"filterModel,omitempty"` // not interpreted
+}
+
+// AGGridSort is one column of the sort model of an AGGridRequest.
+type AGGridSort struct {
+	ColID string `json:"colId"`
+	Sort  string `json:"sort"` // "asc" or "desc"
+}
+
+// AGGridMaxBlockSize is the largest block ParseAGGridRequest allows, since the block size is
+// chosen by the client.  A request for more rows has EndRow lowered to StartRow plus this, and
+// ag-Grid asks for the rest in the next block.  If it is 0 or less the block size is not limited.
+// It should only be set during program initialization.
+var AGGridMaxBlockSize = 1000
+
+// ParseAGGridRequest parses the JSON body of a request from an ag-Grid server-side datasource.
+// The block is limited to AGGridMaxBlockSize rows.
+func ParseAGGridRequest(r *http.Request) (*AGGridRequest, error) {
+
+	var req AGGridRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, err
+	}
+	if req.StartRow < 0 || req.EndRow <= req.StartRow {
+		return nil, fmt.Errorf("invalid startRow %d and endRow %d", req.StartRow, req.EndRow)
+	}
+	if AGGridMaxBlockSize > 0 && req.EndRow-req.StartRow > AGGridMaxBlockSize {
+		req.EndRow = req.StartRow + AGGridMaxBlockSize
+	}
+	for _, s := range req.SortModel {
+		if s.Sort != "asc" && s.Sort != "desc" {
+			return nil, fmt.Errorf("invalid sort %q for %q", s.Sort, s.ColID)
+		}
+	}
+	return &req, nil
+}
+
+// Offset returns the number of rows before the block.
+func (req *AGGridRequest) Offset() int {
+	return req.StartRow
+}
+
+// Limit returns the number of rows to query for the block, one more than the block to tell
+// if it is the last one.
+func (req *AGGridRequest) Limit() int {
+	return req.EndRow - req.StartRow + 1
+}
+
+// OrderBy returns an ORDER BY list (without the ORDER BY) for the sort model, e.g.
+// "`name` DESC, `widget_id`", or "" if there is none.  Only columns in allowed are included,
+// so the request can't order by arbitrary SQL.
+func (req *AGGridRequest) OrderBy(d Dialect, allowed ...string) string {
+	var parts []string
+	for _, s := range req.SortModel {
+		if !containsString(allowed, s.ColID) {
+			continue
+		}
+		part := d.quoteIdent(s.ColID)
+		if s.Sort == "desc" {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
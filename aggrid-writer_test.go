@@ -0,0 +1,63 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAGGridWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	r := httptest.NewRequest("POST", "/widgets", strings.NewReader(`{"startRow":1,"endRow":101,"sortModel":[{"colId":"widget_id","sort":"desc"}]}`))
+	req, err := ParseAGGridRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY "+req.OrderBy(DialectMySQL, "widget_id", "name")+" LIMIT ? OFFSET ?", req.Limit(), req.Offset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	err = NewAGGridWriter(&buf, rows, req.StartRow, req.EndRow).WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"rows":[
+{"widget_id":"abc123","name":"First One"}
+],"lastRow":2}
+` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestParseAGGridRequestMaxBlockSize(t *testing.T) {
+
+	defer func(n int) { AGGridMaxBlockSize = n }(AGGridMaxBlockSize)
+
+	for _, tc := range []struct {
+		max, endRow, want int
+	}{
+		{1000, 110, 110},
+		{1000, 1000000, 1010},
+		{50, 110, 60},
+		{0, 1000000, 1000000},
+	} {
+		AGGridMaxBlockSize = tc.max
+		r := httptest.NewRequest("POST", "/widgets", strings.NewReader(fmt.Sprintf(`{"startRow":10,"endRow":%d}`, tc.endRow)))
+		req, err := ParseAGGridRequest(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.StartRow != 10 || req.EndRow != tc.want || req.Limit() != tc.want-10+1 {
+			t.Errorf("max %d endRow %d: unexpected request %+v", tc.max, tc.endRow, req)
+		}
+	}
+}
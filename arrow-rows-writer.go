@@ -0,0 +1,517 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// ArrowRowsWriter writes a sql.Rows to a stream in the Apache Arrow IPC streaming format,
+// so analytics tools (DuckDB, pandas, polars, etc.) can read query results without a JSON
+// round trip.  Rows are written in record batches of BatchSize rows, so only one batch is
+// held in memory at a time.
+//
+// The Arrow type of each column is chosen from its scan type: integers map to Int64 (or UInt64),
+// floats to Float64, booleans to Bool, times to Timestamp (microseconds, UTC), and everything
+// else to Utf8.  Values of typed columns are taken directly from the scanned data.  Utf8 columns
+// use the same value conversion as RowsWriter, so its options and formatters apply to them:
+// JSON strings are written as their unquoted text and other JSON values as-is.
+// All fields are nullable.
+type ArrowRowsWriter struct {
+	RowsWriter
+
+	BatchSize int // rows per record batch, 1024 if zero
+
+	started bool
+	cols    []arrowColumn
+	nrows   int
+	body    bytes.Buffer
+	fb      fbBuilder
+}
+
+// arrowColumn accumulates the data of one column for the current record batch
+type arrowColumn struct {
+	name     string
+	col      int // index in RowsWriter columns
+	kind     int
+	validity []byte
+	data     []byte // fixed width values or Utf8 bytes
+	offsets  []byte // Utf8 offsets
+	nulls    int
+}
+
+// NewArrowRowsWriter is the same as: return &ArrowRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+func NewArrowRowsWriter(w io.Writer, rows RowsLike) *ArrowRowsWriter {
+	return &ArrowRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (aw *ArrowRowsWriter) WriteTo(w io.Writer) (int64, error) {
+	return aw.writeTo(w, aw.WriteResponse)
+}
+
+// WriteResponse writes the schema, all rows in record batches and the end-of-stream marker.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to "application/vnd.apache.arrow.stream".
+func (aw *ArrowRowsWriter) WriteResponse() error {
+
+	if ok, err := aw.withOutput(false, aw.WriteResponse); ok {
+		return err
+	}
+
+	if w, ok := aw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "application/vnd.apache.arrow.stream")
+		}
+	}
+
+	for aw.nextRow() {
+		err := aw.WriteRow()
+		if err != nil {
+			return err
+		}
+	}
+	if err := aw.rowsErr(); err != nil {
+		return err
+	}
+
+	return aw.Close()
+}
+
+// WriteRow will call rows.Scan with the appropriate arguments and add the result to the current
+// record batch, writing the batch out when it is full.
+func (aw *ArrowRowsWriter) WriteRow() error {
+
+	err := aw.start()
+	if err != nil {
+		return err
+	}
+
+	err = aw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	n := aw.nrows
+	for ci := range aw.cols {
+		c := &aw.cols[ci]
+		if n%8 == 0 {
+			c.validity = append(c.validity, 0)
+		}
+		valid, err := aw.appendValue(c)
+		if err != nil {
+			return fmt.Errorf("column %q: %w", c.name, err)
+		}
+		if valid {
+			c.validity[n/8] |= 1 << (n % 8)
+		} else {
+			c.nulls++
+		}
+	}
+	aw.nrows++
+
+	batchSize := aw.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1024
+	}
+	if aw.nrows >= batchSize {
+		return aw.flushBatch()
+	}
+	return nil
+}
+
+// Close writes any remaining rows and the end-of-stream marker.
+// It does not close the underlying Writer.
+func (aw *ArrowRowsWriter) Close() error {
+
+	err := aw.start()
+	if err != nil {
+		return err
+	}
+
+	if aw.nrows > 0 {
+		err = aw.flushBatch()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = aw.Writer.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return err
+}
+
+// start sets up the columns and writes the schema message if not done yet.
+func (aw *ArrowRowsWriter) start() error {
+
+	if aw.started {
+		return nil
+	}
+
+	if len(aw.colNames) == 0 {
+		err := aw.setupColumns()
+		if err != nil {
+			return err
+		}
+	}
+
+	aw.cols = aw.cols[:0]
+	for _, op := range aw.fieldPlan {
+		if op.col < 0 {
+			continue
+		}
+		aw.cols = append(aw.cols, arrowColumn{name: aw.colKeys[op.col], col: op.col, kind: aw.colKind(op.col)})
+	}
+
+	// Schema message
+	fb := &aw.fb
+	fb.reset()
+	fb.table(
+		fbScalar(0, 2, 4), // version: V5
+		fbScalar(1, 1, 1), // header_type: Schema
+		fbChild(2, func(fb *fbBuilder) int {
+			return fb.table(fbChild(1, func(fb *fbBuilder) int {
+				return fb.tableVector(len(aw.cols), func(fb *fbBuilder, i int) int {
+					return aw.cols[i].writeField(fb)
+				})
+			}))
+		}),
+		fbScalar(3, 8, 0), // bodyLength
+	)
+
+	aw.started = true
+	return aw.writeMessage(nil)
+}
+
+// flushBatch writes the current batch as a RecordBatch message and resets the columns.
+func (aw *ArrowRowsWriter) flushBatch() error {
+
+	type fbBuffer struct{ offset, length int64 }
+
+	aw.body.Reset()
+	var buffers []fbBuffer
+	addBuffer := func(b []byte) {
+		off := int64(aw.body.Len())
+		aw.body.Write(b)
+		for aw.body.Len()%8 != 0 {
+			aw.body.WriteByte(0)
+		}
+		buffers = append(buffers, fbBuffer{off, int64(len(b))})
+	}
+
+	for ci := range aw.cols {
+		c := &aw.cols[ci]
+		addBuffer(c.validity)
+		if c.kind == kindText {
+			addBuffer(c.offsets)
+		}
+		addBuffer(c.data)
+	}
+
+	// RecordBatch message
+	fb := &aw.fb
+	fb.reset()
+	fb.table(
+		fbScalar(0, 2, 4), // version: V5
+		fbScalar(1, 1, 3), // header_type: RecordBatch
+		fbChild(2, func(fb *fbBuilder) int {
+			return fb.table(
+				fbScalar(0, 8, uint64(aw.nrows)),
+				fbChild(1, func(fb *fbBuilder) int { // nodes
+					return fb.structVector(len(aw.cols), 16, func(dst []byte, i int) []byte {
+						dst = binary.LittleEndian.AppendUint64(dst, uint64(aw.nrows))
+						return binary.LittleEndian.AppendUint64(dst, uint64(aw.cols[i].nulls))
+					})
+				}),
+				fbChild(2, func(fb *fbBuilder) int { // buffers
+					return fb.structVector(len(buffers), 16, func(dst []byte, i int) []byte {
+						dst = binary.LittleEndian.AppendUint64(dst, uint64(buffers[i].offset))
+						return binary.LittleEndian.AppendUint64(dst, uint64(buffers[i].length))
+					})
+				}),
+			)
+		}),
+		fbScalar(3, 8, uint64(aw.body.Len())), // bodyLength
+	)
+
+	err := aw.writeMessage(aw.body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for ci := range aw.cols {
+		c := &aw.cols[ci]
+		c.validity, c.data, c.offsets, c.nulls = c.validity[:0], c.data[:0], c.offsets[:0], 0
+	}
+	aw.nrows = 0
+	return nil
+}
+
+// writeMessage writes the flatbuffer in aw.fb as an encapsulated IPC message followed by body.
+func (aw *ArrowRowsWriter) writeMessage(body []byte) error {
+
+	meta := aw.fb.buf
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	aw.fb.buf = meta
+
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	_, err := aw.Writer.Write(prefix[:])
+	if err != nil {
+		return err
+	}
+	_, err = aw.Writer.Write(meta)
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		_, err = aw.Writer.Write(body)
+	}
+	return err
+}
+
+// appendValue appends the value of the column c for the current row, returning false for null.
+func (aw *ArrowRowsWriter) appendValue(c *arrowColumn) (bool, error) {
+
+	scanArg := aw.scanArgs[c.col]
+
+	if c.kind == kindText {
+		if len(c.offsets) == 0 {
+			c.offsets = binary.LittleEndian.AppendUint32(c.offsets, 0)
+		}
+		defer func() {
+			c.offsets = binary.LittleEndian.AppendUint32(c.offsets, uint32(len(c.data)))
+		}()
+
+		text, null, err := aw.columnText(c.col)
+		if err != nil || null {
+			return false, err
+		}
+		c.data = append(c.data, text...)
+		return true, nil
+	}
+
+	v := scanValue(scanArg)
+	switch c.kind {
+	case kindInt64, kindUint64, kindTime:
+		var n uint64
+		switch vt := v.(type) {
+		case nil:
+		case time.Time:
+			n = uint64(vt.UnixMicro())
+		default:
+			rv := reflect.ValueOf(v)
+			switch {
+			case rv.CanInt():
+				n = uint64(rv.Int())
+			case rv.CanUint():
+				n = rv.Uint()
+			default:
+				return false, fmt.Errorf("unexpected value type %T", v)
+			}
+		}
+		c.data = binary.LittleEndian.AppendUint64(c.data, n)
+	case kindFloat64:
+		var f float64
+		if v != nil {
+			rv := reflect.ValueOf(v)
+			if !rv.CanFloat() {
+				return false, fmt.Errorf("unexpected value type %T", v)
+			}
+			f = rv.Float()
+		}
+		c.data = binary.LittleEndian.AppendUint64(c.data, math.Float64bits(f))
+	case kindBool:
+		n := aw.nrows
+		if n%8 == 0 {
+			c.data = append(c.data, 0)
+		}
+		if b, _ := v.(bool); b {
+			c.data[n/8] |= 1 << (n % 8)
+		}
+	}
+	return v != nil, nil
+}
+
+// writeField writes the Schema Field table for c.
+func (c *arrowColumn) writeField(fb *fbBuilder) int {
+
+	var typeType uint64
+	var typeTable func(fb *fbBuilder) int
+	switch c.kind {
+	case kindInt64, kindUint64:
+		typeType = 2 // Int
+		signed := uint64(1)
+		if c.kind == kindUint64 {
+			signed = 0
+		}
+		typeTable = func(fb *fbBuilder) int { return fb.table(fbScalar(0, 4, 64), fbScalar(1, 1, signed)) }
+	case kindFloat64:
+		typeType = 3 // FloatingPoint, DOUBLE precision
+		typeTable = func(fb *fbBuilder) int { return fb.table(fbScalar(0, 2, 2)) }
+	case kindBool:
+		typeType = 6 // Bool
+		typeTable = func(fb *fbBuilder) int { return fb.table() }
+	case kindTime:
+		typeType = 10 // Timestamp, MICROSECOND unit
+		typeTable = func(fb *fbBuilder) int {
+			return fb.table(fbScalar(0, 2, 2), fbChild(1, func(fb *fbBuilder) int { return fb.string("UTC") }))
+		}
+	default:
+		typeType = 5 // Utf8
+		typeTable = func(fb *fbBuilder) int { return fb.table() }
+	}
+
+	return fb.table(
+		fbChild(0, func(fb *fbBuilder) int { return fb.string(c.name) }),
+		fbScalar(1, 1, 1), // nullable
+		fbScalar(2, 1, typeType),
+		fbChild(3, typeTable),
+		fbChild(5, func(fb *fbBuilder) int { // children, readers expect this to be present
+			return fb.tableVector(0, nil)
+		}),
+	)
+}
+
+// fbBuilder is a minimal FlatBuffers builder for the Arrow IPC metadata.  Unlike the usual
+// back-to-front builders it writes front-to-back, with each object's children written after it
+// (so all offsets are positive).  The buffer starts with the offset of the root table.
+type fbBuilder struct {
+	buf    []byte
+	rooted bool
+}
+
+// fbField describes a field of a table, either a scalar or an offset to a child object
+type fbField struct {
+	id    int
+	size  int
+	value uint64
+	child func(fb *fbBuilder) int
+}
+
+func fbScalar(id, size int, value uint64) fbField { return fbField{id: id, size: size, value: value} }
+
+func fbChild(id int, child func(fb *fbBuilder) int) fbField {
+	return fbField{id: id, size: 4, child: child}
+}
+
+func (fb *fbBuilder) reset() {
+	fb.buf = append(fb.buf[:0], 0, 0, 0, 0) // root offset, patched by the first table
+	fb.rooted = false
+}
+
+func (fb *fbBuilder) pad(align int) {
+	for len(fb.buf)%align != 0 {
+		fb.buf = append(fb.buf, 0)
+	}
+}
+
+func (fb *fbBuilder) patchOffset(at, target int) {
+	binary.LittleEndian.PutUint32(fb.buf[at:], uint32(target-at))
+}
+
+// table writes a vtable and table with the given fields, then the children, returning the table position.
+func (fb *fbBuilder) table(fields ...fbField) int {
+
+	// layout of the inline table data, after the 4 byte vtable offset
+	nfields := 0
+	offsets := make([]int, len(fields))
+	size := 4
+	for i, f := range fields {
+		for size%f.size != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += f.size
+		if f.id+1 > nfields {
+			nfields = f.id + 1
+		}
+	}
+
+	// vtable
+	fb.pad(2)
+	vtPos := len(fb.buf)
+	vt := make([]uint16, 2+nfields)
+	vt[0] = uint16(4 + 2*nfields)
+	vt[1] = uint16(size)
+	for i, f := range fields {
+		vt[2+f.id] = uint16(offsets[i])
+	}
+	for _, v := range vt {
+		fb.buf = binary.LittleEndian.AppendUint16(fb.buf, v)
+	}
+
+	// table
+	fb.pad(8)
+	pos := len(fb.buf)
+	if !fb.rooted {
+		fb.patchOffset(0, pos) // first table is the root
+		fb.rooted = true
+	}
+	fb.buf = append(fb.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(fb.buf[pos:], uint32(int32(pos-vtPos)))
+	for i, f := range fields {
+		at := pos + offsets[i]
+		switch f.size {
+		case 1:
+			fb.buf[at] = byte(f.value)
+		case 2:
+			binary.LittleEndian.PutUint16(fb.buf[at:], uint16(f.value))
+		case 4:
+			binary.LittleEndian.PutUint32(fb.buf[at:], uint32(f.value))
+		case 8:
+			binary.LittleEndian.PutUint64(fb.buf[at:], f.value)
+		}
+	}
+
+	// children
+	for i, f := range fields {
+		if f.child != nil {
+			fb.patchOffset(pos+offsets[i], f.child(fb))
+		}
+	}
+
+	return pos
+}
+
+// tableVector writes a vector of n tables, each written by elem, returning the vector position.
+func (fb *fbBuilder) tableVector(n int, elem func(fb *fbBuilder, i int) int) int {
+	fb.pad(4)
+	pos := len(fb.buf)
+	fb.buf = binary.LittleEndian.AppendUint32(fb.buf, uint32(n))
+	fb.buf = append(fb.buf, make([]byte, 4*n)...)
+	for i := 0; i < n; i++ {
+		fb.patchOffset(pos+4+4*i, elem(fb, i))
+	}
+	return pos
+}
+
+// structVector writes a vector of n structs of size bytes (8 byte aligned), each appended by elem.
+func (fb *fbBuilder) structVector(n, size int, elem func(dst []byte, i int) []byte) int {
+	for (len(fb.buf)+4)%8 != 0 {
+		fb.buf = append(fb.buf, 0)
+	}
+	pos := len(fb.buf)
+	fb.buf = binary.LittleEndian.AppendUint32(fb.buf, uint32(n))
+	for i := 0; i < n; i++ {
+		fb.buf = elem(fb.buf, i)
+	}
+	return pos
+}
+
+// string writes a string, returning its position.
+func (fb *fbBuilder) string(s string) int {
+	fb.pad(4)
+	pos := len(fb.buf)
+	fb.buf = binary.LittleEndian.AppendUint32(fb.buf, uint32(len(s)))
+	fb.buf = append(fb.buf, s...)
+	fb.buf = append(fb.buf, 0)
+	return pos
+}
@@ -0,0 +1,312 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArrowRowsWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	aw := NewArrowRowsWriter(&buf, rows)
+	aw.BatchSize = 1
+	err = aw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	t.Logf("%d bytes", len(b))
+	eos := []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}
+	if !bytes.HasPrefix(b, eos[:4]) || !bytes.HasSuffix(b, eos) {
+		t.Errorf("missing continuation or end-of-stream marker: %x", b)
+	}
+	if !bytes.Contains(b, []byte("widget_id")) || !bytes.Contains(b, []byte("First One")) || !bytes.Contains(b, []byte("Next One")) {
+		t.Errorf("unexpected output: %x", b)
+	}
+}
+
+func TestArrowRowsWriterBytes(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "BIGINT", reflect.TypeOf(sql.NullInt64{})},
+			{"big", "BIGINT UNSIGNED", reflect.TypeOf(sql.NullInt64{})},
+			{"price", "DOUBLE", reflect.TypeOf(sql.NullFloat64{})},
+			{"ok", "BOOL", reflect.TypeOf(sql.NullBool{})},
+			{"at", "DATETIME", reflect.TypeOf(sql.NullTime{})},
+			{"name", "VARCHAR", reflect.TypeOf(sql.NullString{})},
+		},
+		rows: [][]interface{}{
+			{int64(1), uint64(math.MaxUint64), 1.5, true, time.Unix(1, 0), "ab"},
+			{nil, nil, nil, nil, nil, nil},
+			{int64(-2), uint64(3), -0.25, false, time.Unix(0, 2000), "xyz"},
+		},
+	}
+
+	var buf bytes.Buffer
+	aw := NewArrowRowsWriter(&buf, rows)
+	aw.BatchSize = 2
+	err := aw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// the schema
+	meta, body, b := readArrowMessage(t, b)
+	if len(body) != 0 {
+		t.Fatalf("schema has a body")
+	}
+	msg := fbRoot(meta)
+	if msg.u16(0) != 4 || msg.u8(1) != 1 {
+		t.Fatalf("schema message version %d header type %d", msg.u16(0), msg.u8(1))
+	}
+	type field struct {
+		name     string
+		nullable bool
+		typ      byte
+		typeInfo []uint64
+	}
+	want := []field{
+		{"id", true, 2, []uint64{64, 1}},
+		{"big", true, 2, []uint64{64, 0}},
+		{"price", true, 3, []uint64{2}},
+		{"ok", true, 6, nil},
+		{"at", true, 10, []uint64{2}},
+		{"name", true, 5, nil},
+	}
+	fields := msg.child(2).vector(1)
+	if len(fields) != len(want) {
+		t.Fatalf("got %d fields", len(fields))
+	}
+	for i, f := range fields {
+		got := field{f.string(0), f.u8(1) == 1, f.u8(2), nil}
+		typ := f.child(3)
+		switch got.typ {
+		case 2:
+			got.typeInfo = []uint64{uint64(typ.u32(0)), uint64(typ.u8(1))}
+		case 3:
+			got.typeInfo = []uint64{uint64(typ.u16(0))}
+		case 10:
+			got.typeInfo = []uint64{uint64(typ.u16(0))}
+			if tz := typ.string(1); tz != "UTC" {
+				t.Errorf("field %d timezone %q", i, tz)
+			}
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("field %d: got %+v, want %+v", i, got, want[i])
+		}
+		if n := len(f.vector(5)); n != 0 {
+			t.Errorf("field %d has %d children", i, n)
+		}
+	}
+
+	// the record batches, with each column's validity bitmap, Utf8 offsets and values
+	u64s := func(vs ...uint64) []byte {
+		var b []byte
+		for _, v := range vs {
+			b = binary.LittleEndian.AppendUint64(b, v)
+		}
+		return b
+	}
+	batches := []struct {
+		length  int
+		nulls   []int
+		buffers [][]byte
+	}{
+		{2, []int{1, 1, 1, 1, 1, 1}, [][]byte{
+			{0x01}, u64s(1, 0),
+			{0x01}, u64s(math.MaxUint64, 0),
+			{0x01}, u64s(math.Float64bits(1.5), 0),
+			{0x01}, {0x01},
+			{0x01}, u64s(1000000, 0),
+			{0x01}, {0, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0}, []byte("ab"),
+		}},
+		{1, []int{0, 0, 0, 0, 0, 0}, [][]byte{
+			{0x01}, u64s(math.MaxUint64 - 1),
+			{0x01}, u64s(3),
+			{0x01}, u64s(math.Float64bits(-0.25)),
+			{0x01}, {0x00},
+			{0x01}, u64s(2),
+			{0x01}, {0, 0, 0, 0, 3, 0, 0, 0}, []byte("xyz"),
+		}},
+	}
+	for bi, batch := range batches {
+		meta, body, b = readArrowMessage(t, b)
+		msg := fbRoot(meta)
+		if msg.u16(0) != 4 || msg.u8(1) != 3 {
+			t.Fatalf("batch %d: message version %d header type %d", bi, msg.u16(0), msg.u8(1))
+		}
+		if n := msg.u64(3); n != uint64(len(body)) {
+			t.Errorf("batch %d: bodyLength %d, body is %d bytes", bi, n, len(body))
+		}
+		rb := msg.child(2)
+		if n := rb.u64(0); n != uint64(batch.length) {
+			t.Errorf("batch %d: length %d", bi, n)
+		}
+
+		nodes := rb.structs(1, 16)
+		if len(nodes) != len(batch.nulls) {
+			t.Fatalf("batch %d: got %d nodes", bi, len(nodes))
+		}
+		for i, node := range nodes {
+			length, nulls := binary.LittleEndian.Uint64(node), binary.LittleEndian.Uint64(node[8:])
+			if length != uint64(batch.length) || nulls != uint64(batch.nulls[i]) {
+				t.Errorf("batch %d node %d: length %d nulls %d", bi, i, length, nulls)
+			}
+		}
+
+		buffers := rb.structs(2, 16)
+		if len(buffers) != len(batch.buffers) {
+			t.Fatalf("batch %d: got %d buffers", bi, len(buffers))
+		}
+		for i, bb := range buffers {
+			off, length := binary.LittleEndian.Uint64(bb), binary.LittleEndian.Uint64(bb[8:])
+			if off%8 != 0 {
+				t.Errorf("batch %d buffer %d: offset %d is not 8 byte aligned", bi, i, off)
+			}
+			if off+length > uint64(len(body)) {
+				t.Fatalf("batch %d buffer %d: %d+%d is past the body", bi, i, off, length)
+			}
+			if got := body[off : off+length]; !bytes.Equal(got, batch.buffers[i]) {
+				t.Errorf("batch %d buffer %d: got % x, want % x", bi, i, got, batch.buffers[i])
+			}
+		}
+	}
+
+	if !bytes.Equal(b, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}) {
+		t.Errorf("expected the end-of-stream marker, got % x", b)
+	}
+}
+
+// readArrowMessage reads an encapsulated IPC message from the start of b, checking the 8 byte
+// alignment of its metadata and body, and returns the metadata, body and the rest of b.
+func readArrowMessage(t *testing.T, b []byte) (meta, body, rest []byte) {
+	t.Helper()
+	if len(b) < 8 || binary.LittleEndian.Uint32(b) != 0xffffffff {
+		t.Fatalf("missing continuation marker: % x", b)
+	}
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if n%8 != 0 || 8+n > len(b) {
+		t.Fatalf("bad metadata length %d", n)
+	}
+	meta, b = b[8:8+n], b[8+n:]
+	bodyLen := int(fbRoot(meta).u64(3))
+	if bodyLen%8 != 0 || bodyLen > len(b) {
+		t.Fatalf("bad body length %d", bodyLen)
+	}
+	return meta, b[:bodyLen], b[bodyLen:]
+}
+
+// fbTable reads a FlatBuffers table, see fbBuilder
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+func fbRoot(buf []byte) fbTable {
+	return fbTable{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of field id, or -1 if it is not present
+func (tb fbTable) field(id int) int {
+	vt := tb.pos - int(int32(binary.LittleEndian.Uint32(tb.buf[tb.pos:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(tb.buf[vt:])) {
+		return -1
+	}
+	off := int(binary.LittleEndian.Uint16(tb.buf[vt+4+2*id:]))
+	if off == 0 {
+		return -1
+	}
+	return tb.pos + off
+}
+
+func (tb fbTable) u8(id int) byte {
+	if p := tb.field(id); p >= 0 {
+		return tb.buf[p]
+	}
+	return 0
+}
+
+func (tb fbTable) u16(id int) uint16 {
+	if p := tb.field(id); p >= 0 {
+		return binary.LittleEndian.Uint16(tb.buf[p:])
+	}
+	return 0
+}
+
+func (tb fbTable) u32(id int) uint32 {
+	if p := tb.field(id); p >= 0 {
+		return binary.LittleEndian.Uint32(tb.buf[p:])
+	}
+	return 0
+}
+
+func (tb fbTable) u64(id int) uint64 {
+	if p := tb.field(id); p >= 0 {
+		if p%8 != 0 {
+			panic("unaligned 8 byte field")
+		}
+		return binary.LittleEndian.Uint64(tb.buf[p:])
+	}
+	return 0
+}
+
+// ref returns the position an offset field points to
+func (tb fbTable) ref(id int) int {
+	p := tb.field(id)
+	if p < 0 {
+		panic("missing offset field")
+	}
+	return p + int(binary.LittleEndian.Uint32(tb.buf[p:]))
+}
+
+func (tb fbTable) child(id int) fbTable {
+	return fbTable{tb.buf, tb.ref(id)}
+}
+
+func (tb fbTable) string(id int) string {
+	p := tb.ref(id)
+	n := int(binary.LittleEndian.Uint32(tb.buf[p:]))
+	return string(tb.buf[p+4 : p+4+n])
+}
+
+func (tb fbTable) vector(id int) []fbTable {
+	p := tb.ref(id)
+	n := int(binary.LittleEndian.Uint32(tb.buf[p:]))
+	tables := make([]fbTable, n)
+	for i := range tables {
+		e := p + 4 + 4*i
+		tables[i] = fbTable{tb.buf, e + int(binary.LittleEndian.Uint32(tb.buf[e:]))}
+	}
+	return tables
+}
+
+// structs returns the elements of a vector of structs of size bytes, which must be 8 byte aligned
+func (tb fbTable) structs(id, size int) [][]byte {
+	p := tb.ref(id)
+	n := int(binary.LittleEndian.Uint32(tb.buf[p:]))
+	if (p+4)%8 != 0 {
+		panic("unaligned struct vector")
+	}
+	elems := make([][]byte, n)
+	for i := range elems {
+		elems[i] = tb.buf[p+4+size*i : p+4+size*(i+1)]
+	}
+	return elems
+}
@@ -0,0 +1,341 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// AvroRowsWriter writes a sql.Rows to a stream as an Apache Avro Object Container File.
+// The Avro schema is a record derived from the column types: integers map to long, floats to
+// double, booleans to boolean, times to long with the timestamp-micros logical type, and
+// everything else (including unsigned 64-bit integers) to string.  Columns that are nullable,
+// or whose nullability the driver does not report, use a ["null", type] union.
+//
+// As with ArrowRowsWriter, values of typed columns are taken directly from the scanned data
+// and string columns use the same value conversion as RowsWriter.  Column keys are used as the
+// field names, with characters that are not valid in Avro names replaced by underscores.  Names
+// that are then the same as an earlier field's (e.g. "a-b" and "a_b", or duplicate columns with
+// DuplicateAllow) are suffixed with a number as with DuplicateSuffix: a_b, a_b_2, a_b_3.
+//
+// Close must be called after the last row to write the final block (WriteResponse does this).
+type AvroRowsWriter struct {
+	RowsWriter
+
+	RecordName string // name of the record schema, "Row" if empty
+	BlockSize  int    // rows per data block, 1000 if zero
+
+	started bool
+	cols    []avroColumn
+	sync    [16]byte
+	nrows   int
+	block   []byte
+	out     []byte
+}
+
+// avroColumn is one field of the record schema
+type avroColumn struct {
+	name     string
+	col      int // index in RowsWriter columns
+	kind     int
+	nullable bool
+}
+
+// NewAvroRowsWriter is the same as: return &AvroRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+func NewAvroRowsWriter(w io.Writer, rows RowsLike) *AvroRowsWriter {
+	return &AvroRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (vw *AvroRowsWriter) WriteTo(w io.Writer) (int64, error) {
+	return vw.writeTo(w, vw.WriteResponse)
+}
+
+// WriteResponse writes the file header, all rows and then calls Close.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to "application/avro".
+func (vw *AvroRowsWriter) WriteResponse() error {
+
+	if ok, err := vw.withOutput(false, vw.WriteResponse); ok {
+		return err
+	}
+
+	if w, ok := vw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "application/avro")
+		}
+	}
+
+	for vw.nextRow() {
+		err := vw.WriteRow()
+		if err != nil {
+			return err
+		}
+	}
+	if err := vw.rowsErr(); err != nil {
+		return err
+	}
+
+	return vw.Close()
+}
+
+// WriteRow will call rows.Scan with the appropriate arguments and add the record to the current
+// block, writing the block out when it is full.
+func (vw *AvroRowsWriter) WriteRow() error {
+
+	err := vw.start()
+	if err != nil {
+		return err
+	}
+
+	err = vw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range vw.cols {
+		vw.block, err = vw.appendValue(vw.block, c)
+		if err != nil {
+			return fmt.Errorf("column %q: %w", c.name, err)
+		}
+	}
+	vw.nrows++
+
+	blockSize := vw.BlockSize
+	if blockSize <= 0 {
+		blockSize = 1000
+	}
+	if vw.nrows >= blockSize {
+		return vw.flushBlock()
+	}
+	return nil
+}
+
+// Close writes any remaining rows.  It does not close the underlying Writer.
+func (vw *AvroRowsWriter) Close() error {
+
+	err := vw.start()
+	if err != nil {
+		return err
+	}
+
+	if vw.nrows > 0 {
+		return vw.flushBlock()
+	}
+	return nil
+}
+
+// Schema returns the Avro schema (JSON) for the result set.
+func (vw *AvroRowsWriter) Schema() ([]byte, error) {
+
+	if len(vw.colNames) == 0 {
+		err := vw.setupColumns()
+		if err != nil {
+			return nil, err
+		}
+	}
+	vw.setupAvroColumns()
+
+	type avroField struct {
+		Name string      `json:"name"`
+		Type interface{} `json:"type"`
+	}
+	fields := make([]avroField, 0, len(vw.cols))
+	for _, c := range vw.cols {
+		var typ interface{}
+		switch c.kind {
+		case kindInt64:
+			typ = "long"
+		case kindFloat64:
+			typ = "double"
+		case kindBool:
+			typ = "boolean"
+		case kindTime:
+			typ = map[string]string{"type": "long", "logicalType": "timestamp-micros"}
+		default:
+			typ = "string"
+		}
+		if c.nullable {
+			typ = []interface{}{"null", typ}
+		}
+		fields = append(fields, avroField{Name: c.name, Type: typ})
+	}
+
+	recordName := vw.RecordName
+	if recordName == "" {
+		recordName = "Row"
+	}
+
+	return json.Marshal(struct {
+		Type   string      `json:"type"`
+		Name   string      `json:"name"`
+		Fields []avroField `json:"fields"`
+	}{"record", recordName, fields})
+}
+
+// setupAvroColumns fills in vw.cols from the RowsWriter columns.
+func (vw *AvroRowsWriter) setupAvroColumns() {
+
+	vw.cols = vw.cols[:0]
+	used := make(map[string]bool, len(vw.fieldPlan))
+	for _, op := range vw.fieldPlan {
+		if op.col < 0 {
+			continue
+		}
+		kind := vw.colKind(op.col)
+		if kind == kindUint64 {
+			kind = kindText // Avro has no unsigned types
+		}
+		name := avroName(vw.colKeys[op.col])
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", avroName(vw.colKeys[op.col]), n)
+		}
+		used[name] = true
+		nullable, ok := vw.colTypes[op.col].Nullable()
+		vw.cols = append(vw.cols, avroColumn{
+			name:     name,
+			col:      op.col,
+			kind:     kind,
+			nullable: nullable || !ok,
+		})
+	}
+}
+
+// start writes the file header if not done yet.
+func (vw *AvroRowsWriter) start() error {
+
+	if vw.started {
+		return nil
+	}
+
+	schema, err := vw.Schema()
+	if err != nil {
+		return err
+	}
+
+	_, err = rand.Read(vw.sync[:])
+	if err != nil {
+		return err
+	}
+
+	out := append(vw.out[:0], 'O', 'b', 'j', 1)
+	out = appendAvroLong(out, 2) // metadata map, one block of two entries
+	out = appendAvroBytes(out, []byte("avro.schema"))
+	out = appendAvroBytes(out, schema)
+	out = appendAvroBytes(out, []byte("avro.codec"))
+	out = appendAvroBytes(out, []byte("null"))
+	out = appendAvroLong(out, 0)
+	out = append(out, vw.sync[:]...)
+	vw.out = out
+
+	vw.started = true
+	_, err = vw.Writer.Write(out)
+	return err
+}
+
+// flushBlock writes the current block of records.
+func (vw *AvroRowsWriter) flushBlock() error {
+
+	out := appendAvroLong(vw.out[:0], int64(vw.nrows))
+	out = appendAvroLong(out, int64(len(vw.block)))
+	out = append(out, vw.block...)
+	out = append(out, vw.sync[:]...)
+	vw.out = out
+
+	vw.block = vw.block[:0]
+	vw.nrows = 0
+
+	_, err := vw.Writer.Write(out)
+	return err
+}
+
+// appendValue appends the value of column c for the current row to dst.
+func (vw *AvroRowsWriter) appendValue(dst []byte, c avroColumn) ([]byte, error) {
+
+	if c.kind == kindText {
+		text, null, err := vw.columnText(c.col)
+		if err != nil {
+			return dst, err
+		}
+		if null {
+			if !c.nullable {
+				return dst, fmt.Errorf("unexpected NULL value")
+			}
+			return appendAvroLong(dst, 0), nil
+		}
+		if c.nullable {
+			dst = appendAvroLong(dst, 1)
+		}
+		return appendAvroBytes(dst, text), nil
+	}
+
+	v := scanValue(vw.scanArgs[c.col])
+	if v == nil {
+		if !c.nullable {
+			return dst, fmt.Errorf("unexpected NULL value")
+		}
+		return appendAvroLong(dst, 0), nil
+	}
+	if c.nullable {
+		dst = appendAvroLong(dst, 1)
+	}
+
+	switch vt := v.(type) {
+	case bool:
+		if vt {
+			return append(dst, 1), nil
+		}
+		return append(dst, 0), nil
+	case time.Time:
+		return appendAvroLong(dst, vt.UnixMicro()), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return appendAvroLong(dst, rv.Int()), nil
+	case rv.CanUint():
+		return appendAvroLong(dst, int64(rv.Uint())), nil
+	case rv.CanFloat():
+		return binary.LittleEndian.AppendUint64(dst, math.Float64bits(rv.Float())), nil
+	}
+	return dst, fmt.Errorf("unexpected value type %T", v)
+}
+
+// appendAvroLong appends n as a zig-zag varint.
+func appendAvroLong(dst []byte, n int64) []byte {
+	return binary.AppendUvarint(dst, uint64((n<<1)^(n>>63)))
+}
+
+// appendAvroBytes appends b as Avro bytes (or string): the length followed by the data.
+func appendAvroBytes(dst []byte, b []byte) []byte {
+	return append(appendAvroLong(dst, int64(len(b))), b...)
+}
+
+// avroName returns s with characters that are not allowed in an Avro name replaced by underscores.
+func avroName(s string) string {
+	var buf bytes.Buffer
+	for i, r := range s {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				buf.WriteByte('_')
+			}
+		default:
+			r = '_'
+		}
+		buf.WriteRune(r)
+	}
+	if buf.Len() == 0 {
+		return "_"
+	}
+	return buf.String()
+}
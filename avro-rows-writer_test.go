@@ -0,0 +1,60 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAvroRowsWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	vw := NewAvroRowsWriter(&buf, rows)
+	schema, err := vw.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("schema: %s", schema)
+	if string(schema) != `{"type":"record","name":"Row","fields":[{"name":"widget_id","type":["null","string"]},{"name":"name","type":["null","string"]}]}` {
+		t.Errorf("unexpected schema: %s", schema)
+	}
+
+	err = vw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if !bytes.HasPrefix(b, []byte("Obj\x01")) || !bytes.Contains(b, []byte("\x02\x12First One")) {
+		t.Errorf("unexpected output: %q", b)
+	}
+}
+
+func TestAvroRowsWriterNameCollisions(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"a-b", "VARCHAR", reflect.TypeOf("")},
+			{"a_b", "VARCHAR", reflect.TypeOf("")},
+			{"a_b_2", "VARCHAR", reflect.TypeOf("")},
+			{"a-b", "VARCHAR", reflect.TypeOf("")},
+		},
+	}
+	schema, err := NewAvroRowsWriter(nil, rows).Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"record","name":"Row","fields":[{"name":"a_b","type":["null","string"]},{"name":"a_b_2","type":["null","string"]},{"name":"a_b_2_2","type":["null","string"]},{"name":"a_b_3","type":["null","string"]}]}`
+	if string(schema) != want {
+		t.Errorf("unexpected schema: %s", schema)
+	}
+}
@@ -0,0 +1,225 @@
+package sqljsonutil
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CBOREncoder is a RowEncoder that writes each row as a CBOR (RFC 8949) map.
+// By default the rows are wrapped in an indefinite-length array so the output is a
+// single CBOR data item.  Binary columns are encoded as byte strings, times as tag 0
+// (RFC 3339 text) and UUIDs as tag 37.  Decimals with DecimalAsNumber are exact: integers,
+// or tag 4 decimal fractions, with bignums (tags 2 and 3) when they don't fit in 64 bits.
+// Other JSON numbers without a fraction or exponent are encoded as integers, other numbers
+// as float64.
+type CBOREncoder struct {
+	// Sequence, if true, writes the rows as a CBOR sequence (RFC 8742), i.e. one map after
+	// another with no surrounding array.
+	Sequence bool
+}
+
+// ContentType implements RowEncoder.
+func (e CBOREncoder) ContentType() string {
+	if e.Sequence {
+		return "application/cbor-seq"
+	}
+	return "application/cbor"
+}
+
+// Begin implements RowEncoder.
+func (e CBOREncoder) Begin(dst []byte) ([]byte, error) {
+	if e.Sequence {
+		return dst, nil
+	}
+	return append(dst, 0x9f), nil // indefinite-length array
+}
+
+// End implements RowEncoder.
+func (e CBOREncoder) End(dst []byte) ([]byte, error) {
+	if e.Sequence {
+		return dst, nil
+	}
+	return append(dst, 0xff), nil // "break"
+}
+
+// EncodeRow implements RowEncoder.
+func (CBOREncoder) EncodeRow(dst []byte, keys []string, values []interface{}) ([]byte, error) {
+	dst = appendCBORHead(dst, 5, uint64(len(keys)))
+	for i, k := range keys {
+		dst = appendCBORHead(dst, 3, uint64(len(k)))
+		dst = append(dst, k...)
+		var err error
+		dst, err = appendCBORValue(dst, values[i])
+		if err != nil {
+			return dst, fmt.Errorf("column %q: %w", k, err)
+		}
+	}
+	return dst, nil
+}
+
+// appendCBORValue appends v, a RowEncoder value or one returned by decodeJSONValue, to dst.
+func appendCBORValue(dst []byte, v interface{}) ([]byte, error) {
+
+	switch vt := v.(type) {
+
+	case json.RawMessage:
+		jv, err := decodeJSONValue(vt)
+		if err != nil {
+			return dst, err
+		}
+		return appendCBORValue(dst, jv)
+
+	case json.Number:
+		return appendCBORDecimal(dst, string(vt))
+
+	case []byte:
+		dst = appendCBORHead(dst, 2, uint64(len(vt)))
+		return append(dst, vt...), nil
+
+	case [16]byte:
+		dst = appendCBORHead(dst, 6, 37)
+		dst = appendCBORHead(dst, 2, 16)
+		return append(dst, vt[:]...), nil
+
+	case time.Time:
+		dst = appendCBORHead(dst, 6, 0)
+		s := vt.Format(time.RFC3339Nano)
+		dst = appendCBORHead(dst, 3, uint64(len(s)))
+		return append(dst, s...), nil
+
+	case nil:
+		return append(dst, 0xf6), nil
+
+	case bool:
+		if vt {
+			return append(dst, 0xf5), nil
+		}
+		return append(dst, 0xf4), nil
+
+	case int64:
+		if vt >= 0 {
+			return appendCBORHead(dst, 0, uint64(vt)), nil
+		}
+		return appendCBORHead(dst, 1, uint64(-1-vt)), nil
+
+	case uint64:
+		return appendCBORHead(dst, 0, vt), nil
+
+	case float64:
+		return binary.BigEndian.AppendUint64(append(dst, 0xfb), math.Float64bits(vt)), nil
+
+	case string:
+		dst = appendCBORHead(dst, 3, uint64(len(vt)))
+		return append(dst, vt...), nil
+
+	case []interface{}:
+		dst = appendCBORHead(dst, 4, uint64(len(vt)))
+		var err error
+		for _, e := range vt {
+			dst, err = appendCBORValue(dst, e)
+			if err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+
+	case map[string]interface{}:
+		dst = appendCBORHead(dst, 5, uint64(len(vt)))
+		keys := make([]string, 0, len(vt))
+		for k := range vt {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			dst = appendCBORHead(dst, 3, uint64(len(k)))
+			dst = append(dst, k...)
+			dst, err = appendCBORValue(dst, vt[k])
+			if err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+	}
+
+	return dst, fmt.Errorf("unsupported value type for CBOR %T", v)
+}
+
+// appendCBORDecimal appends the JSON number s exactly: as an integer if it has no fraction
+// or exponent, otherwise as a tag 4 decimal fraction [exponent, mantissa].  Integers that
+// don't fit in 64 bits are bignums (tag 2 or 3).
+func appendCBORDecimal(dst []byte, s string) ([]byte, error) {
+
+	if !isJSONNumber(s) {
+		return dst, fmt.Errorf("invalid number %q", s)
+	}
+
+	mant, exp := s, int64(0)
+	if i := strings.IndexAny(mant, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(mant[i+1:], 10, 64)
+		if err != nil {
+			return dst, fmt.Errorf("invalid number %q: %w", s, err)
+		}
+		mant, exp = mant[:i], e
+	}
+	if i := strings.IndexByte(mant, '.'); i >= 0 {
+		exp -= int64(len(mant) - i - 1)
+		mant = mant[:i] + mant[i+1:]
+	}
+
+	m, ok := new(big.Int).SetString(mant, 10)
+	if !ok {
+		return dst, fmt.Errorf("invalid number %q", s)
+	}
+	if exp != 0 {
+		dst = appendCBORHead(dst, 6, 4)
+		dst = appendCBORHead(dst, 4, 2)
+		dst = appendCBORInt(dst, big.NewInt(exp))
+	}
+	return appendCBORInt(dst, m), nil
+}
+
+// appendCBORInt appends n as an integer, or as a bignum if it doesn't fit in 64 bits.
+func appendCBORInt(dst []byte, n *big.Int) []byte {
+	if n.Sign() >= 0 {
+		if n.IsUint64() {
+			return appendCBORHead(dst, 0, n.Uint64())
+		}
+		b := n.Bytes()
+		dst = appendCBORHead(dst, 6, 2)
+		dst = appendCBORHead(dst, 2, uint64(len(b)))
+		return append(dst, b...)
+	}
+	m := new(big.Int).Neg(n) // -1-n
+	m.Sub(m, big.NewInt(1))
+	if m.IsUint64() {
+		return appendCBORHead(dst, 1, m.Uint64())
+	}
+	b := m.Bytes()
+	dst = appendCBORHead(dst, 6, 3)
+	dst = appendCBORHead(dst, 2, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// appendCBORHead appends the initial byte(s) for major type major with argument n.
+func appendCBORHead(dst []byte, major byte, n uint64) []byte {
+	mt := major << 5
+	switch {
+	case n < 24:
+		return append(dst, mt|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, mt|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, mt|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, mt|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, mt|27), n)
+}
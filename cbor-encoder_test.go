@@ -0,0 +1,85 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCBOREncoder(t *testing.T) {
+
+	keys := []string{"id", "name", "price", "data", "gone"}
+	values := []interface{}{
+		json.RawMessage(`-1`),
+		json.RawMessage(`"a\"b"`),
+		json.RawMessage(`1.5`),
+		json.RawMessage(`{"n":[true,300]}`),
+		json.RawMessage(`null`),
+	}
+
+	enc := CBOREncoder{}
+	b, err := enc.Begin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = enc.EncodeRow(b, keys, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = enc.End(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x9f,
+		0xa5,
+		0x62, 'i', 'd', 0x20,
+		0x64, 'n', 'a', 'm', 'e', 0x63, 'a', '"', 'b',
+		0x65, 'p', 'r', 'i', 'c', 'e', 0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x64, 'd', 'a', 't', 'a', 0xa1, 0x61, 'n', 0x82, 0xf5, 0x19, 0x01, 0x2c,
+		0x64, 'g', 'o', 'n', 'e', 0xf6,
+		0xff,
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got % x, want % x", b, want)
+	}
+}
+
+func TestCBOREncoderTypes(t *testing.T) {
+
+	u := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	ts := "2024-01-02T03:04:05.5Z"
+
+	for _, tc := range []struct {
+		v    interface{}
+		want []byte
+	}{
+		{[]byte{0, 0xff}, []byte{0x42, 0, 0xff}},
+		{u, append([]byte{0xd8, 0x25, 0x50}, u[:]...)},
+		{time.Date(2024, 1, 2, 3, 4, 5, 5e8, time.UTC), append([]byte{0xc0, 0x76}, ts...)},
+		{json.Number("12"), []byte{0x0c}},
+		{json.Number("-12"), []byte{0x2b}},
+		{json.Number("12.34"), []byte{0xc4, 0x82, 0x21, 0x19, 0x04, 0xd2}},
+		{json.Number("-1.5e3"), []byte{0xc4, 0x82, 0x02, 0x2e}},
+		{json.Number("18446744073709551616"), []byte{0xc2, 0x49, 1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{json.Number("-18446744073709551617"), []byte{0xc3, 0x49, 1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{json.Number("0.00000000000000000001"), []byte{0xc4, 0x82, 0x33, 0x01}},
+		{json.RawMessage(`"x"`), []byte{0x61, 'x'}},
+	} {
+		b, err := appendCBORValue(nil, tc.v)
+		if err != nil {
+			t.Errorf("%v: %v", tc.v, err)
+			continue
+		}
+		if !bytes.Equal(b, tc.want) {
+			t.Errorf("%v: got % x, want % x", tc.v, b, tc.want)
+		}
+	}
+
+	_, err := appendCBORValue(nil, json.Number("1x"))
+	if err == nil {
+		t.Errorf("expected an error for an invalid number")
+	}
+}
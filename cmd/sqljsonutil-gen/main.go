@@ -0,0 +1,88 @@
+// Command sqljsonutil-gen generates a Go struct and a specialized JSON writer function for the
+// result set of a query, see sqljsonutil.GenerateGo.  It is meant to be run with go:generate:
+//
+//	//go:generate go run github.com/d0sbit/sqljsonutil/cmd/sqljsonutil-gen -query "SELECT * FROM widgets" -type Widget -o widget_gen.go
+//
+// The query is run against a MySQL database given by -dsn or the SQLJSONUTIL_DSN environment
+// variable, inside a read-only transaction that is rolled back.  Only the column information
+// is used, no rows are read, so a query that returns no rows works as well.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/d0sbit/sqljsonutil"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", os.Getenv("SQLJSONUTIL_DSN"), "MySQL data source name, defaults to $SQLJSONUTIL_DSN")
+	query := flag.String("query", "", "query to generate the struct for (required)")
+	typeName := flag.String("type", "", "name of the struct type (required)")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name, defaults to $GOPACKAGE as set by go:generate")
+	out := flag.String("o", "", "output file, defaults to stdout")
+	flag.Parse()
+
+	if *query == "" || *typeName == "" || *pkg == "" || *dsn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := generate(*dsn, *query, *pkg, *typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	err = os.WriteFile(*out, src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(dsn, query, pkg, typeName string) ([]byte, error) {
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("running query: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := sqljsonutil.GenerateGo(pkg, typeName, cols)
+	if err != nil {
+		return nil, err
+	}
+
+	// note the query the code was generated from
+	header := "// Code generated by sqljsonutil.GenerateGo. DO NOT EDIT.\n"
+	comment := "// Generated by sqljsonutil-gen from: " + strings.Join(strings.Fields(query), " ") + "\n"
+	return []byte(strings.Replace(string(src), header, header+comment, 1)), nil
+}
@@ -0,0 +1,158 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"math"
+)
+
+// jsonSchemaProp is the JSON Schema of one field of a row object.
+type jsonSchemaProp struct {
+	Type            interface{} `json:"type"` // a type name, or a list of them e.g. ["string","null"]
+	Format          string      `json:"format,omitempty"`
+	ContentEncoding string      `json:"contentEncoding,omitempty"`
+	MaxLength       int64       `json:"maxLength,omitempty"`
+}
+
+// SchemaFromColumns returns a JSON Schema (draft 2020-12) describing the row objects RowsWriter
+// writes with its default options for a result set with columns cols, e.g. from rows.ColumnTypes().
+// Each column is a property with the JSON type of its values, "null" added to the type for
+// nullable columns (or if the driver does not report nullability), and maxLength for
+// text columns if the driver reports a length.
+func SchemaFromColumns(cols []*sql.ColumnType) ([]byte, error) {
+	var rw RowsWriter
+	b, err := rw.objectSchema(cols)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(`{"$schema":"https://json-schema.org/draft/2020-12/schema",`), b[1:]...), nil
+}
+
+// objectSchema returns the JSON Schema of the row objects for cols using the options of rw, without a $schema.
+func (rw *RowsWriter) objectSchema(cols []*sql.ColumnType) ([]byte, error) {
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"object","properties":{`)
+
+	// properties are written in column order, which json.Marshal of a map would not do
+	var required []string
+	for i, ct := range cols {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(ct.Name())
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte(':')
+		b, err = json.Marshal(rw.columnSchema(ct))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		if rw.NullPolicy != NullOmit {
+			required = append(required, ct.Name())
+		}
+		if rw.truncatedField(ct) {
+			b, err = json.Marshal(ct.Name() + "_truncated")
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteByte(',')
+			buf.Write(b)
+			buf.WriteString(`:{"type":"boolean","const":true}`)
+		}
+	}
+
+	buf.WriteString(`},"required":`)
+	if required == nil {
+		required = []string{}
+	}
+	b, err := json.Marshal(required)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(b)
+	buf.WriteString(`,"additionalProperties":false}`)
+
+	return buf.Bytes(), nil
+}
+
+// columnSchema returns the JSON Schema of the values written for a column of type ct.
+func (rw *RowsWriter) columnSchema(ct ColumnType) jsonSchemaProp {
+
+	var p jsonSchemaProp
+	name := ct.Name()
+	binary := isBinaryType(ct.DatabaseTypeName()) || containsString(rw.BinaryColumns, name)
+
+	masked := rw.maskRule(name) != nil
+	uuid, object, boolCol := false, isHstoreType(ct.DatabaseTypeName()), false
+	kind := scanArgKind(newScanArg(ct))
+	switch {
+	case masked:
+		kind = kindText
+	case rw.isBoolColumn(name, ct):
+		kind, boolCol = kindBool, true
+	case rw.isUUIDColumn(name, ct.DatabaseTypeName()):
+		kind, uuid = kindText, true
+	case object || rw.isGeoColumn(name, ct.DatabaseTypeName()):
+		kind, object = kindText, true
+	}
+
+	typ := "string"
+	switch kind {
+	case kindInt64:
+		typ = "integer"
+	case kindUint64:
+		typ = "integer"
+		if rw.Uint64Policy == Uint64AsString {
+			typ = "string"
+		}
+	case kindFloat64:
+		typ = "number"
+	case kindBool:
+		typ = "boolean"
+	case kindTime:
+		p.Format = "date-time"
+	default:
+		switch {
+		case masked: // any length
+		case uuid:
+			p.Format = "uuid"
+		case object:
+			typ = "object"
+		case isDecimalColumn(ct):
+			if rw.DecimalAsNumber {
+				typ = "number"
+			}
+		case binary && rw.BinaryEncoding == BinaryBase64:
+			p.ContentEncoding = "base64"
+		case binary && rw.BinaryEncoding == BinaryHex:
+			p.ContentEncoding = "base16"
+		default:
+			if n, ok := ct.Length(); ok && n > 0 && n < math.MaxInt32 {
+				p.MaxLength = n
+			}
+		}
+	}
+
+	types := []string{typ}
+	if typ == "integer" && (rw.Int64AsString || containsString(rw.Int64AsStringColumns, name)) {
+		types = append(types, "string") // integers outside +/- 2^53-1 are written as strings
+	}
+	if boolCol {
+		types = append(types, "integer") // values other than 0 and 1 are written as numbers
+	}
+	if nullable, ok := ct.Nullable(); (nullable || !ok) && rw.NullPolicy == NullWrite {
+		types = append(types, "null")
+	}
+
+	if len(types) == 1 {
+		p.Type = types[0]
+	} else {
+		p.Type = types
+	}
+	return p
+}
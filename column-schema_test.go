@@ -0,0 +1,103 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaFromColumns(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SchemaFromColumns(cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Type       string                            `json:"type"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	err = json.Unmarshal(b, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Type != "object" || len(schema.Properties) != 2 || schema.Properties["name"]["type"] == nil {
+		t.Errorf("unexpected schema: %s", b)
+	}
+	t.Logf("SCHEMA: %s", b)
+}
+
+func TestSchemaColumnTypes(t *testing.T) {
+
+	cols := testColumnTypes(t, []testDriverColumn{
+		{name: "price", dbType: "DECIMAL", scanType: reflect.TypeOf(sql.NullString{}), nullable: true},
+		{name: "id", dbType: "UUID", scanType: reflect.TypeOf(""), length: 36},
+		{name: "data", dbType: "BLOB", scanType: reflect.TypeOf(sql.RawBytes{}), length: 100},
+		{name: "name", dbType: "VARCHAR", scanType: reflect.TypeOf(""), length: 40},
+		{name: "note", dbType: "VARCHAR", scanType: reflect.TypeOf(""), noNullable: true},
+	})
+
+	tests := []struct {
+		name  string
+		setup func(rw *RowsWriter)
+		want  string
+	}{
+		{"default", func(rw *RowsWriter) {},
+			`{"type":"object","properties":{` +
+				`"price":{"type":["string","null"]},` +
+				`"id":{"type":"string","format":"uuid"},` +
+				`"data":{"type":"string","maxLength":100},` +
+				`"name":{"type":"string","maxLength":40},` +
+				`"note":{"type":["string","null"]}},` +
+				`"required":["price","id","data","name","note"],"additionalProperties":false}`},
+		{"decimal as number and base64", func(rw *RowsWriter) {
+			rw.DecimalAsNumber = true
+			rw.BinaryEncoding = BinaryBase64
+		},
+			`{"type":"object","properties":{` +
+				`"price":{"type":["number","null"]},` +
+				`"id":{"type":"string","format":"uuid"},` +
+				`"data":{"type":"string","contentEncoding":"base64"},` +
+				`"name":{"type":"string","maxLength":40},` +
+				`"note":{"type":["string","null"]}},` +
+				`"required":["price","id","data","name","note"],"additionalProperties":false}`},
+		{"hex and omitted nulls", func(rw *RowsWriter) {
+			rw.BinaryEncoding = BinaryHex
+			rw.NullPolicy = NullOmit
+		},
+			`{"type":"object","properties":{` +
+				`"price":{"type":"string"},` +
+				`"id":{"type":"string","format":"uuid"},` +
+				`"data":{"type":"string","contentEncoding":"base16"},` +
+				`"name":{"type":"string","maxLength":40},` +
+				`"note":{"type":"string"}},` +
+				`"required":[],"additionalProperties":false}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rw RowsWriter
+			tt.setup(&rw)
+			b, err := rw.objectSchema(cols)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("unexpected schema:\n got: %s\nwant: %s", b, tt.want)
+			}
+		})
+	}
+}
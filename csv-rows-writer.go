@@ -0,0 +1,181 @@
+package sqljsonutil
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+)
+
+// CSVRowsWriter writes a sql.Rows to a stream as CSV (RFC 4180) with a header row of column names.
+//
+// It embeds RowsWriter and uses the same scanning and value conversion, so options like NullPolicy,
+// BinaryEncoding, Int64AsString, JSONValueFunc and the formatters apply the same way: values that
+// would be written as JSON strings are written as their unquoted text, null as NullText and
+// anything else (numbers, booleans, custom JSON) as-is.  Fields that would be skipped are
+// written as NullText, since CSV rows must all have the same number of fields.
+// Note that the JSON write methods of the embedded RowsWriter are also available, use the
+// methods declared on CSVRowsWriter to write CSV.  Output is buffered, WriteResponse and
+// WriteRows flush it when done (and with FlushEvery or FlushInterval, before the Writer is
+// flushed), after WriteHeader or WriteRow call Flush.
+type CSVRowsWriter struct {
+	RowsWriter
+
+	Comma    rune   // field delimiter, if zero a comma is used
+	UseCRLF  bool   // end lines with \r\n instead of \n
+	NullText string // text written for null values, empty by default
+	NoHeader bool   // do not write the header row
+
+	csvw   *csv.Writer
+	record []string
+}
+
+// NewCSVRowsWriter is the same as: return &CSVRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+func NewCSVRowsWriter(w io.Writer, rows RowsLike) *CSVRowsWriter {
+	return &CSVRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+}
+
+// Reset clears the internal state, the same as RowsWriter.Reset.
+func (cw *CSVRowsWriter) Reset(rows RowsLike) {
+	cw.RowsWriter.Reset(rows)
+	cw.csvw = nil
+	cw.record = cw.record[:0]
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (cw *CSVRowsWriter) WriteTo(w io.Writer) (int64, error) {
+	return cw.writeTo(w, cw.WriteResponse)
+}
+
+// WriteResponse writes the header row (unless NoHeader is set) followed by all rows.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to "text/csv; charset=utf-8".
+func (cw *CSVRowsWriter) WriteResponse() error {
+
+	if ok, err := cw.withOutput(false, cw.WriteResponse); ok {
+		return err
+	}
+
+	if w, ok := cw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		}
+	}
+
+	if !cw.NoHeader {
+		err := cw.WriteHeader()
+		if err != nil {
+			return err
+		}
+	}
+
+	return cw.WriteRows()
+}
+
+// WriteHeader writes the header row of column names.  It is buffered until Flush or WriteRows.
+func (cw *CSVRowsWriter) WriteHeader() error {
+
+	err := cw.setup()
+	if err != nil {
+		return err
+	}
+
+	cw.record = cw.record[:0]
+	for _, op := range cw.fieldPlan {
+		if op.col >= 0 {
+			cw.record = append(cw.record, cw.colKeys[op.col])
+		}
+	}
+
+	return cw.writeRecord()
+}
+
+// WriteRows calls WriteRow in a loop until the end of the result set, then calls Flush.
+func (cw *CSVRowsWriter) WriteRows() error {
+	err := cw.writeRows()
+	if ferr := cw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (cw *CSVRowsWriter) writeRows() error {
+
+	// the rows are passed to the Writer each time so they are there when nextRow flushes it
+	flushRows := cw.FlushEvery > 0 || cw.FlushInterval > 0
+
+	for cw.nextRow() {
+		err := cw.WriteRow()
+		if err != nil {
+			return err
+		}
+		if flushRows {
+			err = cw.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return cw.rowsErr()
+}
+
+// Flush writes any buffered records to Writer.
+func (cw *CSVRowsWriter) Flush() error {
+	if cw.csvw == nil {
+		return nil
+	}
+	cw.csvw.Flush()
+	return cw.csvw.Error()
+}
+
+// WriteRow will call rows.Scan with the appropriate arguments and write the result as a CSV record.
+func (cw *CSVRowsWriter) WriteRow() error {
+
+	err := cw.setup()
+	if err != nil {
+		return err
+	}
+
+	err = cw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	cw.record = cw.record[:0]
+	for _, op := range cw.fieldPlan {
+		if op.col < 0 {
+			continue
+		}
+		text, null, err := cw.columnText(op.col)
+		if err != nil {
+			return err
+		}
+		if null {
+			cw.record = append(cw.record, cw.NullText)
+			continue
+		}
+		cw.record = append(cw.record, string(text))
+	}
+	cw.rowOutBuf.Reset()
+
+	return cw.writeRecord()
+}
+
+// setup initializes the csv.Writer and column information if not done yet.
+func (cw *CSVRowsWriter) setup() error {
+	if cw.csvw == nil {
+		cw.csvw = csv.NewWriter(cw.Writer)
+		if cw.Comma != 0 {
+			cw.csvw.Comma = cw.Comma
+		}
+		cw.csvw.UseCRLF = cw.UseCRLF
+	}
+	if len(cw.colNames) == 0 {
+		return cw.setupColumns()
+	}
+	return nil
+}
+
+// writeRecord writes the current record to the csv.Writer, which buffers it.
+func (cw *CSVRowsWriter) writeRecord() error {
+	return cw.csvw.Write(cw.record)
+}
@@ -0,0 +1,92 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestCSVRowsWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets_data ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	cw := NewCSVRowsWriter(&buf, rows)
+	err = cw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid output %s: %v", buf.String(), err)
+	}
+	if len(records) != 3 || records[0][1] != "data" || records[1][1] != `{"description":"This is abc123, the first one."}` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+	t.Logf("OUTPUT: %s", buf.String())
+}
+
+// writeCountWriter counts the calls to Write.
+type writeCountWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCountWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestCSVRowsWriterBuffered(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "INT", reflect.TypeOf(int64(0))},
+			{"name", "VARCHAR", reflect.TypeOf(sql.NullString{})},
+		},
+		rows: [][]interface{}{{int64(1), `say "hi"` + "\n"}, {int64(2), nil}, {int64(3), "é"}},
+	}
+	var w writeCountWriter
+	cw := NewCSVRowsWriter(&w, rows)
+	cw.NullText = "NULL"
+	err := cw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "id,name\n1,\"say \"\"hi\"\"\n\"\n2,NULL\n3,é\n" {
+		t.Errorf("unexpected output: %q", w.String())
+	}
+	if w.writes != 1 {
+		t.Errorf("expected the output in 1 write, got %d", w.writes)
+	}
+
+	// WriteRow is buffered until Flush
+	rows.next = 0
+	w = writeCountWriter{}
+	cw = NewCSVRowsWriter(&w, rows)
+	cw.Rows.Next()
+	err = cw.WriteRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Len() != 0 {
+		t.Errorf("unexpected output before Flush: %q", w.String())
+	}
+	err = cw.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "1,\"say \"\"hi\"\"\n\"\n" {
+		t.Errorf("unexpected output: %q", w.String())
+	}
+}
@@ -0,0 +1,175 @@
+package sqljsonutil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DataTablesWriter writes rows as a jQuery DataTables server-side processing response:
+//
+//	{"draw":1,"recordsTotal":2,"recordsFiltered":2,"data":[
+//	{"widget_id":"abc123","name":"First One"}
+//	,{"widget_id":"def456","name":"Next One"}
+//	]}
+//
+// The rows are written as objects, so the DataTables columns should set columns.data to the
+// column names.  The rows should already be the requested page, see ParseDataTablesRequest.
+// It embeds RowsWriter, so the column and value options apply the same way.
+type DataTablesWriter struct {
+	RowsWriter
+
+	Draw            int   // the draw counter from the request, which DataTables uses to order responses
+	RecordsTotal    int64 // the number of rows before filtering
+	RecordsFiltered int64 // the number of rows after filtering (the search), before paging
+}
+
+// NewDataTablesWriter is the same as: return &DataTablesWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Draw: draw}
+func NewDataTablesWriter(w io.Writer, rows RowsLike, draw int) *DataTablesWriter {
+	return &DataTablesWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Draw: draw}
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (dw *DataTablesWriter) WriteTo(w io.Writer) (int64, error) {
+	return dw.writeTo(w, dw.WriteResponse)
+}
+
+// WriteResponse writes the response.  If the io.Writer in the Writer field is an
+// http.ResponseWriter the Content-Type is set the same as RowsWriter.WriteResponse.
+func (dw *DataTablesWriter) WriteResponse() error {
+
+	if ok, err := dw.withOutput(true, dw.WriteResponse); ok {
+		return err
+	}
+
+	dw.setJSONContentType()
+
+	buf := append([]byte(`{"draw":`), strconv.Itoa(dw.Draw)...)
+	buf = append(buf, `,"recordsTotal":`...)
+	buf = strconv.AppendInt(buf, dw.RecordsTotal, 10)
+	buf = append(buf, `,"recordsFiltered":`...)
+	buf = strconv.AppendInt(buf, dw.RecordsFiltered, 10)
+	buf = append(buf, ",\"data\":[\n"...)
+
+	return dw.writeEnvelope(buf, dw.WriteCommaRows, func(error) []byte {
+		return []byte("]}\n")
+	})
+}
+
+// DataTablesRequest is the query parameters of a DataTables server-side processing request.
+type DataTablesRequest struct {
+	Draw        int    // draw
+	Start       int    // start, the offset of the first row
+	Length      int    // length, the number of rows or -1 for all
+	Search      string // search[value]
+	SearchRegex bool   // search[regex]
+	Order       []DataTablesOrder
+	Columns     []DataTablesColumn
+}
+
+// DataTablesOrder is one order[i] of a DataTablesRequest.
+type DataTablesOrder struct {
+	Column int  // order[i][column], the index in Columns
+	Desc   bool // order[i][dir] is "desc"
+}
+
+// DataTablesColumn is one columns[i] of a DataTablesRequest.
+type DataTablesColumn struct {
+	Data        string // columns[i][data]
+	Name        string // columns[i][name]
+	Searchable  bool   // columns[i][searchable]
+	Orderable   bool   // columns[i][orderable]
+	Search      string // columns[i][search][value]
+	SearchRegex bool   // columns[i][search][regex]
+}
+
+// ParseDataTablesRequest parses the DataTables parameters from the URL query or form body of r.
+func ParseDataTablesRequest(r *http.Request) (*DataTablesRequest, error) {
+
+	err := r.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+	f := r.Form
+
+	atoi := func(name string, def int) (int, error) {
+		v := f.Get(name)
+		if v == "" {
+			return def, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		return n, nil
+	}
+
+	var req DataTablesRequest
+	if req.Draw, err = atoi("draw", 0); err != nil {
+		return nil, err
+	}
+	if req.Start, err = atoi("start", 0); err != nil {
+		return nil, err
+	}
+	if req.Length, err = atoi("length", -1); err != nil {
+		return nil, err
+	}
+	if req.Start < 0 || req.Length < -1 {
+		return nil, fmt.Errorf("invalid start or length")
+	}
+	req.Search = f.Get("search[value]")
+	req.SearchRegex = f.Get("search[regex]") == "true"
+
+	for i := 0; ; i++ {
+		p := "columns[" + strconv.Itoa(i) + "]"
+		if _, ok := f[p+"[data]"]; !ok {
+			break
+		}
+		req.Columns = append(req.Columns, DataTablesColumn{
+			Data:        f.Get(p + "[data]"),
+			Name:        f.Get(p + "[name]"),
+			Searchable:  f.Get(p+"[searchable]") == "true",
+			Orderable:   f.Get(p+"[orderable]") == "true",
+			Search:      f.Get(p + "[search][value]"),
+			SearchRegex: f.Get(p+"[search][regex]") == "true",
+		})
+	}
+
+	for i := 0; ; i++ {
+		p := "order[" + strconv.Itoa(i) + "]"
+		if _, ok := f[p+"[column]"]; !ok {
+			break
+		}
+		col, err := atoi(p+"[column]", 0)
+		if err != nil {
+			return nil, err
+		}
+		if col < 0 || col >= len(req.Columns) {
+			return nil, fmt.Errorf("invalid %s[column]: %d", p, col)
+		}
+		req.Order = append(req.Order, DataTablesOrder{Column: col, Desc: strings.EqualFold(f.Get(p+"[dir]"), "desc")})
+	}
+
+	return &req, nil
+}
+
+// OrderBy returns an ORDER BY list (without the ORDER BY) for the requested order, e.g.
+// "`name` DESC, `widget_id`", or "" if there is none.  Only orderable columns whose data
+// is one of allowed are included, so the request can't order by arbitrary SQL.
+func (req *DataTablesRequest) OrderBy(d Dialect, allowed ...string) string {
+	var parts []string
+	for _, o := range req.Order {
+		c := req.Columns[o.Column]
+		if !c.Orderable || !containsString(allowed, c.Data) {
+			continue
+		}
+		part := d.quoteIdent(c.Data)
+		if o.Desc {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,81 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDataTablesWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	r := httptest.NewRequest("GET", "/widgets?draw=2&start=0&length=1&search[value]=&columns[0][data]=widget_id&columns[0][orderable]=true&order[0][column]=0&order[0][dir]=desc", nil)
+	req, err := ParseDataTablesRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderBy := req.OrderBy(DialectMySQL, "widget_id", "name")
+	if orderBy != "`widget_id` DESC" {
+		t.Fatalf("unexpected OrderBy: %s", orderBy)
+	}
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY "+orderBy+" LIMIT ? OFFSET ?", req.Length, req.Start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	dw := NewDataTablesWriter(&buf, rows, req.Draw)
+	dw.RecordsTotal, dw.RecordsFiltered = 2, 2
+	err = dw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"draw":2,"recordsTotal":2,"recordsFiltered":2,"data":[
+{"widget_id":"def456","name":"Next One"}
+]}
+` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+// failingRows is a memRows whose Err returns err once its rows are read.
+type failingRows struct {
+	*memRows
+	err error
+}
+
+func (r *failingRows) Err() error { return r.err }
+
+func TestDataTablesWriterError(t *testing.T) {
+
+	for _, policy := range []ErrorPolicy{ErrorReturn, ErrorRecord} {
+		rows := &failingRows{
+			memRows: &memRows{
+				cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+				rows: [][]interface{}{{int64(1)}},
+			},
+			err: errors.New("connection lost"),
+		}
+		var buf bytes.Buffer
+		dw := NewDataTablesWriter(&buf, rows, 3)
+		dw.ErrorPolicy = policy
+		err := dw.WriteResponse()
+		if err == nil || err.Error() != "connection lost" {
+			t.Errorf("expected the rows error, got %v", err)
+		}
+		// with ErrorRecord the error is written as a row and the envelope is closed
+		want := "{\"draw\":3,\"recordsTotal\":0,\"recordsFiltered\":0,\"data\":[\n{\"id\":1}\n"
+		if policy == ErrorRecord {
+			want += ",{\"_error\":\"connection lost\"}\n]}\n"
+		}
+		if buf.String() != want {
+			t.Errorf("policy %d: unexpected output: %q", policy, buf.String())
+		}
+	}
+}
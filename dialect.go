@@ -0,0 +1,209 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the placeholder style and identifier quoting of generated SQL, see InsertBuilder.
+type Dialect int
+
+const (
+	DialectMySQL     Dialect = iota // ? placeholders and `quoted` identifiers (the default)
+	DialectPostgres                 // $1 placeholders and "quoted" identifiers
+	DialectSQLite                   // ? placeholders and "quoted" identifiers
+	DialectSQLServer                // @p1 placeholders and [quoted] identifiers
+)
+
+// placeholder returns the placeholder for argument n (starting at 1).
+func (d Dialect) placeholder(n int) string {
+	switch d {
+	case DialectPostgres:
+		return "$" + strconv.Itoa(n)
+	case DialectSQLServer:
+		return "@p" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// quoteIdent returns name quoted as an identifier, with any quote characters in it doubled.
+// A name containing dots is treated as qualified (e.g. schema.table) and each part is quoted.
+// Parts already quoted for d (e.g. "my.schema".widgets for DialectPostgres) are kept as they
+// are, so the dots in them do not split the name.
+func (d Dialect) quoteIdent(name string) string {
+	lq, rq := `"`, `"`
+	switch d {
+	case DialectMySQL:
+		lq, rq = "`", "`"
+	case DialectSQLServer:
+		lq, rq = "[", "]"
+	}
+	var sb strings.Builder
+	for i := 0; ; {
+		if strings.HasPrefix(name[i:], lq) {
+			j := d.skipSQL(name, i)
+			if j > i+1 && name[j-1] == rq[0] && (j == len(name) || name[j] == '.') {
+				sb.WriteString(name[i:j])
+				if j == len(name) {
+					break
+				}
+				sb.WriteByte('.')
+				i = j + 1
+				continue
+			}
+		}
+		end := strings.IndexByte(name[i:], '.')
+		if end < 0 {
+			end = len(name)
+		} else {
+			end += i
+		}
+		sb.WriteString(lq + strings.ReplaceAll(name[i:end], rq, rq+rq) + rq)
+		if end == len(name) {
+			break
+		}
+		sb.WriteByte('.')
+		i = end + 1
+	}
+	return sb.String()
+}
+
+// skipSQL returns the index after the string literal, quoted identifier or comment that starts
+// at query[i], or i if none does.  Backslash escapes in strings are only recognized for
+// DialectMySQL, and dollar-quoted strings only for DialectPostgres.
+func (d Dialect) skipSQL(query string, i int) int {
+
+	c := query[i]
+	switch {
+
+	case c == '-' && strings.HasPrefix(query[i:], "--"), c == '#' && d == DialectMySQL:
+		if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+			return i + j + 1
+		}
+		return len(query)
+
+	case c == '/' && strings.HasPrefix(query[i:], "/*"):
+		if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+			return i + 2 + j + 2
+		}
+		return len(query)
+
+	case c == '$' && d == DialectPostgres:
+		j := i + 1
+		for j < len(query) && isParamNameByte(query[j], j == i+1) {
+			j++
+		}
+		if j >= len(query) || query[j] != '$' {
+			return i // a $1 placeholder
+		}
+		tag := query[i : j+1]
+		if k := strings.Index(query[j+1:], tag); k >= 0 {
+			return j + 1 + k + len(tag)
+		}
+		return len(query)
+
+	case c == '\'' || c == '"' || c == '`' || c == '[' && d == DialectSQLServer:
+		end := c
+		if c == '[' {
+			end = ']'
+		}
+		for j := i + 1; j < len(query); j++ {
+			switch {
+			case query[j] == '\\' && d == DialectMySQL && c != '`':
+				j++
+			case query[j] == end:
+				if j+1 < len(query) && query[j+1] == end { // a doubled quote
+					j++
+					continue
+				}
+				return j + 1
+			}
+		}
+		return len(query)
+	}
+
+	return i
+}
+
+// topLevelSQLWords returns the words of query, in upper case, that are not in parentheses,
+// strings, quoted identifiers or comments, e.g. to find a query's own ORDER BY.
+func (d Dialect) topLevelSQLWords(query string) []string {
+	var words []string
+	depth := 0
+	for i := 0; i < len(query); {
+		if j := d.skipSQL(query, i); j > i {
+			i = j
+			continue
+		}
+		switch c := query[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case isParamNameByte(c, false):
+			j := i + 1
+			for j < len(query) && isParamNameByte(query[j], false) {
+				j++
+			}
+			if depth == 0 {
+				words = append(words, strings.ToUpper(query[i:j]))
+			}
+			i = j
+			continue
+		}
+		i++
+	}
+	return words
+}
+
+// decodeJSONObject decodes a JSON object into a map of its raw values.
+func decodeJSONObject(obj []byte) (map[string]json.RawMessage, error) {
+	obj = bytes.TrimSpace(obj)
+	if len(obj) == 0 || obj[0] != '{' {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	var m map[string]json.RawMessage
+	err := json.Unmarshal(obj, &m)
+	return m, err
+}
+
+// jsonArgValue returns the SQL argument for a JSON value: strings, booleans and null as the
+// Go equivalent, numbers as int64 if they are integers in range or otherwise as a json.Number
+// with their exact text (passed to the driver as a string, so e.g. a DECIMAL is not rounded
+// through a float64), and objects and arrays as their JSON text (e.g. for a JSON column).
+func jsonArgValue(v json.RawMessage) (interface{}, error) {
+
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return nil, fmt.Errorf("empty JSON value")
+	}
+
+	switch v[0] {
+	case 'n':
+		return nil, nil
+	case 't', 'f':
+		var b bool
+		err := json.Unmarshal(v, &b)
+		return b, err
+	case '"':
+		var s string
+		err := json.Unmarshal(v, &s)
+		return s, err
+	case '{', '[':
+		return string(v), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.UseNumber()
+	var n json.Number
+	if err := dec.Decode(&n); err != nil || dec.More() {
+		return nil, fmt.Errorf("invalid JSON value %q", v)
+	}
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, nil
+	}
+	return n, nil
+}
@@ -0,0 +1,323 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// GenerateGo returns Go source for package pkg with a struct named typeName for a result set
+// with columns cols, an AppendJSON method that appends a row as a JSON object, and a
+// Write<typeName>Rows function that writes rows the same as WriteResponse with the default
+// options.  The generated code has no reflection or type switches and does not allocate per
+// row, for hot endpoints with a fixed query.  See cmd/sqljsonutil-gen to run it with go:generate.
+//
+// Integer, float, boolean and time columns are scanned into the Go type, and text, binary and
+// decimal columns into sql.RawBytes (only valid until the next row).  Nullable columns use the
+// sql.Null type, e.g. sql.NullInt64 or sql.Null[sql.RawBytes].  The generated code does not
+// mask values, so the Write function returns an error if DefaultMaskRules masks any of the
+// columns (see CheckUnmasked), and AppendJSON should not be used for them.
+func GenerateGo(pkg, typeName string, cols []*sql.ColumnType) ([]byte, error) {
+
+	var buf bytes.Buffer
+	p := func(format string, args ...interface{}) { fmt.Fprintf(&buf, format, args...) }
+
+	type genField struct {
+		name   string // Go field name
+		goType string
+		key    string // JSON of the key
+		kind   int
+		null   bool // goType is a sql.Null type
+	}
+	var fields []genField
+	usesTime, usesStrconv, usesMath := false, false, false
+	names := make(map[string]bool)
+	var colKeys []string
+
+	for _, ct := range cols {
+		f := genField{name: goFieldName(ct.Name(), names), kind: scanArgKind(newScanArg(ct))}
+		names[f.name] = true
+		key, err := json.Marshal(ct.Name())
+		if err != nil {
+			return nil, err
+		}
+		f.key = string(key)
+		colKeys = append(colKeys, f.key)
+		nullable, ok := ct.Nullable()
+		f.null = nullable || !ok
+		switch f.kind {
+		case kindInt64:
+			f.goType = "int64"
+		case kindUint64:
+			f.goType = "uint64"
+		case kindFloat64:
+			f.goType = "float64"
+		case kindBool:
+			f.goType = "bool"
+		case kindTime:
+			f.goType = "time.Time"
+		default:
+			f.goType = "sql.RawBytes"
+		}
+		if f.null {
+			switch f.kind {
+			case kindInt64:
+				f.goType = "sql.NullInt64"
+			case kindFloat64:
+				f.goType = "sql.NullFloat64"
+			case kindBool:
+				f.goType = "sql.NullBool"
+			case kindTime:
+				f.goType = "sql.NullTime"
+			default:
+				f.goType = "sql.Null[" + f.goType + "]"
+			}
+		}
+		switch f.kind {
+		case kindText:
+		case kindTime:
+			usesTime = true
+		case kindFloat64:
+			usesStrconv, usesMath = true, true
+		default:
+			usesStrconv = true
+		}
+		fields = append(fields, f)
+	}
+
+	p("// Code generated by sqljsonutil.GenerateGo. DO NOT EDIT.\n\n")
+	p("package %s\n\n", pkg)
+	p("import (\n\"database/sql\"\n\"io\"\n")
+	if usesMath {
+		p("\"math\"\n")
+	}
+	p("\"net/http\"\n")
+	if usesStrconv {
+		p("\"strconv\"\n")
+	}
+	if usesTime {
+		p("\"time\"\n")
+	}
+	p("\n\"github.com/d0sbit/sqljsonutil\"\n")
+	p(")\n\n")
+
+	p("// %s is one row of the result set.\n", typeName)
+	p("type %s struct {\n", typeName)
+	for _, f := range fields {
+		p("%s %s\n", f.name, f.goType)
+	}
+	p("}\n\n")
+
+	p("// ScanArgs returns the arguments to scan a row into v, in column order.\n")
+	p("func (v *%s) ScanArgs() []interface{} {\nreturn []interface{}{", typeName)
+	for i, f := range fields {
+		if i > 0 {
+			p(", ")
+		}
+		p("&v.%s", f.name)
+	}
+	p("}\n}\n\n")
+
+	p("// AppendJSON appends v as a JSON object to dst.\n")
+	p("func (v *%s) AppendJSON(dst []byte) []byte {\n", typeName)
+	for i, f := range fields {
+		sep := ","
+		if i == 0 {
+			sep = "{"
+		}
+		p("dst = append(dst, %s...)\n", strconv.Quote(sep+f.key+":"))
+		val := "v." + f.name
+		if f.null {
+			p("if !%s.Valid {\ndst = append(dst, \"null\"...)\n} else {\n", val)
+			switch f.kind {
+			case kindInt64:
+				val += ".Int64"
+			case kindFloat64:
+				val += ".Float64"
+			case kindBool:
+				val += ".Bool"
+			case kindTime:
+				val += ".Time"
+			default:
+				val += ".V"
+			}
+		}
+		switch f.kind {
+		case kindInt64:
+			p("dst = strconv.AppendInt(dst, %s, 10)\n", val)
+		case kindUint64:
+			p("dst = strconv.AppendUint(dst, %s, 10)\n", val)
+		case kindFloat64:
+			// NaN and Inf as null, as FloatSpecialNull does by default
+			p("if math.IsNaN(%s) || math.IsInf(%s, 0) {\ndst = append(dst, \"null\"...)\n} else {\n", val, val)
+			p("dst = strconv.AppendFloat(dst, %s, 'f', -1, 64)\n}\n", val)
+		case kindBool:
+			p("dst = strconv.AppendBool(dst, %s)\n", val)
+		case kindTime:
+			p("dst = append(dst, '\"')\ndst = %s.AppendFormat(dst, time.RFC3339Nano)\ndst = append(dst, '\"')\n", val)
+		default:
+			p("dst = sqljsonutil.AppendJSONBytes(dst, %s)\n", val)
+		}
+		if f.null {
+			p("}\n")
+		}
+	}
+	if len(fields) == 0 {
+		p("dst = append(dst, '{')\n")
+	}
+	p("return append(dst, '}')\n}\n\n")
+
+	p("// Write%sRows writes rows as a JSON array of objects, the same as sqljsonutil.RowsWriter.WriteResponse.\n", typeName)
+	p(`func Write%sRows(w io.Writer, rows *sql.Rows) error {
+
+	if err := sqljsonutil.CheckUnmasked(%s); err != nil {
+		return err
+	}
+
+	if rw, ok := w.(http.ResponseWriter); ok {
+		if rw.Header().Get("Content-Type") == "" {
+			rw.Header().Set("Content-Type", "application/json")
+		}
+	}
+
+	var v %s
+	args := v.ScanArgs()
+	buf := make([]byte, 0, 1024)
+
+	buf = append(buf, "[\n"...)
+	n := 0
+	for rows.Next() {
+		err := rows.Scan(args...)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			buf = append(buf, ',')
+		}
+		n++
+		buf = v.AppendJSON(buf)
+		buf = append(buf, '\n')
+		_, err = w.Write(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	buf = append(buf, "]\n"...)
+	_, err := w.Write(buf)
+	return err
+}
+`, typeName, strings.Join(colKeys, ", "), typeName)
+
+	return format.Source(buf.Bytes())
+}
+
+// goInitialisms are the words goFieldName writes in all caps.
+var goInitialisms = map[string]bool{"id": true, "url": true, "uri": true, "api": true, "json": true, "http": true,
+	"html": true, "sql": true, "ip": true, "uuid": true, "utc": true}
+
+// goFieldName returns an exported Go field name for a column, e.g. widget_id becomes WidgetID,
+// adding a number if needed so it is not already in names.
+func goFieldName(colName string, names map[string]bool) string {
+
+	words := strings.FieldsFunc(colName, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+
+	var sb strings.Builder
+	for _, w := range words {
+		if goInitialisms[strings.ToLower(w)] {
+			sb.WriteString(strings.ToUpper(w))
+			continue
+		}
+		sb.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+
+	name := sb.String()
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "C" + name
+	}
+	base := name
+	for n := 2; names[name]; n++ {
+		name = base + strconv.Itoa(n)
+	}
+	return name
+}
+
+// AppendJSONString appends s to dst as a quoted JSON string, escaped the same as RowsWriter
+// with EscapeHTML unset.  It is used by code from GenerateGo.
+func AppendJSONString(dst []byte, s string) []byte {
+	return appendJSONString(dst, s, false)
+}
+
+// appendJSONString appends s to dst as a quoted JSON string, escaped the same as encoding/json
+// including <, > and & if escapeHTML is true.
+func appendJSONString(dst []byte, s string, escapeHTML bool) []byte {
+
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && (!escapeHTML || c != '<' && c != '>' && c != '&') {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid JSON but not valid JavaScript, encoding/json escapes them too
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// AppendJSONBytes is AppendJSONString for a []byte.
+func AppendJSONBytes(dst []byte, b []byte) []byte {
+	return AppendJSONString(dst, unsafeString(b))
+}
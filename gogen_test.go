@@ -0,0 +1,186 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateGo(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := GenerateGo("widgets", "Widget", cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "WidgetID sql.Null[sql.RawBytes]") || !strings.Contains(string(src), "func WriteWidgetRows(") {
+		t.Errorf("unexpected output: %s", src)
+	}
+	t.Logf("SOURCE:\n%s", src)
+
+	for _, s := range []string{"", "plain", "quote\" back\\slash", "ctl\n\t\x01", "<html>&", "é\u2028\u2029", "bad\xffutf8"} {
+		want, _ := json.Marshal(s)
+		if got := AppendJSONString(nil, s); string(got) != strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(string(want)) {
+			t.Errorf("AppendJSONString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestAppendJSONString(t *testing.T) {
+
+	for _, s := range []string{"plain", "quote\" back\\slash", "\x00\b\f\n\r\t\x1f\x7f", "<a href=\"x\">&amp;</a>", "bad \xff utf8", "line\u2028sep\u2029", "é日\U0001F600"} {
+		for _, escapeHTML := range []bool{false, true} {
+			var sb strings.Builder
+			enc := json.NewEncoder(&sb)
+			enc.SetEscapeHTML(escapeHTML)
+			err := enc.Encode(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.TrimSuffix(sb.String(), "\n")
+			if got := string(appendJSONString(nil, s, escapeHTML)); got != want {
+				t.Errorf("appendJSONString(%q, %v) = %s, want %s", s, escapeHTML, got, want)
+			}
+		}
+	}
+}
+
+func TestGenerateGoTypes(t *testing.T) {
+
+	cols := testColumnTypes(t, []testDriverColumn{
+		{name: "id", dbType: "INT", scanType: reflect.TypeOf(int64(0))},
+		{name: "count", dbType: "INT", scanType: reflect.TypeOf(sql.NullInt64{}), nullable: true},
+		{name: "big", dbType: "BIGINT UNSIGNED", scanType: reflect.TypeOf(uint64(0))},
+		{name: "price", dbType: "DOUBLE", scanType: reflect.TypeOf(float64(0))},
+		{name: "rate", dbType: "DOUBLE", scanType: reflect.TypeOf(sql.NullFloat64{}), nullable: true},
+		{name: "ok", dbType: "BOOL", scanType: reflect.TypeOf(sql.NullBool{}), nullable: true},
+		{name: "created_at", dbType: "DATETIME", scanType: reflect.TypeOf(time.Time{})},
+		{name: "name", dbType: "VARCHAR", scanType: reflect.TypeOf(sql.NullString{}), nullable: true},
+		{name: "data", dbType: "BLOB", scanType: reflect.TypeOf(sql.RawBytes{})},
+		{name: "2nd", dbType: "VARCHAR", scanType: reflect.TypeOf("")},
+		{name: "a-b-c", dbType: "VARCHAR", scanType: reflect.TypeOf("")},
+		{name: "a_b_c", dbType: "VARCHAR", scanType: reflect.TypeOf("")},
+		{name: `say "hi"`, dbType: "VARCHAR", scanType: reflect.TypeOf("")},
+	})
+
+	src, err := GenerateGo("widgets", "Widget", cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := checkGeneratedGo(t, src)
+
+	// the fields have the Go types of the columns
+	st := pkg.Scope().Lookup("Widget").Type().Underlying().(*types.Struct)
+	var got []string
+	for i := 0; i < st.NumFields(); i++ {
+		got = append(got, st.Field(i).Name()+" "+st.Field(i).Type().String())
+	}
+	want := []string{
+		"ID int64",
+		"Count database/sql.NullInt64",
+		"Big uint64",
+		"Price float64",
+		"Rate database/sql.NullFloat64",
+		"Ok database/sql.NullBool",
+		"CreatedAt time.Time",
+		"Name database/sql.Null[database/sql.RawBytes]",
+		"Data database/sql.RawBytes",
+		"C2nd database/sql.RawBytes",
+		"ABC database/sql.RawBytes",
+		"ABC2 database/sql.RawBytes",
+		"SayHi database/sql.RawBytes",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got fields %q\nwant %q", got, want)
+	}
+	if pkg.Scope().Lookup("WriteWidgetRows") == nil {
+		t.Errorf("WriteWidgetRows is not defined")
+	}
+
+	// NaN and Inf are written as null, like FloatSpecialNull
+	for _, s := range []string{"math.IsNaN(v.Price) || math.IsInf(v.Price, 0)", "math.IsNaN(v.Rate.Float64) || math.IsInf(v.Rate.Float64, 0)"} {
+		if !strings.Contains(string(src), s) {
+			t.Errorf("no %q in:\n%s", s, src)
+		}
+	}
+
+	// and math is only imported when there is a float column
+	src, err = GenerateGo("widgets", "Widget", cols[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGeneratedGo(t, src)
+	if strings.Contains(string(src), `"math"`) {
+		t.Errorf("math imported without a float column:\n%s", src)
+	}
+}
+
+// checkGeneratedGo type checks the source from GenerateGo, which also fails for unused imports.
+func checkGeneratedGo(t *testing.T, src []byte) *types.Package {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "widget_gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	conf := types.Config{Importer: &genTestImporter{fset: fset, std: importer.ForCompiler(fset, "gc", nil)}}
+	pkg, err := conf.Check("example.com/widgets", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	return pkg
+}
+
+// genTestImporter imports the standard library with std and this package from its source.
+type genTestImporter struct {
+	fset *token.FileSet
+	std  types.Importer
+	pkg  *types.Package
+}
+
+func (im *genTestImporter) Import(path string) (*types.Package, error) {
+	if path != "github.com/d0sbit/sqljsonutil" {
+		return im.std.Import(path)
+	}
+	if im.pkg != nil {
+		return im.pkg, nil
+	}
+	bp, err := build.ImportDir(".", 0)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(im.fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: im.std}
+	im.pkg, err = conf.Check(path, im.fset, files, nil)
+	return im.pkg, err
+}
@@ -0,0 +1,266 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// HALWriter writes rows as a HAL (application/hal+json) resource with the rows embedded as a
+// collection, and each row given _links built from URL templates with its column values:
+//
+//	{"_links":{"self":{"href":"/widgets"}},"_embedded":{"widgets":[
+//	{"widget_id":"abc123","name":"First One","_links":{"self":{"href":"/widgets/abc123"}}}
+//	,{"widget_id":"def456","name":"Next One","_links":{"self":{"href":"/widgets/def456"}}}
+//	]}}
+//
+// It embeds RowsWriter, so the column and value options apply to the rows the same way.
+// GroupBy is not applied.
+type HALWriter struct {
+	RowsWriter
+
+	Rel string // the key of the rows in _embedded, e.g. "widgets"
+
+	// RowLinks are the _links of each row, by relation, as URL templates in which {column} is
+	// replaced by the path escaped value of that column, e.g. "self": "/widgets/{widget_id}".
+	RowLinks map[string]string
+
+	Links map[string]string // the _links of the collection, by relation
+
+	rowLinks []halLink
+	hrefBuf  []byte // the hrefs of the current row
+	hrefEnds []int  // the end of each href in hrefBuf
+}
+
+// halLink is a parsed RowLinks template.
+type halLink struct {
+	rel   string
+	parts []halPart
+}
+
+// halPart is a literal part of a template, or a column if col >= 0.
+type halPart struct {
+	lit string
+	col int
+}
+
+// NewHALWriter is the same as: return &HALWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Rel: rel}
+func NewHALWriter(w io.Writer, rows RowsLike, rel string) *HALWriter {
+	return &HALWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Rel: rel}
+}
+
+// Reset clears the internal state, the same as RowsWriter.Reset.
+func (hw *HALWriter) Reset(rows RowsLike) {
+	hw.RowsWriter.Reset(rows)
+	hw.rowLinks = nil
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (hw *HALWriter) WriteTo(w io.Writer) (int64, error) {
+	return hw.writeTo(w, hw.WriteResponse)
+}
+
+// WriteResponse writes the resource.  If the io.Writer in the Writer field is an
+// http.ResponseWriter, then it will check to see if the Content-Type header is empty and if so
+// will set it to "application/hal+json".
+func (hw *HALWriter) WriteResponse() error {
+
+	if ok, err := hw.withOutput(true, hw.WriteResponse); ok {
+		return err
+	}
+
+	hw.setContentType("application/hal+json")
+
+	hw.msgBuf.Reset()
+	hw.msgBuf.WriteByte('{')
+	if len(hw.Links) > 0 {
+		hw.msgBuf.WriteString(`"_links":`)
+		writeHALLinks(&hw.msgBuf, hw.Links)
+		hw.msgBuf.WriteByte(',')
+	}
+	hw.msgBuf.WriteString(`"_embedded":{`)
+	hw.msgBuf.Write(AppendJSONString(nil, hw.Rel))
+	hw.msgBuf.WriteString(":[\n")
+	open := bytes.Clone(hw.msgBuf.Bytes()) // msgBuf is used for an error record
+
+	return hw.writeEnvelope(open, hw.writeHALRows, func(error) []byte {
+		return []byte("]}}\n")
+	})
+}
+
+// writeHALRows is the WriteCommaRows loop for WriteResponse.
+func (hw *HALWriter) writeHALRows() error {
+
+	defer hw.startHeartbeat(heartbeatJSON)()
+
+	n := 0
+	for hw.nextRow() {
+		err := hw.writeHALRow()
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	if err := hw.rowsErr(); err != nil {
+		return err
+	}
+
+	// indented comma rows are not newline terminated
+	if hw.Indent != "" && n > 0 {
+		_, err := io.WriteString(hw.Writer, "\n")
+		return err
+	}
+
+	return nil
+}
+
+// writeHALRow scans the current row and writes it with its _links.
+func (hw *HALWriter) writeHALRow() error {
+
+	err := hw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	if hw.rowLinks == nil {
+		err := hw.setupRowLinks()
+		if err != nil {
+			return err
+		}
+	}
+
+	// the hrefs first, since columnText uses rowOutBuf
+	hrefs := hw.hrefBuf[:0]
+	ends := hw.hrefEnds[:0]
+	for _, l := range hw.rowLinks {
+		for _, p := range l.parts {
+			if p.col < 0 {
+				hrefs = append(hrefs, p.lit...)
+				continue
+			}
+			text, _, err := hw.columnText(p.col)
+			if err != nil {
+				return err
+			}
+			hrefs = append(hrefs, url.PathEscape(string(text))...)
+		}
+		ends = append(ends, len(hrefs))
+	}
+	hw.hrefBuf, hw.hrefEnds = hrefs, ends
+
+	hw.rowOutBuf.Reset()
+	if hw.rowCount > 1 {
+		hw.rowOutBuf.WriteByte(',')
+	}
+	hw.rowOutBuf.WriteByte('{')
+
+	err = hw.writeRowFields(hw.fieldPlan)
+	if err != nil {
+		return err
+	}
+	if hw.RowIndexField != "" {
+		hw.writeRowIndexField(int64(hw.rowCount - 1))
+	}
+	if hw.ExtraFieldsFunc != nil {
+		err = hw.writeExtraFields()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(hw.rowLinks) > 0 {
+		if b := hw.rowOutBuf.Bytes(); b[len(b)-1] != '{' {
+			hw.rowOutBuf.WriteByte(',')
+		}
+		hw.rowOutBuf.WriteString(`"_links":{`)
+		start := 0
+		for i, l := range hw.rowLinks {
+			if i > 0 {
+				hw.rowOutBuf.WriteByte(',')
+			}
+			hw.writeValue(l.rel)
+			hw.rowOutBuf.WriteString(`:{"href":`)
+			hw.writeValue(string(hrefs[start:ends[i]]))
+			hw.rowOutBuf.WriteByte('}')
+			start = ends[i]
+		}
+		hw.rowOutBuf.WriteByte('}')
+	}
+	hw.rowOutBuf.WriteString("}\n")
+
+	if hw.Indent != "" {
+		err := hw.indentRow(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return hw.writeOut(&hw.rowOutBuf)
+}
+
+// setupRowLinks parses RowLinks into rowLinks, with "self" first and the rest in order of relation.
+func (hw *HALWriter) setupRowLinks() error {
+
+	rels := make([]string, 0, len(hw.RowLinks))
+	for rel := range hw.RowLinks {
+		rels = append(rels, rel)
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		if (rels[i] == "self") != (rels[j] == "self") {
+			return rels[i] == "self"
+		}
+		return rels[i] < rels[j]
+	})
+
+	hw.rowLinks = make([]halLink, 0, len(rels))
+	for _, rel := range rels {
+		l := halLink{rel: rel}
+		tmpl := hw.RowLinks[rel]
+		for tmpl != "" {
+			before, rest, found := strings.Cut(tmpl, "{")
+			name, after, closed := strings.Cut(rest, "}")
+			if !found || !closed {
+				l.parts = append(l.parts, halPart{lit: tmpl, col: -1})
+				break
+			}
+			col := -1
+			for i, colName := range hw.colNames {
+				if colName == name {
+					col = i
+					break
+				}
+			}
+			if col < 0 {
+				return fmt.Errorf("HALWriter: link %q column %q not found in result set", rel, name)
+			}
+			l.parts = append(l.parts, halPart{lit: before, col: -1}, halPart{col: col})
+			tmpl = after
+		}
+		hw.rowLinks = append(hw.rowLinks, l)
+	}
+
+	return nil
+}
+
+// writeHALLinks writes links as a HAL _links object, in order of relation.
+func writeHALLinks(buf *bytes.Buffer, links map[string]string) {
+	rels := make([]string, 0, len(links))
+	for rel := range links {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	buf.WriteByte('{')
+	for i, rel := range rels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(AppendJSONString(nil, rel))
+		buf.WriteString(`:{"href":`)
+		buf.Write(AppendJSONString(nil, links[rel]))
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('}')
+}
@@ -0,0 +1,34 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHALWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	hw := NewHALWriter(&buf, rows, "widgets")
+	hw.RowLinks = map[string]string{"self": "/widgets/{widget_id}"}
+	hw.Links = map[string]string{"self": "/widgets"}
+	err = hw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"_links":{"self":{"href":"/widgets"}},"_embedded":{"widgets":[
+{"widget_id":"abc123","name":"First One","_links":{"self":{"href":"/widgets/abc123"}}}
+,{"widget_id":"def456","name":"Next One","_links":{"self":{"href":"/widgets/def456"}}}
+]}}
+` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
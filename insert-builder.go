@@ -0,0 +1,262 @@
+package sqljsonutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// InsertBuilder makes parameterized INSERT statements from JSON objects, the reverse of RowsWriter:
+//
+//	b := &sqljsonutil.InsertBuilder{Table: "widgets", Columns: []string{"widget_id", "name"}}
+//	query, args, err := b.Build([]byte(`{"widget_id":"abc123","name":"First One"}`))
+//	// INSERT INTO `widgets` (`widget_id`,`name`) VALUES (?,?)
+//	_, err = db.Exec(query, args...)
+//
+// Strings, booleans and null are passed as the Go equivalent, integers as int64, other numbers
+// as a json.Number with their exact text, and objects and arrays as their JSON text (e.g. for
+// a JSON column).
+type InsertBuilder struct {
+	Table   string  // table name, may be qualified e.g. "myschema.widgets"
+	Dialect Dialect // placeholder style and identifier quoting, DialectMySQL if not set
+
+	// Columns, if set, is the whitelist of columns that may be inserted and the order they
+	// are written in.  Keys of the object not in Columns are ignored.  If not set, every key
+	// of the object is used as a column in sorted order; only do this if the input is trusted.
+	Columns []string
+
+	// UpsertKeys, if set, makes the statement an upsert that updates the other columns when a row
+	// with the same values of these (unique) columns already exists: ON DUPLICATE KEY UPDATE for
+	// DialectMySQL (which uses the table's unique keys, UpsertKeys just leaves those columns out
+	// of the update) and ON CONFLICT ... DO UPDATE for DialectPostgres and DialectSQLite.
+	// The key columns must be present in the object.  Not supported for DialectSQLServer.
+	UpsertKeys []string
+}
+
+// Build returns the INSERT statement and arguments for the JSON object obj.
+func (b *InsertBuilder) Build(obj []byte) (query string, args []interface{}, err error) {
+
+	m, err := decodeJSONObject(obj)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cols, args, err := b.columnArgs(m)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(b.UpsertKeys) > 0 {
+		upsert, err := b.upsertSQL(cols)
+		if err != nil {
+			return "", nil, err
+		}
+		return b.insertSQL(cols) + upsert, args, nil
+	}
+
+	return b.insertSQL(cols), args, nil
+}
+
+// Each calls f with the INSERT statement and arguments for each object read from r, which may
+// be a JSON array of objects or a stream of objects (e.g. newline delimited JSON).
+// Objects are read one at a time so the input is not held in memory.
+// An error returned by f stops the iteration and is returned.
+func (b *InsertBuilder) Each(r io.Reader, f func(query string, args []interface{}) error) error {
+
+	br := bufio.NewReader(r)
+	dec := json.NewDecoder(br)
+
+	each := func(obj []byte) error {
+		query, args, err := b.Build(obj)
+		if err != nil {
+			return err
+		}
+		return f(query, args)
+	}
+
+	c, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if c != '[' {
+		for {
+			var obj json.RawMessage
+			err := dec.Decode(&obj)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = each(obj)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = dec.Token() // [
+	if err != nil {
+		return err
+	}
+	for dec.More() {
+		var obj json.RawMessage
+		err := dec.Decode(&obj)
+		if err != nil {
+			return err
+		}
+		err = each(obj)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // ]
+	return err
+}
+
+// columnArgs returns the columns and arguments for the object m according to Columns.
+func (b *InsertBuilder) columnArgs(m map[string]json.RawMessage) (cols []string, args []interface{}, err error) {
+
+	cols = b.Columns
+	if len(cols) == 0 {
+		cols = make([]string, 0, len(m))
+		for k := range m {
+			cols = append(cols, k)
+		}
+		sort.Strings(cols)
+	}
+
+	present := cols[:0:0]
+	for _, col := range cols {
+		v, ok := m[col]
+		if !ok {
+			continue
+		}
+		arg, err := jsonArgValue(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %q: %w", col, err)
+		}
+		present = append(present, col)
+		args = append(args, arg)
+	}
+
+	if len(present) == 0 {
+		return nil, nil, fmt.Errorf("no columns to insert")
+	}
+
+	return present, args, nil
+}
+
+// insertSQL returns the INSERT statement for cols.
+func (b *InsertBuilder) insertSQL(cols []string) string {
+
+	d := b.Dialect
+
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ")
+	sb.WriteString(d.quoteIdent(b.Table))
+	sb.WriteString(" (")
+	for i, col := range cols {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(d.quoteIdent(col))
+	}
+	sb.WriteString(") VALUES (")
+	for i := range cols {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(d.placeholder(i + 1))
+	}
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// upsertSQL returns the clause added to the INSERT statement for UpsertKeys.
+func (b *InsertBuilder) upsertSQL(cols []string) (string, error) {
+
+	d := b.Dialect
+
+	for _, key := range b.UpsertKeys {
+		if !containsString(cols, key) {
+			return "", fmt.Errorf("missing upsert key %q", key)
+		}
+	}
+
+	var sb strings.Builder
+	switch d {
+
+	case DialectMySQL:
+		sb.WriteString(" ON DUPLICATE KEY UPDATE ")
+		n := 0
+		for _, col := range cols {
+			if containsString(b.UpsertKeys, col) {
+				continue
+			}
+			if n > 0 {
+				sb.WriteByte(',')
+			}
+			n++
+			fmt.Fprintf(&sb, "%s=VALUES(%s)", d.quoteIdent(col), d.quoteIdent(col))
+		}
+		if n == 0 { // nothing to update, but the clause needs an assignment
+			col := d.quoteIdent(b.UpsertKeys[0])
+			sb.WriteString(col + "=" + col)
+		}
+
+	case DialectPostgres, DialectSQLite:
+		sb.WriteString(" ON CONFLICT (")
+		for i, key := range b.UpsertKeys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(d.quoteIdent(key))
+		}
+		sb.WriteString(") DO ")
+		n := 0
+		for _, col := range cols {
+			if containsString(b.UpsertKeys, col) {
+				continue
+			}
+			if n == 0 {
+				sb.WriteString("UPDATE SET ")
+			} else {
+				sb.WriteByte(',')
+			}
+			n++
+			fmt.Fprintf(&sb, "%s=excluded.%s", d.quoteIdent(col), d.quoteIdent(col))
+		}
+		if n == 0 {
+			sb.WriteString("NOTHING")
+		}
+
+	default:
+		return "", fmt.Errorf("upserts are not supported for this Dialect")
+	}
+
+	return sb.String(), nil
+}
+
+// peekNonSpace skips JSON whitespace in br and returns the next byte without reading it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return c, br.UnreadByte()
+	}
+}
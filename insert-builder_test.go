@@ -0,0 +1,172 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInsertBuilder(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	b := &InsertBuilder{Table: "widgets", Columns: []string{"widget_id", "name"}}
+
+	query, args, err := b.Build([]byte(`{"name":"Third One","widget_id":"ghi789","unknown":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "INSERT INTO `widgets` (`widget_id`,`name`) VALUES (?,?)" || len(args) != 2 {
+		t.Errorf("unexpected query: %s %v", query, args)
+	}
+	_, err = db.Exec(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = b.Each(strings.NewReader(`[{"widget_id":"jkl012","name":"Fourth One"},{"widget_id":"mno345"}]`), func(query string, args []interface{}) error {
+		n++
+		_, err := db.Exec(query, args...)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM widgets").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || count != 5 {
+		t.Errorf("unexpected counts: %d %d", n, count)
+	}
+
+	pb := &InsertBuilder{Table: "widgets", Dialect: DialectPostgres}
+	query, _, err = pb.Build([]byte(`{"widget_id":"abc123","name":"First One"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != `INSERT INTO "widgets" ("name","widget_id") VALUES ($1,$2)` {
+		t.Errorf("unexpected query: %s", query)
+	}
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS widgets_upsert (widget_id VARCHAR(64) PRIMARY KEY, name VARCHAR(255))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("DELETE FROM widgets_upsert")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ub := &InsertBuilder{Table: "widgets_upsert", Columns: []string{"widget_id", "name"}, UpsertKeys: []string{"widget_id"}}
+	for _, obj := range []string{`{"widget_id":"abc123","name":"First One"}`, `{"widget_id":"abc123","name":"Renamed"}`} {
+		query, args, err := ub.Build([]byte(obj))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var name string
+	err = db.QueryRow("SELECT name FROM widgets_upsert WHERE widget_id='abc123'").Scan(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Renamed" {
+		t.Errorf("unexpected name: %q", name)
+	}
+}
+
+func TestInsertBuilderUpsert(t *testing.T) {
+
+	const obj = `{"org_id":7,"widget_id":"abc123","name":"First One","size":2}`
+	cols := []string{"org_id", "widget_id", "name", "size"}
+
+	for _, tc := range []struct {
+		d    Dialect
+		keys []string
+		cols []string
+		want string // the query or the error
+	}{
+		{DialectMySQL, []string{"widget_id"}, cols,
+			"INSERT INTO `s`.`widgets` (`org_id`,`widget_id`,`name`,`size`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `org_id`=VALUES(`org_id`),`name`=VALUES(`name`),`size`=VALUES(`size`)"},
+		{DialectPostgres, []string{"org_id", "widget_id"}, cols,
+			`INSERT INTO "s"."widgets" ("org_id","widget_id","name","size") VALUES ($1,$2,$3,$4) ON CONFLICT ("org_id","widget_id") DO UPDATE SET "name"=excluded."name","size"=excluded."size"`},
+		{DialectSQLite, []string{"widget_id"}, cols,
+			`INSERT INTO "s"."widgets" ("org_id","widget_id","name","size") VALUES (?,?,?,?) ON CONFLICT ("widget_id") DO UPDATE SET "org_id"=excluded."org_id","name"=excluded."name","size"=excluded."size"`},
+
+		// only key columns, so there is nothing to update
+		{DialectMySQL, []string{"widget_id"}, []string{"widget_id"},
+			"INSERT INTO `s`.`widgets` (`widget_id`) VALUES (?) ON DUPLICATE KEY UPDATE `widget_id`=`widget_id`"},
+		{DialectPostgres, []string{"widget_id"}, []string{"widget_id"},
+			`INSERT INTO "s"."widgets" ("widget_id") VALUES ($1) ON CONFLICT ("widget_id") DO NOTHING`},
+		{DialectSQLite, []string{"widget_id"}, []string{"widget_id"},
+			`INSERT INTO "s"."widgets" ("widget_id") VALUES (?) ON CONFLICT ("widget_id") DO NOTHING`},
+
+		// errors
+		{DialectPostgres, []string{"missing"}, cols, `missing upsert key "missing"`},
+		{DialectPostgres, []string{"widget_id"}, []string{"org_id", "name"}, `missing upsert key "widget_id"`},
+		{DialectSQLServer, []string{"widget_id"}, cols, "upserts are not supported for this Dialect"},
+	} {
+		b := &InsertBuilder{Table: "s.widgets", Dialect: tc.d, Columns: tc.cols, UpsertKeys: tc.keys}
+		query, args, err := b.Build([]byte(obj))
+		if err != nil {
+			query = err.Error()
+		} else if len(args) != len(tc.cols) {
+			t.Errorf("%d %v: got %d args", tc.d, tc.keys, len(args))
+		}
+		if query != tc.want {
+			t.Errorf("%d %v: got %s\nwant %s", tc.d, tc.keys, query, tc.want)
+		}
+	}
+}
+
+func TestInsertBuilderValues(t *testing.T) {
+
+	b := &InsertBuilder{Table: "t"}
+	_, args, err := b.Build([]byte(`{"a":12345678901234567890,"b":1.10,"c":-3,"d":1e2,"e":"x","f":null,"g":[1]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// numbers other than int64 keep their exact text
+	want := []interface{}{json.Number("12345678901234567890"), json.Number("1.10"), int64(-3), json.Number("1e2"), "x", nil, "[1]"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("unexpected args: %#v", args)
+	}
+
+	_, _, err = b.Build([]byte(`{"a":1.2.3}`))
+	if err == nil {
+		t.Errorf("expected an error for an invalid number")
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+
+	tests := []struct {
+		d          Dialect
+		name, want string
+	}{
+		{DialectMySQL, "widgets", "`widgets`"},
+		{DialectMySQL, "app.widgets", "`app`.`widgets`"},
+		{DialectMySQL, "a`b", "`a``b`"},
+		{DialectMySQL, "`my.app`.widgets", "`my.app`.`widgets`"},
+		{DialectMySQL, "app.`wid.gets`", "`app`.`wid.gets`"},
+		{DialectPostgres, `"my.schema".widgets`, `"my.schema"."widgets"`},
+		{DialectPostgres, `"a""b.c"`, `"a""b.c"`},
+		{DialectPostgres, `"unterminated.x`, `"""unterminated"."x"`},
+		{DialectSQLServer, "[dbo.x].[wid]]gets]", "[dbo.x].[wid]]gets]"},
+		{DialectSQLServer, "dbo.a]b", "[dbo].[a]]b]"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.quoteIdent(tt.name); got != tt.want {
+			t.Errorf("quoteIdent(%q) for dialect %d: got %s, want %s", tt.name, tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,616 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jmesKind is the kind of a jmesNode.
+type jmesKind int
+
+const (
+	jmesCurrent   jmesKind = iota // @
+	jmesField                     // name
+	jmesSub                       // left.right
+	jmesIndex                     // left[index]
+	jmesProject                   // left[*] then right for each element
+	jmesFlatten                   // left[] then right for each element
+	jmesValues                    // left.* then right for each value
+	jmesMultiList                 // [a, b]
+	jmesMultiHash                 // {k: a, l: b}
+	jmesLiteral                   // `json` or 'raw string'
+	jmesPipe                      // left | right
+)
+
+// jmesNode is a node of a compiled JMESPath expression.
+type jmesNode struct {
+	kind     jmesKind
+	name     string      // jmesField
+	index    int         // jmesIndex
+	left     *jmesNode   // jmesSub, jmesIndex, projections, jmesPipe
+	right    *jmesNode   // jmesSub, projections, jmesPipe
+	children []*jmesNode // jmesMultiList, jmesMultiHash
+	keys     []string    // jmesMultiHash
+	value    interface{} // jmesLiteral
+}
+
+// jmesObject is a JSON object that keeps the order of its keys.
+type jmesObject struct {
+	keys []string
+	vals map[string]interface{}
+}
+
+// compileJMESPath parses a JMESPath expression.  The supported subset is identifiers (plain or
+// "quoted"), sub-expressions (a.b), indexes (a[0], a[-1]), list, flatten and object projections
+// (a[*].b, a[].b, a.*.b), multiselect lists ([a, b]) and hashes ({x: a, y: b.c}), literals
+// (`json` and 'raw'), the current node (@) and pipes (a | b).  Filters, slices, comparisons and
+// functions are not supported.
+func compileJMESPath(expr string) (*jmesNode, error) {
+	toks, err := lexJMESPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &jmesParser{toks: toks}
+	n, err := p.expression(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != jtEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+// jmesTokKind is the kind of a jmesToken.
+type jmesTokKind int
+
+const (
+	jtEOF jmesTokKind = iota
+	jtIdent
+	jtNumber
+	jtLiteral
+	jtDot
+	jtStar
+	jtLBracket
+	jtRBracket
+	jtFlatten // []
+	jtLBrace
+	jtRBrace
+	jtComma
+	jtColon
+	jtPipe
+	jtCurrent
+)
+
+type jmesToken struct {
+	kind  jmesTokKind
+	text  string
+	pos   int
+	value interface{} // jtLiteral
+}
+
+// lexJMESPath splits expr into tokens.
+func lexJMESPath(expr string) ([]jmesToken, error) {
+
+	var toks []jmesToken
+	simple := map[byte]jmesTokKind{'.': jtDot, '*': jtStar, ']': jtRBracket, '{': jtLBrace, '}': jtRBrace,
+		',': jtComma, ':': jtColon, '@': jtCurrent}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case simple[c] != 0:
+			toks = append(toks, jmesToken{kind: simple[c], text: string(c), pos: i})
+			i++
+
+		case c == '[':
+			if i+1 < len(expr) && expr[i+1] == ']' {
+				toks = append(toks, jmesToken{kind: jtFlatten, text: "[]", pos: i})
+				i += 2
+				continue
+			}
+			if i+1 < len(expr) && expr[i+1] == '?' {
+				return nil, fmt.Errorf("filter expressions are not supported at position %d", i)
+			}
+			toks = append(toks, jmesToken{kind: jtLBracket, text: "[", pos: i})
+			i++
+
+		case c == '|':
+			if i+1 < len(expr) && expr[i+1] == '|' {
+				return nil, fmt.Errorf("|| is not supported at position %d", i)
+			}
+			toks = append(toks, jmesToken{kind: jtPipe, text: "|", pos: i})
+			i++
+
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			for i++; i < len(expr); i++ {
+				c := expr[i]
+				if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+					break
+				}
+			}
+			toks = append(toks, jmesToken{kind: jtIdent, text: expr[start:i], pos: start})
+
+		case c == '-' || c >= '0' && c <= '9':
+			for i++; i < len(expr) && expr[i] >= '0' && expr[i] <= '9'; i++ {
+			}
+			toks = append(toks, jmesToken{kind: jtNumber, text: expr[start:i], pos: start})
+
+		case c == '"':
+			// a quoted identifier is a JSON string
+			end := start + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated quoted identifier at position %d", start)
+			}
+			var name string
+			err := json.Unmarshal([]byte(expr[start:end+1]), &name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted identifier at position %d: %w", start, err)
+			}
+			toks = append(toks, jmesToken{kind: jtIdent, text: name, pos: start})
+			i = end + 1
+
+		case c == '`' || c == '\'':
+			var sb strings.Builder
+			end := start + 1
+			for ; end < len(expr) && expr[end] != c; end++ {
+				if expr[end] == '\\' && end+1 < len(expr) && expr[end+1] == c {
+					end++
+				}
+				sb.WriteByte(expr[end])
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated literal at position %d", start)
+			}
+			var v interface{} = sb.String()
+			if c == '`' {
+				var err error
+				v, err = decodeJMESValue(json.NewDecoder(strings.NewReader(sb.String())))
+				if err != nil {
+					return nil, fmt.Errorf("invalid literal at position %d: %w", start, err)
+				}
+			}
+			toks = append(toks, jmesToken{kind: jtLiteral, text: expr[start : end+1], pos: start, value: v})
+			i = end + 1
+
+		default:
+			return nil, fmt.Errorf("unsupported %q at position %d", c, i)
+		}
+	}
+
+	return append(toks, jmesToken{kind: jtEOF, pos: len(expr)}), nil
+}
+
+// binding powers of the tokens, as in the JMESPath reference implementation
+var jmesBindingPower = map[jmesTokKind]int{jtPipe: 1, jtFlatten: 9, jtStar: 20, jtDot: 40, jtLBrace: 50, jtLBracket: 55}
+
+// jmesParser is a Pratt parser for JMESPath.
+type jmesParser struct {
+	toks []jmesToken
+	pos  int
+}
+
+func (p *jmesParser) peek() jmesToken { return p.toks[p.pos] }
+
+func (p *jmesParser) next() jmesToken {
+	t := p.toks[p.pos]
+	if t.kind != jtEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *jmesParser) expect(kind jmesTokKind) (jmesToken, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.unexpected(t)
+	}
+	return t, nil
+}
+
+func (p *jmesParser) unexpected(t jmesToken) error {
+	if t.kind == jtEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *jmesParser) expression(bp int) (*jmesNode, error) {
+	left, err := p.nud(p.next())
+	if err != nil {
+		return nil, err
+	}
+	for bp < jmesBindingPower[p.peek().kind] {
+		left, err = p.led(p.next(), left)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+// nud parses an expression starting with t.
+func (p *jmesParser) nud(t jmesToken) (*jmesNode, error) {
+
+	current := &jmesNode{kind: jmesCurrent}
+
+	switch t.kind {
+	case jtIdent:
+		return &jmesNode{kind: jmesField, name: t.text}, nil
+	case jtCurrent:
+		return current, nil
+	case jtLiteral:
+		return &jmesNode{kind: jmesLiteral, value: t.value}, nil
+	case jtStar:
+		right, err := p.projectionRHS(jmesBindingPower[jtStar])
+		return &jmesNode{kind: jmesValues, left: current, right: right}, err
+	case jtFlatten:
+		right, err := p.projectionRHS(jmesBindingPower[jtFlatten])
+		return &jmesNode{kind: jmesFlatten, left: current, right: right}, err
+	case jtLBracket:
+		switch p.peek().kind {
+		case jtNumber, jtColon:
+			return p.index(current)
+		case jtStar:
+			if p.toks[p.pos+1].kind == jtRBracket {
+				p.pos += 2
+				right, err := p.projectionRHS(jmesBindingPower[jtStar])
+				return &jmesNode{kind: jmesProject, left: current, right: right}, err
+			}
+		}
+		return p.multiList()
+	case jtLBrace:
+		return p.multiHash()
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// led parses the rest of an expression starting with left followed by t.
+func (p *jmesParser) led(t jmesToken, left *jmesNode) (*jmesNode, error) {
+
+	switch t.kind {
+	case jtDot:
+		if p.peek().kind == jtStar {
+			p.next()
+			right, err := p.projectionRHS(jmesBindingPower[jtStar])
+			return &jmesNode{kind: jmesValues, left: left, right: right}, err
+		}
+		right, err := p.dotRHS(jmesBindingPower[jtDot])
+		return &jmesNode{kind: jmesSub, left: left, right: right}, err
+	case jtFlatten:
+		right, err := p.projectionRHS(jmesBindingPower[jtFlatten])
+		return &jmesNode{kind: jmesFlatten, left: left, right: right}, err
+	case jtLBracket:
+		switch p.peek().kind {
+		case jtNumber, jtColon:
+			return p.index(left)
+		case jtStar:
+			p.next()
+			if _, err := p.expect(jtRBracket); err != nil {
+				return nil, err
+			}
+			right, err := p.projectionRHS(jmesBindingPower[jtStar])
+			return &jmesNode{kind: jmesProject, left: left, right: right}, err
+		}
+		return nil, p.unexpected(p.peek())
+	case jtPipe:
+		right, err := p.expression(jmesBindingPower[jtPipe])
+		return &jmesNode{kind: jmesPipe, left: left, right: right}, err
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// index parses the rest of [n] after the [.
+func (p *jmesParser) index(left *jmesNode) (*jmesNode, error) {
+	t := p.next()
+	if t.kind == jtColon || p.peek().kind == jtColon {
+		return nil, fmt.Errorf("slices are not supported at position %d", t.pos)
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index %q at position %d", t.text, t.pos)
+	}
+	if _, err := p.expect(jtRBracket); err != nil {
+		return nil, err
+	}
+	return &jmesNode{kind: jmesIndex, left: left, index: n}, nil
+}
+
+// projectionRHS parses what is applied to each element of a projection.
+func (p *jmesParser) projectionRHS(bp int) (*jmesNode, error) {
+	switch t := p.peek(); {
+	case jmesBindingPower[t.kind] < 10: // e.g. the end or a pipe stops the projection
+		return &jmesNode{kind: jmesCurrent}, nil
+	case t.kind == jtLBracket || t.kind == jtFlatten:
+		return p.expression(bp)
+	case t.kind == jtDot:
+		p.next()
+		return p.dotRHS(bp)
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// dotRHS parses what follows a dot.
+func (p *jmesParser) dotRHS(bp int) (*jmesNode, error) {
+	switch t := p.peek(); t.kind {
+	case jtIdent, jtLBrace:
+		return p.expression(bp)
+	case jtLBracket:
+		p.next()
+		return p.multiList()
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// multiList parses the rest of [a, b] after the [.
+func (p *jmesParser) multiList() (*jmesNode, error) {
+	n := &jmesNode{kind: jmesMultiList}
+	for {
+		child, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, child)
+		t := p.next()
+		if t.kind == jtRBracket {
+			return n, nil
+		}
+		if t.kind != jtComma {
+			return nil, p.unexpected(t)
+		}
+	}
+}
+
+// multiHash parses the rest of {k: a, l: b} after the {.
+func (p *jmesParser) multiHash() (*jmesNode, error) {
+	n := &jmesNode{kind: jmesMultiHash}
+	for {
+		key, err := p.expect(jtIdent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(jtColon); err != nil {
+			return nil, err
+		}
+		child, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key.text)
+		n.children = append(n.children, child)
+		t := p.next()
+		if t.kind == jtRBrace {
+			return n, nil
+		}
+		if t.kind != jtComma {
+			return nil, p.unexpected(t)
+		}
+	}
+}
+
+// eval returns the result of n applied to v.
+func (n *jmesNode) eval(v interface{}) interface{} {
+
+	switch n.kind {
+
+	case jmesCurrent:
+		return v
+
+	case jmesField:
+		if obj, ok := v.(*jmesObject); ok {
+			return obj.vals[n.name]
+		}
+		return nil
+
+	case jmesSub:
+		l := n.left.eval(v)
+		if l == nil {
+			return nil
+		}
+		return n.right.eval(l)
+
+	case jmesIndex:
+		list, ok := n.left.eval(v).([]interface{})
+		if !ok {
+			return nil
+		}
+		i := n.index
+		if i < 0 {
+			i += len(list)
+		}
+		if i < 0 || i >= len(list) {
+			return nil
+		}
+		return list[i]
+
+	case jmesProject, jmesFlatten, jmesValues:
+		var elems []interface{}
+		switch l := n.left.eval(v).(type) {
+		case []interface{}:
+			if n.kind == jmesValues {
+				return nil
+			}
+			elems = l
+			if n.kind == jmesFlatten {
+				elems = nil
+				for _, e := range l {
+					if sub, ok := e.([]interface{}); ok {
+						elems = append(elems, sub...)
+					} else {
+						elems = append(elems, e)
+					}
+				}
+			}
+		case *jmesObject:
+			if n.kind != jmesValues {
+				return nil
+			}
+			for _, k := range l.keys {
+				elems = append(elems, l.vals[k])
+			}
+		default:
+			return nil
+		}
+		out := make([]interface{}, 0, len(elems))
+		for _, e := range elems {
+			if r := n.right.eval(e); r != nil {
+				out = append(out, r)
+			}
+		}
+		return out
+
+	case jmesMultiList:
+		if v == nil {
+			return nil
+		}
+		out := make([]interface{}, len(n.children))
+		for i, c := range n.children {
+			out[i] = c.eval(v)
+		}
+		return out
+
+	case jmesMultiHash:
+		if v == nil {
+			return nil
+		}
+		obj := &jmesObject{vals: make(map[string]interface{}, len(n.keys))}
+		for i, c := range n.children {
+			if _, dup := obj.vals[n.keys[i]]; !dup {
+				obj.keys = append(obj.keys, n.keys[i])
+			}
+			obj.vals[n.keys[i]] = c.eval(v)
+		}
+		return obj
+
+	case jmesLiteral:
+		return n.value
+
+	case jmesPipe:
+		return n.right.eval(n.left.eval(v))
+	}
+
+	return nil
+}
+
+// decodeJMESValue decodes the next JSON value from dec, with objects as *jmesObject and
+// numbers as json.Number so they are written back unchanged.
+func decodeJMESValue(dec *json.Decoder) (interface{}, error) {
+
+	dec.UseNumber()
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			list := []interface{}{}
+			for dec.More() {
+				v, err := decodeJMESValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			_, err := dec.Token()
+			return list, err
+		case '{':
+			obj := &jmesObject{vals: make(map[string]interface{})}
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				k := kt.(string)
+				v, err := decodeJMESValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				if _, dup := obj.vals[k]; !dup {
+					obj.keys = append(obj.keys, k)
+				}
+				obj.vals[k] = v
+			}
+			_, err := dec.Token()
+			return obj, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+	}
+
+	return t, nil
+}
+
+// appendJMESValue appends v as JSON to buf.
+func appendJMESValue(buf *bytes.Buffer, v interface{}, escapeHTML bool) error {
+
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		buf.WriteString(v.String())
+	case string:
+		return appendJMESString(buf, v, escapeHTML)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := appendJMESValue(buf, e, escapeHTML); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *jmesObject:
+		buf.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := appendJMESString(buf, k, escapeHTML); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := appendJMESValue(buf, v.vals[k], escapeHTML); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected value type %T", v)
+	}
+	return nil
+}
+
+func appendJMESString(buf *bytes.Buffer, s string, escapeHTML bool) error {
+	if !escapeHTML {
+		buf.Write(AppendJSONString(buf.AvailableBuffer(), s))
+		return nil
+	}
+	enc := json.NewEncoder(buf)
+	err := enc.Encode(s)
+	if err == nil {
+		buf.Truncate(buf.Len() - 1) // Encode adds a newline
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJMESPath(t *testing.T) {
+
+	const doc = `{"a":{"b":{"c":1}},"list":[{"n":1,"tags":["x","y"]},{"n":2,"tags":["z"]},{"m":3}],` +
+		`"nested":[[1,2],[3,[4]],5],"obj":{"x":{"v":1},"y":{"v":2},"z":{}},"big":12345678901234567890,` +
+		`"quoted key":"q","s":"<&>"}`
+
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		// identifiers and sub-expressions
+		{"a", `{"b":{"c":1}}`},
+		{"a.b.c", `1`},
+		{`"quoted key"`, `"q"`},
+		{"a.missing.c", `null`},
+		{"missing", `null`},
+		{"big", `12345678901234567890`},
+		{"@", doc},
+
+		// indexes
+		{"list[0].n", `1`},
+		{"list[-1]", `{"m":3}`},
+		{"list[5]", `null`},
+		{"a[0]", `null`},
+
+		// projections, which drop null results
+		{"list[*].n", `[1,2]`},
+		{"list[*].tags[0]", `["x","z"]`},
+		{"list[].tags[]", `["x","y","z"]`},
+		{"nested[]", `[1,2,3,[4],5]`},
+		{"nested[][]", `[1,2,3,4,5]`},
+		{"obj.*.v", `[1,2]`},
+		{"obj.*", `[{"v":1},{"v":2},{}]`},
+		{"list.*", `null`},
+		{"obj[*]", `null`},
+		{"missing[*].n", `null`},
+
+		// multiselect lists and hashes
+		{"[a.b.c, list[0].n]", `[1,1]`},
+		{"{first: list[0].n, last: list[-1].m, none: missing}", `{"first":1,"last":3,"none":null}`},
+		{"list[*].{n: n, t: tags[0]}", `[{"n":1,"t":"x"},{"n":2,"t":"z"},{"n":null,"t":null}]`},
+		{"missing.[a]", `null`},
+
+		// literals
+		{"`[1, {\"x\": true}]`", `[1,{"x":true}]`},
+		{"'raw \\' string'", `"raw ' string"`},
+		{"{k: `\"v\"`, n: `null`}", `{"k":"v","n":null}`},
+
+		// pipes stop projections
+		{"list[*].tags | [0]", `["x","y"]`},
+		{"list[*].tags[0] | [1]", `"z"`},
+		{"a | b | c", `1`},
+
+		// strings are written as RowsWriter writes them, without HTML escaping
+		{"s", `"<&>"`},
+	} {
+		got, err := evalJMESPathTest(tc.expr, doc)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestJMESPathInvalid(t *testing.T) {
+
+	for _, tc := range []struct {
+		expr string
+		want string // part of the error
+	}{
+		// filters, slices, comparisons and functions are not supported
+		{"list[?n > `1`]", "filter expressions are not supported"},
+		{"list[0:2]", "slices are not supported"},
+		{"list[::2]", "slices are not supported"},
+		{"[:1]", "slices are not supported"},
+		{"a == b", "unsupported '='"},
+		{"length(list)", "unsupported '('"},
+		{"sort_by(list, &n)", "unsupported '('"},
+		{"a || b", "|| is not supported"},
+		{"!a", "unsupported '!'"},
+
+		// syntax errors
+		{"", "unexpected"},
+		{"a.", "unexpected"},
+		{"a..b", "unexpected"},
+		{"[a, b", "unexpected"},
+		{"{a: b", "unexpected"},
+		{"{a b}", "unexpected"},
+		{"a[0", "unexpected"},
+		{`"unterminated`, "unterminated"},
+		{"`[1, 2`", "literal"},
+		{"'raw", "unterminated"},
+		{"a b", "unexpected"},
+	} {
+		_, err := compileJMESPath(tc.expr)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected an error containing %q, got %v", tc.expr, tc.want, err)
+		}
+	}
+}
+
+// evalJMESPathTest evaluates expr on the JSON doc and returns the result as JSON.
+func evalJMESPathTest(expr, doc string) (string, error) {
+	n, err := compileJMESPath(expr)
+	if err != nil {
+		return "", err
+	}
+	v, err := decodeJMESValue(json.NewDecoder(strings.NewReader(doc)))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = appendJMESValue(&buf, n.eval(v), false)
+	return buf.String(), err
+}
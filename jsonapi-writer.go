@@ -0,0 +1,221 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// JSONAPIWriter writes rows as a JSON:API document, with each row as a resource object whose
+// attributes are the columns other than IDColumn:
+//
+//	{"data":[
+//	{"type":"widgets","id":"abc123","attributes":{"name":"First One"}}
+//	,{"type":"widgets","id":"def456","attributes":{"name":"Next One"}}
+//	],"links":{"self":"/widgets"},"meta":{"total":2}}
+//
+// It embeds RowsWriter, so the column and value options apply to the attributes the same way,
+// including RowIndexField and ExtraFieldsFunc.  GroupBy is not applied.
+type JSONAPIWriter struct {
+	RowsWriter
+
+	Type     string // the resource type, e.g. "widgets"
+	IDColumn string // the column written as the resource id (as a string), "id" if empty
+
+	// ResourceLink, if not empty, is written as the "self" link of each resource, with {id}
+	// replaced by the path escaped id, e.g. "/widgets/{id}".
+	ResourceLink string
+
+	Links map[string]string      // top level links, e.g. "self" or "next", written if not empty
+	Meta  map[string]interface{} // top level meta, marshaled with encoding/json, written if not empty
+
+	idCol     int
+	attrPlan  []fieldOp
+	planReady bool
+}
+
+// NewJSONAPIWriter is the same as: return &JSONAPIWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Type: typ}
+func NewJSONAPIWriter(w io.Writer, rows RowsLike, typ string) *JSONAPIWriter {
+	return &JSONAPIWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Type: typ}
+}
+
+// Reset clears the internal state, the same as RowsWriter.Reset.
+func (jw *JSONAPIWriter) Reset(rows RowsLike) {
+	jw.RowsWriter.Reset(rows)
+	jw.attrPlan = jw.attrPlan[:0]
+	jw.planReady = false
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (jw *JSONAPIWriter) WriteTo(w io.Writer) (int64, error) {
+	return jw.writeTo(w, jw.WriteResponse)
+}
+
+// WriteResponse writes the document.  If the io.Writer in the Writer field is an
+// http.ResponseWriter, then it will check to see if the Content-Type header is empty and if so
+// will set it to "application/vnd.api+json".
+func (jw *JSONAPIWriter) WriteResponse() error {
+
+	if ok, err := jw.withOutput(true, jw.WriteResponse); ok {
+		return err
+	}
+
+	// the closing is made first, so an error marshaling Meta is returned before anything is written
+	closing := []byte{']'}
+	if len(jw.Links) > 0 {
+		keys := make([]string, 0, len(jw.Links))
+		for k := range jw.Links {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		closing = append(closing, `,"links":{`...)
+		for i, k := range keys {
+			if i > 0 {
+				closing = append(closing, ',')
+			}
+			closing = AppendJSONString(closing, k)
+			closing = append(closing, ':')
+			closing = AppendJSONString(closing, jw.Links[k])
+		}
+		closing = append(closing, '}')
+	}
+	if len(jw.Meta) > 0 {
+		b, err := json.Marshal(jw.Meta)
+		if err != nil {
+			return err
+		}
+		closing = append(closing, `,"meta":`...)
+		closing = append(closing, b...)
+	}
+	closing = append(closing, "}\n"...)
+
+	jw.setContentType("application/vnd.api+json")
+
+	return jw.writeEnvelope([]byte("{\"data\":[\n"), jw.writeResources, func(error) []byte {
+		return closing
+	})
+}
+
+// writeResources is the WriteCommaRows loop for WriteResponse.
+func (jw *JSONAPIWriter) writeResources() error {
+
+	defer jw.startHeartbeat(heartbeatJSON)()
+
+	n := 0
+	for jw.nextRow() {
+		err := jw.writeResource()
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	if err := jw.rowsErr(); err != nil {
+		return err
+	}
+
+	// indented comma rows are not newline terminated
+	if jw.Indent != "" && n > 0 {
+		_, err := io.WriteString(jw.Writer, "\n")
+		return err
+	}
+
+	return nil
+}
+
+// writeResource scans the current row and writes it as a resource object.
+func (jw *JSONAPIWriter) writeResource() error {
+
+	err := jw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	if !jw.planReady {
+		err := jw.setupAttrPlan()
+		if err != nil {
+			return err
+		}
+	}
+
+	id, null, err := jw.columnText(jw.idCol)
+	if err != nil {
+		return err
+	}
+	if null {
+		return fmt.Errorf("JSONAPIWriter: null value in id column %q", jw.colNames[jw.idCol])
+	}
+	idStr := string(id) // columnText uses rowOutBuf
+
+	jw.rowOutBuf.Reset()
+	if jw.rowCount > 1 {
+		jw.rowOutBuf.WriteByte(',')
+	}
+	jw.rowOutBuf.WriteString(`{"type":`)
+	jw.writeValue(jw.Type)
+	jw.rowOutBuf.WriteString(`,"id":`)
+	jw.writeValue(idStr)
+	jw.rowOutBuf.WriteString(`,"attributes":{`)
+
+	err = jw.writeRowFields(jw.attrPlan)
+	if err != nil {
+		return err
+	}
+	if jw.RowIndexField != "" {
+		jw.writeRowIndexField(int64(jw.rowCount - 1))
+	}
+	if jw.ExtraFieldsFunc != nil {
+		err = jw.writeExtraFields()
+		if err != nil {
+			return err
+		}
+	}
+	jw.rowOutBuf.WriteByte('}')
+
+	if jw.ResourceLink != "" {
+		jw.rowOutBuf.WriteString(`,"links":{"self":`)
+		jw.writeValue(strings.ReplaceAll(jw.ResourceLink, "{id}", url.PathEscape(idStr)))
+		jw.rowOutBuf.WriteByte('}')
+	}
+	jw.rowOutBuf.WriteString("}\n")
+
+	if jw.Indent != "" {
+		err := jw.indentRow(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return jw.writeOut(&jw.rowOutBuf)
+}
+
+// setupAttrPlan finds IDColumn and sets attrPlan to write the other columns.
+func (jw *JSONAPIWriter) setupAttrPlan() error {
+
+	idColumn := jw.IDColumn
+	if idColumn == "" {
+		idColumn = "id"
+	}
+	jw.idCol = -1
+	for i, name := range jw.colNames {
+		if name == idColumn {
+			jw.idCol = i
+			break
+		}
+	}
+	if jw.idCol < 0 {
+		return fmt.Errorf("JSONAPIWriter: id column %q not found in result set", idColumn)
+	}
+
+	var err error
+	jw.attrPlan, err = jw.buildFieldPlan(jw.attrPlan[:0], func(i int) (string, bool) {
+		return jw.colKeys[i], i != jw.idCol && jw.childIndex(i) < 0
+	})
+	if err != nil {
+		return err
+	}
+	jw.planReady = true
+	return nil
+}
@@ -0,0 +1,79 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONAPIWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	jw := NewJSONAPIWriter(&buf, rows, "widgets")
+	jw.IDColumn = "widget_id"
+	jw.ResourceLink = "/widgets/{id}"
+	jw.Links = map[string]string{"self": "/widgets"}
+	jw.Meta = map[string]interface{}{"total": 2}
+	err = jw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"data":[
+{"type":"widgets","id":"abc123","attributes":{"name":"First One"},"links":{"self":"/widgets/abc123"}}
+,{"type":"widgets","id":"def456","attributes":{"name":"Next One"},"links":{"self":"/widgets/def456"}}
+],"links":{"self":"/widgets"},"meta":{"total":2}}
+` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestJSONAPIWriterMeta(t *testing.T) {
+
+	newRows := func() *memRows {
+		return &memRows{
+			cols: []memColumn{
+				{"id", "VARCHAR", reflect.TypeOf("")},
+				{"name", "VARCHAR", reflect.TypeOf("")},
+			},
+			rows: [][]interface{}{{"a1", "First"}},
+		}
+	}
+
+	var buf bytes.Buffer
+	jw := NewJSONAPIWriter(&buf, newRows(), "widgets")
+	jw.Links = map[string]string{"self": "/widgets", "next": "/widgets?page=2"}
+	jw.Meta = map[string]interface{}{"total": 1}
+	err := jw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"data":[
+{"type":"widgets","id":"a1","attributes":{"name":"First"}}
+],"links":{"next":"/widgets?page=2","self":"/widgets"},"meta":{"total":1}}
+` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// Meta that can't be marshaled is an error before anything is written
+	w := httptest.NewRecorder()
+	jw = NewJSONAPIWriter(w, newRows(), "widgets")
+	jw.Meta = map[string]interface{}{"f": func() {}}
+	err = jw.WriteResponse()
+	if err == nil || !strings.Contains(err.Error(), "unsupported type") {
+		t.Errorf("expected a marshal error, got %v", err)
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Errorf("unexpected output: %q %v", w.Body.String(), w.Header())
+	}
+}
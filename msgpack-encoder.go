@@ -0,0 +1,205 @@
+package sqljsonutil
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MsgpackEncoder is a RowEncoder that writes each row as a MessagePack map.
+// The output is a stream of maps, one per row, with no surrounding array
+// (since the number of rows is not known in advance).  Binary columns are encoded as bin,
+// times with the timestamp extension type (-1) and UUIDs as strings.  JSON numbers (from
+// DecimalAsNumber or options that write JSON) without a fraction or exponent are encoded as
+// integers, other numbers as float64.
+type MsgpackEncoder struct{}
+
+// ContentType implements RowEncoder.
+func (MsgpackEncoder) ContentType() string { return "application/msgpack" }
+
+// Begin implements RowEncoder.
+func (MsgpackEncoder) Begin(dst []byte) ([]byte, error) { return dst, nil }
+
+// End implements RowEncoder.
+func (MsgpackEncoder) End(dst []byte) ([]byte, error) { return dst, nil }
+
+// EncodeRow implements RowEncoder.
+func (MsgpackEncoder) EncodeRow(dst []byte, keys []string, values []interface{}) ([]byte, error) {
+	dst = appendMsgpackMapLen(dst, len(keys))
+	for i, k := range keys {
+		dst = appendMsgpackString(dst, k)
+		var err error
+		dst, err = appendMsgpackValue(dst, values[i])
+		if err != nil {
+			return dst, fmt.Errorf("column %q: %w", k, err)
+		}
+	}
+	return dst, nil
+}
+
+// appendMsgpackValue appends v, a RowEncoder value or one returned by decodeJSONValue, to dst.
+func appendMsgpackValue(dst []byte, v interface{}) ([]byte, error) {
+
+	switch vt := v.(type) {
+
+	case json.RawMessage:
+		jv, err := decodeJSONValue(vt)
+		if err != nil {
+			return dst, err
+		}
+		return appendMsgpackValue(dst, jv)
+
+	case json.Number:
+		n, err := parseJSONNumber(string(vt))
+		if err != nil {
+			return dst, err
+		}
+		return appendMsgpackValue(dst, n)
+
+	case []byte:
+		n := len(vt)
+		switch {
+		case n <= math.MaxUint8:
+			dst = append(dst, 0xc4, byte(n))
+		case n <= math.MaxUint16:
+			dst = binary.BigEndian.AppendUint16(append(dst, 0xc5), uint16(n))
+		default:
+			dst = binary.BigEndian.AppendUint32(append(dst, 0xc6), uint32(n))
+		}
+		return append(dst, vt...), nil
+
+	case [16]byte:
+		dst = append(dst, 0xd9, 36) // str8, too long for a fixstr
+		return appendUUID(dst, vt), nil
+
+	case time.Time:
+		return appendMsgpackTime(dst, vt), nil
+
+	case nil:
+		return append(dst, 0xc0), nil
+
+	case bool:
+		if vt {
+			return append(dst, 0xc3), nil
+		}
+		return append(dst, 0xc2), nil
+
+	case int64:
+		switch {
+		case vt >= 0:
+			return appendMsgpackUint(dst, uint64(vt)), nil
+		case vt >= -32:
+			return append(dst, byte(vt)), nil
+		case vt >= math.MinInt8:
+			return append(dst, 0xd0, byte(vt)), nil
+		case vt >= math.MinInt16:
+			return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(vt)), nil
+		case vt >= math.MinInt32:
+			return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(vt)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(vt)), nil
+
+	case uint64:
+		return appendMsgpackUint(dst, vt), nil
+
+	case float64:
+		return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(vt)), nil
+
+	case string:
+		return appendMsgpackString(dst, vt), nil
+
+	case []interface{}:
+		n := len(vt)
+		switch {
+		case n < 16:
+			dst = append(dst, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			dst = binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+		default:
+			dst = binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+		}
+		var err error
+		for _, e := range vt {
+			dst, err = appendMsgpackValue(dst, e)
+			if err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+
+	case map[string]interface{}:
+		dst = appendMsgpackMapLen(dst, len(vt))
+		keys := make([]string, 0, len(vt))
+		for k := range vt {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			dst = appendMsgpackString(dst, k)
+			dst, err = appendMsgpackValue(dst, vt[k])
+			if err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+	}
+
+	return dst, fmt.Errorf("unsupported value type for msgpack %T", v)
+}
+
+// appendMsgpackTime appends t with the timestamp extension type, in the smallest of its
+// 32, 64 and 96 bit formats that holds it.
+func appendMsgpackTime(dst []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd6, 0xff), uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd7, 0xff), nsec<<34|uint64(sec))
+	}
+	dst = binary.BigEndian.AppendUint32(append(dst, 0xc7, 12, 0xff), uint32(nsec))
+	return binary.BigEndian.AppendUint64(dst, uint64(sec))
+}
+
+func appendMsgpackUint(dst []byte, u uint64) []byte {
+	switch {
+	case u < 128:
+		return append(dst, byte(u))
+	case u <= math.MaxUint8:
+		return append(dst, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, 0xcf), u)
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, s...)
+}
+
+func appendMsgpackMapLen(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+}
@@ -0,0 +1,283 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMsgpackEncoder(t *testing.T) {
+
+	keys := []string{"id", "name", "price", "data", "gone"}
+	values := []interface{}{
+		json.RawMessage(`-1`),
+		json.RawMessage(`"a\"b"`),
+		json.RawMessage(`1.5`),
+		json.RawMessage(`{"n":[true,300]}`),
+		json.RawMessage(`null`),
+	}
+
+	b, err := MsgpackEncoder{}.EncodeRow(nil, keys, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x85,
+		0xa2, 'i', 'd', 0xff,
+		0xa4, 'n', 'a', 'm', 'e', 0xa3, 'a', '"', 'b',
+		0xa5, 'p', 'r', 'i', 'c', 'e', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa4, 'd', 'a', 't', 'a', 0x81, 0xa1, 'n', 0x92, 0xc3, 0xcd, 0x01, 0x2c,
+		0xa4, 'g', 'o', 'n', 'e', 0xc0,
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got % x, want % x", b, want)
+	}
+}
+
+func TestWriteEncodedTeeWriters(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+		rows: [][]interface{}{{int64(1)}, {int64(2)}},
+	}
+	var buf, audit bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.TeeWriters = []io.Writer{&audit}
+	err := rw.WriteEncoded(MsgpackEncoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x81, 0xa2, 'i', 'd', 0x01, 0x81, 0xa2, 'i', 'd', 0x02}
+	if !bytes.Equal(buf.Bytes(), want) || !bytes.Equal(audit.Bytes(), want) {
+		t.Errorf("got % x, copy % x, want % x", buf.Bytes(), audit.Bytes(), want)
+	}
+	if _, ok := rw.Writer.(*teeWriter); ok {
+		t.Errorf("Writer was not restored")
+	}
+}
+
+func TestMsgpackEncoderTypes(t *testing.T) {
+
+	keys := []string{"data", "at", "id", "price"}
+	values := []interface{}{
+		[]byte{0, 0xff},
+		time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		[16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0},
+		json.Number("12"),
+	}
+
+	b, err := MsgpackEncoder{}.EncodeRow(nil, keys, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-01-02T03:04:05Z is 0x65937d25, with 6ns it is the 64 bit format
+	want := []byte{0x84, 0xa4, 'd', 'a', 't', 'a', 0xc4, 0x02, 0, 0xff,
+		0xa2, 'a', 't', 0xd7, 0xff, 0, 0, 0, 0x18, 0x65, 0x93, 0x7d, 0x25,
+		0xa2, 'i', 'd', 0xd9, 36}
+	want = append(want, "12345678-9abc-def0-1234-56789abcdef0"...)
+	want = append(want, 0xa5, 'p', 'r', 'i', 'c', 'e', 12)
+	if !bytes.Equal(b, want) {
+		t.Errorf("got % x, want % x", b, want)
+	}
+
+	// the 32 and 96 bit timestamp formats
+	for _, tc := range []struct {
+		t    time.Time
+		want []byte
+	}{
+		{time.Unix(1, 0), []byte{0xd6, 0xff, 0, 0, 0, 1}},
+		{time.Unix(-1, 5), []byte{0xc7, 12, 0xff, 0, 0, 0, 5, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		b, err := appendMsgpackValue(nil, tc.t)
+		if err != nil || !bytes.Equal(b, tc.want) {
+			t.Errorf("%v: got % x, %v, want % x", tc.t, b, err, tc.want)
+		}
+	}
+}
+
+func TestWriteEncodedTypes(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"data", "VARBINARY", reflect.TypeOf([]byte(nil))},
+			{"id", "BINARY", reflect.TypeOf([]byte(nil))},
+			{"at", "DATETIME", reflect.TypeOf(sql.NullTime{})},
+			{"price", "DECIMAL", reflect.TypeOf("")},
+			{"name", "VARCHAR", reflect.TypeOf("")},
+			{"n", "BIGINT", reflect.TypeOf(sql.NullInt64{})},
+		},
+		rows: [][]interface{}{
+			{[]byte{1, 2}, make([]byte, 16), time.Unix(1, 0).UTC(), "1.50", "x", int64(1) << 60},
+			{nil, nil, nil, nil, nil, nil},
+		},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.UUIDColumns = []string{"id"}
+	rw.DecimalAsNumber = true
+	rw.SetColumnFormatter("name", func(w io.Writer, colName string, colIndex int, value interface{}) (bool, bool, error) {
+		_, err := io.WriteString(w, "[1]")
+		return true, false, err
+	})
+	err := rw.WriteEncoded(MsgpackEncoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x86,
+		0xa4, 'd', 'a', 't', 'a', 0xc4, 0x02, 1, 2,
+		0xa2, 'i', 'd', 0xd9, 36}
+	want = append(want, "00000000-0000-0000-0000-000000000000"...)
+	want = append(want,
+		0xa2, 'a', 't', 0xd6, 0xff, 0, 0, 0, 1,
+		0xa5, 'p', 'r', 'i', 'c', 'e', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa4, 'n', 'a', 'm', 'e', 0x91, 0x01,
+		0xa1, 'n', 0xcf, 0x10, 0, 0, 0, 0, 0, 0, 0,
+		0x86,
+		0xa4, 'd', 'a', 't', 'a', 0xc0,
+		0xa2, 'i', 'd', 0xc0,
+		0xa2, 'a', 't', 0xc0,
+		0xa5, 'p', 'r', 'i', 'c', 'e', 0xc0,
+		0xa4, 'n', 'a', 'm', 'e', 0x91, 0x01,
+		0xa1, 'n', 0xc0)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got % x, want % x", buf.Bytes(), want)
+	}
+
+	// and a decoder reads back two rows with the same values
+	got, err := decodeMsgpack(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := []interface{}{
+		map[string]interface{}{"data": []byte{1, 2}, "id": "00000000-0000-0000-0000-000000000000",
+			"at": msgpackExt{-1, []byte{0, 0, 0, 1}}, "price": 1.5, "name": []interface{}{uint64(1)}, "n": uint64(1) << 60},
+		map[string]interface{}{"data": nil, "id": nil, "at": nil, "price": nil, "name": []interface{}{uint64(1)}, "n": nil},
+	}
+	if !reflect.DeepEqual(got, wantRows) {
+		t.Errorf("decoded %#v, want %#v", got, wantRows)
+	}
+}
+
+// msgpackExt is a MessagePack extension value read by decodeMsgpack.
+type msgpackExt struct {
+	typ  int8
+	data []byte
+}
+
+// decodeMsgpack decodes the stream of MessagePack values in b, independently of the encoder,
+// with maps as map[string]interface{}, arrays as []interface{}, integers as int64 or uint64,
+// floats as float64, str as string, bin as []byte and ext as msgpackExt.
+func decodeMsgpack(b []byte) ([]interface{}, error) {
+	d := &msgpackDecoder{b: b}
+	var vals []interface{}
+	for d.off < len(b) && d.err == nil {
+		vals = append(vals, d.value())
+	}
+	return vals, d.err
+}
+
+type msgpackDecoder struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (d *msgpackDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b)-d.off < n {
+		if d.err == nil {
+			d.err = fmt.Errorf("truncated at offset %d", d.off)
+		}
+		return make([]byte, max(n, 0))
+	}
+	p := d.b[d.off : d.off+n]
+	d.off += n
+	return p
+}
+
+// uint reads an n byte big-endian unsigned integer.
+func (d *msgpackDecoder) uint(n int) uint64 {
+	var v uint64
+	for _, c := range d.next(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (d *msgpackDecoder) value() interface{} {
+	c := d.next(1)[0]
+	switch {
+	case c <= 0x7f:
+		return uint64(c)
+	case c >= 0xe0:
+		return int64(int8(c))
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return string(d.next(int(c & 0x1f)))
+	}
+	switch c {
+	case 0xc0:
+		return nil
+	case 0xc2, 0xc3:
+		return c == 0xc3
+	case 0xc4, 0xc5, 0xc6:
+		return bytes.Clone(d.next(int(d.uint(1 << (c - 0xc4)))))
+	case 0xc7, 0xc8, 0xc9:
+		n := int(d.uint(1 << (c - 0xc7)))
+		return msgpackExt{int8(d.next(1)[0]), bytes.Clone(d.next(n))}
+	case 0xca:
+		return float64(math.Float32frombits(uint32(d.uint(4))))
+	case 0xcb:
+		return math.Float64frombits(d.uint(8))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		return int64(d.uint(n)<<(64-8*n)) >> (64 - 8*n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		typ := int8(d.next(1)[0])
+		return msgpackExt{typ, bytes.Clone(d.next(1 << (c - 0xd4)))}
+	case 0xd9, 0xda, 0xdb:
+		return string(d.next(int(d.uint(1 << (c - 0xd9)))))
+	case 0xdc, 0xdd:
+		return d.arrayOf(int(d.uint(2 << (c - 0xdc))))
+	case 0xde, 0xdf:
+		return d.mapOf(int(d.uint(2 << (c - 0xde))))
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("unknown type byte 0x%02x at offset %d", c, d.off-1)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) arrayOf(n int) []interface{} {
+	a := []interface{}{}
+	for i := 0; i < n && d.err == nil; i++ {
+		a = append(a, d.value())
+	}
+	return a
+}
+
+func (d *msgpackDecoder) mapOf(n int) map[string]interface{} {
+	m := map[string]interface{}{}
+	for i := 0; i < n && d.err == nil; i++ {
+		k, ok := d.value().(string)
+		if !ok && d.err == nil {
+			d.err = fmt.Errorf("non-string map key at offset %d", d.off)
+		}
+		m[k] = d.value()
+	}
+	return m
+}
@@ -0,0 +1,439 @@
+package sqljsonutil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ODataQuery is a safe subset of the OData system query options of a request, translated to
+// SQL fragments for the caller's query, see ParseODataQuery.
+type ODataQuery struct {
+	Select  []string      // $select, the columns to write, empty for all
+	Where   string        // $filter as a condition (without the WHERE), empty if none
+	Args    []interface{} // the arguments for the placeholders in Where
+	OrderBy string        // $orderby as an ORDER BY list (without the ORDER BY), empty if none
+	Top     int           // $top, the number of rows, -1 if not set
+	Skip    int           // $skip, the number of rows to skip, 0 if not set
+}
+
+// ParseODataQuery parses $select, $filter, $orderby, $top and $skip from the URL query of r.
+// Only the given columns may be used, so the request can't refer to other columns or SQL.
+// Other options are ignored.  The returned errors are meant for the client, e.g. with a 400 status.
+//
+// $filter supports comparisons of a column with a literal (eq, ne, gt, ge, lt, le), and, or,
+// not, parentheses and the contains, startswith and endswith functions.  Literals are 'strings'
+// (with '' for a quote), numbers, true, false and null, and are passed as arguments, never in
+// the SQL.  Placeholders are numbered from 1, see Dialect.
+func ParseODataQuery(r *http.Request, d Dialect, columns ...string) (*ODataQuery, error) {
+
+	query := r.URL.Query()
+	q := &ODataQuery{Top: -1}
+
+	if sel := strings.TrimSpace(query.Get("$select")); sel != "" && sel != "*" {
+		for _, name := range strings.Split(sel, ",") {
+			name = strings.TrimSpace(name)
+			if !containsString(columns, name) {
+				return nil, fmt.Errorf("$select: unknown column %q", name)
+			}
+			q.Select = append(q.Select, name)
+		}
+	}
+
+	if filter := strings.TrimSpace(query.Get("$filter")); filter != "" {
+		p := &odataParser{d: d, columns: columns, input: filter}
+		err := p.parse()
+		if err != nil {
+			return nil, fmt.Errorf("$filter: %w", err)
+		}
+		q.Where, q.Args = p.sql.String(), p.args
+	}
+
+	if orderBy := strings.TrimSpace(query.Get("$orderby")); orderBy != "" {
+		var parts []string
+		for _, item := range strings.Split(orderBy, ",") {
+			fields := strings.Fields(item)
+			if len(fields) == 0 || len(fields) > 2 {
+				return nil, fmt.Errorf("$orderby: invalid item %q", strings.TrimSpace(item))
+			}
+			if !containsString(columns, fields[0]) {
+				return nil, fmt.Errorf("$orderby: unknown column %q", fields[0])
+			}
+			part := d.quoteIdent(fields[0])
+			if len(fields) == 2 {
+				switch strings.ToLower(fields[1]) {
+				case "asc":
+				case "desc":
+					part += " DESC"
+				default:
+					return nil, fmt.Errorf("$orderby: invalid direction %q", fields[1])
+				}
+			}
+			parts = append(parts, part)
+		}
+		q.OrderBy = strings.Join(parts, ", ")
+	}
+
+	for _, opt := range []struct {
+		name string
+		dst  *int
+	}{{"$top", &q.Top}, {"$skip", &q.Skip}} {
+		v := query.Get(opt.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s: invalid value %q", opt.name, v)
+		}
+		*opt.dst = n
+	}
+
+	return q, nil
+}
+
+// Apply sets IncludeColumns to Select, so q.Apply can be used as an Option.
+func (q *ODataQuery) Apply(rw *RowsWriter) {
+	rw.IncludeColumns = q.Select
+}
+
+// odataMaxDepth limits the nesting of $filter expressions.
+const odataMaxDepth = 32
+
+// odataParser is a recursive descent parser for the $filter subset, writing SQL to sql.
+type odataParser struct {
+	d       Dialect
+	columns []string
+	input   string
+	pos     int
+	depth   int
+	sql     strings.Builder
+	args    []interface{}
+}
+
+var odataOperators = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+// odataToken is a token of the $filter input: one of ( ) , or a string literal (kind '\''),
+// a number (kind '0') or a word (kind 'a').  kind is 0 at the end of the input.
+type odataToken struct {
+	kind byte
+	text string // the word or number, or the unquoted string
+}
+
+func (p *odataParser) parse() error {
+	err := p.parseOr()
+	if err != nil {
+		return err
+	}
+	if t, err := p.peek(); err != nil || t.kind != 0 {
+		return p.unexpected(t, err)
+	}
+	return nil
+}
+
+func (p *odataParser) parseOr() error {
+	return p.parseBinary("or", " OR ", p.parseAnd)
+}
+
+func (p *odataParser) parseAnd() error {
+	return p.parseBinary("and", " AND ", p.parseUnary)
+}
+
+// parseBinary parses operands separated by the keyword op, joined in SQL by sqlOp.
+func (p *odataParser) parseBinary(op, sqlOp string, operand func() error) error {
+
+	start := p.sql.Len()
+	err := operand()
+	if err != nil {
+		return err
+	}
+
+	n := 1
+	for {
+		save := p.pos
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+		if t.kind != 'a' || !strings.EqualFold(t.text, op) {
+			p.pos = save
+			break
+		}
+		if n == 1 {
+			// wrap the expression so far in parentheses
+			first := p.sql.String()[start:]
+			p.truncate(start)
+			p.sql.WriteString("(" + first)
+		}
+		p.sql.WriteString(sqlOp)
+		err = operand()
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 1 {
+		p.sql.WriteString(")")
+	}
+	return nil
+}
+
+func (p *odataParser) parseUnary() error {
+
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > odataMaxDepth {
+		return fmt.Errorf("expression is nested too deeply")
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case t.kind == '(':
+		p.sql.WriteString("(")
+		err := p.parseOr()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(')'); err != nil {
+			return err
+		}
+		p.sql.WriteString(")")
+		return nil
+
+	case t.kind == 'a' && strings.EqualFold(t.text, "not"):
+		p.sql.WriteString("NOT ")
+		return p.parseUnary()
+
+	case t.kind == 'a' && p.peekKind() == '(':
+		return p.parseFunc(strings.ToLower(t.text))
+
+	case t.kind == 'a':
+		col, err := p.column(t)
+		if err != nil {
+			return err
+		}
+		opTok, err := p.next()
+		if err != nil {
+			return err
+		}
+		op, ok := odataOperators[strings.ToLower(opTok.text)]
+		if opTok.kind != 'a' || !ok {
+			return p.unexpected(opTok, nil)
+		}
+		lit, err := p.literal()
+		if err != nil {
+			return err
+		}
+		if lit == nil {
+			switch op {
+			case "=":
+				p.sql.WriteString(col + " IS NULL")
+			case "<>":
+				p.sql.WriteString(col + " IS NOT NULL")
+			default:
+				return fmt.Errorf("null can only be compared with eq or ne")
+			}
+			return nil
+		}
+		p.sql.WriteString(col + " " + op + " " + p.arg(lit))
+		return nil
+	}
+
+	return p.unexpected(t, nil)
+}
+
+// parseFunc parses the arguments of a string function and writes it as a LIKE.
+func (p *odataParser) parseFunc(name string) error {
+
+	var prefix, suffix string
+	switch name {
+	case "contains":
+		prefix, suffix = "%", "%"
+	case "startswith":
+		suffix = "%"
+	case "endswith":
+		prefix = "%"
+	default:
+		return fmt.Errorf("unsupported function %q", name)
+	}
+
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	col, err := p.column(t)
+	if err != nil {
+		return err
+	}
+	if err := p.expect(','); err != nil {
+		return err
+	}
+	t, err = p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind != '\'' {
+		return fmt.Errorf("%s requires a string", name)
+	}
+	if err := p.expect(')'); err != nil {
+		return err
+	}
+
+	// ! is the escape character, since backslash is not the same in every database
+	pattern := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(t.text)
+	p.sql.WriteString(col + " LIKE " + p.arg(prefix+pattern+suffix) + " ESCAPE '!'")
+	return nil
+}
+
+// column returns the quoted column for the word t, which must be one of columns.
+func (p *odataParser) column(t odataToken) (string, error) {
+	if t.kind != 'a' {
+		return "", p.unexpected(t, nil)
+	}
+	if !containsString(p.columns, t.text) {
+		return "", fmt.Errorf("unknown column %q", t.text)
+	}
+	return p.d.quoteIdent(t.text), nil
+}
+
+// literal parses a literal and returns its value, nil for null.
+func (p *odataParser) literal() (interface{}, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case '\'':
+		return t.text, nil
+	case '0':
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return f, nil
+	case 'a':
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, p.unexpected(t, nil)
+}
+
+// arg adds v to args and returns its placeholder.
+func (p *odataParser) arg(v interface{}) string {
+	p.args = append(p.args, v)
+	return p.d.placeholder(len(p.args))
+}
+
+// truncate discards the SQL written after n bytes.
+func (p *odataParser) truncate(n int) {
+	s := p.sql.String()[:n]
+	p.sql.Reset()
+	p.sql.WriteString(s)
+}
+
+func (p *odataParser) expect(kind byte) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind != kind {
+		return p.unexpected(t, nil)
+	}
+	return nil
+}
+
+func (p *odataParser) unexpected(t odataToken, err error) error {
+	if err != nil {
+		return err
+	}
+	if t.kind == 0 {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", t.text, p.pos)
+}
+
+func (p *odataParser) peek() (odataToken, error) {
+	save := p.pos
+	t, err := p.next()
+	p.pos = save
+	return t, err
+}
+
+func (p *odataParser) peekKind() byte {
+	t, _ := p.peek()
+	return t.kind
+}
+
+// next returns the next token and advances past it.
+func (p *odataParser) next() (odataToken, error) {
+
+	s := p.input
+	for p.pos < len(s) && (s[p.pos] == ' ' || s[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos >= len(s) {
+		return odataToken{}, nil
+	}
+
+	start := p.pos
+	c := s[p.pos]
+	switch {
+	case c == '(' || c == ')' || c == ',':
+		p.pos++
+		return odataToken{kind: c, text: string(c)}, nil
+
+	case c == '\'':
+		var sb strings.Builder
+		for p.pos++; p.pos < len(s); p.pos++ {
+			if s[p.pos] != '\'' {
+				sb.WriteByte(s[p.pos])
+				continue
+			}
+			if p.pos+1 < len(s) && s[p.pos+1] == '\'' { // '' is a quote
+				sb.WriteByte('\'')
+				p.pos++
+				continue
+			}
+			p.pos++
+			return odataToken{kind: '\'', text: sb.String()}, nil
+		}
+		return odataToken{}, fmt.Errorf("unterminated string at position %d", start)
+
+	case c == '-' || c >= '0' && c <= '9':
+		for p.pos++; p.pos < len(s); p.pos++ {
+			c := s[p.pos]
+			if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-') {
+				break
+			}
+		}
+		return odataToken{kind: '0', text: s[start:p.pos]}, nil
+
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos++; p.pos < len(s); p.pos++ {
+			c := s[p.pos]
+			if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+				break
+			}
+		}
+		return odataToken{kind: 'a', text: s[start:p.pos]}, nil
+	}
+
+	return odataToken{}, fmt.Errorf("unexpected %q at position %d", c, start)
+}
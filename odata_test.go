@@ -0,0 +1,49 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestODataQuery(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	r := httptest.NewRequest("GET", "/widgets?$select=name&$filter=startswith(name,'Next')%20or%20widget_id%20eq%20'abc123'&$orderby=widget_id%20desc&$top=10", nil)
+	q, err := ParseODataQuery(r, DialectMySQL, "widget_id", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Where != "(`name` LIKE ? ESCAPE '!' OR `widget_id` = ?)" || q.OrderBy != "`widget_id` DESC" || q.Top != 10 {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+
+	rows, err := db.Query("SELECT * FROM widgets WHERE "+q.Where+" ORDER BY "+q.OrderBy+" LIMIT ?", append(q.Args, q.Top)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	q.Apply(rw)
+	err = rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `[
+{"name":"Next One"}
+,{"name":"First One"}
+]
+` {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	r = httptest.NewRequest("GET", "/widgets?$filter=secret%20eq%201", nil)
+	_, err = ParseODataQuery(r, DialectMySQL, "widget_id", "name")
+	if err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+}
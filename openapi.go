@@ -0,0 +1,61 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// OpenAPISchema returns an OpenAPI 3.1 schema object for the row objects of a result set with
+// columns cols, for use in components/schemas.  OpenAPI 3.1 schemas are JSON Schema, so this
+// is the same as SchemaFromColumns without the $schema keyword.
+func OpenAPISchema(cols []*sql.ColumnType) ([]byte, error) {
+	var rw RowsWriter
+	return rw.objectSchema(cols)
+}
+
+// OpenAPIPathItem returns an OpenAPI 3.1 path item object with a GET operation for an endpoint
+// that writes a result set with columns cols, e.g. one made with QueryHandler.  If array is
+// true the 200 response is an array of row objects (as written by WriteResponse), otherwise a
+// single row object.  The default response is the {"error":"..."} object QueryHandler writes.
+func OpenAPIPathItem(cols []*sql.ColumnType, operationID string, array bool) ([]byte, error) {
+
+	rowSchema, err := OpenAPISchema(cols)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := json.RawMessage(rowSchema)
+	if array {
+		schema, err = json.Marshal(map[string]interface{}{"type": "array", "items": schema})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	type content map[string]map[string]interface{}
+	type response struct {
+		Description string  `json:"description"`
+		Content     content `json:"content"`
+	}
+	type operation struct {
+		OperationID string              `json:"operationId,omitempty"`
+		Responses   map[string]response `json:"responses"`
+	}
+
+	return json.Marshal(map[string]operation{
+		"get": {
+			OperationID: operationID,
+			Responses: map[string]response{
+				"200": {
+					Description: "OK",
+					Content:     content{"application/json": {"schema": schema}},
+				},
+				"default": {
+					Description: "Error",
+					Content: content{"application/json": {"schema": json.RawMessage(
+						`{"type":"object","properties":{"error":{"type":"string"}},"required":["error"]}`)}},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOpenAPIPathItem(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenAPIPathItem(cols, "listWidgets", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var item struct {
+		Get struct {
+			OperationID string `json:"operationId"`
+			Responses   map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Type  string `json:"type"`
+						Items struct {
+							Properties map[string]interface{} `json:"properties"`
+						} `json:"items"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"get"`
+	}
+	err = json.Unmarshal(b, &item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := item.Get.Responses["200"].Content["application/json"].Schema
+	if item.Get.OperationID != "listWidgets" || schema.Type != "array" || len(schema.Items.Properties) != 2 {
+		t.Errorf("unexpected path item: %s", b)
+	}
+	t.Logf("PATH ITEM: %s", b)
+}
@@ -0,0 +1,187 @@
+package sqljsonutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeCursor returns the cursor for the row with values, see PaginatedWriter.CursorColumns.
+// The cursor is a JSON array with each key as null or its text prefixed with its type, e.g.
+// ["s:abc123","u:18446744073709551615","t:2024-01-02T03:04:05.123456Z"], so DecodeCursor can
+// return the same value instead of one rounded through a float64 or a string.
+func encodeCursor(colNames []string, values []interface{}, cursorColumns []string) (string, error) {
+
+	keys := make([]interface{}, len(cursorColumns))
+	for i, name := range cursorColumns {
+		idx := -1
+		for j, colName := range colNames {
+			if colName == name {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return "", fmt.Errorf("cursor column %q not found in result set", name)
+		}
+		v := scanValue(values[idx])
+		if v == nil {
+			continue // null
+		}
+		s, ok := cursorKeyText(v)
+		if !ok {
+			return "", fmt.Errorf("cursor column %q has a value of unsupported type %T", name, v)
+		}
+		keys[i] = s
+	}
+
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// cursorKeyText returns the text of a cursor key v, prefixed with its type.
+func cursorKeyText(v interface{}) (string, bool) {
+
+	if t, ok := v.(time.Time); ok {
+		return "t:" + t.Format(time.RFC3339Nano), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return "s:" + rv.String(), true
+	case reflect.Bool:
+		return "b:" + strconv.FormatBool(rv.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "i:" + strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "u:" + strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return "f:" + strconv.FormatFloat(rv.Float(), 'g', -1, 64), true
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 { // []byte and sql.RawBytes, as text
+			return "s:" + string(rv.Bytes()), true
+		}
+	}
+	return "", false
+}
+
+// DecodeCursor returns the key values in a nextCursor written by PaginatedWriter, in
+// CursorColumns order, as SQL arguments of the type they were scanned as: nil for NULL,
+// string, bool, int64, uint64, float64 or time.Time.
+func DecodeCursor(cursor string) ([]interface{}, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var keys []*string
+	err = json.Unmarshal(b, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		if k == nil {
+			continue
+		}
+		typ, s, _ := strings.Cut(*k, ":")
+		switch typ {
+		case "s":
+			args[i] = s
+		case "b":
+			args[i], err = strconv.ParseBool(s)
+		case "i":
+			args[i], err = strconv.ParseInt(s, 10, 64)
+		case "u":
+			args[i], err = strconv.ParseUint(s, 10, 64)
+		case "f":
+			args[i], err = strconv.ParseFloat(s, 64)
+		case "t":
+			args[i], err = time.Parse(time.RFC3339Nano, s)
+		default:
+			err = fmt.Errorf("unknown key type %q", typ)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+	}
+	return args, nil
+}
+
+// CursorWhere returns a WHERE clause condition (without the WHERE) and its arguments that
+// selects the rows after cursor, for a query ordered by columns ascending, e.g. for columns
+// a, b: (`a` > ? OR (`a` = ? AND `b` > ?)).  Placeholders are numbered from 1, so for
+// DialectPostgres and DialectSQLServer the condition's arguments should come first.
+// If cursor is empty it returns an empty condition, for the first page.
+//
+// NULLs are ordered as the database does by default: first for MySQL, SQLite and SQL
+// Server and last for Postgres, so a NULL key is compared with IS NULL and IS NOT NULL,
+// and for Postgres a non-NULL key is followed by the NULLs.
+func CursorWhere(d Dialect, columns []string, cursor string) (string, []interface{}, error) {
+
+	if cursor == "" {
+		return "", nil, nil
+	}
+
+	keys, err := DecodeCursor(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(keys) != len(columns) || len(keys) == 0 {
+		return "", nil, fmt.Errorf("invalid cursor: got %d values for %d columns", len(keys), len(columns))
+	}
+	nullsLast := d == DialectPostgres
+
+	var terms []string
+	var args []interface{}
+	for i := range columns {
+
+		// nothing sorts after a NULL when NULLs are last
+		if keys[i] == nil && nullsLast {
+			continue
+		}
+
+		var sb strings.Builder
+		if i > 0 {
+			sb.WriteString("(")
+		}
+		for j := 0; j < i; j++ {
+			col := d.quoteIdent(columns[j])
+			if keys[j] == nil {
+				fmt.Fprintf(&sb, "%s IS NULL AND ", col)
+				continue
+			}
+			args = append(args, keys[j])
+			fmt.Fprintf(&sb, "%s = %s AND ", col, d.placeholder(len(args)))
+		}
+		col := d.quoteIdent(columns[i])
+		switch {
+		case keys[i] == nil:
+			fmt.Fprintf(&sb, "%s IS NOT NULL", col)
+		case nullsLast:
+			args = append(args, keys[i])
+			fmt.Fprintf(&sb, "(%s > %s OR %s IS NULL)", col, d.placeholder(len(args)), col)
+		default:
+			args = append(args, keys[i])
+			fmt.Fprintf(&sb, "%s > %s", col, d.placeholder(len(args)))
+		}
+		if i > 0 {
+			sb.WriteString(")")
+		}
+		terms = append(terms, sb.String())
+	}
+
+	if len(terms) == 0 {
+		return "1=0", nil, nil // the cursor was the last row
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args, nil
+}
@@ -0,0 +1,289 @@
+package sqljsonutil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PaginatedWriter writes one page of rows in an envelope with the page details:
+//
+//	{"data":[
+//	{"widget_id":"abc123","name":"First One"}
+//	],"page":1,"perPage":1,"hasMore":true}
+//
+// hasMore is found by reading one more row than PerPage, so the rows should either come from
+// a query with LIMIT Limit() OFFSET Offset() (see PaginateQuery), or be the whole result with
+// SkipRows set.  It embeds RowsWriter, so the column and value options apply the same way.
+type PaginatedWriter struct {
+	RowsWriter
+
+	Page    int // the page number, starting at 1, less than 1 is the same as 1
+	PerPage int // the number of rows per page, must be more than 0
+
+	// SkipRows, if true, means Rows is the unpaginated result and the rows before Page are read
+	// and discarded.  This works with any query but reads every row up to the page, so it is best
+	// for small results or queries that can't be changed.
+	SkipRows bool
+
+	// CursorColumns, if set, are the columns (usually the ORDER BY columns, ending with a unique
+	// one) whose values in the last row of the page are written as an opaque "nextCursor" in the
+	// envelope, or null if there are no more rows.  The next page is then selected with
+	// CursorWhere (or DecodeCursor) instead of an offset, which stays fast and stable for large
+	// results.  With a cursor, Page is normally left at 1.  Masked columns (see MaskRules) can't
+	// be cursor columns, since the cursor would hold their values.
+	CursorColumns []string
+
+	// CountFunc, if not nil, is called before anything is written to get the total number of
+	// rows in the unpaginated result, e.g. by running a CountQuery or returning a cached count.
+	// It is written as "total" in the envelope and, if the Writer is an http.ResponseWriter,
+	// in the TotalHeader header.
+	CountFunc func() (int64, error)
+
+	// TotalHeader is the HTTP header set to the total from CountFunc, "X-Total-Count" if empty
+	// or none if "-".
+	TotalHeader string
+
+	// LinkURL, if not empty and the Writer is an http.ResponseWriter, is a URL template for an
+	// RFC 8288 Link header with the next page (rel="next") and, if it contains {page}, the
+	// first, previous and (with CountFunc) last pages.  {page}, {perPage} and {cursor} are
+	// replaced with the values for each page, e.g. "/widgets?page={page}&per_page={perPage}" or
+	// "/widgets?cursor={cursor}".  The page is buffered (as with Atomic) so the header can be set
+	// once it is known whether there are more rows.
+	LinkURL string
+
+	nextCursor string
+}
+
+// NewPaginatedWriter is the same as: return &PaginatedWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Page: page, PerPage: perPage}
+func NewPaginatedWriter(w io.Writer, rows RowsLike, page, perPage int) *PaginatedWriter {
+	return &PaginatedWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}, Page: page, PerPage: perPage}
+}
+
+// Offset returns the number of rows before Page.
+func (pw *PaginatedWriter) Offset() int {
+	return pageOffset(pw.Page, pw.PerPage)
+}
+
+// Limit returns the number of rows to query for Page, one more than PerPage to tell if there are more.
+func (pw *PaginatedWriter) Limit() int {
+	return pw.PerPage + 1
+}
+
+// NextCursor returns the nextCursor written by WriteResponse, or "" if there are no more rows.
+func (pw *PaginatedWriter) NextCursor() string {
+	if !pw.truncated {
+		return ""
+	}
+	return pw.nextCursor
+}
+
+// linkHeader returns the Link header value for LinkURL, see LinkURL.
+func (pw *PaginatedWriter) linkHeader(page int, total int64) string {
+
+	var links []string
+	add := func(rel string, page int, cursor string) {
+		u := strings.NewReplacer("{page}", strconv.Itoa(page), "{perPage}", strconv.Itoa(pw.PerPage),
+			"{cursor}", url.QueryEscape(cursor)).Replace(pw.LinkURL)
+		links = append(links, "<"+u+`>; rel="`+rel+`"`)
+	}
+
+	paged := strings.Contains(pw.LinkURL, "{page}")
+	if pw.truncated && (paged || pw.NextCursor() != "") {
+		add("next", page+1, pw.NextCursor())
+	}
+	if paged {
+		if page > 1 {
+			add("prev", page-1, "")
+		}
+		add("first", 1, "")
+		if total >= 0 {
+			last := int((total + int64(pw.PerPage) - 1) / int64(pw.PerPage))
+			add("last", max(last, 1), "")
+		}
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// pageOffset returns the number of rows before page.
+func pageOffset(page, perPage int) int {
+	if page < 1 {
+		page = 1
+	}
+	return (page - 1) * perPage
+}
+
+// PaginateQuery appends to query the clauses that return the rows PaginatedWriter needs for
+// page, i.e. LIMIT perPage+1 and the OFFSET of the page (OFFSET/FETCH for DialectSQLServer).
+// query should end with an ORDER BY, or the pages are not in a stable order, and for
+// DialectSQLServer it must have one.  An error is returned if query already has a LIMIT,
+// OFFSET or FETCH.
+func PaginateQuery(d Dialect, query string, page, perPage int) (string, error) {
+
+	query = strings.TrimRight(query, "; \t\r\n")
+	orderBy := false
+	words := d.topLevelSQLWords(query)
+	for i, w := range words {
+		switch w {
+		case "LIMIT", "OFFSET", "FETCH":
+			return "", fmt.Errorf("PaginateQuery: query already has %s", w)
+		case "ORDER":
+			orderBy = orderBy || i+1 < len(words) && words[i+1] == "BY"
+		}
+	}
+
+	limit, offset := perPage+1, pageOffset(page, perPage)
+	if d == DialectSQLServer {
+		if !orderBy {
+			return "", fmt.Errorf("PaginateQuery: query must have an ORDER BY for OFFSET/FETCH")
+		}
+		return fmt.Sprintf("%s OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", query, offset, limit), nil
+	}
+	return fmt.Sprintf("%s LIMIT %d OFFSET %d", query, limit, offset), nil
+}
+
+// CountQuery wraps query so it returns the number of rows, for PaginatedWriter.CountFunc.
+func CountQuery(query string) string {
+	return "SELECT COUNT(*) FROM (" + query + ") AS count_query"
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (pw *PaginatedWriter) WriteTo(w io.Writer) (int64, error) {
+	return pw.writeTo(w, pw.WriteResponse)
+}
+
+// WriteResponse writes the page of rows in the envelope.  MaxRows is set to PerPage for the
+// duration of the call.  If the io.Writer in the Writer field is an http.ResponseWriter the
+// Content-Type is set the same as RowsWriter.WriteResponse.
+//
+// Atomic, ETag and ETagVersion apply the same as for RowsWriter.WriteResponse, as the page is
+// buffered anyway when LinkURL is set.  The ETag is a hash of the whole envelope.
+func (pw *PaginatedWriter) WriteResponse() error {
+
+	if ok, err := pw.withOutput(true, pw.WriteResponse); ok {
+		return err
+	}
+
+	if pw.PerPage < 1 {
+		return fmt.Errorf("PaginatedWriter requires PerPage")
+	}
+
+	if pw.ETagVersion != "" && pw.notModified([]byte(pw.ETagVersion)) {
+		return nil
+	}
+
+	// headers are set on the response, not the Atomic buffer
+	hw, _ := pw.Writer.(http.ResponseWriter)
+
+	if pw.Atomic || pw.etagBuffered() || (pw.LinkURL != "" && hw != nil) {
+		return pw.writeAtomic(func() error { return pw.writePage(hw) })
+	}
+
+	return pw.writePage(hw)
+}
+
+// writePage writes the page for WriteResponse, setting headers on hw if not nil.
+func (pw *PaginatedWriter) writePage(hw http.ResponseWriter) error {
+
+	total := int64(-1)
+	if pw.CountFunc != nil {
+		var err error
+		total, err = pw.CountFunc()
+		if err != nil {
+			return err
+		}
+		if hw != nil && pw.TotalHeader != "-" {
+			name := pw.TotalHeader
+			if name == "" {
+				name = "X-Total-Count"
+			}
+			hw.Header().Set(name, strconv.FormatInt(total, 10))
+		}
+	}
+
+	pw.setJSONContentType()
+
+	if pw.SkipRows {
+		for i := pw.Offset(); i > 0; i-- {
+			if !pw.nextIncludedRow() {
+				break
+			}
+		}
+		pw.prescanned = false
+	}
+
+	pw.nextCursor = ""
+	prevCursor := ""
+	if len(pw.CursorColumns) > 0 {
+		for _, name := range pw.CursorColumns {
+			if pw.maskRule(name) != nil {
+				return fmt.Errorf("cursor column %q is masked, its values would be in the cursor", name)
+			}
+		}
+		// the filter sees the values of every included row, including the one after the page
+		prevFilter := pw.RowFilterFunc
+		defer func() { pw.RowFilterFunc = prevFilter }()
+		n := 0
+		pw.RowFilterFunc = func(colNames []string, values []interface{}) (bool, error) {
+			if prevFilter != nil {
+				include, err := prevFilter(colNames, values)
+				if err != nil || !include {
+					return include, err
+				}
+			}
+			n++
+			if n <= pw.PerPage {
+				cursor, err := encodeCursor(colNames, values, pw.CursorColumns)
+				if err != nil {
+					return false, err
+				}
+				prevCursor, pw.nextCursor = pw.nextCursor, cursor
+			}
+			return true, nil
+		}
+	}
+
+	prevMaxRows := pw.MaxRows
+	pw.MaxRows = pw.PerPage
+	defer func() { pw.MaxRows = prevMaxRows }()
+
+	return pw.writeEnvelope([]byte("{\"data\":[\n"), pw.WriteCommaRows, func(err error) []byte {
+
+		if err == ErrMaxBytes {
+			pw.nextCursor = prevCursor // the last row read was not written
+		}
+
+		page := pw.Page
+		if page < 1 {
+			page = 1
+		}
+		if hw != nil && pw.LinkURL != "" {
+			if link := pw.linkHeader(page, total); link != "" {
+				hw.Header().Set("Link", link)
+			}
+		}
+
+		buf := append([]byte("],\"page\":"), strconv.Itoa(page)...)
+		buf = append(buf, ",\"perPage\":"...)
+		buf = strconv.AppendInt(buf, int64(pw.PerPage), 10)
+		if total >= 0 {
+			buf = append(buf, ",\"total\":"...)
+			buf = strconv.AppendInt(buf, total, 10)
+		}
+		buf = append(buf, ",\"hasMore\":"...)
+		buf = strconv.AppendBool(buf, pw.truncated)
+		if len(pw.CursorColumns) > 0 {
+			buf = append(buf, ",\"nextCursor\":"...)
+			if cursor := pw.NextCursor(); cursor != "" {
+				buf = strconv.AppendQuote(buf, cursor) // base64url needs no escaping
+			} else {
+				buf = append(buf, "null"...)
+			}
+		}
+		return append(buf, "}\n"...)
+	})
+}
@@ -0,0 +1,301 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaginatedWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	t.Run("Query", func(t *testing.T) {
+
+		query, err := PaginateQuery(DialectMySQL, "SELECT * FROM widgets ORDER BY widget_id", 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		err = NewPaginatedWriter(&buf, rows, 1, 1).WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `{"data":[
+{"widget_id":"abc123","name":"First One"}
+],"page":1,"perPage":1,"hasMore":true}
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("SkipRows", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		pw := NewPaginatedWriter(&buf, rows, 2, 1)
+		pw.SkipRows = true
+		err = pw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `{"data":[
+{"widget_id":"def456","name":"Next One"}
+],"page":2,"perPage":1,"hasMore":false}
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("Cursor", func(t *testing.T) {
+
+		cursor := ""
+		for _, want := range []string{`{"data":[
+{"widget_id":"abc123","name":"First One"}
+],"page":1,"perPage":1,"hasMore":true,"nextCursor":"WyJzOmFiYzEyMyJd"}
+`, `{"data":[
+{"widget_id":"def456","name":"Next One"}
+],"page":1,"perPage":1,"hasMore":false,"nextCursor":null}
+`} {
+
+			where, args, err := CursorWhere(DialectMySQL, []string{"widget_id"}, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if where == "" {
+				where = "1=1"
+			}
+			query, err := PaginateQuery(DialectMySQL, "SELECT * FROM widgets WHERE "+where+" ORDER BY widget_id", 1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.Query(query, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			var buf bytes.Buffer
+			pw := NewPaginatedWriter(&buf, rows, 1, 1)
+			pw.CursorColumns = []string{"widget_id"}
+			err = pw.WriteResponse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != want {
+				t.Errorf("unexpected output: %s", buf.String())
+			}
+			cursor = pw.NextCursor()
+		}
+	})
+
+	t.Run("Total", func(t *testing.T) {
+
+		const query = "SELECT * FROM widgets ORDER BY widget_id"
+		pageQuery, err := PaginateQuery(DialectMySQL, query, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := db.Query(pageQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		w := httptest.NewRecorder()
+		pw := NewPaginatedWriter(w, rows, 1, 1)
+		pw.CountFunc = func() (n int64, err error) {
+			err = db.QueryRow(CountQuery(query)).Scan(&n)
+			return n, err
+		}
+		err = pw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Header().Get("X-Total-Count") != "2" || w.Body.String() != `{"data":[
+{"widget_id":"abc123","name":"First One"}
+],"page":1,"perPage":1,"total":2,"hasMore":true}
+` {
+			t.Errorf("unexpected response %v: %s", w.Header(), w.Body.String())
+		}
+	})
+
+	t.Run("Link", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		w := httptest.NewRecorder()
+		pw := NewPaginatedWriter(w, rows, 1, 1)
+		pw.SkipRows = true
+		pw.LinkURL = "/widgets?page={page}&per_page={perPage}"
+		err = pw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link := w.Header().Get("Link"); link != `</widgets?page=2&per_page=1>; rel="next", </widgets?page=1&per_page=1>; rel="first"` {
+			t.Errorf("unexpected Link header: %s", link)
+		}
+	})
+}
+
+func TestPaginatedWriterMaskedCursor(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{{"email", "TEXT", reflect.TypeOf("")}},
+		rows: [][]interface{}{{"joe@example.com"}},
+	}
+	var buf bytes.Buffer
+	pw := NewPaginatedWriter(&buf, rows, 1, 10)
+	pw.CursorColumns = []string{"email"}
+	pw.MaskRules = []MaskRule{{Pattern: "Email"}}
+	err := pw.WriteResponse()
+	if err == nil || !strings.Contains(err.Error(), `cursor column "email" is masked`) {
+		t.Errorf("expected a masked cursor column error, got %v", err)
+	}
+	if strings.Contains(buf.String(), "joe") {
+		t.Errorf("masked value was written: %s", buf.String())
+	}
+}
+
+func TestPaginatedWriterETag(t *testing.T) {
+
+	etag := ""
+	for i, wantCode := range []int{200, 304} {
+		rows := &memRows{
+			cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+			rows: [][]interface{}{{int64(1)}, {int64(2)}},
+		}
+		w := httptest.NewRecorder()
+		pw := NewPaginatedWriter(w, rows, 1, 1)
+		pw.SkipRows = true
+		pw.LinkURL = "/widgets?page={page}"
+		pw.ETag = true
+		pw.IfNoneMatch = etag
+		err := pw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the hash is of the whole envelope
+		etag = w.Header().Get("ETag")
+		if w.Code != wantCode || etag == "" || (i == 0) != strings.Contains(w.Body.String(), `"hasMore":true`) {
+			t.Errorf("unexpected response %d %q: %s", w.Code, etag, w.Body.String())
+		}
+	}
+}
+
+func TestPaginatedWriterCursorTypes(t *testing.T) {
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.FixedZone("", 3600))
+	rows := &memRows{
+		cols: []memColumn{
+			{"u", "BIGINT UNSIGNED", reflect.TypeOf(uint64(0))},
+			{"n", "BIGINT", reflect.TypeOf(sql.NullInt64{})},
+			{"t", "DATETIME", reflect.TypeOf(sql.NullTime{})},
+			{"f", "DOUBLE", reflect.TypeOf(float64(0))},
+			{"s", "VARCHAR", reflect.TypeOf("")},
+		},
+		rows: [][]interface{}{
+			{uint64(18446744073709551615), nil, ts, 0.1, "a:b"},
+			{uint64(1), int64(2), nil, 0.2, ""},
+		},
+	}
+	var buf bytes.Buffer
+	pw := NewPaginatedWriter(&buf, rows, 1, 1)
+	pw.CursorColumns = []string{"u", "n", "t", "f", "s"}
+	err := pw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values come back as they were scanned, including the NULL
+	keys, err := DecodeCursor(pw.NextCursor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{uint64(18446744073709551615), nil, ts, 0.1, "a:b"}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != nil || !keys[2].(time.Time).Equal(ts) || keys[3] != want[3] || keys[4] != want[4] {
+		t.Errorf("unexpected keys: %#v", keys)
+	}
+
+	for _, cursor := range []string{"WyJ4OjEiXQ", "WzFd", "bm90IGpzb24"} { // ["x:1"], [1], not json
+		if _, err := DecodeCursor(cursor); err == nil || !strings.Contains(err.Error(), "invalid cursor") {
+			t.Errorf("%s: expected an invalid cursor error, got %v", cursor, err)
+		}
+	}
+}
+
+func TestCursorWhere(t *testing.T) {
+
+	for _, tc := range []struct {
+		d      Dialect
+		cursor string
+		where  string
+		args   []interface{}
+	}{
+		{DialectMySQL, `["s:x",null]`, "(`a` > ? OR (`a` = ? AND `b` IS NOT NULL))", []interface{}{"x", "x"}},
+		{DialectMySQL, `[null,"i:2"]`, "(`a` IS NOT NULL OR (`a` IS NULL AND `b` > ?))", []interface{}{int64(2)}},
+		{DialectPostgres, `["s:x","i:2"]`, `(("a" > $1 OR "a" IS NULL) OR ("a" = $2 AND ("b" > $3 OR "b" IS NULL)))`, []interface{}{"x", "x", int64(2)}},
+		{DialectPostgres, `[null,"i:2"]`, `(("a" IS NULL AND ("b" > $1 OR "b" IS NULL)))`, []interface{}{int64(2)}},
+		{DialectPostgres, `[null,null]`, "1=0", nil},
+	} {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(tc.cursor))
+		where, args, err := CursorWhere(tc.d, []string{"a", "b"}, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if where != tc.where || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: unexpected condition %s %#v", tc.cursor, where, args)
+		}
+	}
+}
+
+func TestPaginateQuery(t *testing.T) {
+
+	for _, tc := range []struct {
+		d     Dialect
+		query string
+		want  string // or the error
+	}{
+		{DialectMySQL, "SELECT * FROM widgets ORDER BY widget_id", "SELECT * FROM widgets ORDER BY widget_id LIMIT 11 OFFSET 20"},
+		{DialectMySQL, "SELECT * FROM widgets ORDER BY widget_id;\n", "SELECT * FROM widgets ORDER BY widget_id LIMIT 11 OFFSET 20"},
+		{DialectPostgres, "SELECT * FROM widgets", "SELECT * FROM widgets LIMIT 11 OFFSET 20"},
+		{DialectSQLServer, "SELECT * FROM widgets ORDER BY widget_id", "SELECT * FROM widgets ORDER BY widget_id OFFSET 20 ROWS FETCH NEXT 11 ROWS ONLY"},
+		{DialectSQLServer, "SELECT * FROM widgets", "must have an ORDER BY"},
+		{DialectSQLServer, "SELECT *, ROW_NUMBER() OVER (ORDER BY name) AS n FROM widgets", "must have an ORDER BY"},
+		{DialectSQLServer, "SELECT 'order by' AS s FROM [order by] -- ORDER BY x", "must have an ORDER BY"},
+		{DialectMySQL, "SELECT * FROM widgets LIMIT 5", "already has LIMIT"},
+		{DialectMySQL, "SELECT * FROM (SELECT * FROM widgets LIMIT 5) w WHERE name <> 'it''s \\' limit' /* OFFSET */", "SELECT * FROM (SELECT * FROM widgets LIMIT 5) w WHERE name <> 'it''s \\' limit' /* OFFSET */ LIMIT 11 OFFSET 20"},
+		{DialectPostgres, "SELECT $$ LIMIT $$, '\\' AS s FROM widgets WHERE id = $1", "SELECT $$ LIMIT $$, '\\' AS s FROM widgets WHERE id = $1 LIMIT 11 OFFSET 20"},
+		{DialectSQLServer, "SELECT * FROM widgets ORDER BY widget_id OFFSET 0 ROWS", "already has OFFSET"},
+	} {
+		got, err := PaginateQuery(tc.d, tc.query, 3, 10)
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.Contains(got, tc.want) || (err == nil && got != tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/netip"
+	"reflect"
+)
+
+// PgxRows is the part of pgx.Rows (github.com/jackc/pgx/v5) used by PgxRowsAdapter, so this
+// package does not depend on pgx.
+type PgxRows interface {
+	Next() bool
+	Values() ([]interface{}, error)
+	Err() error
+	Close()
+}
+
+// PgxField describes a column of a PgxRows, from the pgconn.FieldDescription of the same name.
+type PgxField struct {
+	Name        string
+	DataTypeOID uint32
+}
+
+// PgxRowsAdapter is a RowsLike for the rows of a pgx query made without database/sql, e.g.
+//
+//	rows, err := conn.Query(ctx, "SELECT widget_id, price FROM widgets")
+//	//...
+//	var fields []sqljsonutil.PgxField
+//	for _, fd := range rows.FieldDescriptions() {
+//		fields = append(fields, sqljsonutil.PgxField{Name: fd.Name, DataTypeOID: fd.DataTypeOID})
+//	}
+//	err = sqljsonutil.NewRowsWriter(w, sqljsonutil.NewPgxRowsAdapter(rows, fields)).WriteResponse()
+//
+// The values are read with Values, and pgtype values are converted with their Value method
+// (pgtype.Numeric to its exact text, pgtype.Interval to its text, pgtype.Timestamptz to a
+// time.Time, etc.), UUIDs to strings, INET host addresses (a netip.Prefix) to the address
+// without a prefix length, and arrays to JSON arrays.  Columns get the database type names
+// database/sql reports for pgx (e.g. "NUMERIC", "UUID", "JSONB", "_INT4"), so the options based
+// on them like DecimalAsNumber and SetTypeFormatter apply.  DecimalAsNumber applies to NUMERIC
+// columns, the elements of NUMERIC arrays are written as strings.
+//
+// Boolean, integer, float, text and BYTEA columns have a ScanType, so they are scanned like
+// those of *sql.Rows.  Postgres does not report whether the columns of a result can be NULL,
+// so they are all reported as nullable.
+type PgxRowsAdapter struct {
+	rows   PgxRows
+	fields []PgxField
+	values []interface{}
+	err    error
+}
+
+// NewPgxRowsAdapter returns a PgxRowsAdapter for rows with the columns fields.
+func NewPgxRowsAdapter(rows PgxRows, fields []PgxField) *PgxRowsAdapter {
+	return &PgxRowsAdapter{rows: rows, fields: fields}
+}
+
+func (a *PgxRowsAdapter) Columns() ([]string, error) {
+	names := make([]string, len(a.fields))
+	for i, f := range a.fields {
+		names[i] = f.Name
+	}
+	return names, nil
+}
+
+// ColumnTypes returns nil, see ColumnTypeInfo.
+func (a *PgxRowsAdapter) ColumnTypes() ([]*sql.ColumnType, error) {
+	return nil, nil
+}
+
+func (a *PgxRowsAdapter) ColumnTypeInfo() ([]ColumnType, error) {
+	cts := make([]ColumnType, len(a.fields))
+	for i, f := range a.fields {
+		cts[i] = pgxColumnType{name: f.Name, typeName: pgTypeNames[f.DataTypeOID], scanType: pgScanTypes[f.DataTypeOID]}
+	}
+	return cts, nil
+}
+
+func (a *PgxRowsAdapter) Next() bool {
+	if a.err != nil || !a.rows.Next() {
+		return false
+	}
+	a.values, a.err = a.rows.Values()
+	return a.err == nil
+}
+
+// Scan sets dest, which must be *interface{} or sql.Scanner values, to the current row.
+func (a *PgxRowsAdapter) Scan(dest ...interface{}) error {
+
+	if len(dest) != len(a.values) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(a.values), len(dest))
+	}
+	for i, v := range a.values {
+		v, err := pgxValue(v, a.fields[i].DataTypeOID == pgInetOID || a.fields[i].DataTypeOID == pgInetArrayOID)
+		if err != nil {
+			return fmt.Errorf("converting column %q: %w", a.fields[i].Name, err)
+		}
+		switch d := dest[i].(type) {
+		case *interface{}:
+			*d = v
+		case sql.Scanner:
+			err = d.Scan(v)
+		default:
+			err = fmt.Errorf("unsupported scan arg %T", dest[i])
+		}
+		if err != nil {
+			return fmt.Errorf("scanning column %q: %w", a.fields[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (a *PgxRowsAdapter) Err() error {
+	if a.err != nil {
+		return a.err
+	}
+	return a.rows.Err()
+}
+
+func (a *PgxRowsAdapter) NextResultSet() bool {
+	return false
+}
+
+func (a *PgxRowsAdapter) Close() error {
+	a.rows.Close()
+	return nil
+}
+
+// pgxValue converts a value returned by pgx.Rows.Values to one RowsWriter writes: driver.Valuers
+// (the pgtype types) to their Value, UUIDs ([16]byte) to strings and the elements of arrays.
+// If inet is true, a netip.Prefix of a single address (an INET host) is converted to the address.
+func pgxValue(v interface{}, inet bool) (interface{}, error) {
+
+	switch vt := v.(type) {
+	case nil, string, int64, float64, bool, []byte:
+		return v, nil
+	case [16]byte:
+		return string(appendUUID(make([]byte, 0, 36), vt)), nil
+	case netip.Prefix:
+		if inet && vt.IsSingleIP() {
+			return vt.Addr(), nil
+		}
+		return vt, nil
+	case []interface{}:
+		out := make([]interface{}, len(vt))
+		for i, e := range vt {
+			var err error
+			out[i], err = pgxValue(e, inet)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case driver.Valuer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, nil
+		}
+		val, err := vt.Value()
+		if err != nil {
+			return nil, err
+		}
+		return pgxValue(val, inet)
+	}
+	return v, nil
+}
+
+// pgxColumnType is the ColumnType of a PgxField.  ScanType is nil for the types not in
+// pgScanTypes, whose values are scanned as they are converted by pgxValue.
+type pgxColumnType struct {
+	name     string
+	typeName string
+	scanType reflect.Type
+}
+
+func (ct pgxColumnType) Name() string                                   { return ct.name }
+func (ct pgxColumnType) DatabaseTypeName() string                       { return ct.typeName }
+func (ct pgxColumnType) ScanType() reflect.Type                         { return ct.scanType }
+func (ct pgxColumnType) Nullable() (nullable, ok bool)                  { return true, true }
+func (ct pgxColumnType) Length() (length int64, ok bool)                { return 0, false }
+func (ct pgxColumnType) DecimalSize() (precision, scale int64, ok bool) { return 0, 0, false }
+
+const (
+	pgInetOID      = 869
+	pgInetArrayOID = 1041
+)
+
+// pgScanTypes are the scan types of the PostgreSQL types by OID whose values pgx always
+// returns as the same Go type.  Others, like dates (which may be infinity), are scanned into
+// an *interface{}.
+var pgScanTypes = map[uint32]reflect.Type{
+	16:   reflect.TypeOf(false),
+	17:   reflect.TypeOf(sql.Null[[]byte]{}),
+	20:   reflect.TypeOf(int64(0)),
+	21:   reflect.TypeOf(int16(0)),
+	23:   reflect.TypeOf(int32(0)),
+	25:   reflect.TypeOf(""),
+	700:  reflect.TypeOf(float32(0)),
+	701:  reflect.TypeOf(float64(0)),
+	1042: reflect.TypeOf(""),
+	1043: reflect.TypeOf(""),
+}
+
+// pgTypeNames are the names of the built in PostgreSQL types by OID, as database/sql reports
+// them for pgx.  Types with OIDs that vary between databases, like hstore, are not included.
+var pgTypeNames = map[uint32]string{
+	16:   "BOOL",
+	17:   "BYTEA",
+	20:   "INT8",
+	21:   "INT2",
+	23:   "INT4",
+	25:   "TEXT",
+	114:  "JSON",
+	199:  "_JSON",
+	650:  "CIDR",
+	700:  "FLOAT4",
+	701:  "FLOAT8",
+	829:  "MACADDR",
+	869:  "INET",
+	1041: "_INET",
+	1000: "_BOOL",
+	1001: "_BYTEA",
+	1005: "_INT2",
+	1007: "_INT4",
+	1009: "_TEXT",
+	1015: "_VARCHAR",
+	1016: "_INT8",
+	1021: "_FLOAT4",
+	1022: "_FLOAT8",
+	1042: "BPCHAR",
+	1043: "VARCHAR",
+	1082: "DATE",
+	1083: "TIME",
+	1114: "TIMESTAMP",
+	1115: "_TIMESTAMP",
+	1182: "_DATE",
+	1184: "TIMESTAMPTZ",
+	1185: "_TIMESTAMPTZ",
+	1186: "INTERVAL",
+	1231: "_NUMERIC",
+	1700: "NUMERIC",
+	2950: "UUID",
+	2951: "_UUID",
+	3802: "JSONB",
+	3807: "_JSONB",
+}
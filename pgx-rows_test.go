@@ -0,0 +1,94 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPgxRowsAdapter(t *testing.T) {
+
+	id := [16]byte{0x12, 0x34, 0x56, 0x78, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	rows := &testPgxRows{rows: [][]interface{}{
+		{id, testNumeric("1234.5000"), []interface{}{int32(1), nil, int32(3)}, map[string]interface{}{"a": "b"}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{nil, nil, nil, nil, nil},
+	}}
+	fields := []PgxField{{"widget_id", 2950}, {"price", 1700}, {"counts", 1007}, {"data", 3802}, {"created_at", 1184}}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, NewPgxRowsAdapter(rows, fields))
+	rw.DecimalAsNumber = true
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+{"widget_id":"12345678-0102-0304-0506-0708090a0b0c","price":1234.5000,"counts":[1,null,3],"data":{"a":"b"},"created_at":"2024-01-02T03:04:05Z"}
+,{"widget_id":null,"price":null,"counts":null,"data":null,"created_at":null}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestPgxRowsAdapterTypes(t *testing.T) {
+
+	rows := &testPgxRows{rows: [][]interface{}{
+		{int32(7), []byte{1, 2}, testInterval("1 mon 2 day 03:04:05"), netip.MustParsePrefix("192.168.0.1/32"),
+			netip.MustParsePrefix("10.0.0.0/8"), testNumeric("NaN"), []interface{}{testNumeric("1.50"), nil, testNumeric("Infinity")}},
+		{nil, nil, nil, nil, nil, testNumeric("-Infinity"), []interface{}{}},
+	}}
+	fields := []PgxField{{"qty", 23}, {"bin", 17}, {"wait", 1186}, {"host", 869}, {"net", 650}, {"price", 1700}, {"prices", 1231}}
+
+	cts, err := NewPgxRowsAdapter(rows, fields).ColumnTypeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := cts[0].ScanType(); st != reflect.TypeOf(int32(0)) {
+		t.Errorf("unexpected INT4 scan type %v", st)
+	}
+	if nullable, ok := cts[0].Nullable(); !nullable || !ok {
+		t.Errorf("expected columns to be nullable, got %v, %v", nullable, ok)
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, NewPgxRowsAdapter(rows, fields))
+	rw.DecimalAsNumber = true
+	err = rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+{"qty":7,"bin":"\u0001\u0002","wait":"1 mon 2 day 03:04:05","host":"192.168.0.1","net":"10.0.0.0/8","price":"NaN","prices":["1.50",null,"Infinity"]}
+,{"qty":null,"bin":null,"wait":null,"host":null,"net":null,"price":"-Infinity","prices":[]}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+// testPgxRows is an in-memory PgxRows.
+type testPgxRows struct {
+	rows [][]interface{}
+	next int
+}
+
+func (r *testPgxRows) Next() bool                     { r.next++; return r.next <= len(r.rows) }
+func (r *testPgxRows) Values() ([]interface{}, error) { return r.rows[r.next-1], nil }
+func (r *testPgxRows) Err() error                     { return nil }
+func (r *testPgxRows) Close()                         {}
+
+// testNumeric implements driver.Valuer like pgtype.Numeric
+type testNumeric string
+
+func (n testNumeric) Value() (driver.Value, error) { return string(n), nil }
+
+// testInterval implements driver.Valuer like pgtype.Interval
+type testInterval string
+
+func (i testInterval) Value() (driver.Value, error) { return string(i), nil }
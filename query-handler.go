@@ -0,0 +1,143 @@
+package sqljsonutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Option configures a RowsWriter, see NewRowsWriterOpts and the With... functions.
+// It is also how QueryHandler, RowsToJSON, etc. configure the RowsWriter they use.
+type Option func(rw *RowsWriter)
+
+// QueryHandler returns an http.Handler that runs query for each request and writes the
+// result with WriteResponse, making a read-only JSON endpoint out of a SQL statement.
+//
+// The query may contain named parameters like :widget_id, which are bound from the request:
+// the path value of that name if the handler is registered with a matching http.ServeMux
+// pattern (e.g. "GET /widgets/{widget_id}"), otherwise the URL query parameter.  The query
+// is sent to the database with ? placeholders, as used by MySQL and SQLite.  A request that
+// is missing a parameter gets a 400 response.
+//
+// Errors running the query are mapped to a status code (504 for timeouts, 503 for connection
+// errors, 500 otherwise) and written as {"error":"..."} with the status text, the error itself
+// is not sent to the client.  Errors after the response has started cannot change the status,
+// so unless an Option sets Atomic (or ETag without ETagVersion, which buffers the same way)
+// the response is aborted by panicking with http.ErrAbortHandler, so the client sees an
+// incomplete response rather than a truncated one that looks complete.
+// If an Option sets ErrorPolicy to ErrorRecord or sets ErrorTrailer the error is reported that
+// way instead and the response is completed.
+func QueryHandler(db *sql.DB, query string, opts ...Option) http.Handler {
+
+	q, params := parseNamedParams(query)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		args := make([]interface{}, 0, len(params))
+		for _, p := range params {
+			v := r.PathValue(p)
+			if v == "" {
+				if vals, ok := r.URL.Query()[p]; ok && len(vals) > 0 {
+					v = vals[0]
+				} else {
+					writeHandlerError(w, http.StatusBadRequest, fmt.Sprintf("missing parameter %q", p))
+					return
+				}
+			}
+			args = append(args, v)
+		}
+
+		rows, err := db.QueryContext(r.Context(), q, args...)
+		if err != nil {
+			code := queryErrorStatus(err)
+			writeHandlerError(w, code, http.StatusText(code))
+			return
+		}
+		defer rows.Close()
+
+		rw := NewRowsWriter(w, rows)
+		rw.IfNoneMatch = r.Header.Get("If-None-Match")      // only used if an Option sets ETag or ETagVersion
+		rw.AcceptEncoding = r.Header.Get("Accept-Encoding") // only used if an Option sets Compress
+		for _, opt := range opts {
+			opt(rw)
+		}
+		err = rw.WriteResponseContext(r.Context())
+		switch {
+		case err == nil || err == ErrMaxBytes:
+		case rw.Atomic || rw.etagBuffered():
+			// nothing has been written yet, so there can still be an error response
+			code := queryErrorStatus(err)
+			writeHandlerError(w, code, http.StatusText(code))
+		case rw.ErrorPolicy != ErrorRecord && rw.ErrorTrailer == "":
+			// the status has already been sent, so the response can only be cut off
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// parseNamedParams replaces the :name parameters in query with ? and returns the names in order.
+// Parameters are not recognized inside quoted strings or identifiers or comments (see
+// Dialect.skipSQL), and :: (a PostgreSQL cast) is left as-is.
+func parseNamedParams(query string) (string, []string) {
+
+	var sb strings.Builder
+	var params []string
+
+	for i := 0; i < len(query); {
+		if j := DialectMySQL.skipSQL(query, i); j > i {
+			sb.WriteString(query[i:j])
+			i = j
+			continue
+		}
+
+		c := query[i]
+		switch {
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			sb.WriteString("::")
+			i += 2
+			continue
+		case c == ':' && i+1 < len(query) && isParamNameByte(query[i+1], true):
+			j := i + 1
+			for j < len(query) && isParamNameByte(query[j], false) {
+				j++
+			}
+			params = append(params, query[i+1:j])
+			sb.WriteByte('?')
+			i = j
+			continue
+		}
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String(), params
+}
+
+func isParamNameByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// queryErrorStatus returns the HTTP status code for an error returned running a query.
+func queryErrorStatus(err error) int {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeout) && timeout.Timeout():
+		return http.StatusGatewayTimeout
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeHandlerError writes a JSON error response.
+func writeHandlerError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,106 @@
+package sqljsonutil
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryHandler(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /widgets/{widget_id}", QueryHandler(db, "SELECT * FROM widgets WHERE widget_id = :widget_id"))
+	mux.Handle("GET /widgets", QueryHandler(db, "SELECT * FROM widgets WHERE name LIKE :name ORDER BY widget_id"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets/def456", nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"name":"Next One"`) || strings.Contains(rec.Body.String(), "abc123") {
+		t.Errorf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	t.Logf("RESPONSE: %s", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets?name=First%25", nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"name":"First One"`) {
+		t.Errorf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/widgets", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing parameter, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	QueryHandler(db, "SELECT * FROM widgets", func(rw *RowsWriter) { rw.ColumnTables = []string{"widgets", "widgets"} },
+		AsDownload("{table}.json")).ServeHTTP(rec, httptest.NewRequest("GET", "/widgets", nil))
+	if cd := rec.Header().Get("Content-Disposition"); cd != "attachment; filename=widgets.json" {
+		t.Errorf("unexpected Content-Disposition: %s", cd)
+	}
+}
+
+func TestParseNamedParams(t *testing.T) {
+
+	for _, tc := range []struct {
+		query, want string
+		params      []string
+	}{
+		{"SELECT * FROM t WHERE a = :a AND b = :b_2", "SELECT * FROM t WHERE a = ? AND b = ?", []string{"a", "b_2"}},
+		{"SELECT ':x', \"a:x\", `b:x` FROM t WHERE a = :a", "SELECT ':x', \"a:x\", `b:x` FROM t WHERE a = ?", []string{"a"}},
+		{"SELECT a::text FROM t WHERE b = :b", "SELECT a::text FROM t WHERE b = ?", []string{"b"}},
+		{"SELECT a -- :x\nFROM t /* :y */ WHERE b = :b # :z", "SELECT a -- :x\nFROM t /* :y */ WHERE b = ? # :z", []string{"b"}},
+		{"SELECT 'it\\'s :x' FROM t", "SELECT 'it\\'s :x' FROM t", nil},
+	} {
+		got, params := parseNamedParams(tc.query)
+		if got != tc.want || !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("parseNamedParams(%q) = %q, %q, want %q, %q", tc.query, got, params, tc.want, tc.params)
+		}
+	}
+}
+
+func TestQueryHandlerAbort(t *testing.T) {
+
+	db := testDB(t, &testDriverResult{
+		cols: []testDriverColumn{{name: "id", dbType: "BIGINT", scanType: reflect.TypeOf(int64(0))}},
+		rows: [][]driver.Value{{int64(1)}, {int64(2)}},
+		err:  errors.New("connection lost"),
+	})
+
+	serve := func(opts ...Option) (rec *httptest.ResponseRecorder, recovered interface{}) {
+		rec = httptest.NewRecorder()
+		defer func() { recovered = recover() }()
+		QueryHandler(db, "SELECT id FROM t", opts...).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec, nil
+	}
+
+	// the error comes after the response has started, so it is aborted
+	rec, recovered := serve()
+	if recovered != http.ErrAbortHandler {
+		t.Errorf("expected panic with http.ErrAbortHandler, got %v: %s", recovered, rec.Body.String())
+	}
+
+	// unless it can be replaced with an error response
+	rec, recovered = serve(func(rw *RowsWriter) { rw.Atomic = true })
+	if recovered != nil || rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 with Atomic, got %v, %d: %s", recovered, rec.Code, rec.Body.String())
+	}
+
+	// which ETag also buffers for
+	rec, recovered = serve(func(rw *RowsWriter) { rw.ETag = true })
+	if recovered != nil || rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 with ETag, got %v, %d: %s", recovered, rec.Code, rec.Body.String())
+	}
+
+	// or is recorded in the response
+	rec, recovered = serve(func(rw *RowsWriter) { rw.ErrorPolicy = ErrorRecord })
+	if recovered != nil || rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with ErrorRecord, got %v, %d: %s", recovered, rec.Code, rec.Body.String())
+	}
+}
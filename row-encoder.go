@@ -0,0 +1,320 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// RowEncoder encodes rows in an output format other than JSON, see RowsWriter.WriteEncoded.
+//
+// Values are given to the encoder typed, as they were scanned, so formats with types JSON
+// lacks (binary data, timestamps, etc.) can use them.  Each value is one of:
+//
+//   - nil for NULL
+//   - bool, int64, uint64, float64, string or time.Time
+//   - []byte for binary columns (see BinaryColumns), only valid until EncodeRow returns
+//   - [16]byte for UUID columns (see UUIDColumns)
+//   - json.Number for DECIMAL columns with DecimalAsNumber, otherwise they are strings
+//   - json.RawMessage for values whose JSON is made by an option (masks, JSONValueFunc, the
+//     formatters, NullDefault, ValueMaps, FloatPrecision, truncation, Int64AsString, GeoJSON,
+//     RawJSONColumns, etc.), for ExtraFieldsFunc fields and for other driver types
+//
+// So the RowsWriter options apply the same way regardless of the output format.  Nested
+// objects (NestSeparator) are not applied, keys are the full column keys.  RowIndexField is
+// an int64.
+type RowEncoder interface {
+	// ContentType returns the MIME type of the encoded output.
+	ContentType() string
+
+	// Begin appends anything that must be written before the first row to dst.
+	Begin(dst []byte) ([]byte, error)
+
+	// EncodeRow appends the encoding of one row to dst.  keys and values have the same length.
+	EncodeRow(dst []byte, keys []string, values []interface{}) ([]byte, error)
+
+	// End appends anything that must be written after the last row to dst.
+	End(dst []byte) ([]byte, error)
+}
+
+// WriteEncoded writes all rows using enc instead of JSON.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to enc.ContentType().
+func (rw *RowsWriter) WriteEncoded(enc RowEncoder) error {
+
+	if ok, err := rw.withOutput(false, func() error { return rw.WriteEncoded(enc) }); ok {
+		return err
+	}
+
+	if w, ok := rw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", enc.ContentType())
+		}
+	}
+
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := enc.Begin(rw.valOutBytes[:0])
+	if err != nil {
+		return err
+	}
+	_, err = rw.Writer.Write(out)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	var values []interface{}
+	var raws []rawValue
+
+	for rw.nextRow() {
+
+		err := rw.scanRowArgs(false)
+		if err != nil {
+			return err
+		}
+
+		// typed values go in values, JSON values are written into rowOutBuf and sliced up after
+		keys, values, raws = keys[:0], values[:0], raws[:0]
+		for _, op := range rw.fieldPlan {
+			if op.col < 0 {
+				continue
+			}
+			custom, skip, err := rw.customColumnValue(op.col)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue
+			}
+			keys = append(keys, rw.colKeys[op.col])
+			if custom == nil {
+				if v, ok := rw.encodedValue(op.col); ok {
+					values = append(values, v)
+					continue
+				}
+			}
+			start := rw.rowOutBuf.Len()
+			if custom != nil {
+				rw.rowOutBuf.Write(custom)
+			} else {
+				err = rw.writeColumnValue(op.col)
+				if err != nil {
+					return err
+				}
+			}
+			raws = append(raws, rawValue{len(values), start, rw.rowOutBuf.Len()})
+			values = append(values, nil)
+		}
+
+		if rw.RowIndexField != "" {
+			keys = append(keys, rw.RowIndexField)
+			values = append(values, int64(rw.rowCount-1)+rw.RowIndexOffset)
+		}
+
+		if rw.ExtraFieldsFunc != nil {
+			extraKeys, extra, err := rw.extraFields()
+			if err != nil {
+				return err
+			}
+			for _, k := range extraKeys {
+				keys = append(keys, k)
+				if len(extra[k]) == 0 {
+					values = append(values, nil)
+				} else {
+					values = append(values, extra[k])
+				}
+			}
+		}
+
+		b := rw.rowOutBuf.Bytes()
+		for _, r := range raws {
+			values[r.i] = json.RawMessage(b[r.start:r.end])
+		}
+
+		out, err = enc.EncodeRow(out[:0], keys, values)
+		if err != nil {
+			return err
+		}
+		_, err = rw.Writer.Write(out)
+		if err != nil {
+			return err
+		}
+		rw.rowOutBuf.Reset()
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+	rw.rowOutBuf.Reset()
+
+	out, err = enc.End(out[:0])
+	if err != nil {
+		return err
+	}
+	_, err = rw.Writer.Write(out)
+	rw.valOutBytes = out[:0]
+	return err
+}
+
+// rawValue is a value of a row for a RowEncoder that was written as JSON to rowOutBuf.
+type rawValue struct {
+	i          int // index in the values
+	start, end int // offsets in rowOutBuf
+}
+
+// encodedValue returns the typed value of column i for a RowEncoder, see RowEncoder.  If false
+// is returned the value should be the JSON written for it, as the options that apply to the
+// column make its JSON or the value is not one of the types.
+func (rw *RowsWriter) encodedValue(i int) (interface{}, bool) {
+
+	name := rw.colNames[i]
+	if rw.colGeo[i] != 0 || rw.colHstore[i] || rw.colNested[i] || rw.colRawJSON[i] {
+		return nil, false
+	}
+	if _, ok := rw.ValueMaps[name]; ok {
+		return nil, false
+	}
+	if _, ok := rw.FloatPrecision[name]; ok {
+		return nil, false
+	}
+
+	arg := rw.scanArgs[i]
+	if isNullValue(arg) {
+		return nil, true
+	}
+	val := scanValue(arg)
+
+	switch {
+	case rw.colUUID[i] != 0:
+		if u, ok := uuidValue(arg, rw.colUUID[i] == 2); ok {
+			return u, true
+		}
+	case rw.colBool[i]:
+		b, ok := boolValue(val)
+		return b, ok
+	case rw.colBinary[i]:
+		switch vt := val.(type) {
+		case []byte:
+			return vt, true
+		case sql.RawBytes:
+			return []byte(vt), true
+		case string:
+			return []byte(vt), true
+		}
+		return nil, false
+	case rw.colDecimal[i]:
+		s := scanText(arg)
+		if rw.DecimalAsNumber && isJSONNumber(s) {
+			return json.Number(s), true
+		}
+		return s, true
+	}
+
+	if rw.Int64AsString || containsString(rw.Int64AsStringColumns, name) || rw.maxStringLength(name) > 0 {
+		return nil, false
+	}
+
+	switch vt := val.(type) {
+	case bool, string, time.Time:
+		return vt, true
+	case []byte:
+		return unsafeString(vt), true // a text column, only used until EncodeRow returns
+	case sql.RawBytes:
+		return unsafeString(vt), true
+	}
+	rv := reflect.ValueOf(val)
+	switch {
+	case rv.CanInt():
+		return rv.Int(), true
+	case rv.CanUint():
+		return rv.Uint(), true
+	case rv.CanFloat():
+		return rv.Float(), true
+	}
+	return nil, false
+}
+
+// decodeJSONValue converts a JSON value as given to a RowEncoder into a Go value:
+// nil, bool, int64, uint64, float64, string, []interface{} or map[string]interface{}
+// (with keys in an unspecified order).  Integers that fit in an int64 or uint64 are returned
+// as such, other numbers as float64.
+func decodeJSONValue(b []byte) (interface{}, error) {
+
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty JSON value")
+	}
+
+	switch b[0] {
+	case 'n':
+		return nil, nil
+	case 't':
+		return true, nil
+	case 'f':
+		return false, nil
+	case '"':
+		if bytes.IndexByte(b, '\\') < 0 && len(b) >= 2 {
+			return string(b[1 : len(b)-1]), nil
+		}
+		var s string
+		err := json.Unmarshal(b, &s)
+		return s, err
+	case '{', '[':
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var v interface{}
+		err := dec.Decode(&v)
+		if err != nil {
+			return nil, err
+		}
+		return convertJSONNumbers(v)
+	}
+
+	return parseJSONNumber(string(b))
+}
+
+// parseJSONNumber converts a JSON number to int64, uint64 or float64.
+func parseJSONNumber(s string) (interface{}, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// convertJSONNumbers replaces json.Number values in v (as decoded with UseNumber) using parseJSONNumber.
+func convertJSONNumbers(v interface{}) (interface{}, error) {
+	switch vt := v.(type) {
+	case json.Number:
+		return parseJSONNumber(string(vt))
+	case []interface{}:
+		for i := range vt {
+			c, err := convertJSONNumbers(vt[i])
+			if err != nil {
+				return nil, err
+			}
+			vt[i] = c
+		}
+	case map[string]interface{}:
+		for k := range vt {
+			c, err := convertJSONNumbers(vt[k])
+			if err != nil {
+				return nil, err
+			}
+			vt[k] = c
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,199 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// WriteRowsAs scans each row into a struct of type T and writes the rows as a JSON array of
+// the marshaled structs, the same shape as WriteResponse.  This is for when the schema is known
+// and the output should follow the struct (its json tags, omitempty, MarshalJSON methods, etc.)
+// rather than the result set.
+//
+// Columns are matched to exported fields by the name in the field's json tag (or the field name
+// if there is no tag name), preferring an exact match but otherwise case-insensitive.  Fields
+// tagged "-" and embedded pointers are not matched and columns with no matching field are
+// ignored.  Fields must be types rows.Scan can set, e.g. sql.NullString or *string for nullable
+// columns.
+//
+// opts are applied to the RowsWriter used, the same as with QueryHandler.  Context, MaxRows,
+// MaxBytes, Indent, flushing, progress and RowFilterFunc apply; the column and value options
+// do not.  Masks (MaskRules and DefaultMaskRules) do apply: the fields of masked columns must
+// be a string, *string or sql.NullString and are set to the masked text, otherwise an error is
+// returned.
+func WriteRowsAs[T any](w io.Writer, rows RowsLike, opts ...Option) error {
+
+	rw := NewRowsWriterOpts(w, rows, opts...)
+
+	rw.setJSONContentType()
+
+	io.WriteString(w, "[\n")
+
+	err := writeCommaRowsAs[T](rw)
+	if err != nil && err != ErrMaxBytes {
+		return err
+	}
+
+	io.WriteString(w, "]\n")
+
+	return err
+}
+
+// writeCommaRowsAs is the WriteCommaRows loop for WriteRowsAs.
+func writeCommaRowsAs[T any](rw *RowsWriter) error {
+
+	var v T
+	rv := reflect.ValueOf(&v).Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("WriteRowsAs: %T is not a struct", v)
+	}
+
+	colNames, err := rw.Rows.Columns()
+	if err != nil {
+		return err
+	}
+	dest := structScanArgs(rv, colNames)
+
+	err = rw.setupMasks()
+	if err != nil {
+		return err
+	}
+	masks := make([]*MaskRule, len(colNames))
+	for i, name := range colNames {
+		if _, discarded := dest[i].(*interface{}); discarded {
+			continue
+		}
+		masks[i] = rw.maskRule(name)
+		if masks[i] == nil {
+			continue
+		}
+		switch dest[i].(type) {
+		case *string, **string, *sql.NullString:
+		default:
+			return fmt.Errorf("WriteRowsAs: column %q is masked but its field is a %T", name, dest[i])
+		}
+	}
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	for rw.nextRow() {
+
+		err := rw.Rows.Scan(dest...)
+		if err != nil {
+			return err
+		}
+		rw.prescanned = false
+		rw.rowCount++
+		rw.totalRows++
+
+		for i, rule := range masks {
+			if rule != nil {
+				maskField(dest[i], rule)
+			}
+		}
+
+		b, err := json.Marshal(&v)
+		if err != nil {
+			return err
+		}
+
+		rw.rowOutBuf.Reset()
+		if rw.rowCount > 1 {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		rw.rowOutBuf.Write(b)
+		rw.rowOutBuf.WriteByte('\n')
+		if rw.Indent != "" {
+			err := rw.indentRow(true)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = rw.writeOut(&rw.rowOutBuf)
+		if err != nil {
+			return err
+		}
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+
+	// indented comma rows are not newline terminated
+	if rw.Indent != "" && rw.rowCount > 0 {
+		_, err := io.WriteString(rw.Writer, "\n")
+		return err
+	}
+
+	return nil
+}
+
+// structScanArgs returns the rows.Scan arguments that set the fields of the struct rv
+// matching colNames, see WriteRowsAs.
+func structScanArgs(rv reflect.Value, colNames []string) []interface{} {
+
+	exact := make(map[string][]int)  // JSON name -> field index
+	folded := make(map[string][]int) // lower case JSON name -> field index
+	for _, f := range reflect.VisibleFields(rv.Type()) {
+		if !f.IsExported() || (f.Anonymous && f.Type.Kind() == reflect.Struct) || throughPointer(rv.Type(), f.Index) {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		exact[name] = f.Index
+		folded[strings.ToLower(name)] = f.Index
+	}
+
+	dest := make([]interface{}, len(colNames))
+	for i, name := range colNames {
+		index, ok := exact[name]
+		if !ok {
+			index, ok = folded[strings.ToLower(name)]
+		}
+		if !ok {
+			dest[i] = new(interface{}) // discarded
+			continue
+		}
+		dest[i] = rv.FieldByIndex(index).Addr().Interface()
+	}
+
+	return dest
+}
+
+// maskField sets the string field p (a *string, **string or *sql.NullString) to its text masked
+// with rule, unless it is NULL.
+func maskField(p interface{}, rule *MaskRule) {
+	switch pt := p.(type) {
+	case *string:
+		*pt = maskText(*pt, rule)
+	case **string:
+		if *pt != nil {
+			s := maskText(**pt, rule)
+			*pt = &s
+		}
+	case *sql.NullString:
+		if pt.Valid {
+			pt.String = maskText(pt.String, rule)
+		}
+	}
+}
+
+// throughPointer returns true if the field at index is promoted through an embedded pointer.
+func throughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRowsAs(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type widget struct {
+		ID    string `json:"widget_id"`
+		Title string `json:"title"`
+		Name  string `json:"-"`
+	}
+
+	var buf bytes.Buffer
+	err = WriteRowsAs[widget](&buf, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[\n{\"widget_id\":\"abc123\",\"title\":\"\"}\n,{\"widget_id\":\"def456\",\"title\":\"\"}\n]\n" {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+	t.Logf("OUTPUT: %s", buf.String())
+}
+
+func TestWriteRowsAsMasks(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"email", "TEXT", reflect.TypeOf("")},
+			{"api_token", "TEXT", reflect.TypeOf(sql.NullString{})},
+			{"ssn", "TEXT", reflect.TypeOf(sql.NullString{})},
+		},
+		rows: [][]interface{}{{"joe@example.com", "abcdefgh", nil}},
+	}
+
+	type user struct {
+		Email string         `json:"email"`
+		Token *string        `json:"api_token"`
+		SSN   sql.NullString `json:"ssn"`
+	}
+
+	var buf bytes.Buffer
+	err := WriteRowsAs[user](&buf, rows, WithMaskRules(MaskRule{Pattern: "EMAIL", Strategy: MaskPartial}, MaskRule{Pattern: "*_token"}, MaskRule{Pattern: "ssn"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[\n{\"email\":\"j***@example.com\",\"api_token\":\"***\",\"ssn\":{\"String\":\"\",\"Valid\":false}}\n]\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// a masked column can't be set in a field that isn't a string
+	type count struct {
+		N int `json:"n"`
+	}
+	rows = &memRows{cols: []memColumn{{"n", "INT", reflect.TypeOf(0)}}, rows: [][]interface{}{{1}}}
+	err = WriteRowsAs[count](&buf, rows, WithMaskRules(MaskRule{Pattern: "n"}))
+	if err == nil || !strings.Contains(err.Error(), `column "n" is masked`) {
+		t.Errorf("expected a masked column error, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrAtomicLimit is returned when the output buffered for Atomic would exceed AtomicLimit.
+var ErrAtomicLimit = errors.New("sqljsonutil: AtomicLimit exceeded")
+
+// atomicBuffer is the Writer used while buffering for Atomic.
+type atomicBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *atomicBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && int64(b.Len()+len(p)) > b.limit {
+		return 0, ErrAtomicLimit
+	}
+	return b.Buffer.Write(p)
+}
+
+// writeAtomic calls f with Writer replaced by a buffer, and writes the buffer to Writer only if
+// f succeeds (or stops due to MaxBytes, which still completes the output).
+func (rw *RowsWriter) writeAtomic(f func() error) error {
+
+	w := rw.Writer
+	buf := &atomicBuffer{limit: rw.AtomicLimit}
+	rw.Writer = buf
+	err := f()
+	rw.Writer = w
+
+	if err != nil && err != ErrMaxBytes {
+		return err
+	}
+
+	if rw.ValidateOutput {
+		verr := rw.validateJSON(buf.Bytes(), 0, "")
+		if verr != nil {
+			return verr
+		}
+	}
+
+	if rw.etagBuffered() && rw.notModified(buf.Bytes()) {
+		return nil
+	}
+
+	rw.setJSONContentType()
+	_, werr := buf.WriteTo(w)
+	if werr != nil {
+		return werr
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// newBatchWriter returns a batchWriter for Writer if BatchRows or BatchBytes is set, or nil if
+// the rows should be written directly.
+func (rw *RowsWriter) newBatchWriter() *batchWriter {
+
+	if rw.BatchRows <= 0 && rw.BatchBytes <= 0 {
+		return nil
+	}
+	if _, ok := rw.Writer.(*batchWriter); ok { // already batching
+		return nil
+	}
+	return &batchWriter{w: rw.Writer, maxRows: rw.BatchRows, maxBytes: rw.BatchBytes}
+}
+
+// withBatchWriter calls f with Writer set to bw, then writes what is left in the batch and
+// restores Writer.
+func (rw *RowsWriter) withBatchWriter(bw *batchWriter, f func() error) error {
+	prev := rw.Writer
+	rw.Writer = bw
+	err := f()
+	rw.Writer = prev
+	ferr := bw.flush()
+	if err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// batchWriter holds what is written to it until BatchRows rows or BatchBytes bytes have been
+// written, then writes them to w with a single Write.  An error writing to w is returned by
+// every later Write.  It is an http.Flusher so FlushEvery, FlushInterval and Heartbeat still
+// send the rows held so far.
+type batchWriter struct {
+	w        io.Writer
+	buf      bytes.Buffer
+	rows     int // rows in buf, see endRow
+	maxRows  int
+	maxBytes int
+	err      error
+}
+
+func (b *batchWriter) Write(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	b.buf.Write(p)
+	if b.maxBytes > 0 && b.buf.Len() >= b.maxBytes {
+		if err := b.flush(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// endRow is called by writeOut after each row is written, counting it against maxRows.
+func (b *batchWriter) endRow() error {
+	b.rows++
+	if b.maxRows > 0 && b.rows >= b.maxRows {
+		return b.flush()
+	}
+	return b.err
+}
+
+// flush writes the batch to w.
+func (b *batchWriter) flush() error {
+	if b.err == nil && b.buf.Len() > 0 {
+		_, b.err = b.buf.WriteTo(b.w)
+	}
+	b.buf.Reset()
+	b.rows = 0
+	return b.err
+}
+
+// Flush writes the batch and flushes w if it is an http.Flusher.
+func (b *batchWriter) Flush() {
+	if b.flush() != nil {
+		return
+	}
+	if f, ok := b.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,49 @@
+package sqljsonutil
+
+import "bytes"
+
+// defaultRowBufferSize is the initial capacity of the row buffer if RowBufferSize is not set.
+const defaultRowBufferSize = 1024
+
+// rowBufferSize returns the initial capacity of rowOutBuf, see RowBufferSize.
+func (rw *RowsWriter) rowBufferSize() int {
+	if rw.RowBufferSize > 0 {
+		return rw.RowBufferSize
+	}
+	return defaultRowBufferSize
+}
+
+// pooledBufferLimit returns the largest buffer capacity Release keeps.
+func (rw *RowsWriter) pooledBufferLimit() int {
+	if rw.MaxRetainedBuffer > 0 && rw.MaxRetainedBuffer < maxPooledBuffer {
+		return rw.MaxRetainedBuffer
+	}
+	return maxPooledBuffer
+}
+
+// trimBuffers drops the internal buffers that grew beyond MaxRetainedBuffer, after buf was written.
+// buf is usually rowOutBuf, but may belong to an encode worker.
+func (rw *RowsWriter) trimBuffers(buf *bytes.Buffer) {
+
+	max := rw.MaxRetainedBuffer
+	if max <= 0 {
+		return
+	}
+	if buf.Cap() > max {
+		*buf = bytes.Buffer{}
+		if buf == &rw.rowOutBuf {
+			buf.Grow(rw.rowBufferSize())
+		}
+	}
+	for _, b := range [...]*bytes.Buffer{&rw.valOutBuf, &rw.customBuf, &rw.indentBuf, &rw.msgBuf} {
+		if b.Cap() > max {
+			*b = bytes.Buffer{}
+		}
+	}
+	if cap(rw.valOutBytes) > max {
+		rw.valOutBytes = nil
+	}
+	if cap(rw.geoBuf) > max {
+		rw.geoBuf = nil
+	}
+}
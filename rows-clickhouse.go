@@ -0,0 +1,56 @@
+package sqljsonutil
+
+import (
+	"reflect"
+	"strings"
+)
+
+// uint8Array is the scan arg for ClickHouse Array(UInt8) columns, which clickhouse-go scans
+// as a []uint8 that is a list of numbers rather than binary data.
+type uint8Array []uint8
+
+var uint8SliceType = reflect.TypeOf([]uint8(nil))
+
+// clickHouseBaseType returns the ClickHouse type name dbTypeName without any Nullable(...)
+// and LowCardinality(...) wrappers, e.g. "Decimal(18, 4)" for "Nullable(Decimal(18, 4))".
+func clickHouseBaseType(dbTypeName string) string {
+	for {
+		s, ok := strings.CutPrefix(dbTypeName, "Nullable(")
+		if !ok {
+			s, ok = strings.CutPrefix(dbTypeName, "LowCardinality(")
+		}
+		if !ok || !strings.HasSuffix(s, ")") {
+			return dbTypeName
+		}
+		dbTypeName = s[:len(s)-1]
+	}
+}
+
+// isClickHouseDecimal returns true if dbTypeName is a ClickHouse Decimal type such as
+// "Decimal(18, 4)" or "Nullable(Decimal64(4))".  Unlike isDecimalType these are scanned
+// with the driver's scan type, as clickhouse-go can't scan them into a sql.NullString.
+func isClickHouseDecimal(dbTypeName string) bool {
+	return strings.HasPrefix(clickHouseBaseType(dbTypeName), "Decimal")
+}
+
+// isClickHouseNested returns true if dbTypeName is a ClickHouse type that clickhouse-go scans
+// into a pointer, slice or map, see writeNestedValue: Nullable, Array, Map and Tuple types, and
+// the integers of more than 64 bits (scanned as a *big.Int).
+func isClickHouseNested(dbTypeName string) bool {
+	s := strings.TrimPrefix(dbTypeName, "LowCardinality(")
+	for _, prefix := range [...]string{"Nullable(", "Array(", "Map(", "Tuple("} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	switch s {
+	case "Int128", "Int256", "UInt128", "UInt256":
+		return true
+	}
+	return false
+}
+
+// isClickHouseArray returns true if dbTypeName is a ClickHouse Array type.
+func isClickHouseArray(dbTypeName string) bool {
+	return strings.HasPrefix(dbTypeName, "Array(")
+}
@@ -0,0 +1,71 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteClickHouseTypes(t *testing.T) {
+
+	n := int32(2)
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "UInt64", reflect.TypeOf(uint64(0))},
+			{"level", "Nullable(UInt8)", reflect.TypeOf((*uint8)(nil))},
+			{"day", "Date", reflect.TypeOf(time.Time{})},
+			{"tags", "Array(LowCardinality(String))", reflect.TypeOf([]string(nil))},
+			{"codes", "Array(UInt8)", reflect.TypeOf([]uint8(nil))},
+			{"counts", "Array(Nullable(Int32))", reflect.TypeOf([]*int32(nil))},
+			{"price", "Nullable(Decimal(18, 4))", reflect.TypeOf((*testClickHouseDecimal)(nil))},
+			{"totals", "Map(String, UInt64)", reflect.TypeOf(map[string]uint64(nil))},
+		},
+		rows: [][]interface{}{
+			{uint64(18446744073709551615), uint8(3), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+				[]string{"a", "b"}, []uint8{1, 2}, []*int32{&n, nil}, testClickHouseDecimal("12.3400"), map[string]uint64{"x": 1}},
+			{uint64(1), nil, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+				[]string{}, []uint8{}, []*int32{}, nil, map[string]uint64{}},
+		},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.StrictTypes = true
+	rw.DecimalAsNumber = true
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+{"id":18446744073709551615,"level":3,"day":"2024-01-02T00:00:00Z","tags":["a","b"],"codes":[1,2],"counts":[2,null],"price":12.3400,"totals":{"x":1}}
+,{"id":1,"level":null,"day":"2024-01-03T00:00:00Z","tags":[],"codes":[],"counts":[],"price":null,"totals":{}}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestWriteClickHouseTypesOnly(t *testing.T) {
+
+	// the same scan type from a column that isn't a ClickHouse Array is still rejected by StrictTypes
+	rows := &memRows{
+		cols: []memColumn{{"counts", "INTEGER ARRAY", reflect.TypeOf([]int32(nil))}},
+		rows: [][]interface{}{{[]int32{1, 2}}},
+	}
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.StrictTypes = true
+	err := rw.WriteResponse()
+	if err == nil || !strings.Contains(err.Error(), "unknown type for writeValue") {
+		t.Errorf("expected an unknown type error, got %v", err)
+	}
+}
+
+// testClickHouseDecimal implements driver.Valuer like decimal.Decimal
+type testClickHouseDecimal string
+
+func (d testClickHouseDecimal) Value() (driver.Value, error) { return string(d), nil }
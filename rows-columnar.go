@@ -0,0 +1,256 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// WriteColumnar writes rows in a columnar format where the column names are written once,
+// followed by each row as an array of values:
+//
+//	{"columns":["widget_id","name"],"rows":[
+//	["abc123","First One"]
+//	,["def456","Next One"]
+//	]}
+//
+// For wide result sets this is much smaller than repeating the keys in every object.
+// If MaxRows or MaxBytes cuts the result short, "truncated":true is written after the rows.
+// Nested objects (NestSeparator) are not applied and fields that would be skipped are written as null,
+// so each row array lines up with the columns array.
+// If the io.Writer in the Writer field is an http.ResponseWriter the Content-Type is set the
+// same as WriteResponse.
+func (rw *RowsWriter) WriteColumnar() error {
+
+	if ok, err := rw.withOutput(true, rw.WriteColumnar); ok {
+		return err
+	}
+
+	rw.setJSONContentType()
+
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
+		if err != nil {
+			return err
+		}
+	}
+
+	w := rw.Writer
+
+	rw.rowOutBuf.Reset()
+	rw.rowOutBuf.WriteString(`{"columns":`)
+	rw.writeColumnKeys()
+	rw.rowOutBuf.WriteString(",\"rows\":[\n")
+	_, err := rw.rowOutBuf.WriteTo(w)
+	if err != nil {
+		return err
+	}
+
+	err = rw.WriteArrayRows()
+	if err != nil && err != ErrMaxBytes {
+		return err
+	}
+
+	if rw.truncated {
+		fmt.Fprintln(w, "],\"truncated\":true}")
+		return err
+	}
+	fmt.Fprintln(w, "]}")
+
+	return nil
+}
+
+// WriteArrayResponse writes rows as a JSON array of arrays, where the first array is a header
+// with the column names and each following array holds the values of one row:
+//
+//	[
+//	["widget_id","name"]
+//	,["abc123","First One"]
+//	,["def456","Next One"]
+//	]
+//
+// Useful for bulk exports where payload size matters more than self-describing objects.
+// Nested objects and skipped fields are handled the same as WriteColumnar.
+// If the io.Writer in the Writer field is an http.ResponseWriter the Content-Type is set the
+// same as WriteResponse.
+func (rw *RowsWriter) WriteArrayResponse() error {
+
+	if ok, err := rw.withOutput(true, rw.WriteArrayResponse); ok {
+		return err
+	}
+
+	rw.setJSONContentType()
+
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
+		if err != nil {
+			return err
+		}
+	}
+
+	rw.rowOutBuf.Reset()
+	rw.rowOutBuf.WriteString("[\n")
+	rw.writeColumnKeys()
+	rw.rowOutBuf.WriteByte('\n')
+	_, err := rw.rowOutBuf.WriteTo(rw.Writer)
+	if err != nil {
+		return err
+	}
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	for rw.nextRow() {
+		err := rw.scanRowArgs(false)
+		if err != nil {
+			return err
+		}
+		rw.rowOutBuf.WriteString(",[")
+		err = rw.writeRowValues(rw.fieldPlan)
+		if err != nil {
+			return err
+		}
+		rw.rowOutBuf.WriteString("]\n")
+		err = rw.writeOut(&rw.rowOutBuf)
+		if err == ErrMaxBytes {
+			fmt.Fprintln(rw.Writer, "]")
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(rw.Writer, "]")
+
+	return nil
+}
+
+// WriteColumnMajor writes rows as an object with an array of values for each column:
+//
+//	{"widget_id":["abc123","def456"],"name":["First One","Next One"]}
+//
+// Some grid and charting libraries consume exactly this shape.  Unlike the other write
+// methods, the entire result set is buffered in memory before anything is written.
+// If the io.Writer in the Writer field is an http.ResponseWriter the Content-Type is set the
+// same as WriteResponse.
+func (rw *RowsWriter) WriteColumnMajor() error {
+
+	if ok, err := rw.withOutput(true, rw.WriteColumnMajor); ok {
+		return err
+	}
+
+	rw.setJSONContentType()
+
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
+		if err != nil {
+			return err
+		}
+	}
+
+	var colOps []fieldOp
+	for _, op := range rw.fieldPlan {
+		if op.col >= 0 {
+			colOps = append(colOps, op)
+		}
+	}
+	colBufs := make([]bytes.Buffer, len(colOps))
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	for rw.nextRow() {
+		err := rw.scanRowArgs(false)
+		if err != nil {
+			return err
+		}
+		for n := range colOps {
+			rw.rowOutBuf.Reset()
+			err := rw.writeRowValues(colOps[n : n+1])
+			if err != nil {
+				return err
+			}
+			if rw.rowCount > 1 {
+				colBufs[n].WriteByte(',')
+			}
+			colBufs[n].Write(rw.rowOutBuf.Bytes())
+		}
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+
+	rw.rowOutBuf.Reset()
+	rw.rowOutBuf.WriteByte('{')
+	for n, op := range colOps {
+		if n > 0 {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		rw.writeValue(rw.colKeys[op.col])
+		rw.rowOutBuf.WriteString(":[")
+		rw.rowOutBuf.Write(colBufs[n].Bytes())
+		rw.rowOutBuf.WriteByte(']')
+	}
+	rw.rowOutBuf.WriteString("}\n")
+
+	_, err := rw.rowOutBuf.WriteTo(rw.Writer)
+	return err
+}
+
+// WriteArrayRow is like WriteCommaRow but writes the row as an array of values instead of an object,
+// see WriteColumnar.
+func (rw *RowsWriter) WriteArrayRow() error {
+
+	err := rw.scanRowArgs(true)
+	if err != nil {
+		return err
+	}
+
+	rw.rowOutBuf.WriteByte('[')
+
+	err = rw.writeRowValues(rw.fieldPlan)
+	if err != nil {
+		return err
+	}
+
+	rw.rowOutBuf.WriteString("]\n")
+
+	return rw.writeOut(&rw.rowOutBuf)
+}
+
+// WriteArrayRows calls WriteArrayRow in a loop.
+// Surround with `[`...`]` to form valid JSON.
+func (rw *RowsWriter) WriteArrayRows() error {
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	for rw.nextRow() {
+		err := rw.WriteArrayRow()
+		if err != nil {
+			return err
+		}
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeColumnKeys writes the JSON keys of the columns in fieldPlan to rowOutBuf as an array.
+func (rw *RowsWriter) writeColumnKeys() {
+	rw.rowOutBuf.WriteByte('[')
+	first := true
+	for _, op := range rw.fieldPlan {
+		if op.col < 0 {
+			continue
+		}
+		if !first {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		first = false
+		rw.writeValue(rw.colKeys[op.col])
+	}
+	rw.rowOutBuf.WriteByte(']')
+}
@@ -0,0 +1,91 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestColumnar(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	t.Run("WriteColumnar", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		err = NewRowsWriter(&buf, rows).WriteColumnar()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Columns []string        `json:"columns"`
+			Rows    [][]interface{} `json:"rows"`
+		}
+		err = json.Unmarshal(buf.Bytes(), &result)
+		if err != nil {
+			t.Fatalf("invalid output %s: %v", buf.String(), err)
+		}
+		if len(result.Columns) != 2 || len(result.Rows) != 2 || result.Rows[0][0] != "abc123" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("WriteColumnMajor", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		err = NewRowsWriter(&buf, rows).WriteColumnMajor()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result map[string][]string
+		err = json.Unmarshal(buf.Bytes(), &result)
+		if err != nil {
+			t.Fatalf("invalid output %s: %v", buf.String(), err)
+		}
+		if len(result["widget_id"]) != 2 || result["name"][1] != "Next One" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("WriteArrayResponse", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		err = NewRowsWriter(&buf, rows).WriteArrayResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result [][]string
+		err = json.Unmarshal(buf.Bytes(), &result)
+		if err != nil {
+			t.Fatalf("invalid output %s: %v", buf.String(), err)
+		}
+		if len(result) != 3 || result[0][0] != "widget_id" || result[1][0] != "abc123" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+}
@@ -0,0 +1,182 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+)
+
+// setupColWriters populates colWriters from scanArgs and the column options.  Columns none of
+// the value options apply to get a writer specialized for their scan arg, which avoids checking
+// the options and the type switch of writeValue for each row.  The options it was set up with
+// are kept in colWriterOpts, so scanRowArgs can set it up again if they are changed.
+func (rw *RowsWriter) setupColWriters() {
+
+	rw.colWriterOpts = rw.currentColWriterOpts()
+	rw.colWriters = rw.colWriters[:0]
+	for i := range rw.scanArgs {
+		if rw.plainColumn(i) {
+			rw.colWriters = append(rw.colWriters, rw.plainColumnWriter(rw.scanArgs[i]))
+			continue
+		}
+		rw.colWriters = append(rw.colWriters, func() error { return rw.writeOptionsColumnValue(i) })
+	}
+}
+
+// colWriterOpts are the options plainColumn checks.  The slices and maps are compared by their
+// address and length, so replacing them or changing their length is noticed, but editing an
+// element in place (e.g. Int64AsStringColumns[0] = "x") is not and must not be done after the first row.
+type colWriterOpts struct {
+	int64AsString, decimalAsNumber bool
+	binaryEncoding                 BinaryEncoding
+	maxStringLength                int
+	int64AsStringColumns           [2]uintptr
+	valueMaps                      [2]uintptr
+	floatPrecision                 [2]uintptr
+	truncateStrings                [2]uintptr
+}
+
+// currentColWriterOpts returns the colWriterOpts for the options as they are now.
+func (rw *RowsWriter) currentColWriterOpts() colWriterOpts {
+	return colWriterOpts{
+		int64AsString:        rw.Int64AsString,
+		decimalAsNumber:      rw.DecimalAsNumber,
+		binaryEncoding:       rw.BinaryEncoding,
+		maxStringLength:      rw.MaxStringLength,
+		int64AsStringColumns: [2]uintptr{reflect.ValueOf(rw.Int64AsStringColumns).Pointer(), uintptr(len(rw.Int64AsStringColumns))},
+		valueMaps:            [2]uintptr{reflect.ValueOf(rw.ValueMaps).Pointer(), uintptr(len(rw.ValueMaps))},
+		floatPrecision:       [2]uintptr{reflect.ValueOf(rw.FloatPrecision).Pointer(), uintptr(len(rw.FloatPrecision))},
+		truncateStrings:      [2]uintptr{reflect.ValueOf(rw.TruncateStrings).Pointer(), uintptr(len(rw.TruncateStrings))},
+	}
+}
+
+// plainColumn returns true if none of the options checked by writeOptionsColumnValue apply to column i.
+func (rw *RowsWriter) plainColumn(i int) bool {
+
+	name := rw.colNames[i]
+	if rw.Int64AsString || containsString(rw.Int64AsStringColumns, name) {
+		return false
+	}
+	if rw.colGeo[i] != 0 || rw.colHstore[i] || rw.colNested[i] || rw.colRawJSON[i] || rw.colUUID[i] != 0 || rw.colBool[i] {
+		return false
+	}
+	if rw.BinaryEncoding != BinaryRawString && rw.colBinary[i] || rw.DecimalAsNumber && rw.colDecimal[i] {
+		return false
+	}
+	if _, ok := rw.ValueMaps[name]; ok {
+		return false
+	}
+	if _, ok := rw.FloatPrecision[name]; ok {
+		return false
+	}
+	return rw.maxStringLength(name) <= 0 || rw.colBinary[i]
+}
+
+// plainColumnWriter returns a function that writes the value of scan arg v the same as
+// writeValue, specialized for the common scan arg types.
+func (rw *RowsWriter) plainColumnWriter(v interface{}) func() error {
+
+	out := &rw.rowOutBuf
+	switch vt := v.(type) {
+
+	case *sql.RawBytes:
+		return func() error { return rw.writeText(unsafeString(*vt)) }
+
+	case *sql.NullString:
+		return func() error {
+			if !vt.Valid {
+				out.WriteString("null")
+				return nil
+			}
+			return rw.writeText(vt.String)
+		}
+
+	case *sql.Null[string]:
+		return func() error {
+			if !vt.Valid {
+				out.WriteString("null")
+				return nil
+			}
+			return rw.writeText(vt.V)
+		}
+
+	case *string:
+		return func() error { return rw.writeText(*vt) }
+
+	case *sql.NullInt64:
+		return func() error {
+			if !vt.Valid {
+				out.WriteString("null")
+				return nil
+			}
+			rw.valOutBytes = strconv.AppendInt(rw.valOutBytes[:0], vt.Int64, 10)
+			out.Write(rw.valOutBytes)
+			return nil
+		}
+
+	case *sql.Null[int64]:
+		return func() error {
+			if !vt.Valid {
+				out.WriteString("null")
+				return nil
+			}
+			rw.valOutBytes = strconv.AppendInt(rw.valOutBytes[:0], vt.V, 10)
+			out.Write(rw.valOutBytes)
+			return nil
+		}
+
+	case *int64:
+		return func() error {
+			rw.valOutBytes = strconv.AppendInt(rw.valOutBytes[:0], *vt, 10)
+			out.Write(rw.valOutBytes)
+			return nil
+		}
+
+	case *sql.NullFloat64:
+		return func() error {
+			if !vt.Valid {
+				out.WriteString("null")
+				return nil
+			}
+			var err error
+			rw.valOutBytes, err = rw.writeFloat(rw.valOutBytes[:0], vt.Float64, 64, -1)
+			return err
+		}
+
+	case *float64:
+		return func() error {
+			var err error
+			rw.valOutBytes, err = rw.writeFloat(rw.valOutBytes[:0], *vt, 64, -1)
+			return err
+		}
+
+	case *sql.NullBool:
+		return func() error {
+			if !vt.Valid {
+				out.WriteString("null")
+				return nil
+			}
+			out.WriteString(strconv.FormatBool(vt.Bool))
+			return nil
+		}
+
+	case *bool:
+		return func() error {
+			out.WriteString(strconv.FormatBool(*vt))
+			return nil
+		}
+	}
+
+	return func() error { return rw.writeValue(v) }
+}
+
+// writeText writes s as a JSON string, directly if it needs no escaping.
+func (rw *RowsWriter) writeText(s string) error {
+	if stringNeedsJSONEsc(s, rw.EscapeHTML) {
+		return rw.writeValue(s)
+	}
+	rw.rowOutBuf.WriteByte('"')
+	rw.rowOutBuf.WriteString(s)
+	rw.rowOutBuf.WriteByte('"')
+	return nil
+}
@@ -0,0 +1,94 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestColWritersOptionsChanged(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "BIGINT", reflect.TypeOf(int64(0))},
+			{"name", "VARCHAR", reflect.TypeOf("")},
+		},
+		rows: [][]interface{}{{int64(1) << 60, "First One"}, {int64(2) << 60, "Next One"}, {int64(3) << 60, "Third One"}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.Rows.Next()
+	err := rw.WriteRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// options set after the columns were set up apply from the next row
+	rw.Int64AsString = true
+	rw.TruncateStrings = map[string]int{"name": 4}
+	rw.Rows.Next()
+	err = rw.WriteRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.TruncateStrings["name"] = 5 // changing the map in place is noticed when it is read
+	rw.Rows.Next()
+	err = rw.WriteRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":1152921504606846976,"name":"First One"}
+{"id":"2305843009213693952","name":"Next"}
+{"id":"3458764513820540928","name":"Third"}
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+// BenchmarkColumnWriters compares the writers setupColWriters chooses for plain columns with
+// writeOptionsColumnValue, which checks each of the options for every value.
+func BenchmarkColumnWriters(b *testing.B) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "BIGINT", reflect.TypeOf(int64(0))},
+			{"name", "VARCHAR", reflect.TypeOf("")},
+			{"price", "DOUBLE", reflect.TypeOf(float64(0))},
+			{"active", "BOOLEAN", reflect.TypeOf(false)},
+			{"code", "VARCHAR", reflect.TypeOf("")},
+		},
+	}
+	for i := 0; i < 100; i++ {
+		rows.rows = append(rows.rows, []interface{}{int64(i), fmt.Sprintf("widget %d", i), float64(i) * 1.5, i%2 == 0, "abc"})
+	}
+
+	for _, name := range []string{"colWriters", "options"} {
+		b.Run(name, func(b *testing.B) {
+			rows.next = 0
+			rw := NewRowsWriter(nil, rows)
+			rw.Rows.Next()
+			err := rw.scanRowArgs(false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if name == "options" {
+				for i := range rw.colWriters {
+					rw.colWriters[i] = func() error { return rw.writeOptionsColumnValue(i) }
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				rw.rowOutBuf.Reset()
+				err := rw.writeRowFields(rw.fieldPlan)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
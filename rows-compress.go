@@ -0,0 +1,146 @@
+package sqljsonutil
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compressor is a Content-Encoding for Compress, e.g. to add zstd or brotli from another package.
+// If the writer returned by NewWriter has a Flush() error method (as the gzip, zstd and brotli
+// writers do) it is called before the response is flushed, so streamed rows are not held back.
+type Compressor interface {
+	Encoding() string                     // the Content-Encoding token, e.g. "br"
+	NewWriter(w io.Writer) io.WriteCloser // returns a writer that compresses to w
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Encoding() string                     { return "gzip" }
+func (gzipCompressor) NewWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+// deflateCompressor is the HTTP "deflate" encoding, which is zlib format.
+type deflateCompressor struct{}
+
+func (deflateCompressor) Encoding() string                     { return "deflate" }
+func (deflateCompressor) NewWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+
+// builtinCompressors are used after Compressors, in order of preference.
+var builtinCompressors = []Compressor{gzipCompressor{}, deflateCompressor{}}
+
+// newCompressWriter returns a compressWriter for the first of Compressors and the built in
+// encodings that AcceptEncoding allows, or nil if the output should not be compressed.
+func (rw *RowsWriter) newCompressWriter() *compressWriter {
+
+	if !rw.Compress {
+		return nil
+	}
+	w, ok := rw.Writer.(http.ResponseWriter)
+	if !ok {
+		return nil
+	}
+	switch w.(type) {
+	case *compressWriter, *teeResponseWriter: // already compressing, or teeing which is set up after compressing
+		return nil
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	for _, list := range [][]Compressor{rw.Compressors, builtinCompressors} {
+		for _, c := range list {
+			if acceptsEncoding(rw.AcceptEncoding, c.Encoding()) {
+				return &compressWriter{ResponseWriter: w, c: c}
+			}
+		}
+	}
+	return nil
+}
+
+// acceptsEncoding returns true if the Accept-Encoding header value header allows encoding,
+// by name or "*", with a q value more than 0.
+func acceptsEncoding(header, encoding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		ok := true
+		for _, p := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				ok = err == nil && q > 0
+			}
+		}
+		if name != "*" {
+			return ok // an explicit entry takes precedence over *
+		}
+		wildcard = ok
+	}
+	return wildcard
+}
+
+// compressWriter is an http.ResponseWriter that compresses what is written to it.  The headers
+// are set on the first Write, and responses without a body (e.g. 304 from ETag) are not compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	c           Compressor
+	cw          io.WriteCloser // nil until the first Write
+	passthrough bool
+}
+
+// start sets the headers and creates the compressing writer if not done already.
+func (w *compressWriter) start() {
+	if w.cw != nil || w.passthrough {
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Encoding", w.c.Encoding())
+	h.Del("Content-Length")
+	w.cw = w.c.NewWriter(w.ResponseWriter)
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		w.passthrough = true
+	} else {
+		w.start()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	w.start()
+	return w.cw.Write(p)
+}
+
+// Flush writes out what has been compressed so far and flushes the response.
+func (w *compressWriter) Flush() {
+	if f, ok := w.cw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close writes the end of the compressed output, if anything was written.
+func (w *compressWriter) Close() error {
+	if w.cw == nil {
+		return nil
+	}
+	return w.cw.Close()
+}
@@ -0,0 +1,45 @@
+package sqljsonutil
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AsDownload returns an Option that sets the Content-Disposition header so browsers save the
+// response as a file, if the Writer is an http.ResponseWriter.  It is meant for the export
+// formats, e.g. with WriteNDJSON or a CSVRowsWriter (apply it to &cw.RowsWriter).
+//
+// filename may contain {date} (2006-01-02) and {timestamp} (20060102-150405), both in UTC,
+// and {table}, the first of ColumnTables or "export" if not set, so apply it after ColumnTables.
+// Names that are not plain ASCII are sent in the RFC 2231 filename* form.
+func AsDownload(filename string) Option {
+	return func(rw *RowsWriter) {
+		w, ok := rw.Writer.(http.ResponseWriter)
+		if !ok {
+			return
+		}
+		name := downloadFilename(filename, rw.ColumnTables, time.Now())
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+}
+
+// downloadFilename returns filename with the placeholders replaced, see AsDownload.
+func downloadFilename(filename string, tables []string, t time.Time) string {
+
+	table := "export"
+	for _, tbl := range tables {
+		if tbl != "" {
+			table = tbl
+			break
+		}
+	}
+
+	t = t.UTC()
+	return strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{timestamp}", t.Format("20060102-150405"),
+		"{table}", table,
+	).Replace(filename)
+}
@@ -0,0 +1,113 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+var bigIntPtrType = reflect.TypeOf((*big.Int)(nil))
+
+// duckDBText is the scan arg for go-duckdb HUGEINT, UHUGEINT and DECIMAL columns, which it
+// scans as a *big.Int or a duckdb.Decimal.  The value is held as text, as other drivers'
+// DECIMAL columns are, so it is written as a string (or a number with DecimalAsNumber).
+type duckDBText struct {
+	sql.NullString
+}
+
+// Scan implements sql.Scanner.
+func (t *duckDBText) Scan(src interface{}) error {
+	if b, ok := src.(*big.Int); ok {
+		t.Valid = b != nil
+		t.String = ""
+		if b != nil {
+			t.String = b.String()
+		}
+		return nil
+	}
+	if s, ok := duckDBDecimalText(src); ok {
+		t.String, t.Valid = s, true
+		return nil
+	}
+	return t.NullString.Scan(src)
+}
+
+// isHugeIntType returns true if dbTypeName is the DuckDB HUGEINT or UHUGEINT type.
+func isHugeIntType(dbTypeName string) bool {
+	switch strings.ToUpper(dbTypeName) {
+	case "HUGEINT", "UHUGEINT":
+		return true
+	}
+	return false
+}
+
+// isDuckDBNested returns true if dbTypeName is a DuckDB LIST, ARRAY, STRUCT or MAP type, which
+// go-duckdb scans into slices and maps, see writeNestedValue.
+func isDuckDBNested(dbTypeName string) bool {
+	s := strings.ToUpper(dbTypeName)
+	return strings.HasPrefix(s, "LIST") || strings.HasPrefix(s, "STRUCT") || strings.HasPrefix(s, "MAP") ||
+		strings.HasSuffix(s, "]") // e.g. INTEGER[] or INTEGER[3]
+}
+
+// isDuckDBDecimal returns true if t is the duckdb.Decimal type of go-duckdb, a struct of the
+// Width, Scale and unscaled Value of a DECIMAL.  It is matched by its fields so the driver
+// does not need to be imported.
+func isDuckDBDecimal(t reflect.Type) bool {
+	if t == nil || t.Kind() != reflect.Struct || t.NumField() != 3 {
+		return false
+	}
+	width, ok1 := t.FieldByName("Width")
+	scale, ok2 := t.FieldByName("Scale")
+	value, ok3 := t.FieldByName("Value")
+	return ok1 && ok2 && ok3 && width.Type.Kind() == reflect.Uint8 && scale.Type.Kind() == reflect.Uint8 &&
+		value.Type == bigIntPtrType
+}
+
+// duckDBDecimalText returns the exact text of v if it is a duckdb.Decimal or a pointer to one,
+// e.g. "-12.340" for Value -12340 and Scale 3.
+func duckDBDecimalText(v interface{}) (string, bool) {
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || !isDuckDBDecimal(rv.Type()) {
+		return "", false
+	}
+	b, _ := rv.FieldByName("Value").Interface().(*big.Int)
+	if b == nil {
+		return "", false
+	}
+	scale := int(rv.FieldByName("Scale").Uint())
+
+	digits := new(big.Int).Abs(b).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	s := digits
+	if scale > 0 {
+		s = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if b.Sign() < 0 {
+		s = "-" + s
+	}
+	return s, true
+}
+
+// writeDuckDBDecimal writes v if it is a duckdb.Decimal, as in a LIST or STRUCT column, the
+// same as a DECIMAL column value.  If false is returned nothing was written.
+func (rw *RowsWriter) writeDuckDBDecimal(v interface{}) (bool, error) {
+	s, ok := duckDBDecimalText(v)
+	if !ok {
+		return false, nil
+	}
+	if rw.DecimalAsNumber {
+		rw.rowOutBuf.WriteString(s)
+		return true, nil
+	}
+	return true, rw.writeValue(s)
+}
@@ -0,0 +1,77 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteDuckDBTypes(t *testing.T) {
+
+	huge, _ := new(big.Int).SetString("-170141183460469231731687303715884105728", 10)
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "HUGEINT", reflect.TypeOf((*big.Int)(nil))},
+			{"price", "DECIMAL(18,3)", reflect.TypeOf(testDuckDBDecimal{})},
+			{"tags", "LIST", reflect.TypeOf([]interface{}(nil))},
+			{"info", "STRUCT", reflect.TypeOf(map[string]interface{}(nil))},
+			{"totals", "MAP", reflect.TypeOf(map[interface{}]interface{}(nil))},
+		},
+		rows: [][]interface{}{
+			{huge, testDuckDBDecimal{18, 3, big.NewInt(-12340)},
+				[]interface{}{"a", nil, int32(3)},
+				map[string]interface{}{"name": "x", "cost": testDuckDBDecimal{5, 2, big.NewInt(5)}, "sizes": []interface{}{int64(1)}},
+				map[interface{}]interface{}{int32(2): "b", int32(1): "a"}},
+			{nil, nil, nil, nil, nil},
+		},
+	}
+
+	for _, decimalAsNumber := range []bool{false, true} {
+		rows.next = 0
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.StrictTypes = true
+		rw.DecimalAsNumber = decimalAsNumber
+		err := rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[
+{"id":"-170141183460469231731687303715884105728","price":"-12.340","tags":["a",null,3],"info":{"cost":"0.05","name":"x","sizes":[1]},"totals":{"1":"a","2":"b"}}
+,{"id":null,"price":null,"tags":null,"info":null,"totals":null}
+]
+`
+		if decimalAsNumber {
+			want = `[
+{"id":"-170141183460469231731687303715884105728","price":-12.340,"tags":["a",null,3],"info":{"cost":0.05,"name":"x","sizes":[1]},"totals":{"1":"a","2":"b"}}
+,{"id":null,"price":null,"tags":null,"info":null,"totals":null}
+]
+`
+		}
+		if buf.String() != want {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	}
+}
+
+func TestWriteDuckDBMapKeyCollision(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{{"totals", "MAP", reflect.TypeOf(map[interface{}]interface{}(nil))}},
+		rows: [][]interface{}{{map[interface{}]interface{}{int32(1): "a", "1": "b"}}},
+	}
+	var buf bytes.Buffer
+	err := NewRowsWriter(&buf, rows).WriteResponse()
+	if err == nil || !strings.Contains(err.Error(), `more than one key written as "1"`) {
+		t.Errorf("expected a duplicate key error, got %v", err)
+	}
+}
+
+// testDuckDBDecimal has the fields of duckdb.Decimal
+type testDuckDBDecimal struct {
+	Width uint8
+	Scale uint8
+	Value *big.Int
+}
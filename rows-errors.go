@@ -0,0 +1,59 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorPolicy specifies what is written when an error occurs after output has started.
+type ErrorPolicy int
+
+const (
+	ErrorReturn ErrorPolicy = iota // only return the error, leaving the output cut short (default)
+	ErrorRecord                    // also write a final {"_error":"..."} element or record, see ErrorKey
+)
+
+// handleStreamError is called with the error that stopped a write method after output has
+// started.  It sets the ErrorTrailer HTTP trailer and writes the error record according to
+// ErrorPolicy, prefixed with prefix and followed by suffix.  ErrMaxBytes is not an error here,
+// the output was completed normally.
+func (rw *RowsWriter) handleStreamError(err error, prefix, suffix string) {
+
+	if err == nil || err == ErrMaxBytes {
+		return
+	}
+
+	if rw.ErrorTrailer != "" {
+		if w, ok := rw.Writer.(http.ResponseWriter); ok {
+			w.Header().Set(http.TrailerPrefix+rw.ErrorTrailer, err.Error())
+		}
+	}
+
+	if rw.ErrorPolicy != ErrorRecord {
+		return
+	}
+
+	key := rw.ErrorKey
+	if key == "" {
+		key = "_error"
+	}
+	b, _ := json.Marshal(map[string]string{key: err.Error()})
+
+	rw.msgBuf.Reset()
+	rw.msgBuf.WriteString(prefix)
+	rw.msgBuf.Write(b)
+	rw.msgBuf.WriteString(suffix)
+	rw.msgBuf.WriteTo(rw.Writer) // there is already an error to return
+}
+
+// commaRowsErrorPrefix returns the prefix for an error record after WriteCommaRows, which
+// wrote nothing if bytesWritten is still start.
+func (rw *RowsWriter) commaRowsErrorPrefix(start int64) string {
+	if rw.bytesWritten == start {
+		return ""
+	}
+	if rw.Indent != "" { // indented comma rows are not newline terminated
+		return ",\n" + rw.Indent
+	}
+	return ","
+}
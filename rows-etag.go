@@ -0,0 +1,48 @@
+package sqljsonutil
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// notModified sets the ETag header made from a hash of b, if the Writer is an http.ResponseWriter.
+// If the ETag matches IfNoneMatch, a 304 Not Modified status is written and true is returned.
+func (rw *RowsWriter) notModified(b []byte) bool {
+
+	w, ok := rw.Writer.(http.ResponseWriter)
+	if !ok {
+		return false
+	}
+
+	sum := sha256.Sum256(b)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	if !etagMatch(rw.IfNoneMatch, etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagBuffered returns true if the ETag is a hash of the output, which has to be buffered
+// to compute it before the headers are sent.
+func (rw *RowsWriter) etagBuffered() bool {
+	return rw.ETag && rw.ETagVersion == ""
+}
+
+// etagMatch returns true if the If-None-Match header value matches etag, using the weak
+// comparison RFC 9110 requires for If-None-Match.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
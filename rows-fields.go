@@ -0,0 +1,64 @@
+package sqljsonutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelectFields sets IncludeColumns from a comma separated list of fields, e.g. from a
+// ?fields=widget_id,name,address.city query parameter, checked against the columns of Rows.
+// A dotted field selects a column of a nested object (see NestSeparator) and a field naming
+// a nested object selects all of its columns.  If NestSeparator is empty and the columns are
+// named with dots (e.g. `address.city`), NestSeparator is set to "." so they are written nested.
+//
+// If strict is true an unknown field is an error (meant for the client, e.g. with a 400
+// status), otherwise unknown fields are ignored.  An empty list, or one with only unknown
+// fields, selects all columns.
+func (rw *RowsWriter) SelectFields(fields string, strict bool) error {
+
+	fields = strings.TrimSpace(fields)
+	if fields == "" {
+		rw.IncludeColumns = nil
+		return nil
+	}
+
+	colNames, err := rw.Rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	sep := rw.NestSeparator
+	if sep == "" {
+		sep = "."
+	}
+
+	var include []string
+	nested := false
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		path := strings.ReplaceAll(field, ".", sep)
+		found := false
+		for _, name := range colNames {
+			if name != path && !strings.HasPrefix(name, path+sep) {
+				continue
+			}
+			found = true
+			nested = nested || strings.Contains(name, sep)
+			if !containsString(include, name) {
+				include = append(include, name)
+			}
+		}
+		if !found && strict {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	if rw.NestSeparator == "" && nested {
+		rw.NestSeparator = sep
+	}
+	rw.IncludeColumns = include
+	return nil
+}
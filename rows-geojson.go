@@ -0,0 +1,319 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WKB geometry type codes written without GeoJSONFunc
+const (
+	wkbPoint      = 1
+	wkbLineString = 2
+	wkbPolygon    = 3
+)
+
+// isGeoColumn returns true if the values of the column should be written as GeoJSON,
+// see GeoJSON and GeoJSONColumns.
+func (rw *RowsWriter) isGeoColumn(colName, dbTypeName string) bool {
+	if containsString(rw.GeoJSONColumns, colName) {
+		return true
+	}
+	switch strings.ToUpper(dbTypeName) {
+	case "GEOMETRY", "GEOGRAPHY":
+		return rw.GeoJSON
+	}
+	return false
+}
+
+// writeGeoJSONValue writes the geometry value of v as a GeoJSON geometry object.  v is WKB,
+// PostGIS EWKB as binary or hex text, or if mysql is true and it has that layout (see
+// isMySQLGeometry) the MySQL internal format.  If false is returned v is NULL or not binary
+// or text and nothing was written.
+func (rw *RowsWriter) writeGeoJSONValue(v interface{}, mysql bool) (bool, error) {
+
+	var b []byte
+	switch vt := scanValue(v).(type) {
+	case []byte:
+		b = vt
+	case sql.RawBytes:
+		b = vt
+	case string:
+		b = []byte(vt)
+	default:
+		return false, nil
+	}
+
+	if isHexWKB(b) {
+		var err error
+		rw.geoBuf, err = hex.AppendDecode(rw.geoBuf[:0], b)
+		if err != nil {
+			return true, err
+		}
+		b = rw.geoBuf
+	} else if mysql && isMySQLGeometry(b) {
+		b = b[4:]
+	}
+
+	vob, n, err := rw.appendGeoJSON(rw.valOutBytes[:0], b)
+	if err == nil && n != len(b) {
+		err = fmt.Errorf("invalid geometry value: %d bytes after WKB", len(b)-n)
+	}
+	if err != nil {
+		return true, err
+	}
+	rw.rowOutBuf.Write(vob)
+	rw.valOutBytes = vob
+	return true, nil
+}
+
+// isHexWKB returns true if b is hex encoded (E)WKB, as PostGIS returns geometry values in the text format.
+func isHexWKB(b []byte) bool {
+	if len(b) < 10 || len(b)%2 != 0 || b[0] != '0' || (b[1] != '0' && b[1] != '1') {
+		return false
+	}
+	for _, c := range b {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// isMySQLGeometry returns true if b is in the MySQL internal format, a 4 byte SRID followed by
+// WKB, rather than WKB or EWKB.  Other drivers (e.g. for PostGIS) can report the same GEOMETRY
+// type name, so it goes by the layout: b is MySQL's if the WKB after the SRID is exactly the
+// rest of b and b itself is not WKB of exactly its length.
+func isMySQLGeometry(b []byte) bool {
+	if len(b) < 9 || b[4] > 1 {
+		return false
+	}
+	n, ok := wkbSize(b[4:])
+	if !ok || n != len(b)-4 {
+		return false
+	}
+	n, ok = wkbSize(b)
+	return !ok || n != len(b)
+}
+
+// wkbSize returns the size in bytes of the WKB or EWKB geometry at the start of b, for the
+// OGC geometry types (Point to GeometryCollection).  ok is false if b doesn't start with one.
+func wkbSize(b []byte) (n int, ok bool) {
+
+	if len(b) < 5 || b[0] > 1 {
+		return 0, false
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if b[0] == 1 {
+		order = binary.LittleEndian
+	}
+	typ := order.Uint32(b[1:5])
+	off := 5
+
+	// as in appendGeoJSON
+	dims := 2
+	if typ&0x80000000 != 0 {
+		dims++
+	}
+	if typ&0x40000000 != 0 {
+		dims++
+	}
+	if typ&0x20000000 != 0 {
+		off += 4 // SRID
+	}
+	typ &= 0x0fffffff
+	switch typ / 1000 {
+	case 0:
+	case 1, 2:
+		dims++
+	case 3:
+		dims += 2
+	default:
+		return 0, false
+	}
+
+	count := func() int {
+		if len(b)-off < 4 {
+			off = len(b) + 1 // truncated
+			return 0
+		}
+		c := int(order.Uint32(b[off:]))
+		off += 4
+		return c
+	}
+	switch typ % 1000 {
+	case wkbPoint:
+		off += 8 * dims
+	case wkbLineString:
+		off += 8 * dims * count()
+	case wkbPolygon:
+		for rings := count(); rings > 0 && off <= len(b); rings-- {
+			off += 8 * dims * count()
+		}
+	case 4, 5, 6, 7: // Multi... and GeometryCollection
+		for parts := count(); parts > 0 && off <= len(b); parts-- {
+			m, ok := wkbSize(b[off:])
+			if !ok {
+				return 0, false
+			}
+			off += m
+		}
+	default:
+		return 0, false
+	}
+	return off, off <= len(b)
+}
+
+// appendGeoJSON appends the GeoJSON geometry object for the WKB or EWKB geometry at the start of
+// wkb to dst, and returns the number of bytes of wkb read.  Z coordinates are kept and M dropped.
+func (rw *RowsWriter) appendGeoJSON(dst, wkb []byte) ([]byte, int, error) {
+
+	if len(wkb) < 5 || wkb[0] > 1 {
+		return dst, 0, fmt.Errorf("invalid geometry value: not WKB")
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if wkb[0] == 1 {
+		order = binary.LittleEndian
+	}
+	typ := order.Uint32(wkb[1:5])
+	off := 5
+
+	// EWKB flags, then ISO WKB thousands for Z, M and ZM
+	hasZ, hasM := typ&0x80000000 != 0, typ&0x40000000 != 0
+	if typ&0x20000000 != 0 {
+		off += 4 // SRID
+	}
+	typ &= 0x0fffffff
+	switch typ / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+	typ %= 1000
+
+	dims := 2
+	if hasZ {
+		dims++
+	}
+	if hasM {
+		dims++
+	}
+
+	r := wkbReader{b: wkb, off: off, order: order}
+	switch typ {
+	case wkbPoint:
+		dst = append(dst, `{"type":"Point","coordinates":`...)
+		dst = r.appendPoint(dst, dims, hasZ, true)
+	case wkbLineString:
+		dst = append(dst, `{"type":"LineString","coordinates":`...)
+		dst = r.appendPoints(dst, dims, hasZ)
+	case wkbPolygon:
+		dst = append(dst, `{"type":"Polygon","coordinates":[`...)
+		rings := r.uint32()
+		for i := uint32(0); i < rings && r.err == nil; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = r.appendPoints(dst, dims, hasZ)
+		}
+		dst = append(dst, ']')
+	default:
+		if rw.GeoJSONFunc == nil {
+			return dst, 0, fmt.Errorf("unsupported WKB geometry type %d", typ)
+		}
+		b, err := rw.GeoJSONFunc(typ, wkb)
+		if err != nil {
+			return dst, 0, err
+		}
+		return append(dst, b...), len(wkb), nil
+	}
+	if r.err != nil {
+		return dst, 0, r.err
+	}
+	return append(dst, '}'), r.off, nil
+}
+
+// wkbReader reads the values of a WKB geometry, recording the first error.
+type wkbReader struct {
+	b     []byte
+	off   int
+	order binary.ByteOrder
+	err   error
+}
+
+func (r *wkbReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b)-r.off < 4 {
+		r.err = fmt.Errorf("invalid geometry value: truncated WKB")
+		return 0
+	}
+	v := r.order.Uint32(r.b[r.off:])
+	r.off += 4
+	return v
+}
+
+func (r *wkbReader) float64() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b)-r.off < 8 {
+		r.err = fmt.Errorf("invalid geometry value: truncated WKB")
+		return 0
+	}
+	v := math.Float64frombits(r.order.Uint64(r.b[r.off:]))
+	r.off += 8
+	return v
+}
+
+// appendPoint appends the coordinates array of a point with dims coordinates, the first three
+// if hasZ or else the first two.  An empty point (NaN coordinates) is only allowed if empty is true, as [].
+func (r *wkbReader) appendPoint(dst []byte, dims int, hasZ, empty bool) []byte {
+	n := 2
+	if hasZ {
+		n = 3
+	}
+	var c [4]float64
+	for i := 0; i < dims; i++ {
+		c[i] = r.float64()
+	}
+	if empty && math.IsNaN(c[0]) && math.IsNaN(c[1]) {
+		return append(dst, "[]"...)
+	}
+
+	dst = append(dst, '[')
+	for i, f := range c[:n] {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			if r.err == nil {
+				r.err = fmt.Errorf("invalid geometry value: coordinate %v", f)
+			}
+			break
+		}
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = strconv.AppendFloat(dst, f, 'f', -1, 64)
+	}
+	return append(dst, ']')
+}
+
+// appendPoints appends the coordinates array of a point count followed by the points.
+func (r *wkbReader) appendPoints(dst []byte, dims int, hasZ bool) []byte {
+	count := r.uint32()
+	dst = append(dst, '[')
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = r.appendPoint(dst, dims, hasZ, false)
+	}
+	return append(dst, ']')
+}
@@ -0,0 +1,52 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGeoJSONLayout(t *testing.T) {
+
+	point := func(srid []byte, typ uint32) []byte {
+		b := append(srid, 1)
+		b = binary.LittleEndian.AppendUint32(b, typ)
+		if typ&0x20000000 != 0 {
+			b = binary.LittleEndian.AppendUint32(b, 4326)
+		}
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(1.5))
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(2))
+	}
+
+	// all reported as GEOMETRY, only the first two are in the MySQL internal format
+	db := testDB(t, &testDriverResult{
+		cols: []testDriverColumn{{name: "g", dbType: "GEOMETRY", scanType: reflect.TypeOf(sql.RawBytes{})}},
+		rows: [][]driver.Value{
+			{point([]byte{0, 0, 0, 0}, wkbPoint)},
+			{point([]byte{0xe6, 0x10, 0, 0}, wkbPoint)},
+			{point(nil, wkbPoint)},
+			{point(nil, wkbPoint|0x20000000)}, // EWKB with SRID
+		},
+	})
+	rows, err := db.Query("SELECT g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.GeoJSON = true
+	err = rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := `{"g":{"type":"Point","coordinates":[1.5,2]}}`
+	if want := "[\n" + g + "\n," + g + "\n," + g + "\n," + g + "\n]\n"; buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
@@ -0,0 +1,268 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChildArray describes a nested array of child objects collected from the rows of a
+// one-to-many JOIN, see RowsWriter.GroupBy.
+type ChildArray struct {
+	Key    string // JSON key of the array in the parent object, e.g. "items"
+	Prefix string // columns starting with this prefix are written to the child objects with the prefix removed, e.g. "item_"
+}
+
+// groupState is the per result set state used when writing grouped rows.
+type groupState struct {
+	keyCols    []int       // indexes of GroupBy columns
+	childPlans [][]fieldOp // plan for each of Children
+	key        []byte      // JSON of key column values for the current group
+	open       bool        // a group has been started and not yet written
+	count      int         // number of groups written
+	parentBuf  bytes.Buffer
+	childBufs  []bytes.Buffer
+	childCount []int
+}
+
+func (g *groupState) reset() {
+	g.keyCols = g.keyCols[:0]
+	g.childPlans = g.childPlans[:0]
+	g.key = g.key[:0]
+	g.open = false
+	g.count = 0
+	g.parentBuf.Reset()
+	g.childBufs = g.childBufs[:0]
+	g.childCount = g.childCount[:0]
+}
+
+// childIndex returns the index in Children that column i belongs to, or -1 if none.
+func (rw *RowsWriter) childIndex(i int) int {
+	if len(rw.GroupBy) == 0 {
+		return -1
+	}
+	for ci, c := range rw.Children {
+		if strings.HasPrefix(rw.colNames[i], c.Prefix) {
+			return ci
+		}
+	}
+	return -1
+}
+
+// setupGroup initializes the group state from GroupBy and Children,
+// called when the column information is first read.
+func (rw *RowsWriter) setupGroup() error {
+
+	g := &rw.group
+	g.reset()
+
+	if len(rw.GroupBy) == 0 {
+		return nil
+	}
+
+	for _, name := range rw.GroupBy {
+		found := false
+		for i, cn := range rw.colNames {
+			if cn == name {
+				g.keyCols = append(g.keyCols, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("GroupBy column %q not found in result set", name)
+		}
+	}
+
+	for ci, c := range rw.Children {
+		plan, err := rw.buildFieldPlan(nil, func(i int) (string, bool) {
+			return strings.TrimPrefix(rw.colKeys[i], c.Prefix), rw.childIndex(i) == ci
+		})
+		if err != nil {
+			return err
+		}
+		g.childPlans = append(g.childPlans, plan)
+	}
+	g.childBufs = make([]bytes.Buffer, len(rw.Children))
+	g.childCount = make([]int, len(rw.Children))
+
+	return nil
+}
+
+// writeGroupedRows is the GroupBy version of WriteCommaRows.
+func (rw *RowsWriter) writeGroupedRows() error {
+
+	for rw.nextRow() {
+		err := rw.writeGroupedRow()
+		if err != nil {
+			return err
+		}
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+
+	err := rw.flushGroup()
+	if err != nil {
+		return err
+	}
+
+	// indented comma rows are not newline terminated
+	if rw.Indent != "" && rw.group.count > 0 {
+		_, err := io.WriteString(rw.Writer, "\n")
+		return err
+	}
+
+	return nil
+}
+
+// writeGroupedRow scans the current row and adds it to the current group,
+// writing out the prior group first if this row starts a new one.
+func (rw *RowsWriter) writeGroupedRow() error {
+
+	err := rw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+	g := &rw.group
+
+	// compute the key for this row using the JSON of the key columns
+	rw.rowOutBuf.Reset()
+	for _, i := range g.keyCols {
+		err := rw.writeValue(rw.scanArgs[i])
+		if err != nil {
+			return err
+		}
+		rw.rowOutBuf.WriteByte(',')
+	}
+
+	if g.open && !bytes.Equal(rw.rowOutBuf.Bytes(), g.key) {
+		g.key = append(g.key[:0], rw.rowOutBuf.Bytes()...) // flushGroup uses rowOutBuf
+		err := rw.flushGroup()
+		if err != nil {
+			return err
+		}
+	} else {
+		g.key = append(g.key[:0], rw.rowOutBuf.Bytes()...)
+	}
+
+	// first row of the group provides the parent fields
+	if !g.open {
+		rw.rowOutBuf.Reset()
+		err := rw.writeRowFields(rw.fieldPlan)
+		if err != nil {
+			return err
+		}
+		if rw.RowIndexField != "" {
+			rw.writeRowIndexField(int64(g.count))
+		}
+		if rw.ExtraFieldsFunc != nil {
+			err = rw.writeExtraFields()
+			if err != nil {
+				return err
+			}
+		}
+		g.parentBuf.Reset()
+		g.parentBuf.Write(rw.rowOutBuf.Bytes())
+		for ci := range g.childBufs {
+			g.childBufs[ci].Reset()
+			g.childCount[ci] = 0
+		}
+		g.open = true
+	}
+
+	// each row provides an object for each child array, unless all of its values are NULL (e.g. LEFT JOIN with no match)
+	for ci, plan := range g.childPlans {
+		if rw.childAllNull(plan) {
+			continue
+		}
+		rw.rowOutBuf.Reset()
+		err := rw.writeRowFields(plan)
+		if err != nil {
+			return err
+		}
+		cb := &g.childBufs[ci]
+		if g.childCount[ci] > 0 {
+			cb.WriteByte(',')
+		}
+		cb.WriteByte('{')
+		cb.Write(rw.rowOutBuf.Bytes())
+		cb.WriteByte('}')
+		g.childCount[ci]++
+	}
+
+	rw.rowOutBuf.Reset()
+	return nil
+}
+
+// childAllNull returns true if the values of the current row for the child plan are all NULL.
+func (rw *RowsWriter) childAllNull(plan []fieldOp) bool {
+	for _, op := range plan {
+		if op.col >= 0 && !isNullValue(rw.scanArgs[op.col]) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRowChildren appends the Children arrays of the current row to the row object in rowOutBuf,
+// each with the one child object of the row (or none if its values are all NULL).  It is used by
+// the methods that write a row at a time, which don't collapse rows into groups.
+func (rw *RowsWriter) writeRowChildren() error {
+	for ci, c := range rw.Children {
+		if b := rw.rowOutBuf.Bytes(); len(b) > 0 && b[len(b)-1] != '{' {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		rw.writeValue(c.Key)
+		rw.rowOutBuf.WriteString(":[")
+		if plan := rw.group.childPlans[ci]; !rw.childAllNull(plan) {
+			rw.rowOutBuf.WriteByte('{')
+			err := rw.writeRowFields(plan)
+			if err != nil {
+				return err
+			}
+			rw.rowOutBuf.WriteByte('}')
+		}
+		rw.rowOutBuf.WriteByte(']')
+	}
+	return nil
+}
+
+// flushGroup writes the current group, if any, as a comma row.
+func (rw *RowsWriter) flushGroup() error {
+
+	g := &rw.group
+	if !g.open {
+		return nil
+	}
+
+	rw.rowOutBuf.Reset()
+	if g.count > 0 {
+		rw.rowOutBuf.WriteByte(',')
+	}
+	rw.rowOutBuf.WriteByte('{')
+	rw.rowOutBuf.Write(g.parentBuf.Bytes())
+	for ci, c := range rw.Children {
+		if ci > 0 || g.parentBuf.Len() > 0 {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		rw.writeValue(c.Key)
+		rw.rowOutBuf.WriteString(":[")
+		rw.rowOutBuf.Write(g.childBufs[ci].Bytes())
+		rw.rowOutBuf.WriteByte(']')
+	}
+	rw.rowOutBuf.WriteString("}\n")
+
+	if rw.Indent != "" {
+		err := rw.indentRow(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.open = false
+	g.count++
+
+	return rw.writeOut(&rw.rowOutBuf)
+}
@@ -0,0 +1,95 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT w.widget_id, w.name, d.data AS data_text
+		FROM widgets w LEFT JOIN widgets_data d ON w.widget_id = d.widget_id
+		ORDER BY w.widget_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.GroupBy = []string{"widget_id"}
+	rw.Children = []ChildArray{{Key: "data", Prefix: "data_"}}
+	err = rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []struct {
+		WidgetID string `json:"widget_id"`
+		Data     []struct {
+			Text string `json:"text"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &result)
+	if err != nil {
+		t.Fatalf("invalid output %s: %v", buf.String(), err)
+	}
+	if len(result) != 2 || len(result[0].Data) != 1 {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+	t.Logf("OUTPUT: %s", buf.String())
+}
+
+func TestGroupByWriteRow(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"order_id", "INT", reflect.TypeOf(int64(0))},
+			{"item_name", "VARCHAR", reflect.TypeOf(sql.NullString{})},
+		},
+		rows: [][]interface{}{{int64(1), "a"}, {int64(1), "b"}, {int64(2), nil}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.GroupBy = []string{"order_id"}
+	rw.Children = []ChildArray{{Key: "items", Prefix: "item_"}}
+	for rw.Rows.Next() {
+		err := rw.WriteRow()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the rows are not collapsed but each keeps its child
+	want := `{"order_id":1,"items":[{"name":"a"}]}
+{"order_id":1,"items":[{"name":"b"}]}
+{"order_id":2,"items":[]}
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	rows.next = 0
+	buf.Reset()
+	rw = NewRowsWriter(&buf, rows)
+	rw.GroupBy = []string{"order_id"}
+	rw.Children = []ChildArray{{Key: "items", Prefix: "item_"}}
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `[
+{"order_id":1,"items":[{"name":"a"},{"name":"b"}]}
+,{"order_id":2,"items":[]}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
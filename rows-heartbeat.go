@@ -0,0 +1,76 @@
+package sqljsonutil
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	heartbeatJSON = []byte("\n")  // whitespace, valid between JSON values
+	heartbeatSSE  = []byte(":\n") // an SSE comment line
+)
+
+// heartbeat is the state of the goroutine writing heartbeats for Heartbeat.
+// The row loop holds mu except while waiting in Rows.Next, so heartbeats are only
+// written while waiting for a row and never in the middle of a row.
+type heartbeat struct {
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts writing msg every Heartbeat while waiting for rows and returns a
+// function to stop it.  If Heartbeat is not set or a heartbeat is already running it does nothing.
+func (rw *RowsWriter) startHeartbeat(msg []byte) (stop func()) {
+
+	if rw.Heartbeat <= 0 || rw.hb != nil {
+		return func() {}
+	}
+
+	hb := &heartbeat{stop: make(chan struct{}), done: make(chan struct{})}
+	hb.mu.Lock()
+	rw.hb = hb
+	count := rw.rowCount
+
+	go func() {
+		defer close(hb.done)
+
+		ticker := time.NewTicker(rw.Heartbeat)
+		defer ticker.Stop()
+
+		lastCount := count
+		for {
+			select {
+			case <-hb.stop:
+				return
+			case <-ticker.C:
+			}
+
+			hb.mu.Lock()
+			select {
+			case <-hb.stop:
+				hb.mu.Unlock()
+				return
+			default:
+			}
+			// only if no row was read since the last tick, and within MaxBytes
+			if rw.rowCount == lastCount && (rw.MaxBytes <= 0 || rw.BytesWritten()+int64(len(msg)) <= rw.MaxBytes) {
+				rw.heartbeatBytes += int64(len(msg))
+				rw.Writer.Write(msg)
+				if f, ok := rw.Writer.(http.Flusher); ok {
+					f.Flush()
+				}
+			}
+			lastCount = rw.rowCount
+			hb.mu.Unlock()
+		}
+	}()
+
+	return func() {
+		close(hb.stop)
+		hb.mu.Unlock()
+		<-hb.done
+		rw.hb = nil
+	}
+}
@@ -0,0 +1,67 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT widget_id, SLEEP(0.2) AS slept FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.Heartbeat = 50 * time.Millisecond
+	err = rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("OUTPUT: %q", buf.String())
+
+	var out []map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &out)
+	if err != nil || len(out) != 2 {
+		t.Errorf("invalid output %v: %q", err, buf.String())
+	}
+}
+
+// slowRows is a memRows that waits before each call to Next returns.
+type slowRows struct {
+	*memRows
+	delay time.Duration
+}
+
+func (r *slowRows) Next() bool {
+	time.Sleep(r.delay)
+	return r.memRows.Next()
+}
+
+func TestHeartbeatMaxBytes(t *testing.T) {
+
+	rows := &slowRows{
+		memRows: &memRows{cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}}},
+		delay:   200 * time.Millisecond,
+	}
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.Heartbeat = 5 * time.Millisecond
+	rw.MaxBytes = 4
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only as many heartbeats as fit in MaxBytes
+	if buf.String() != "[\n\n\n\n\n]\n" || rw.BytesWritten() != 4 {
+		t.Errorf("unexpected output (%d bytes written): %q", rw.BytesWritten(), buf.String())
+	}
+}
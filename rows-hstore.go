@@ -0,0 +1,115 @@
+package sqljsonutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isHstoreType returns true if dbTypeName is the Postgres hstore type.
+func isHstoreType(dbTypeName string) bool {
+	return strings.EqualFold(dbTypeName, "HSTORE")
+}
+
+// writeHstoreValue writes the hstore text, e.g. `"a"=>"1", "b"=>NULL`, as a JSON object
+// with the keys in the same order and NULL values written as null.
+func (rw *RowsWriter) writeHstoreValue(text string) error {
+
+	rw.rowOutBuf.WriteByte('{')
+	first := true
+	err := parseHstore(text, func(key string, val *string) error {
+		if !first {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		first = false
+		err := rw.writeValue(key)
+		if err != nil {
+			return err
+		}
+		rw.rowOutBuf.WriteByte(':')
+		if val == nil {
+			rw.rowOutBuf.WriteString("null")
+			return nil
+		}
+		return rw.writeValue(*val)
+	})
+	if err != nil {
+		return err
+	}
+	rw.rowOutBuf.WriteByte('}')
+	return nil
+}
+
+// parseHstore calls fn for each pair of the hstore text s.  Keys and values are double quoted
+// with backslash escapes, or unquoted, and a value of NULL (unquoted) is passed as nil.
+func parseHstore(s string, fn func(key string, val *string) error) error {
+
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return nil
+		}
+
+		key, rest, _, err := parseHstoreString(s)
+		if err != nil {
+			return err
+		}
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if !strings.HasPrefix(rest, "=>") {
+			return fmt.Errorf("invalid hstore value: expected => after %q", key)
+		}
+		val, rest, quoted, err := parseHstoreString(strings.TrimLeft(rest[2:], " \t\r\n"))
+		if err != nil {
+			return err
+		}
+
+		var valp *string
+		if quoted || !strings.EqualFold(val, "NULL") {
+			valp = &val
+		}
+		err = fn(key, valp)
+		if err != nil {
+			return err
+		}
+
+		s = strings.TrimLeft(rest, " \t\r\n")
+		if s != "" {
+			if s[0] != ',' {
+				return fmt.Errorf("invalid hstore value: expected , after %q", key)
+			}
+			s = s[1:]
+		}
+	}
+}
+
+// parseHstoreString parses a quoted or unquoted hstore key or value at the start of s.
+func parseHstoreString(s string) (str, rest string, quoted bool, err error) {
+
+	if s == "" || s[0] != '"' {
+		end := strings.IndexAny(s, "=, \t\r\n")
+		if end < 0 {
+			end = len(s)
+		} else if s[end] == '=' && !strings.HasPrefix(s[end:], "=>") {
+			return "", "", false, fmt.Errorf("invalid hstore value: unexpected = in %q", s)
+		}
+		if end == 0 {
+			return "", "", false, fmt.Errorf("invalid hstore value: expected string at %q", s)
+		}
+		return s[:end], s[end:], false, nil
+	}
+
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i < len(s) {
+				sb.WriteByte(s[i])
+			}
+		case '"':
+			return sb.String(), s[i+1:], true, nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", false, fmt.Errorf("invalid hstore value: unterminated string")
+}
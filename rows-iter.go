@@ -0,0 +1,36 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"errors"
+	"iter"
+)
+
+// Rows2 returns an iterator over the JSON object for each row, for use with range:
+//
+//	for row, err := range rw.Rows2() {
+//		if err != nil {
+//			return err
+//		}
+//		// send row to a channel, queue, file, etc.
+//	}
+//
+// The object is the same as WriteEach passes to send and is only valid until the next iteration.
+// If an error occurs it is yielded with a nil row as the last value.  Breaking out of the loop
+// leaves the remaining rows unread.
+func (rw *RowsWriter) Rows2() iter.Seq2[json.RawMessage, error] {
+	return func(yield func(json.RawMessage, error) bool) {
+		err := rw.WriteEach(func(row json.RawMessage) error {
+			if !yield(row, nil) {
+				return errStopRows2
+			}
+			return nil
+		})
+		if err != nil && err != errStopRows2 {
+			yield(nil, err)
+		}
+	}
+}
+
+// errStopRows2 is returned to WriteEach to stop when the loop over Rows2 is broken out of.
+var errStopRows2 = errors.New("sqljsonutil: Rows2 stopped")
@@ -0,0 +1,62 @@
+package sqljsonutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRows2(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var out []string
+	for row, err := range NewRowsWriter(nil, rows).Rows2() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(row))
+	}
+	if len(out) != 2 || out[1] != `{"widget_id":"def456","name":"Next One"}` {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestRows2Stop(t *testing.T) {
+
+	rows := &failingRows{
+		memRows: &memRows{
+			cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+			rows: [][]interface{}{{int64(1)}, {int64(2)}},
+		},
+		err: errors.New("connection lost"),
+	}
+
+	// breaking out of the loop leaves the remaining rows unread
+	n := 0
+	for range NewRowsWriter(nil, rows).Rows2() {
+		n++
+		break
+	}
+	if n != 1 || rows.next != 1 {
+		t.Errorf("expected 1 row read, got %d yielded, %d read", n, rows.next)
+	}
+
+	// an error is yielded last
+	var out []string
+	var lastErr error
+	for row, err := range NewRowsWriter(nil, rows).Rows2() {
+		out = append(out, string(row))
+		lastErr = err
+	}
+	if !reflect.DeepEqual(out, []string{`{"id":2}`, ""}) || lastErr != rows.err {
+		t.Errorf("unexpected output %q, error %v", out, lastErr)
+	}
+}
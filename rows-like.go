@@ -0,0 +1,59 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// RowsLike is the part of *sql.Rows that RowsWriter uses, so other row sources can be
+// written too: adapters for native drivers like pgx, or in-memory rows for tests.
+// *sql.Rows implements it.
+//
+// Only database/sql can create an *sql.ColumnType, so row sources that are not *sql.Rows
+// should also implement ColumnTyper, and may return nil from ColumnTypes.
+type RowsLike interface {
+	Columns() ([]string, error)
+	ColumnTypes() ([]*sql.ColumnType, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	NextResultSet() bool
+	Close() error
+}
+
+// ColumnType describes a column of a result set, as *sql.ColumnType does (and implements),
+// see ColumnTyper.  ScanType may return nil if the type is not known, and the values are then
+// scanned into an *interface{}.
+type ColumnType interface {
+	Name() string
+	DatabaseTypeName() string
+	ScanType() reflect.Type
+	Nullable() (nullable, ok bool)
+	Length() (length int64, ok bool)
+	DecimalSize() (precision, scale int64, ok bool)
+}
+
+// ColumnTyper is implemented by RowsLike sources that describe their columns with
+// ColumnType values instead of *sql.ColumnType.  If Rows implements it, RowsWriter uses
+// ColumnTypeInfo instead of ColumnTypes, and ScanArgFunc is called with these ColumnTypes.
+type ColumnTyper interface {
+	ColumnTypeInfo() ([]ColumnType, error)
+}
+
+// columnTypes returns the column types of rows, see ColumnTyper.
+func columnTypes(rows RowsLike) ([]ColumnType, error) {
+
+	if ctr, ok := rows.(ColumnTyper); ok {
+		return ctr.ColumnTypeInfo()
+	}
+
+	sqlTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	cts := make([]ColumnType, len(sqlTypes))
+	for i, ct := range sqlTypes {
+		cts[i] = ct
+	}
+	return cts, nil
+}
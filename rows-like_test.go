@@ -0,0 +1,193 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// memRows is an in-memory RowsLike with typed columns.  Values are scanned the way drivers
+// with their own scan types do: assigned (or converted) to the scan arg, into a new pointer
+// for pointer scan args, or with Scan for a sql.Scanner.
+type memRows struct {
+	cols []memColumn
+	rows [][]interface{}
+	next int
+}
+
+func (r *memRows) ColumnTypes() ([]*sql.ColumnType, error) { return nil, nil }
+func (r *memRows) Next() bool                              { r.next++; return r.next <= len(r.rows) }
+func (r *memRows) Err() error                              { return nil }
+func (r *memRows) NextResultSet() bool                     { return false }
+func (r *memRows) Close() error                            { return nil }
+
+func (r *memRows) Columns() ([]string, error) {
+	var names []string
+	for _, c := range r.cols {
+		names = append(names, c.name)
+	}
+	return names, nil
+}
+
+func (r *memRows) ColumnTypeInfo() ([]ColumnType, error) {
+	cts := make([]ColumnType, len(r.cols))
+	for i, c := range r.cols {
+		cts[i] = c
+	}
+	return cts, nil
+}
+
+func (r *memRows) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.next-1] {
+		if sc, ok := dest[i].(sql.Scanner); ok {
+			if err := sc.Scan(v); err != nil {
+				return err
+			}
+			continue
+		}
+		dv := reflect.ValueOf(dest[i]).Elem()
+		switch {
+		case v == nil:
+			dv.SetZero()
+		case dv.Kind() == reflect.Pointer:
+			p := reflect.New(dv.Type().Elem())
+			p.Elem().Set(reflect.ValueOf(v))
+			dv.Set(p)
+		default:
+			dv.Set(reflect.ValueOf(v).Convert(dv.Type()))
+		}
+	}
+	return nil
+}
+
+// memColumn is a ColumnType of a memRows column, a nil scanType for an unknown type.
+type memColumn struct {
+	name     string
+	dbType   string
+	scanType reflect.Type
+}
+
+func (ct memColumn) Name() string                       { return ct.name }
+func (ct memColumn) DatabaseTypeName() string           { return ct.dbType }
+func (ct memColumn) ScanType() reflect.Type             { return ct.scanType }
+func (ct memColumn) Nullable() (nullable, ok bool)      { return false, false }
+func (ct memColumn) Length() (length int64, ok bool)    { return 0, false }
+func (ct memColumn) DecimalSize() (p, s int64, ok bool) { return 0, 0, false }
+
+// testDriverColumn is a column of a result set from the sqljsonutil-test driver.
+type testDriverColumn struct {
+	name, dbType string
+	scanType     reflect.Type
+	nullable     bool
+	noNullable   bool  // the driver does not report nullability
+	length       int64 // reported if more than 0
+}
+
+// testDriverResult is the result of every query of a sqljsonutil-test DB.
+type testDriverResult struct {
+	cols []testDriverColumn
+	rows [][]driver.Value
+	err  error // returned by Next after the rows
+}
+
+var (
+	testDriverMu      sync.Mutex
+	testDriverResults = map[string]*testDriverResult{} // by DSN
+)
+
+func init() {
+	sql.Register("sqljsonutil-test", testDriver{})
+}
+
+// testDB returns a DB of the sqljsonutil-test driver, whose queries (with any arguments) return res.
+func testDB(t *testing.T, res *testDriverResult) *sql.DB {
+	t.Helper()
+
+	testDriverMu.Lock()
+	dsn := fmt.Sprint(len(testDriverResults))
+	testDriverResults[dsn] = res
+	testDriverMu.Unlock()
+
+	db, err := sql.Open("sqljsonutil-test", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testColumnTypes returns real *sql.ColumnType values for cols, from a query with the
+// sqljsonutil-test driver that returns them and no rows.
+func testColumnTypes(t *testing.T, cols []testDriverColumn) []*sql.ColumnType {
+	t.Helper()
+
+	rows, err := testDB(t, &testDriverResult{cols: cols}).Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cts
+}
+
+// testDriver is a database/sql driver whose queries return the result registered for the DSN.
+type testDriver struct{}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	testDriverMu.Lock()
+	defer testDriverMu.Unlock()
+	return testConn{testDriverResults[dsn]}, nil
+}
+
+type testConn struct{ res *testDriverResult }
+
+func (c testConn) Prepare(string) (driver.Stmt, error) { return c, nil }
+func (testConn) Close() error                          { return nil }
+func (testConn) Begin() (driver.Tx, error)             { return nil, fmt.Errorf("not supported") }
+func (testConn) NumInput() int                         { return -1 }
+func (testConn) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (c testConn) Query([]driver.Value) (driver.Rows, error) {
+	return &testDriverRows{res: c.res}, nil
+}
+
+type testDriverRows struct {
+	res  *testDriverResult
+	next int
+}
+
+func (*testDriverRows) Close() error { return nil }
+func (r *testDriverRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.res.rows) {
+		if r.res.err != nil {
+			return r.res.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.next])
+	r.next++
+	return nil
+}
+func (r *testDriverRows) Columns() []string {
+	var names []string
+	for _, c := range r.res.cols {
+		names = append(names, c.name)
+	}
+	return names
+}
+func (r *testDriverRows) ColumnTypeScanType(i int) reflect.Type   { return r.res.cols[i].scanType }
+func (r *testDriverRows) ColumnTypeDatabaseTypeName(i int) string { return r.res.cols[i].dbType }
+func (r *testDriverRows) ColumnTypeNullable(i int) (nullable, ok bool) {
+	return r.res.cols[i].nullable, !r.res.cols[i].noNullable
+}
+func (r *testDriverRows) ColumnTypeLength(i int) (length int64, ok bool) {
+	return r.res.cols[i].length, r.res.cols[i].length > 0
+}
@@ -0,0 +1,127 @@
+package sqljsonutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaskStrategy specifies how the values of a masked column are written, see MaskRule.
+type MaskStrategy int
+
+const (
+	MaskRedact  MaskStrategy = iota // write "***" (default)
+	MaskPartial                     // keep the last 4 characters, or the first character and domain of an email, e.g. "***6789", "j***@example.com"
+	MaskHash                        // write the hex SHA-256 of the value, so equal values can still be matched
+	MaskHMAC                        // write the hex HMAC-SHA256 of the value with Key, a stable identifier that can't be reversed by guessing values
+)
+
+// MaskRule masks the values of the columns whose name matches Pattern.  Masked values are
+// always written as JSON strings, NULL is still written according to NullPolicy.
+type MaskRule struct {
+	Pattern  string       // a path.Match pattern for the column name, case insensitive, e.g. "email", "ssn" or "*_token"
+	Strategy MaskStrategy // how matching values are written
+	Key      []byte       // the secret key for MaskHMAC
+}
+
+// DefaultMaskRules are applied by every RowsWriter after its own MaskRules, so that masking of
+// sensitive columns can be enforced in one place, e.g.:
+//
+//	sqljsonutil.DefaultMaskRules = []sqljsonutil.MaskRule{{Pattern: "*_token"}, {Pattern: "email", Strategy: sqljsonutil.MaskPartial}}
+//
+// It should only be set during program initialization.
+var DefaultMaskRules []MaskRule
+
+// maskRule returns the first rule of MaskRules and DefaultMaskRules that matches the column
+// named name, or nil.
+func (rw *RowsWriter) maskRule(name string) *MaskRule {
+	name = strings.ToLower(name)
+	for _, rules := range [...][]MaskRule{rw.MaskRules, DefaultMaskRules} {
+		for i := range rules {
+			if ok, _ := path.Match(strings.ToLower(rules[i].Pattern), name); ok {
+				return &rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// setupMasks populates colMasks from colNames, checking the rule patterns.
+func (rw *RowsWriter) setupMasks() error {
+
+	for _, rules := range [...][]MaskRule{rw.MaskRules, DefaultMaskRules} {
+		for _, rule := range rules {
+			if _, err := path.Match(strings.ToLower(rule.Pattern), ""); err != nil {
+				return fmt.Errorf("invalid mask pattern %q: %w", rule.Pattern, err)
+			}
+			if rule.Strategy == MaskHMAC && len(rule.Key) == 0 {
+				return fmt.Errorf("mask pattern %q requires a Key for MaskHMAC", rule.Pattern)
+			}
+		}
+	}
+
+	rw.colMasks = rw.colMasks[:0]
+	for _, name := range rw.colNames {
+		rw.colMasks = append(rw.colMasks, rw.maskRule(name))
+	}
+	return nil
+}
+
+// maskedColumnValue returns the JSON string to write for column i masked with rule.
+// The returned slice is only valid until the next call.
+func (rw *RowsWriter) maskedColumnValue(i int, rule *MaskRule) []byte {
+	rw.customBuf.Reset()
+	rw.customBuf.Write(AppendJSONString(rw.customBuf.AvailableBuffer(), maskText(scanText(rw.scanArgs[i]), rule)))
+	return rw.customBuf.Bytes()
+}
+
+// maskText returns the text s masked with rule.
+func maskText(s string, rule *MaskRule) string {
+	switch rule.Strategy {
+	case MaskPartial:
+		s = maskPartial(s)
+	case MaskHash:
+		sum := sha256.Sum256([]byte(s))
+		s = hex.EncodeToString(sum[:])
+	case MaskHMAC:
+		mac := hmac.New(sha256.New, rule.Key)
+		mac.Write([]byte(s))
+		s = hex.EncodeToString(mac.Sum(nil))
+	default:
+		s = "***"
+	}
+	return s
+}
+
+// CheckUnmasked returns an error if any of the columns colNames is masked by DefaultMaskRules.
+// It is used by code from GenerateGo, which does not apply masks.
+func CheckUnmasked(colNames ...string) error {
+	var rw RowsWriter
+	for _, name := range colNames {
+		if rw.maskRule(name) != nil {
+			return fmt.Errorf("column %q is masked by DefaultMaskRules, which generated code does not apply", name)
+		}
+	}
+	return nil
+}
+
+// maskPartial masks all but the last 4 characters of s, or for an email address all of the
+// local part but the first character.  Values too short to partly show are fully masked.
+func maskPartial(s string) string {
+
+	if local, domain, ok := strings.Cut(s, "@"); ok && local != "" && domain != "" {
+		r, _ := utf8.DecodeRuneInString(local)
+		return string(r) + "***@" + domain
+	}
+
+	n := utf8.RuneCountInString(s)
+	if n <= 4 {
+		return "***"
+	}
+	r := []rune(s)
+	return "***" + string(r[n-4:])
+}
@@ -0,0 +1,62 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+)
+
+// ColumnInfo describes a column of the result set, as written when ColumnMetadata is set.
+type ColumnInfo struct {
+	Name         string `json:"name"`               // the JSON key of the column in each row object
+	DatabaseType string `json:"databaseType"`       // the DatabaseTypeName, e.g. "VARCHAR"
+	Nullable     *bool  `json:"nullable,omitempty"` // nil if the driver does not report it
+	Length       *int64 `json:"length,omitempty"`   // nil if not a variable length type or the driver does not report it
+}
+
+// Columns returns the description of the columns of the current result set of Rows.
+// Columns not written (due to DuplicateLastWins or Children) are not included.
+func (rw *RowsWriter) Columns() ([]ColumnInfo, error) {
+
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cols := make([]ColumnInfo, 0, len(rw.colNames))
+	for i, ct := range rw.colTypes {
+		if rw.colDropped[i] || rw.childIndex(i) >= 0 {
+			continue
+		}
+		c := ColumnInfo{Name: rw.colKeys[i], DatabaseType: ct.DatabaseTypeName()}
+		if nullable, ok := ct.Nullable(); ok {
+			c.Nullable = &nullable
+		}
+		if length, ok := ct.Length(); ok {
+			c.Length = &length
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// writeColumnMetadata writes prefix, "columns":[...] and suffix to Writer.
+func (rw *RowsWriter) writeColumnMetadata(prefix, suffix string) error {
+
+	cols, err := rw.Columns()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(cols)
+	if err != nil {
+		return err
+	}
+
+	rw.rowOutBuf.Reset()
+	rw.rowOutBuf.WriteString(prefix)
+	rw.rowOutBuf.WriteString(`"columns":`)
+	rw.rowOutBuf.Write(b)
+	rw.rowOutBuf.WriteString(suffix)
+	_, err = rw.rowOutBuf.WriteTo(rw.Writer)
+	return err
+}
@@ -0,0 +1,139 @@
+package sqljsonutil
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// writeNestedElem writes v, a nested column value or an element of one, see colNested.
+func (rw *RowsWriter) writeNestedElem(v interface{}) error {
+	if ok, err := rw.writeDuckDBDecimal(v); ok {
+		return err
+	}
+	if ok, err := rw.writeNestedValue(v); ok {
+		return err
+	}
+	return rw.writeValue(v)
+}
+
+// writeNestedValue writes values writeValue has no case for that are pointers, slices, arrays
+// or maps, as scanned by clickhouse-go for Nullable, Array and Map columns and by go-duckdb
+// for LIST, STRUCT and MAP columns.  A pointer to a pointer or interface is NULL if the inner
+// one is nil, and otherwise its element is written.  Slices and arrays are written as a JSON
+// array and maps as a JSON object, with writeNestedElem for each element so they are written
+// the same as column values.  If false is returned v is none of these and nothing was written.
+func (rw *RowsWriter) writeNestedValue(v interface{}) (bool, error) {
+
+	if _, ok := v.(encoding.TextMarshaler); ok {
+		return false, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		switch e := rv.Elem(); e.Kind() {
+		case reflect.Pointer:
+			if e.IsNil() {
+				rw.rowOutBuf.WriteString("null")
+				return true, nil
+			}
+			return true, rw.writeNestedElem(e.Interface())
+		case reflect.Interface:
+			if e.IsNil() {
+				rw.rowOutBuf.WriteString("null")
+				return true, nil
+			}
+			// a pointer to the value, which writeValue has more cases for, e.g. *int32
+			p := reflect.New(e.Elem().Type())
+			p.Elem().Set(e.Elem())
+			return true, rw.writeNestedElem(p.Interface())
+		case reflect.Slice, reflect.Array, reflect.Map:
+			rv = e
+		default:
+			return false, nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			rw.rowOutBuf.WriteString("null")
+			return true, nil
+		}
+	case reflect.Array:
+		if !rv.CanAddr() {
+			p := reflect.New(rv.Type())
+			p.Elem().Set(rv)
+			rv = p.Elem()
+		}
+	case reflect.Map:
+		return true, rw.writeMapValue(rv)
+	default:
+		return false, nil
+	}
+
+	rw.rowOutBuf.WriteByte('[')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		err := rw.writeNestedElem(rv.Index(i).Addr().Interface())
+		if err != nil {
+			return true, err
+		}
+	}
+	rw.rowOutBuf.WriteByte(']')
+	return true, nil
+}
+
+// writeMapValue writes the map rv as a JSON object with writeNestedElem for each value, and the
+// keys sorted as encoding/json does.  Keys that are not strings, as in a go-duckdb MAP, are
+// written as their fmt.Sprint text, and an error is returned if two keys have the same text
+// (e.g. 1 and "1"), since which value was written would depend on the map iteration order.
+func (rw *RowsWriter) writeMapValue(rv reflect.Value) error {
+
+	if rv.IsNil() {
+		rw.rowOutBuf.WriteString("null")
+		return nil
+	}
+
+	keys := make([]string, 0, rv.Len())
+	vals := make(map[string]reflect.Value, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		ks := ""
+		if k.Kind() == reflect.String {
+			ks = k.String()
+		} else {
+			ks = fmt.Sprint(k.Interface())
+		}
+		if _, ok := vals[ks]; ok {
+			return fmt.Errorf("map value has more than one key written as %q", ks)
+		}
+		keys = append(keys, ks)
+		vals[ks] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	rw.rowOutBuf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		err := rw.writeValue(k)
+		if err != nil {
+			return err
+		}
+		rw.rowOutBuf.WriteByte(':')
+		p := reflect.New(rv.Type().Elem())
+		p.Elem().Set(vals[k])
+		err = rw.writeNestedElem(p.Interface())
+		if err != nil {
+			return err
+		}
+	}
+	rw.rowOutBuf.WriteByte('}')
+	return nil
+}
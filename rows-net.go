@@ -0,0 +1,62 @@
+package sqljsonutil
+
+import (
+	"net"
+	"net/netip"
+)
+
+// writeNetValue writes the network address value v, e.g. from a driver's scan type for a
+// Postgres INET, CIDR or MACADDR column, as its canonical string form ("192.168.0.1",
+// "10.0.0.0/8", "08:00:2b:01:02:03").  The zero value of each type is written as null.
+func (rw *RowsWriter) writeNetValue(v interface{}) error {
+
+	if isNullValue(v) {
+		rw.rowOutBuf.WriteString("null")
+		return nil
+	}
+
+	switch vt := v.(type) {
+	case *net.IP:
+		v = *vt
+	case *net.HardwareAddr:
+		v = *vt
+	case *netip.Addr:
+		v = *vt
+	case *netip.Prefix:
+		v = *vt
+	}
+
+	var s string
+	switch vt := v.(type) {
+	case net.IP:
+		if len(vt) > 0 {
+			s = vt.String()
+		}
+	case net.HardwareAddr:
+		if len(vt) > 0 {
+			s = vt.String()
+		}
+	case *net.IPNet:
+		if vt.IP != nil {
+			s = vt.String()
+		}
+	case net.IPNet:
+		if vt.IP != nil {
+			s = vt.String()
+		}
+	case netip.Addr:
+		if vt.IsValid() {
+			s = vt.String()
+		}
+	case netip.Prefix:
+		if vt.IsValid() {
+			s = vt.String()
+		}
+	}
+
+	if s == "" {
+		rw.rowOutBuf.WriteString("null")
+		return nil
+	}
+	return rw.writeValue(s)
+}
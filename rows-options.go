@@ -0,0 +1,161 @@
+package sqljsonutil
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// NewRowsWriterOpts is NewRowsWriter with opts applied to the RowsWriter, e.g.
+//
+//	rw := NewRowsWriterOpts(w, rows, WithMaxRows(1000), WithNullPolicy(NullOmit))
+//
+// The With... options set the RowsWriter field of the same name, and any func(*RowsWriter)
+// can be used as an Option for the rest.
+func NewRowsWriterOpts(w io.Writer, rows RowsLike, opts ...Option) *RowsWriter {
+	rw := NewRowsWriter(w, rows)
+	for _, opt := range opts {
+		opt(rw)
+	}
+	return rw
+}
+
+// WithConfig copies cfg into the Config of the RowsWriter, replacing all of its options, so
+// it should come before other options.
+func WithConfig(cfg *Config) Option {
+	return func(rw *RowsWriter) { rw.Config = *cfg }
+}
+
+// WithContext sets Context.
+func WithContext(ctx context.Context) Option {
+	return func(rw *RowsWriter) { rw.Context = ctx }
+}
+
+// WithMaxRows sets MaxRows.
+func WithMaxRows(n int) Option {
+	return func(rw *RowsWriter) { rw.MaxRows = n }
+}
+
+// WithMaxBytes sets MaxBytes.
+func WithMaxBytes(n int64) Option {
+	return func(rw *RowsWriter) { rw.MaxBytes = n }
+}
+
+// WithBufferSizes returns an Option that sets RowBufferSize and MaxRetainedBuffer, e.g. for
+// long-lived servers that see occasional huge rows.
+func WithBufferSizes(rowBufferSize, maxRetainedBuffer int) Option {
+	return func(rw *RowsWriter) {
+		rw.RowBufferSize = rowBufferSize
+		rw.MaxRetainedBuffer = maxRetainedBuffer
+	}
+}
+
+// WithFlushInterval sets FlushInterval.
+func WithFlushInterval(d time.Duration) Option {
+	return func(rw *RowsWriter) { rw.FlushInterval = d }
+}
+
+// WithHeartbeat sets Heartbeat.
+func WithHeartbeat(d time.Duration) Option {
+	return func(rw *RowsWriter) { rw.Heartbeat = d }
+}
+
+// WithTeeWriters sets TeeWriters.
+func WithTeeWriters(w ...io.Writer) Option {
+	return func(rw *RowsWriter) { rw.TeeWriters = w }
+}
+
+// WithAtomic sets Atomic.
+func WithAtomic() Option {
+	return func(rw *RowsWriter) { rw.Atomic = true }
+}
+
+// WithCompress sets Compress.
+func WithCompress() Option {
+	return func(rw *RowsWriter) { rw.Compress = true }
+}
+
+// WithErrorPolicy sets ErrorPolicy.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(rw *RowsWriter) { rw.ErrorPolicy = p }
+}
+
+// WithJSONValueFunc sets JSONValueFunc.
+func WithJSONValueFunc(f func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error)) Option {
+	return func(rw *RowsWriter) { rw.JSONValueFunc = f }
+}
+
+// WithColumnFormatter calls SetColumnFormatter.
+func WithColumnFormatter(colName string, f ValueFormatter) Option {
+	return func(rw *RowsWriter) { rw.SetColumnFormatter(colName, f) }
+}
+
+// WithTypeFormatter calls SetTypeFormatter.
+func WithTypeFormatter(dbTypeName string, f ValueFormatter) Option {
+	return func(rw *RowsWriter) { rw.SetTypeFormatter(dbTypeName, f) }
+}
+
+// WithNullPolicy sets NullPolicy.
+func WithNullPolicy(p NullPolicy) Option {
+	return func(rw *RowsWriter) { rw.NullPolicy = p }
+}
+
+// WithBinaryEncoding sets BinaryEncoding.
+func WithBinaryEncoding(e BinaryEncoding) Option {
+	return func(rw *RowsWriter) { rw.BinaryEncoding = e }
+}
+
+// WithInt64AsString sets Int64AsString.
+func WithInt64AsString() Option {
+	return func(rw *RowsWriter) { rw.Int64AsString = true }
+}
+
+// WithDecimalAsNumber sets DecimalAsNumber.
+func WithDecimalAsNumber() Option {
+	return func(rw *RowsWriter) { rw.DecimalAsNumber = true }
+}
+
+// WithIndent sets Indent.
+func WithIndent(indent string) Option {
+	return func(rw *RowsWriter) { rw.Indent = indent }
+}
+
+// WithMaskRules sets MaskRules.
+func WithMaskRules(rules ...MaskRule) Option {
+	return func(rw *RowsWriter) { rw.MaskRules = rules }
+}
+
+// WithIncludeColumns sets IncludeColumns.
+func WithIncludeColumns(names ...string) Option {
+	return func(rw *RowsWriter) { rw.IncludeColumns = names }
+}
+
+// WithColumnRenames sets ColumnRenames.
+func WithColumnRenames(renames map[string]string) Option {
+	return func(rw *RowsWriter) { rw.ColumnRenames = renames }
+}
+
+// WithColumnNameFunc sets ColumnNameFunc.
+func WithColumnNameFunc(f func(key string) string) Option {
+	return func(rw *RowsWriter) { rw.ColumnNameFunc = f }
+}
+
+// WithRawJSONColumns sets RawJSONColumns.
+func WithRawJSONColumns(names ...string) Option {
+	return func(rw *RowsWriter) { rw.RawJSONColumns = names }
+}
+
+// WithGroupBy sets GroupBy.
+func WithGroupBy(colNames ...string) Option {
+	return func(rw *RowsWriter) { rw.GroupBy = colNames }
+}
+
+// WithRowFilterFunc sets RowFilterFunc.
+func WithRowFilterFunc(f func(colNames []string, values []interface{}) (include bool, err error)) Option {
+	return func(rw *RowsWriter) { rw.RowFilterFunc = f }
+}
+
+// WithRowIndexField sets RowIndexField.
+func WithRowIndexField(name string) Option {
+	return func(rw *RowsWriter) { rw.RowIndexField = name }
+}
@@ -0,0 +1,146 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+)
+
+// encodeWorker encodes rows on its own goroutine with a copy of the RowsWriter, see EncodeWorkers.
+type encodeWorker struct {
+	rw   *RowsWriter
+	copy []func(dst, src interface{}) // copies each scan arg value into rw.scanArgs
+	in   chan int                     // row number of the row to encode
+	out  chan error                   // result of encoding, the row is left in rw.rowOutBuf
+}
+
+// parallelRows returns true if WriteCommaRows should encode the rows with EncodeWorkers.
+func (rw *RowsWriter) parallelRows() bool {
+	return rw.EncodeWorkers > 1 && len(rw.GroupBy) == 0
+}
+
+// newEncodeWorker returns a worker with a copy of the options and column setup of rw and
+// its own buffers and scan args, and starts its goroutine.
+func (rw *RowsWriter) newEncodeWorker() *encodeWorker {
+
+	c := new(RowsWriter)
+	*c = *rw
+	c.Writer, c.hb = nil, nil
+	c.rowOutBuf, c.valOutBuf, c.customBuf, c.indentBuf, c.msgBuf = bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}
+	c.valOutBytes, c.geoBuf, c.colWriters, c.group = nil, nil, nil, groupState{}
+
+	w := &encodeWorker{rw: c, in: make(chan int), out: make(chan error, 1)}
+	c.scanArgs = make([]interface{}, len(rw.scanArgs))
+	for i, arg := range rw.scanArgs {
+		c.scanArgs[i] = reflect.New(reflect.TypeOf(arg).Elem()).Interface()
+		w.copy = append(w.copy, scanArgCopier(arg))
+	}
+	c.setupColWriters()
+
+	go func() {
+		for row := range w.in {
+			c.rowCount = row
+			c.rowOutBuf.Reset()
+			if row > 1 {
+				c.rowOutBuf.WriteByte(',')
+			}
+			w.out <- c.buildRowObject(true)
+		}
+	}()
+	return w
+}
+
+// scanArgCopier returns a function that copies the value of a scan arg of the same type as arg.
+// sql.RawBytes are only valid until the next call to Next, so they are copied.
+func scanArgCopier(arg interface{}) func(dst, src interface{}) {
+	if _, ok := arg.(*sql.RawBytes); ok {
+		return func(dst, src interface{}) {
+			d, s := dst.(*sql.RawBytes), src.(*sql.RawBytes)
+			if *s == nil {
+				*d = nil
+				return
+			}
+			*d = append((*d)[:0], *s...)
+		}
+	}
+	return func(dst, src interface{}) {
+		reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+	}
+}
+
+// writeParallelRows is WriteCommaRows with the rows encoded by EncodeWorkers goroutines.  Rows
+// are scanned on this goroutine and handed to the workers in turn, so with n workers up to n
+// rows are being encoded at once, and the rows are written in the order they were scanned.
+// The error returned is the first one in row order, after all the workers are done.
+func (rw *RowsWriter) writeParallelRows() (int, error) {
+
+	workers := make([]*encodeWorker, rw.EncodeWorkers)
+	defer func() {
+		for _, w := range workers {
+			if w != nil {
+				close(w.in)
+			}
+		}
+	}()
+
+	var err error
+	n, done := 0, 0 // rows handed to the workers and collected from them
+
+	// collect waits for the row being encoded by w and writes it, unless there was an error
+	collect := func(w *encodeWorker) {
+		werr := <-w.out
+		done++
+		if err == nil {
+			err = werr
+		}
+		if err == nil {
+			err = rw.writeOut(&w.rw.rowOutBuf)
+		}
+	}
+
+	for err == nil && rw.nextRow() {
+
+		if len(rw.colNames) == 0 {
+			err = rw.setupColumns()
+			if err != nil {
+				break
+			}
+		}
+		if rw.prescanned {
+			rw.prescanned = false
+		} else {
+			err = rw.Rows.Scan(rw.scanArgs...)
+			if err != nil {
+				break
+			}
+		}
+		rw.rowCount++
+		rw.totalRows++
+
+		w := workers[n%len(workers)]
+		if w == nil {
+			w = rw.newEncodeWorker()
+			workers[n%len(workers)] = w
+		} else {
+			collect(w)
+			if err != nil {
+				break
+			}
+		}
+		for i, arg := range rw.scanArgs {
+			w.copy[i](w.rw.scanArgs[i], arg)
+		}
+		w.in <- rw.rowCount
+		n++
+	}
+
+	// the rows still being encoded, oldest first; after an error they are waited for but not written
+	for done < n {
+		collect(workers[done%len(workers)])
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, rw.rowsErr()
+}
@@ -0,0 +1,77 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+var rowsWriterPool = sync.Pool{New: func() interface{} { return new(RowsWriter) }}
+
+// maxPooledBuffer is the largest buffer capacity Release keeps, so a single response with
+// very large values doesn't pin that much memory in the pool.  MaxRetainedBuffer can lower it.
+const maxPooledBuffer = 64 << 10
+
+// GetRowsWriter is like NewRowsWriter but returns a RowsWriter from a pool, with the internal
+// buffers and per-column slices of a previously released one, so busy handlers don't allocate
+// them for each request.  All options have their zero values.  Call Release when done with it.
+func GetRowsWriter(w io.Writer, rows RowsLike) *RowsWriter {
+	rw := rowsWriterPool.Get().(*RowsWriter)
+	rw.Writer, rw.Rows = w, rows
+	return rw
+}
+
+// Release clears rw, including all options, and returns it to the pool used by GetRowsWriter.
+// rw must not be used after calling Release.  RowsWriters from NewRowsWriter may be released too.
+func (rw *RowsWriter) Release() {
+
+	rw.Reset(nil)
+	limit := rw.pooledBufferLimit()
+
+	// keep the memory of the internal buffers and slices, clear everything else
+	kept := RowsWriter{
+		colNames:      rw.colNames[:0],
+		colKeys:       rw.colKeys[:0],
+		colDropped:    rw.colDropped[:0],
+		fieldPlan:     clearSlice(rw.fieldPlan),
+		colTypes:      clearSlice(rw.colTypes),
+		colBinary:     rw.colBinary[:0],
+		colDecimal:    rw.colDecimal[:0],
+		colBool:       rw.colBool[:0],
+		colUUID:       rw.colUUID[:0],
+		colGeo:        rw.colGeo[:0],
+		colHstore:     rw.colHstore[:0],
+		colNested:     rw.colNested[:0],
+		colRawJSON:    rw.colRawJSON[:0],
+		colWriters:    clearSlice(rw.colWriters),
+		colFormatters: clearSlice(rw.colFormatters),
+		colMasks:      clearSlice(rw.colMasks),
+	}
+	if cap(rw.valOutBytes) <= limit {
+		kept.valOutBytes = rw.valOutBytes[:0]
+	}
+	if cap(rw.geoBuf) <= limit {
+		kept.geoBuf = rw.geoBuf[:0]
+	}
+	for _, b := range [...]struct{ from, to *bytes.Buffer }{
+		{&rw.rowOutBuf, &kept.rowOutBuf},
+		{&rw.valOutBuf, &kept.valOutBuf},
+		{&rw.customBuf, &kept.customBuf},
+		{&rw.indentBuf, &kept.indentBuf},
+		{&rw.msgBuf, &kept.msgBuf},
+	} {
+		if b.from.Cap() <= limit {
+			b.from.Reset()
+			*b.to = *b.from
+		}
+	}
+
+	*rw = kept
+	rowsWriterPool.Put(rw)
+}
+
+// clearSlice zeroes the elements of s, so they can be garbage collected, and returns it with length 0.
+func clearSlice[T any](s []T) []T {
+	clear(s[:cap(s)])
+	return s[:0]
+}
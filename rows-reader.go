@@ -0,0 +1,106 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewRowsJSONReader returns an io.Reader that reads rows as the same JSON WriteResponse
+// writes.  Rows are read and encoded as the output is read, so the result set is never held
+// in memory; useful for http.Client request bodies, uploads and other APIs that take a Reader.
+// opts are applied to the RowsWriter used, the same as with QueryHandler.
+//
+// As with WriteResponse, if MaxBytes is exceeded the array is closed and Read then returns ErrMaxBytes.
+func NewRowsJSONReader(rows RowsLike, opts ...Option) io.Reader {
+	r := &rowsJSONReader{}
+	r.rw = NewRowsWriterOpts(&r.buf, rows, opts...)
+	return r
+}
+
+type rowsJSONReader struct {
+	rw      *RowsWriter
+	buf     bytes.Buffer // output not yet read
+	started bool
+	done    bool
+	err     error // returned once buf is drained
+}
+
+// Read implements io.Reader.
+func (r *rowsJSONReader) Read(p []byte) (int, error) {
+
+	for r.buf.Len() == 0 {
+		if r.done {
+			if r.err != nil {
+				return 0, r.err
+			}
+			return 0, io.EOF
+		}
+		r.fill()
+	}
+
+	return r.buf.Read(p)
+}
+
+// fill writes the next part of the output to buf.
+func (r *rowsJSONReader) fill() {
+
+	rw := r.rw
+
+	if !r.started {
+		r.started = true
+		if rw.ColumnMetadata {
+			r.err = rw.writeColumnMetadata("{", ",\"rows\":[\n")
+			r.done = r.err != nil
+			return
+		}
+		r.buf.WriteString("[\n")
+		return
+	}
+
+	if rw.nextRow() {
+		var err error
+		if len(rw.GroupBy) > 0 {
+			err = rw.writeGroupedRow()
+		} else {
+			err = rw.WriteCommaRow()
+		}
+		if err == nil {
+			return
+		}
+		r.done, r.err = true, err
+		if err == ErrMaxBytes {
+			r.writeEnd()
+		}
+		return
+	}
+
+	r.done = true
+	r.err = rw.rowsErr()
+	if r.err != nil {
+		return
+	}
+
+	n := rw.rowCount
+	if len(rw.GroupBy) > 0 {
+		r.err = rw.flushGroup()
+		if r.err != nil {
+			return
+		}
+		n = rw.group.count
+	}
+
+	// indented comma rows are not newline terminated
+	if rw.Indent != "" && n > 0 {
+		r.buf.WriteByte('\n')
+	}
+	r.writeEnd()
+}
+
+// writeEnd writes the end of the array (and envelope if ColumnMetadata is set).
+func (r *rowsJSONReader) writeEnd() {
+	if r.rw.ColumnMetadata {
+		r.buf.WriteString("]}\n")
+		return
+	}
+	r.buf.WriteString("]\n")
+}
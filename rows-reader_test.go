@@ -0,0 +1,26 @@
+package sqljsonutil
+
+import (
+	"io"
+	"testing"
+)
+
+func TestNewRowsJSONReader(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	b, err := io.ReadAll(NewRowsJSONReader(rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "[\n{\"widget_id\":\"abc123\",\"name\":\"First One\"}\n,{\"widget_id\":\"def456\",\"name\":\"Next One\"}\n]\n" {
+		t.Errorf("unexpected output: %s", b)
+	}
+}
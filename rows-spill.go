@@ -0,0 +1,117 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"database/sql"
+	"unicode/utf8"
+)
+
+// spillChunk is the most bytes of a value spillValue escapes at a time.
+const spillChunk = 32 << 10
+
+// canSpill returns true if the values of the row about to be built may be spilled, see SpillThreshold.
+func (rw *RowsWriter) canSpill() bool {
+	return rw.SpillThreshold > 0 && rw.MaxBytes <= 0 && rw.Indent == "" && rw.RowTransform == "" &&
+		!rw.ValidateOutput && len(rw.GroupBy) == 0
+}
+
+// spillText returns the text value of column i if it should be spilled: the row may be
+// spilled, the value is longer than SpillThreshold and none of the value options apply to it.
+func (rw *RowsWriter) spillText(i int) (string, bool) {
+
+	if !rw.spillRow {
+		return "", false
+	}
+
+	var s string
+	switch vt := scanValue(rw.scanArgs[i]).(type) {
+	case string:
+		s = vt
+	case []byte:
+		s = unsafeString(vt)
+	case sql.RawBytes:
+		s = unsafeString(vt)
+	default:
+		return "", false
+	}
+	if len(s) <= rw.SpillThreshold || !rw.plainColumn(i) {
+		return "", false
+	}
+	// the other UTF8Policy values need the whole value
+	if rw.UTF8Policy != UTF8Replace && !utf8.ValidString(s) {
+		return "", false
+	}
+	return s, true
+}
+
+// spilledValue is a value held back from rowOutBuf by spillValue, to be written at pos.
+type spilledValue struct {
+	pos int
+	s   string
+}
+
+// spillValue holds back s, the value of the field being written, to be written as a JSON string
+// by writeRowOut once the rest of the row has been built.
+func (rw *RowsWriter) spillValue(s string) {
+	rw.spills = append(rw.spills, spilledValue{pos: rw.rowOutBuf.Len(), s: s})
+}
+
+// writeRowOut writes the row in rowOutBuf with writeOut.  If values were held back by spillValue
+// they are written in their place directly to Writer, escaped in chunks of at most spillChunk
+// bytes.  As that only happens after the whole row was built, an error from a later column
+// (e.g. a formatter or StrictTypes) doesn't leave part of the row written.
+func (rw *RowsWriter) writeRowOut() error {
+
+	if len(rw.spills) == 0 {
+		return rw.writeOut(&rw.rowOutBuf)
+	}
+
+	row := rw.rowOutBuf.Bytes()
+	buf := &rw.valOutBuf
+	buf.Reset()
+	prev := 0
+	for _, sp := range rw.spills {
+		buf.Write(row[prev:sp.pos])
+		buf.WriteByte('"')
+		prev = sp.pos
+
+		s := sp.s
+		for len(s) > 0 {
+			// don't split a UTF-8 sequence
+			end := min(len(s), spillChunk)
+			for n := 1; n < utf8.UTFMax && end < len(s) && !utf8.RuneStart(s[end]); n++ {
+				end--
+			}
+			chunk := s[:end]
+			s = s[end:]
+
+			if rw.ControlCharPolicy != ControlCharEscape {
+				chunk = rw.mapControlChars(chunk)
+			}
+			b := appendJSONString(buf.AvailableBuffer(), chunk, rw.EscapeHTML)
+			buf.Write(b[1 : len(b)-1]) // without the quotes
+			err := rw.writeRowPart(buf)
+			if err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte('"')
+	}
+	buf.Write(row[prev:])
+	rw.rowOutBuf.Reset()
+	rw.spills = clearSlice(rw.spills) // don't keep the values
+
+	return rw.writeOut(buf)
+}
+
+// writeRowPart writes buf, part of a row, to Writer.  It is writeOut without ending the row.
+func (rw *RowsWriter) writeRowPart(buf *bytes.Buffer) error {
+	err := rw.reserveBytes(buf.Len())
+	if err != nil {
+		buf.Reset()
+		return err
+	}
+	_, err = buf.WriteTo(rw.Writer)
+	return err
+}
@@ -0,0 +1,110 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+)
+
+// WriteSSE writes all rows as Server-Sent Events, one event per row with the row object as
+// its data, so large results can be streamed live to a browser EventSource.  The event name
+// and id are taken from SSEEvent and SSEIDColumn if set.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to "text/event-stream".
+// If it is an http.Flusher the output is flushed after each row.
+func (rw *RowsWriter) WriteSSE() error {
+
+	if ok, err := rw.withOutput(true, rw.WriteSSE); ok {
+		return err
+	}
+
+	if w, ok := rw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+	}
+
+	defer rw.startHeartbeat(heartbeatSSE)()
+
+	for rw.nextRow() {
+		err := rw.WriteSSERow()
+		if err != nil {
+			return err
+		}
+	}
+	return rw.rowsErr()
+}
+
+// WriteSSERow will call rows.Scan with the appropriate arguments and write the result as a
+// Server-Sent Event, flushing the Writer if it is an http.Flusher.
+func (rw *RowsWriter) WriteSSERow() error {
+
+	err := rw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	buf := &rw.msgBuf
+	buf.Reset()
+
+	if rw.SSEEvent != "" {
+		buf.WriteString("event: ")
+		writeSSEField(buf, []byte(rw.SSEEvent))
+	}
+
+	if rw.SSEIDColumn != "" {
+		i := -1
+		for j, name := range rw.colNames {
+			if name == rw.SSEIDColumn {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("SSEIDColumn %q not found", rw.SSEIDColumn)
+		}
+		id, null, err := rw.columnText(i)
+		if err != nil {
+			return err
+		}
+		if !null {
+			buf.WriteString("id: ")
+			writeSSEField(buf, id)
+		}
+	}
+
+	rw.rowOutBuf.Reset()
+	err = rw.buildRowObject(false)
+	if err != nil {
+		return err
+	}
+
+	// each line of the object (more than one if Indent is set) is a data line
+	for _, line := range bytes.Split(bytes.TrimRight(rw.rowOutBuf.Bytes(), "\n"), []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	rw.rowOutBuf.Reset()
+
+	err = rw.writeOut(buf)
+	if err != nil {
+		return err
+	}
+
+	if f, ok := rw.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeSSEField writes v followed by a newline, leaving out any line breaks in v.
+func writeSSEField(buf *bytes.Buffer, v []byte) {
+	for _, c := range v {
+		if c != '\n' && c != '\r' {
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,37 @@
+package sqljsonutil
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteSSE(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	w := httptest.NewRecorder()
+	rw := NewRowsWriter(w, rows)
+	rw.SSEEvent = "widget"
+	rw.SSEIDColumn = "widget_id"
+	err = rw.WriteSSE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Header().Get("Content-Type") != "text/event-stream" || !w.Flushed {
+		t.Errorf("unexpected headers %v or not flushed", w.Header())
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "event: widget\nid: abc123\ndata: {\"widget_id\":\"abc123\",\"name\":\"First One\"}\n\n") {
+		t.Errorf("unexpected output: %s", body)
+	}
+	t.Logf("OUTPUT: %s", body)
+}
@@ -0,0 +1,151 @@
+package sqljsonutil
+
+import (
+	"io"
+	"net/http"
+)
+
+// newTeeWriter returns Writer with TeeWriters added, or nil if there are none or they were
+// added already.  The result is an http.ResponseWriter if Writer is one.
+func (rw *RowsWriter) newTeeWriter() io.Writer {
+
+	if len(rw.TeeWriters) == 0 {
+		return nil
+	}
+	switch w := rw.Writer.(type) {
+	case *teeWriter, *teeResponseWriter:
+		return nil
+	case http.ResponseWriter:
+		return &teeResponseWriter{ResponseWriter: w, tees: rw.TeeWriters}
+	}
+	return &teeWriter{w: rw.Writer, tees: rw.TeeWriters}
+}
+
+// withOutput is the output path shared by the Write... methods for whole responses, which
+// start with:
+//
+//	if ok, err := rw.withOutput(true, rw.WriteResponse); ok {
+//		return err
+//	}
+//
+// It sets Writer to compress (if compress is true, see Compress) and then copy to TeeWriters,
+// calls write, which calls withOutput again and gets false, and restores Writer.  If there is
+// nothing to add to Writer, false is returned without calling write.
+func (rw *RowsWriter) withOutput(compress bool, write func() error) (bool, error) {
+
+	prev := rw.Writer
+	var cw *compressWriter
+	if compress {
+		cw = rw.newCompressWriter()
+		if cw != nil {
+			rw.Writer = cw
+		}
+	}
+	tw := rw.newTeeWriter()
+	if tw != nil {
+		rw.Writer = tw
+	}
+	if cw == nil && tw == nil {
+		return false, nil
+	}
+
+	err := write()
+	rw.Writer = prev
+	if cw != nil {
+		cerr := cw.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	return true, err
+}
+
+// teeMessage writes a copy of the message p to TeeWriters followed by a newline, for the
+// Write... methods that send messages rather than write to Writer.
+func (rw *RowsWriter) teeMessage(p []byte) error {
+	for _, t := range rw.TeeWriters {
+		_, err := t.Write(p)
+		if err == nil {
+			_, err = t.Write([]byte{'\n'})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTee writes p to w and then to each of tees, stopping at the first error.
+func writeTee(w io.Writer, tees []io.Writer, p []byte) (int, error) {
+	n, err := w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	for _, t := range tees {
+		if _, err := t.Write(p); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// teeWriter copies what is written to it to tees, see TeeWriters.
+type teeWriter struct {
+	w    io.Writer
+	tees []io.Writer
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	return writeTee(w.w, w.tees, p)
+}
+
+// teeResponseWriter is teeWriter for an http.ResponseWriter.  Only the body is copied.
+type teeResponseWriter struct {
+	http.ResponseWriter
+	tees []io.Writer
+}
+
+func (w *teeResponseWriter) Write(p []byte) (int, error) {
+	return writeTee(w.ResponseWriter, w.tees, p)
+}
+
+// Flush flushes the response, the tees are not flushed.
+func (w *teeResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController.
+func (w *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingWriter counts the bytes written to w, for the WriteTo methods.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// writeTo calls write with Writer set to w and returns the number of bytes written, see WriteTo.
+func (rw *RowsWriter) writeTo(w io.Writer, write func() error) (int64, error) {
+	cw := &countingWriter{w: w}
+	prev := rw.Writer
+	rw.Writer = cw
+	err := write()
+	rw.Writer = prev
+	return cw.n, err
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, implementing io.WriterTo.
+// It returns the number of bytes written to w, and is meant for plain writers like files and
+// buffers rather than http.ResponseWriters, as no headers are set.
+func (rw *RowsWriter) WriteTo(w io.Writer) (int64, error) {
+	return rw.writeTo(w, rw.WriteResponse)
+}
@@ -0,0 +1,52 @@
+package sqljsonutil
+
+import "encoding/json"
+
+// RowsToJSON reads all of rows and returns them as a compact JSON array of objects,
+// for when the result is needed in memory rather than written to a stream.
+// opts are applied to the RowsWriter used, the same as with QueryHandler.
+func RowsToJSON(rows RowsLike, opts ...Option) ([]byte, error) {
+
+	rw := NewRowsWriterOpts(nil, rows, opts...)
+
+	out := []byte{'['}
+	err := rw.WriteEach(func(row json.RawMessage) error {
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, row...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, ']'), nil
+}
+
+// RowsToRawMessages reads all of rows and returns the JSON object for each row.
+// opts are applied to the RowsWriter used, the same as with QueryHandler.
+func RowsToRawMessages(rows RowsLike, opts ...Option) ([]json.RawMessage, error) {
+
+	rw := NewRowsWriterOpts(nil, rows, opts...)
+
+	// all rows share one buffer, sliced up at the end
+	var buf []byte
+	var ends []int
+	err := rw.WriteEach(func(row json.RawMessage) error {
+		buf = append(buf, row...)
+		ends = append(ends, len(buf))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]json.RawMessage, len(ends))
+	start := 0
+	for i, end := range ends {
+		ret[i] = json.RawMessage(buf[start:end:end])
+		start = end
+	}
+	return ret, nil
+}
@@ -0,0 +1,39 @@
+package sqljsonutil
+
+import (
+	"testing"
+)
+
+func TestRowsToJSON(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	b, err := RowsToJSON(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[{"widget_id":"abc123","name":"First One"},{"widget_id":"def456","name":"Next One"}]` {
+		t.Errorf("unexpected output: %s", b)
+	}
+
+	rows, err = db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	msgs, err := RowsToRawMessages(rows, func(rw *RowsWriter) { rw.RowIndexField = "_row" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || string(msgs[1]) != `{"widget_id":"def456","name":"Next One","_row":1}` {
+		t.Errorf("unexpected output: %q", msgs)
+	}
+}
@@ -0,0 +1,46 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// transformRow replaces the row object in rowOutBuf with the result of RowTransform applied to it,
+// keeping the leading comma of a comma row.
+func (rw *RowsWriter) transformRow() error {
+
+	if rw.rowTransform == nil || rw.rowTransformExpr != rw.RowTransform {
+		n, err := compileJMESPath(rw.RowTransform)
+		if err != nil {
+			return fmt.Errorf("RowTransform %q: %w", rw.RowTransform, err)
+		}
+		rw.rowTransform, rw.rowTransformExpr = n, rw.RowTransform
+	}
+
+	obj := bytes.TrimSpace(rw.rowOutBuf.Bytes())
+	comma := len(obj) > 0 && obj[0] == ','
+	if comma {
+		obj = obj[1:]
+	}
+
+	v, err := decodeJMESValue(json.NewDecoder(bytes.NewReader(obj)))
+	if err != nil {
+		return err
+	}
+
+	// indentRow resets indentBuf before using it
+	rw.indentBuf.Reset()
+	if comma {
+		rw.indentBuf.WriteByte(',')
+	}
+	err = appendJMESValue(&rw.indentBuf, rw.rowTransform.eval(v), rw.EscapeHTML)
+	if err != nil {
+		return err
+	}
+	rw.indentBuf.WriteByte('\n')
+
+	rw.rowOutBuf.Reset()
+	rw.rowOutBuf.Write(rw.indentBuf.Bytes())
+	return nil
+}
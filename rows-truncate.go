@@ -0,0 +1,52 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"unicode/utf8"
+)
+
+// maxStringLength returns the maximum length in characters of the values of the column named
+// colName, or 0 for no maximum, see TruncateStrings and MaxStringLength.
+func (rw *RowsWriter) maxStringLength(colName string) int {
+	if n, ok := rw.TruncateStrings[colName]; ok {
+		return n
+	}
+	return rw.MaxStringLength
+}
+
+// writeTruncatedValue writes the text value of v cut to n characters followed by TruncateMarker,
+// and sets valueTruncated.  If false is returned v is NULL, not text or not longer than n and
+// nothing was written.
+func (rw *RowsWriter) writeTruncatedValue(v interface{}, n int) (bool, error) {
+
+	var s string
+	switch vt := scanValue(v).(type) {
+	case string:
+		s = vt
+	case []byte:
+		s = unsafeString(vt)
+	case sql.RawBytes:
+		s = unsafeString(vt)
+	default:
+		return false, nil
+	}
+	if len(s) <= n || utf8.RuneCountInString(s) <= n {
+		return false, nil
+	}
+
+	end := 0
+	for i := 0; i < n; i++ {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+	}
+	rw.valueTruncated = true
+	return true, rw.writeValue(s[:end] + rw.TruncateMarker)
+}
+
+// truncatedField returns true if a "<key>_truncated" field may be written after values of a
+// column of type ct, for the schemas.
+func (rw *RowsWriter) truncatedField(ct ColumnType) bool {
+	return rw.TruncatedFields && rw.maxStringLength(ct.Name()) > 0 &&
+		!isBinaryType(ct.DatabaseTypeName()) && !containsString(rw.BinaryColumns, ct.Name()) &&
+		scanArgKind(newScanArg(ct)) == kindText
+}
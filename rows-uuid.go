@@ -0,0 +1,65 @@
+package sqljsonutil
+
+import (
+	"database/sql"
+	"encoding/hex"
+)
+
+// isUUIDColumn returns true if 16 byte values of the column should be written as UUID strings,
+// see UUIDColumns.
+func (rw *RowsWriter) isUUIDColumn(colName, dbTypeName string) bool {
+	return containsString(rw.UUIDColumns, colName) || dbTypeName == "UUID" || dbTypeName == "UNIQUEIDENTIFIER"
+}
+
+// writeUUIDValue writes the 16 byte value of v as a UUID string, with the first three groups
+// byte swapped if mixed is true.  If false is returned v is NULL or not 16 bytes and nothing
+// was written.
+func (rw *RowsWriter) writeUUIDValue(v interface{}, mixed bool) bool {
+
+	u, ok := uuidValue(v, mixed)
+	if !ok {
+		return false
+	}
+
+	vob := append(rw.valOutBytes[:0], '"')
+	vob = appendUUID(vob, u)
+	vob = append(vob, '"')
+	rw.rowOutBuf.Write(vob)
+	rw.valOutBytes = vob
+	return true
+}
+
+// uuidValue returns the UUID held by scan arg v if it is 16 bytes, see writeUUIDValue.
+func uuidValue(v interface{}, mixed bool) (u [16]byte, ok bool) {
+
+	var b []byte
+	switch vt := scanValue(v).(type) {
+	case []byte:
+		b = vt
+	case sql.RawBytes:
+		b = vt
+	}
+	if len(b) != 16 {
+		return u, false
+	}
+
+	copy(u[:], b)
+	if mixed {
+		u[0], u[1], u[2], u[3] = u[3], u[2], u[1], u[0]
+		u[4], u[5] = u[5], u[4]
+		u[6], u[7] = u[7], u[6]
+	}
+	return u, true
+}
+
+// appendUUID appends u to dst in the canonical 8-4-4-4-12 form.
+func appendUUID(dst []byte, u [16]byte) []byte {
+	for i, end := range [...]int{4, 6, 8, 10, 16} {
+		if i > 0 {
+			dst = append(dst, '-')
+		}
+		start := [...]int{0, 4, 6, 8, 10}[i]
+		dst = hex.AppendEncode(dst, u[start:end])
+	}
+	return dst
+}
@@ -0,0 +1,56 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// InvalidOutputError is returned with ValidateOutput when invalid JSON was written, e.g. by a
+// JSONValueFunc.
+type InvalidOutputError struct {
+	Row    int    // the row number in the result set starting at 1, or 0 for the whole document
+	Column string // the column whose value is invalid, or "" for the row object or document
+	JSON   string // the invalid JSON
+	Err    error  // the syntax error
+}
+
+func (e *InvalidOutputError) Error() string {
+	switch {
+	case e.Column != "":
+		return fmt.Sprintf("sqljsonutil: invalid JSON for row %d column %q: %v: %s", e.Row, e.Column, e.Err, e.JSON)
+	case e.Row > 0:
+		return fmt.Sprintf("sqljsonutil: invalid JSON for row %d: %v: %s", e.Row, e.Err, e.JSON)
+	}
+	return fmt.Sprintf("sqljsonutil: invalid JSON document: %v", e.Err)
+}
+
+func (e *InvalidOutputError) Unwrap() error { return e.Err }
+
+// validateJSON returns an InvalidOutputError if b is not valid JSON.
+func (rw *RowsWriter) validateJSON(b []byte, row int, column string) error {
+
+	if json.Valid(b) {
+		return nil
+	}
+
+	// json.Valid doesn't say what is wrong, Compact does
+	var buf bytes.Buffer
+	err := json.Compact(&buf, b)
+	if err == nil {
+		err = fmt.Errorf("invalid JSON")
+	}
+	return &InvalidOutputError{Row: row, Column: column, JSON: string(b), Err: err}
+}
+
+// validateColumnValue checks the value of column i written to rowOutBuf from offset start.
+func (rw *RowsWriter) validateColumnValue(i, start int) error {
+	return rw.validateJSON(rw.rowOutBuf.Bytes()[start:], rw.rowCount, rw.colNames[i])
+}
+
+// validateRowObject checks the row written to rowOutBuf, which may start with a comma.
+func (rw *RowsWriter) validateRowObject() error {
+	b := bytes.TrimSpace(rw.rowOutBuf.Bytes())
+	b = bytes.TrimSpace(bytes.TrimPrefix(b, []byte(",")))
+	return rw.validateJSON(b, rw.rowCount, "")
+}
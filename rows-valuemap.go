@@ -0,0 +1,48 @@
+package sqljsonutil
+
+import (
+	"strings"
+)
+
+// ValueMap maps the values of a column, see RowsWriter.ValueMaps.
+type ValueMap struct {
+	// Labels maps values to what is written for them, e.g. {"A": "Active", "S": "Suspended"} for
+	// an ENUM or {"1": "pending", "2": "shipped"} for a status code.  Other values are written
+	// as-is.
+	Labels map[string]string
+
+	// Set, if true, causes the value to be split on commas, as for a MySQL SET column, and written
+	// as an array of strings (each mapped with Labels), e.g. "red,blue" as ["red","blue"].
+	Set bool
+}
+
+// writeMappedValue writes the text of a value mapped according to m.  If false is returned
+// the value is not mapped and nothing was written.
+func (rw *RowsWriter) writeMappedValue(text string, m ValueMap) (bool, error) {
+
+	if !m.Set {
+		label, ok := m.Labels[text]
+		if !ok {
+			return false, nil
+		}
+		return true, rw.writeValue(label)
+	}
+
+	rw.rowOutBuf.WriteByte('[')
+	if text != "" {
+		for i, part := range strings.Split(text, ",") {
+			if i > 0 {
+				rw.rowOutBuf.WriteByte(',')
+			}
+			if label, ok := m.Labels[part]; ok {
+				part = label
+			}
+			err := rw.writeValue(part)
+			if err != nil {
+				return true, err
+			}
+		}
+	}
+	rw.rowOutBuf.WriteByte(']')
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package sqljsonutil
+
+import (
+	"bytes"
+)
+
+// WebSocketConn is the part of a WebSocket connection used by WriteWebSocket.  It matches
+// the WriteMessage method of github.com/gorilla/websocket.Conn, other libraries can be
+// adapted with WebSocketFunc.
+type WebSocketConn interface {
+	WriteMessage(messageType int, data []byte) error
+}
+
+// WebSocketTextMessage is the message type passed to WebSocketConn.WriteMessage, the
+// same value as websocket.TextMessage in gorilla/websocket.
+const WebSocketTextMessage = 1
+
+// WebSocketFunc adapts a function that sends a text message to a WebSocketConn, e.g. for nhooyr.io/websocket:
+//
+//	conn := sqljsonutil.WebSocketFunc(func(data []byte) error {
+//		return c.Write(ctx, websocket.MessageText, data)
+//	})
+type WebSocketFunc func(data []byte) error
+
+// WriteMessage implements WebSocketConn.
+func (f WebSocketFunc) WriteMessage(messageType int, data []byte) error {
+	return f(data)
+}
+
+// WriteWebSocket sends all rows to conn as text messages, one JSON object per message or,
+// if WebSocketBatch is more than 1, a JSON array of up to WebSocketBatch rows per message.
+// GroupBy is not applied.  TeeWriters get a copy of each message followed by a newline.
+func (rw *RowsWriter) WriteWebSocket(conn WebSocketConn) error {
+
+	buf := &rw.msgBuf
+	buf.Reset()
+	n := 0
+
+	send := func() error {
+		if rw.WebSocketBatch > 1 {
+			buf.WriteByte(']')
+		}
+		err := rw.reserveBytes(buf.Len())
+		if err == nil {
+			err = conn.WriteMessage(WebSocketTextMessage, buf.Bytes())
+		}
+		if err == nil {
+			err = rw.teeMessage(buf.Bytes())
+		}
+		buf.Reset()
+		n = 0
+		return err
+	}
+
+	for rw.nextRow() {
+
+		err := rw.buildRow(false)
+		if err != nil {
+			return err
+		}
+
+		if rw.WebSocketBatch > 1 {
+			if n == 0 {
+				buf.WriteByte('[')
+			} else {
+				buf.WriteByte(',')
+			}
+		}
+		buf.Write(bytes.TrimRight(rw.rowOutBuf.Bytes(), "\n"))
+		rw.rowOutBuf.Reset()
+		n++
+
+		if n >= rw.WebSocketBatch {
+			err = send()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := rw.rowsErr(); err != nil {
+		return err
+	}
+
+	if n > 0 {
+		return send()
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package sqljsonutil
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestWriteWebSocket(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var messages []string
+	rw := NewRowsWriter(nil, rows)
+	rw.WebSocketBatch = 10
+	err = rw.WriteWebSocket(WebSocketFunc(func(data []byte) error {
+		messages = append(messages, string(data))
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 1 || messages[0] != `[{"widget_id":"abc123","name":"First One"},{"widget_id":"def456","name":"Next One"}]` {
+		t.Errorf("unexpected messages: %q", messages)
+	}
+	t.Logf("MESSAGES: %q", messages)
+}
+
+func TestWriteWebSocketTeeWriters(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+		rows: [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}},
+	}
+	var audit bytes.Buffer
+	rw := NewRowsWriter(nil, rows)
+	rw.WebSocketBatch = 2
+	rw.TeeWriters = []io.Writer{&audit}
+	err := rw.WriteWebSocket(WebSocketFunc(func(data []byte) error { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"id":1},{"id":2}]
+[{"id":3}]
+`
+	if audit.String() != want {
+		t.Errorf("unexpected copy: %s", audit.String())
+	}
+}
@@ -2,15 +2,27 @@ package sqljsonutil
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
-	"unsafe"
+	"unicode/utf8"
 )
 
 // FIXME:
@@ -20,7 +32,215 @@ import (
 // names that came from the SQL result set.
 type RowsWriter struct {
 	Writer io.Writer // write output here
-	Rows   *sql.Rows // SQL result rows to read from
+	Rows   RowsLike  // SQL result rows to read from, usually *sql.Rows
+
+	// TeeWriters, if set, get a copy of everything the Write... methods for whole responses
+	// (WriteResponse, WriteNDJSON, WriteColumnar, WriteEncoded, etc.) write to Writer, or of the
+	// messages WriteWebSocket sends, so a single pass over the rows can serve a response and e.g.
+	// write an audit copy to a file.  The copy is uncompressed, and an error writing to any of
+	// them stops the output and is returned.
+	TeeWriters []io.Writer
+
+	// Context, if not nil, is checked for cancellation before each row is read.  If it is done
+	// Rows is closed and the context error is returned, so an export stops when e.g. the client
+	// disconnects.  WriteResponseContext and the other ...Context methods set this for the call.
+	Context context.Context
+
+	// IfNoneMatch is the If-None-Match header of the request, for ETag and ETagVersion.
+	IfNoneMatch string
+
+	// AcceptEncoding is the Accept-Encoding header of the request, for Compress.
+	AcceptEncoding string
+
+	// Config holds the options, whose fields are promoted so they can be set directly on the
+	// RowsWriter, e.g. rw.MaxRows = 100.  It can also be built once and copied in, see Config.
+	Config
+
+	colNames          []string
+	colKeys           []string // JSON key for each column
+	colDropped        []bool   // columns not output due to DuplicateLastWins
+	rowCount          int      // rows scanned from the current result set
+	fieldPlan         []fieldOp
+	group             groupState
+	colTypes          []ColumnType
+	colBinary         []bool
+	colDecimal        []bool
+	colBool           []bool
+	colUUID           []int8              // 1 for UUID columns, 2 for mixed-endian ones
+	colGeo            []int8              // 1 for GeoJSON columns, 2 for ones that may be in the MySQL internal format
+	geoBuf            []byte              // decoded hex EWKB
+	colHstore         []bool              // true for hstore columns
+	colNested         []bool              // true for array, map and struct columns of ClickHouse and DuckDB
+	colRawJSON        []bool              // true for RawJSONColumns
+	colWriters        []func() error      // writes the value of each column, see setupColWriters
+	colWriterOpts     colWriterOpts       // the options colWriters were chosen by
+	valueTruncated    bool                // set by writeTruncatedValue, reset for each field by writeRowFields
+	spillRow          bool                // large values of the row being built may be spilled, see SpillThreshold
+	spills            []spilledValue      // values of the row held back by spillValue
+	colFormatters     [][2]ValueFormatter // column and type formatter for each column
+	colMasks          []*MaskRule         // mask rule for each column, or nil
+	scanArgs          []interface{}
+	rowOutBuf         bytes.Buffer
+	valOutBuf         bytes.Buffer
+	customBuf         bytes.Buffer
+	indentBuf         bytes.Buffer
+	msgBuf            bytes.Buffer // one message for WriteSSE etc.
+	loopErr           error        // set when nextRow stops due to Context or an error
+	prescanned        bool         // the current row was already scanned by nextRow
+	truncated         bool         // set when nextRow stops due to MaxRows or MaxBytes is exceeded
+	bytesWritten      int64        // rows output counted against MaxBytes
+	heartbeatBytes    int64        // heartbeats written, also counted against MaxBytes
+	flushedRows       int          // rowCount at the last flush
+	lastFlush         time.Time
+	hb                *heartbeat
+	totalRows         int64 // rows scanned from all result sets
+	progressRows      int64 // totalRows at the last OnProgress call
+	valOutBytes       []byte
+	jsonFieldSuffixes []string
+	rowTransform      *jmesNode // compiled RowTransform
+	rowTransformExpr  string    // the RowTransform rowTransform was compiled from
+}
+
+// Config is the configuration of a RowsWriter (policies, hooks, formats and limits), separate
+// from the state of the query being written, so it can be built once and shared by the handlers
+// of many requests instead of each setting up the same options:
+//
+//	var widgetsConfig = sqljsonutil.Config{NullPolicy: sqljsonutil.NullOmit, MaxRows: 1000}
+//	...
+//	rw := sqljsonutil.NewRowsWriterOpts(w, rows, sqljsonutil.WithConfig(&widgetsConfig))
+//
+// RowsWriter only reads its copy of the Config, and SetColumnFormatter and SetTypeFormatter
+// copy the maps they change, so a shared Config is not modified by the RowsWriters using it.
+//
+// Options should be set before the first row is written.  What applies to each column is worked
+// out once, when the columns are set up, so that rows are written without checking every option
+// for every value.  Changes to the value options (Int64AsString, DecimalAsNumber, BinaryEncoding,
+// ValueMaps, FloatPrecision, TruncateStrings, MaxStringLength, etc.) after that are noticed and
+// apply from the next row, while the column lists, masks and formatters (BinaryColumns,
+// BooleanColumns, MaskRules, SetColumnFormatter, etc.) only apply after Reset.
+type Config struct {
+	// MaxRows, if more than 0, is the maximum number of rows read from each result set.
+	// Once it is reached the remaining rows are not written and Truncated returns true, so a
+	// runaway query can't produce an unbounded response.  Envelope formats like WriteColumnar
+	// also write "truncated":true.  With GroupBy this limits the rows read, not the objects written.
+	MaxRows int
+
+	// MaxBytes, if more than 0, is the output budget in bytes for the rows written by the JSON
+	// methods (WriteResponse, WriteCommaRows, WriteColumnar, WriteSSE, etc.).  A row that would
+	// exceed it is not written, Truncated returns true and ErrMaxBytes is returned.  WriteResponse,
+	// WriteResultSets, WriteColumnar and WriteArrayResponse still close the JSON before returning
+	// ErrMaxBytes, so the output is valid and WriteColumnar includes "truncated":true.
+	MaxBytes int64
+
+	// SpillThreshold, if more than 0, is the length in bytes above which text values are escaped
+	// in chunks directly to Writer instead of being buffered with the rest of the row, bounding
+	// the memory used for rows with very large TEXT/BLOB values.  It applies to WriteRow and
+	// WriteCommaRow (and so WriteResponse) unless MaxBytes, Indent, RowTransform, ValidateOutput
+	// or GroupBy is used, since those need the whole row.  The row is still built (and its other
+	// values checked) before anything of it is written.
+	SpillThreshold int
+
+	// EncodeWorkers, if more than 1, is the number of goroutines WriteCommaRows (and so
+	// WriteResponse) encodes rows on, for CPU-bound exports of many rows.  The rows are still
+	// scanned one at a time and written in order, and the error returned is the first one in row
+	// order.  JSONValueFunc, ExtraFieldsFunc and the formatters are then called concurrently and
+	// must be safe for that.  It is not used with GroupBy, and SpillThreshold does not apply.
+	EncodeWorkers int
+
+	// RowBufferSize, if more than 0, is the initial capacity in bytes of the buffer rows are
+	// built in, 1024 by default.  Set it to about the size of a typical row to avoid growing it.
+	RowBufferSize int
+
+	// MaxRetainedBuffer, if more than 0, is the largest capacity in bytes the internal buffers
+	// keep after a row is written and after Reset.  Buffers that grew beyond it for a huge row are
+	// dropped, so long-lived RowsWriters (and the pool, see Release) don't pin that memory.
+	MaxRetainedBuffer int
+
+	// FlushEvery, if more than 0, flushes the Writer after every FlushEvery rows if it is an
+	// http.Flusher, so clients start receiving data before the response buffer fills up.
+	FlushEvery int
+
+	// FlushInterval, if more than 0, flushes the Writer (if it is an http.Flusher) when at least
+	// this long has passed since the last flush.  It is checked between rows, including before
+	// the first, so the start of the response is sent right away on a slow query.
+	FlushInterval time.Duration
+
+	// BatchRows and BatchBytes, if more than 0, hold the rows written by WriteCommaRows (and so
+	// WriteResponse), WriteNDJSON and WriteJSONSeq in memory until that many rows or bytes have
+	// accumulated, then write them to Writer at once.  This cuts the number of Write calls (and
+	// syscalls) for network writers compared to one per row.  Flushes (FlushEvery, FlushInterval
+	// and Heartbeat) write the rows held so far first.
+	BatchRows  int
+	BatchBytes int
+
+	// Atomic, if true, causes WriteResponse to build the complete output in memory and only write
+	// it to Writer once all rows have been read without error.  If there is an error nothing has
+	// been written, so the caller can still send a clean error response instead of a half written
+	// array.  Use it for endpoints with results small enough to hold in memory, see AtomicLimit.
+	Atomic bool
+
+	// AtomicLimit, if more than 0, is the most bytes of output Atomic will buffer.  If the output
+	// is larger, WriteResponse returns ErrAtomicLimit and nothing is written.
+	AtomicLimit int64
+
+	// ValidateOutput, if true, checks that each value and row object written is valid JSON, and
+	// with Atomic or ETag also the whole document, returning an *InvalidOutputError with the row
+	// number and column otherwise.  It is a debugging aid for JSONValueFunc, formatters and
+	// the like, and slows writing down.
+	ValidateOutput bool
+
+	// ETag, if true and the Writer is an http.ResponseWriter, causes WriteResponse to buffer the
+	// output (as with Atomic) and set the ETag header to a hash of it.  If it matches IfNoneMatch,
+	// a 304 Not Modified response is sent instead of the body.  The headers have to be sent before
+	// the body, so the whole output is held in memory (up to AtomicLimit) to hash it first.
+	ETag bool
+
+	// ETagVersion, if not empty, is used instead of the output to make the ETag, e.g. a version
+	// number or last modified time of the data the query reads.  The ETag can then be checked
+	// before any rows are read, and the output is streamed, not buffered, even if ETag is also
+	// set (unless Atomic is set).
+	ETagVersion string
+
+	// Compress, if true and the Writer is an http.ResponseWriter, compresses the output of the
+	// JSON write methods with the first of Compressors, gzip or deflate that AcceptEncoding allows,
+	// setting the Content-Encoding and Vary headers.  Flushing flushes the compressor first,
+	// so streamed rows and heartbeats still reach the client as they are written.
+	Compress bool
+
+	// Compressors are additional encodings for Compress (e.g. zstd or brotli), preferred in
+	// order over the built in gzip and deflate.
+	Compressors []Compressor
+
+	// ErrorPolicy controls what is written when an error (e.g. from the database connection) stops
+	// WriteResponse, WriteNDJSON or WriteJSONSeq after rows have been written.  The default,
+	// ErrorReturn, just returns the error, so the output is cut short and not valid JSON.
+	// ErrorRecord writes a final element (or record) with the error message and, for WriteResponse,
+	// closes the array, so clients can tell the result is incomplete.  The error message is sent
+	// to the client, so use it with care for public endpoints.
+	ErrorPolicy ErrorPolicy
+
+	// ErrorKey is the key of the error message in the ErrorRecord object, "_error" if empty.
+	ErrorKey string
+
+	// ErrorTrailer, if not empty and the Writer is an http.ResponseWriter, is the name of an
+	// HTTP trailer (e.g. "X-Error") that is set to the error message in the same cases as ErrorPolicy.
+	ErrorTrailer string
+
+	// Heartbeat, if more than 0, causes a newline (or an SSE comment line for WriteSSE) to be
+	// written and flushed every Heartbeat while waiting for the next row, so proxies and load
+	// balancers don't time out the connection during a slow query.  Whitespace between JSON values
+	// is harmless to parsers.  Only applies to JSON output methods that write to Writer, and the
+	// heartbeat runs in a separate goroutine, so Writer must not be written to concurrently by anything else.
+	// Heartbeats count towards MaxBytes and BytesWritten, and are skipped if they would exceed MaxBytes.
+	Heartbeat time.Duration
+
+	// OnProgress, if not nil, is called every ProgressEvery rows with the total rows read and
+	// bytes written (see BytesWritten) so far, and once more when the rows are done, e.g. to
+	// report the progress of an export.  It is called from the row loop, between rows.
+	OnProgress func(rowsWritten int64, bytesWritten int64)
+
+	// ProgressEvery is the number of rows between OnProgress calls, 1000 if zero.
+	ProgressEvery int
 
 	// JSONValueFunc, if not nil, gives you the ability to convert individual
 	// fields to JSON using custom logic.
@@ -38,54 +258,461 @@ type RowsWriter struct {
 	// If a non-nil err is returned then this will be returned to the top level calling code.
 	JSONValueFunc func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error)
 
-	colNames          []string
-	scanArgs          []interface{}
-	rowOutBuf         bytes.Buffer
-	rowOutEnc         *json.Encoder
-	valOutBuf         bytes.Buffer
-	valOutBytes       []byte
-	jsonFieldSuffixes []string
+	// ScanArgFunc, if set, is called once per column to return the scan arg (the pointer passed
+	// to Rows.Scan) for it, overriding the type chosen from the ColumnType, e.g. new(sql.NullString)
+	// to scan a driver's TIMESTAMP values as text.  Returning nil uses the default.  For *sql.Rows
+	// ct is an *sql.ColumnType, for other RowsLike sources the ColumnType from ColumnTypeInfo.
+	ScanArgFunc func(ct ColumnType) interface{}
+
+	// Int64AsString, if true, causes integer values that cannot be exactly represented
+	// as a float64 (i.e. outside of +/- 2^53-1) to be written as JSON strings instead of numbers.
+	// JavaScript clients otherwise silently lose precision on things like snowflake IDs and hashes.
+	// Values within range are still written as numbers.
+	Int64AsString bool
+
+	// Int64AsStringColumns is the same as Int64AsString but only applies to the columns named here.
+	Int64AsStringColumns []string
+
+	// Uint64Policy controls how unsigned 64-bit integers are written, since values above
+	// the int64 range (e.g. MySQL BIGINT UNSIGNED) cannot be handled by many consumers.
+	// The default is Uint64AsNumber.
+	Uint64Policy Uint64Policy
+
+	// FloatPolicy controls how NaN and infinite float values are written, since JSON has no
+	// representation for them.  The default is FloatSpecialNull.
+	FloatPolicy FloatPolicy
+
+	// FloatPrecision gives a fixed number of digits after the decimal point for the values of
+	// specific float columns, e.g. {"price": 2}.  Other float values are written with as many
+	// digits as needed to represent them exactly.
+	FloatPrecision map[string]int
+
+	// UTF8Policy controls how string and text column values that are not valid UTF-8 (e.g. latin1
+	// data in a utf8 column, or binary data) are written.  The default is UTF8Replace.
+	UTF8Policy UTF8Policy
+
+	// ControlCharPolicy controls how ASCII control characters other than tab, newline and
+	// carriage return in string values are written.  The default ControlCharEscape writes them
+	// as JSON escapes, which is valid JSON but can break consumers and downstream systems.
+	ControlCharPolicy ControlCharPolicy
+
+	// TruncateStrings gives the maximum length in characters of the values of specific text
+	// columns, e.g. {"description": 200}, so list endpoints don't write very large values.
+	// A length of 0 disables truncation for the column.  MaxStringLength applies to the others.
+	TruncateStrings map[string]int
+
+	// MaxStringLength, if > 0, is the maximum length in characters of text column values not
+	// in TruncateStrings.
+	MaxStringLength int
+
+	// TruncateMarker is appended to truncated values, e.g. "...".
+	TruncateMarker string
+
+	// TruncatedFields, if true, causes a "<key>_truncated":true field to be written after each
+	// truncated value.  Only the formats that write a JSON object per row (WriteResponse,
+	// WriteNDJSON, WriteEach, etc.) have the field, the array and non-JSON formats (WriteColumnar,
+	// WriteEncoded, CSV, etc.) truncate values without marking them.
+	TruncatedFields bool
+
+	// BinaryEncoding controls how values of binary columns are written.  Binary columns
+	// are detected by their DatabaseTypeName (BLOB, BINARY, VARBINARY, BYTEA, etc.) or can be
+	// listed explicitly in BinaryColumns.  The default is BinaryRawString.
+	BinaryEncoding BinaryEncoding
+
+	// BinaryColumns names additional columns that should be treated as binary.
+	BinaryColumns []string
+
+	// RawJSONColumns names columns whose values are JSON text (e.g. JSON columns, or built with
+	// JSON_OBJECT in the query) to be written as is instead of as strings, so they appear as
+	// nested objects and arrays.  NULL is written as null.  The values are not validated, a value
+	// that isn't valid JSON makes the output invalid.
+	RawJSONColumns []string
+
+	// UUIDColumns names BINARY(16) columns whose values are written as canonical UUID strings
+	// (e.g. "6ba7b810-9dad-11d1-80b4-00c04fd430c8") instead of according to BinaryEncoding.
+	// 16 byte values of UUID and UNIQUEIDENTIFIER columns are always written this way.
+	UUIDColumns []string
+
+	// UUIDMixedEndian, if true, causes the first three groups of UUIDColumns values to be byte
+	// swapped, for the mixed-endian order SQL Server uses for UNIQUEIDENTIFIER (which is
+	// always read this way).
+	UUIDMixedEndian bool
+
+	// GeoJSON, if true, causes GEOMETRY and GEOGRAPHY column values to be written as GeoJSON
+	// geometry objects, e.g. {"type":"Point","coordinates":[1.5,2]}, as are the values of
+	// GeoJSONColumns.  Values may be in the MySQL internal format, WKB (e.g. from ST_AsBinary)
+	// or PostGIS EWKB as binary or hex text.  Points, LineStrings and Polygons are supported.
+	GeoJSON        bool
+	GeoJSONColumns []string
+
+	// GeoJSONFunc, if set, is called for the geometry types other than Point, LineString and
+	// Polygon with the WKB type code (e.g. 4 for MultiPoint, without Z/M flags) and the WKB,
+	// and returns the GeoJSON to write.  Without it these types are an error.
+	GeoJSONFunc func(geomType uint32, wkb []byte) ([]byte, error)
+
+	// DecimalAsNumber, if true, causes DECIMAL/NUMERIC column values to be written as JSON numbers.
+	// By default these columns are scanned as strings and written as JSON strings, which preserves
+	// their exact value (consumers parsing numbers into float64 would round them).
+	DecimalAsNumber bool
+
+	// MySQLBooleans, if true, causes BIT and TINYINT column values of 0 and 1 to be written as
+	// false and true, for MySQL's BOOLEAN (an alias for TINYINT(1)) and BIT(1) columns.  Other
+	// values are written as numbers, so e.g. a TINYINT status of 2 is not made true.  The display
+	// width is not available from the MySQL driver, so BIT columns are only skipped if the driver
+	// reports a length other than 1.  BooleanColumns lists columns to write this way explicitly.
+	MySQLBooleans bool
+
+	// ValueMaps maps the values of specific columns, by column name, e.g. status codes to labels
+	// or MySQL SET values to arrays, see ValueMap.
+	ValueMaps map[string]ValueMap
+
+	// BooleanColumns names columns whose 0 and 1 (or other integer) values are written as false and true.
+	BooleanColumns []string
+
+	// NullPolicy controls what is written for NULL values.  The default, NullWrite, writes null.
+	NullPolicy NullPolicy
+
+	// NullDefaults gives the JSON value to write in place of NULL for specific columns when
+	// NullPolicy is NullDefault, e.g. {"tags": json.RawMessage("[]")}.  Columns not listed here
+	// get the zero value for their type (e.g. "", 0, false).
+	NullDefaults map[string]json.RawMessage
+
+	// StrictTypes, if true, causes an error to be returned for values of types with no built-in
+	// handling, as can come from the custom ScanType of a driver.  By default these are written
+	// the same as encoding/json.  Values implementing json.Marshaler or driver.Valuer are
+	// always written, using MarshalJSON or the value returned by Value.  The pointers, slices
+	// and maps of ClickHouse Nullable, Array and Map columns and DuckDB LIST, STRUCT and MAP
+	// columns are written as their elements, JSON arrays and objects, each element checked the same way.
+	StrictTypes bool
+
+	// EscapeHTML, if true, causes <, > and & in string values to be escaped (as \u003c etc.) so the
+	// output is safe to embed in HTML, the same as json.Encoder.SetEscapeHTML.
+	EscapeHTML bool
+
+	// Indent, if not empty, causes each row object to be written as indented multi-line JSON
+	// using this string for each indentation level (e.g. "  " or "\t"), for human readable output.
+	// Rows written with WriteCommaRow are indented one level and separated by ",\n".
+	Indent string
+
+	// RowTransform, if not empty, is a JMESPath expression applied to each row object before
+	// it is written, so the output can be reshaped in configuration rather than code, e.g.
+	// "{id: widget_id, label: name}" or "address.city".  The result, which need not be an
+	// object, is written in place of the row.  Only a subset of JMESPath is supported (see
+	// compileJMESPath): no filters, slices or functions.  An invalid expression is returned as
+	// an error when the first row is written.  It is not applied to rows grouped with GroupBy.
+	RowTransform string
+
+	// MaskRules mask the values of sensitive columns by name, e.g. {Pattern: "*_token"}, see
+	// MaskRule.  DefaultMaskRules are applied after these.  Masking takes precedence over
+	// JSONValueFunc and the formatters, and applies to all output formats.
+	MaskRules []MaskRule
+
+	// ColumnMetadata, if true, describes the columns before the rows so generic clients can
+	// interpret them: WriteResponse writes {"columns":[...],"rows":[...]} instead of just the
+	// array, and WriteNDJSON and WriteJSONSeq write a {"columns":[...]} record first.  Each column
+	// is described by a ColumnInfo.
+	ColumnMetadata bool
+
+	// IncludeColumns, if not empty, names the only columns that are written, e.g. from a client's
+	// field selection (see ParseODataQuery).  The other columns are still read but not output.
+	IncludeColumns []string
+
+	// ColumnRenames maps column names to the JSON keys to write them as, e.g. {"usr_nm": "userName"},
+	// to fix awkward names without an AS clause in every query.  It is applied after
+	// DuplicateColumns, so a key qualified by DuplicateQualify (e.g. "users.id") can be renamed too.
+	ColumnRenames map[string]string
+
+	// StripPrefixes are prefixes removed from the JSON keys of columns not in ColumnRenames, e.g.
+	// "w_" or "widgets_" for queries that select table prefixed aliases to avoid collisions.
+	// The first matching prefix is removed, unless that would leave an empty key.
+	StripPrefixes []string
+
+	// ColumnNameFunc, if not nil, maps the JSON keys of columns not in ColumnRenames, after
+	// StripPrefixes, e.g. to convert snake_case column names to camelCase keys.
+	ColumnNameFunc func(key string) string
+
+	// ColumnOrder, if not empty, gives the order of the fields of each row object, by column name
+	// or JSON key, with the columns not listed following in result set order.  With NestSeparator
+	// a nested object can be listed by its key, e.g. "address".  Names not in the result set are
+	// ignored.
+	ColumnOrder []string
+
+	// DuplicateColumns controls what happens when the result set contains more than one column
+	// with the same name, as is common with JOIN queries like "SELECT a.*, b.* ...".
+	// The default, DuplicateAllow, writes duplicate JSON keys.  Columns not in IncludeColumns
+	// are not output, so they are not counted as duplicates.  The policy also applies to columns
+	// given the same key by ColumnRenames, StripPrefixes or ColumnNameFunc, e.g. w_name and
+	// o_name with StripPrefixes "w_" and "o_".
+	DuplicateColumns DuplicatePolicy
+
+	// ColumnTables optionally gives the table name for each column (by index), which is used
+	// to qualify duplicate column names when DuplicateColumns is DuplicateQualify.
+	// The database/sql package does not expose this information, so it must be supplied here.
+	ColumnTables []string
+
+	// NestSeparator, if not empty, causes column names containing this separator to be
+	// written as nested JSON objects, e.g. with "__" the columns address__city and address__zip
+	// are written as {"address":{"city":...,"zip":...}}.  Columns sharing a prefix are grouped
+	// at the position of the first one, even if they are not adjacent in the result set.
+	// A column whose name is also the prefix of another (address and address__city) is an error.
+	NestSeparator string
+
+	// GroupBy, if set along with Children, names the parent key columns used to collapse
+	// consecutive rows of a one-to-many JOIN into a single object per parent, with the child
+	// columns of each row collected into nested arrays (see Children).  Rows must be ordered
+	// so that rows with the same parent key are adjacent.  Grouping is done by WriteCommaRows
+	// and WriteResponse.  Methods that write one row at a time (WriteRow, WriteJSONSeq, etc.)
+	// don't collapse rows, each row is written with its child object in arrays of one.
+	GroupBy []string
+
+	// RowFilterFunc, if not nil, is called with the column names and scanned values (the same
+	// values JSONValueFunc gets) of each row, and rows for which it returns include==false are
+	// not written at all, e.g. for authorization checks that can't be done in SQL.  An error
+	// stops the output and is returned.  Filtered rows do not count towards MaxRows.
+	// It is applied by the methods that iterate over the rows (WriteResponse, WriteCommaRows, etc.)
+	// and not by the single row methods like WriteRow.
+	RowFilterFunc func(colNames []string, values []interface{}) (include bool, err error)
+
+	// ExtraFieldsFunc, if not nil, is called with the scanned values of each row (the same values
+	// JSONValueFunc gets) and the fields it returns are added to the end of the row object in key
+	// order, e.g. derived fields like "display_name" or constants like "_type":"widget".  The values
+	// must be valid JSON.  It is not applied to the array and columnar formats.
+	ExtraFieldsFunc func(values []interface{}) (map[string]json.RawMessage, error)
+
+	// RowIndexField, if not empty, is the name of a field (e.g. "_row") added after the columns
+	// of each row object, containing the 0-based index of the row in the result set plus
+	// RowIndexOffset.  Paginated clients can use it as a stable key.  With GroupBy it is the
+	// index of the group.  It is not applied to the array and columnar formats.
+	RowIndexField string
+
+	// RowIndexOffset is added to the row index written for RowIndexField, e.g. the offset of the current page.
+	RowIndexOffset int64
+
+	// Children describes the nested arrays that child columns are collected into when GroupBy is set.
+	// Columns matching a child's Prefix are only written in that child array.
+	Children []ChildArray
+
+	// SSEEvent, if not empty, is written as the event name of each row written by WriteSSE.
+	SSEEvent string
+
+	// SSEIDColumn, if not empty, names the column whose value is written as the event id of
+	// each row written by WriteSSE, so clients can resume with Last-Event-ID.
+	SSEIDColumn string
+
+	// WebSocketBatch, if more than 1, causes WriteWebSocket to send this many rows per message
+	// as a JSON array instead of one row object per message.
+	WebSocketBatch int
+
+	columnFormatters map[string]ValueFormatter // by column name
+	typeFormatters   map[string]ValueFormatter // by DatabaseTypeName
 }
 
+// Uint64Policy specifies how unsigned 64-bit integer values are written.
+type Uint64Policy int
+
+const (
+	Uint64AsNumber Uint64Policy = iota // write as a JSON number (default)
+	Uint64AsString                     // always write as a JSON string
+	Uint64Error                        // return an error for values that exceed the int64 range
+)
+
+// FloatPolicy specifies how NaN and infinite float values are written.
+type FloatPolicy int
+
+const (
+	FloatSpecialNull   FloatPolicy = iota // write null (default)
+	FloatSpecialString                    // write the strings "NaN", "+Inf" and "-Inf"
+	FloatSpecialError                     // return an error
+)
+
+// UTF8Policy specifies how string values with invalid UTF-8 are written.
+type UTF8Policy int
+
+const (
+	UTF8Replace UTF8Policy = iota // replace each invalid byte with U+FFFD (default)
+	UTF8Base64                    // write the whole value as a standard base64 encoded JSON string
+	UTF8Null                      // write null
+	UTF8Error                     // return an error
+)
+
+// ControlCharPolicy specifies how ASCII control characters in string values are written.
+type ControlCharPolicy int
+
+const (
+	ControlCharEscape  ControlCharPolicy = iota // write as JSON escapes, e.g. \u0000 (default)
+	ControlCharStrip                            // remove them
+	ControlCharReplace                          // replace each with U+FFFD
+)
+
+// BinaryEncoding specifies how binary column values are written.
+type BinaryEncoding int
+
+const (
+	BinaryRawString BinaryEncoding = iota // write the bytes as-is as a JSON string (default)
+	BinaryBase64                          // write as a standard base64 encoded JSON string
+	BinaryHex                             // write as a lowercase hex encoded JSON string
+)
+
+// DuplicatePolicy specifies how duplicate column names are handled.
+type DuplicatePolicy int
+
+const (
+	DuplicateAllow    DuplicatePolicy = iota // write duplicate JSON keys (default)
+	DuplicateSuffix                          // suffix subsequent duplicates with a number: id, id_2, id_3
+	DuplicateQualify                         // prefix with the table name from ColumnTables: a.id, b.id (falls back to DuplicateSuffix)
+	DuplicateError                           // return an error
+	DuplicateLastWins                        // only write the last column with a given name
+)
+
+// ValueFormatter writes a custom JSON value for a column, it has the same semantics as
+// RowsWriter.JSONValueFunc.  Returning ok==false declines and lets the next formatter
+// (or the default behavior) write the value.
+type ValueFormatter func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error)
+
+// NullPolicy specifies how NULL values are written.
+type NullPolicy int
+
+const (
+	NullWrite   NullPolicy = iota // write null (default)
+	NullOmit                      // omit the field entirely
+	NullDefault                   // write a default value, see NullDefaults
+)
+
 // NewRowsWriter is the same as: return &RowsWriter{Writer: w}
-func NewRowsWriter(w io.Writer, rows *sql.Rows) *RowsWriter {
+func NewRowsWriter(w io.Writer, rows RowsLike) *RowsWriter {
 	return &RowsWriter{Writer: w, Rows: rows}
 }
 
+// SetColumnFormatter registers f to write values of the column named colName.
+// Column formatters are consulted after JSONValueFunc and before type formatters.
+// Passing a nil f removes the formatter.
+// This must be called before the first row is written.
+func (c *Config) SetColumnFormatter(colName string, f ValueFormatter) {
+	c.columnFormatters = setFormatter(c.columnFormatters, colName, f)
+}
+
+// SetTypeFormatter registers f to write values of all columns whose
+// sql.ColumnType.DatabaseTypeName() equals dbTypeName (e.g. "JSON", "DATETIME").
+// Passing a nil f removes the formatter.
+// This must be called before the first row is written.
+func (c *Config) SetTypeFormatter(dbTypeName string, f ValueFormatter) {
+	c.typeFormatters = setFormatter(c.typeFormatters, dbTypeName, f)
+}
+
+// setFormatter returns a copy of formatters with f set for name, or removed if f is nil.
+// The map is copied so Configs that share it are not changed.
+func setFormatter(formatters map[string]ValueFormatter, name string, f ValueFormatter) map[string]ValueFormatter {
+	formatters = maps.Clone(formatters)
+	if formatters == nil {
+		formatters = make(map[string]ValueFormatter)
+	}
+	if f == nil {
+		delete(formatters, name)
+	} else {
+		formatters[name] = f
+	}
+	return formatters
+}
+
 // Reset clears the internal state for this RowsWriter.
 // The value of Writer is retained.  Other internal buffers
 // have the equivalent reset functionality applied (i.e. reusing memory where possible).
 // This must be called before using this RowsWriter with a different sql.Rows.
-func (rw *RowsWriter) Reset(rows *sql.Rows) {
+func (rw *RowsWriter) Reset(rows RowsLike) {
 	rw.Rows = rows
 	rw.colNames = rw.colNames[:0]
+	rw.rowCount = 0
+	rw.colKeys = rw.colKeys[:0]
+	rw.colDropped = rw.colDropped[:0]
+	rw.fieldPlan = rw.fieldPlan[:0]
+	rw.group.reset()
+	rw.colTypes = rw.colTypes[:0]
+	rw.colBinary = rw.colBinary[:0]
+	rw.colDecimal = rw.colDecimal[:0]
+	rw.colBool = rw.colBool[:0]
+	rw.colUUID = rw.colUUID[:0]
+	rw.colGeo = rw.colGeo[:0]
+	rw.colHstore = rw.colHstore[:0]
+	rw.colNested = rw.colNested[:0]
+	rw.colRawJSON = rw.colRawJSON[:0]
+	rw.colWriters = rw.colWriters[:0]
+	rw.colFormatters = rw.colFormatters[:0]
+	rw.colMasks = rw.colMasks[:0]
 	rw.scanArgs = rw.scanArgs[:0]
+	rw.spills = clearSlice(rw.spills)
 	rw.rowOutBuf.Reset()
-	rw.rowOutEnc = nil
 	rw.valOutBuf.Reset()
+	rw.customBuf.Reset()
+	rw.indentBuf.Reset()
+	rw.msgBuf.Reset()
+	rw.loopErr = nil
+	rw.prescanned = false
+	rw.truncated = false
+	rw.flushedRows = 0
 	rw.valOutBytes = rw.valOutBytes[:0]
 	rw.jsonFieldSuffixes = rw.jsonFieldSuffixes[:0]
+	rw.trimBuffers(&rw.rowOutBuf)
 
 }
 
-func stringNeedsJSONEsc(s string) bool {
+func stringNeedsJSONEsc(s string, escapeHTML bool) bool {
 	for _, c := range s {
-		if c < 0x20 || c > 0x7f || c == '"' || c == '\\' {
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			return true
+		}
+		if escapeHTML && (c == '<' || c == '>' || c == '&') {
 			return true
 		}
 	}
 	return false
 }
 
-func (rw *RowsWriter) trimnl() {
-	for l := rw.rowOutBuf.Len() - 1; l >= 0 && rw.rowOutBuf.Bytes()[l] == '\n'; l-- {
-		rw.rowOutBuf.Truncate(l)
+// writeEscapedString writes s as a JSON string with escaping, invalid UTF-8 according to
+// UTF8Policy and control characters according to ControlCharPolicy.
+func (rw *RowsWriter) writeEscapedString(s string) error {
+
+	if rw.UTF8Policy != UTF8Replace && !utf8.ValidString(s) {
+		switch rw.UTF8Policy {
+		case UTF8Base64:
+			rw.rowOutBuf.WriteByte('"')
+			rw.valOutBytes = base64.StdEncoding.AppendEncode(rw.valOutBytes[:0], []byte(s))
+			rw.rowOutBuf.Write(rw.valOutBytes)
+			rw.rowOutBuf.WriteByte('"')
+			return nil
+		case UTF8Null:
+			rw.rowOutBuf.WriteString("null")
+			return nil
+		}
+		return fmt.Errorf("invalid UTF-8 in string value")
+	}
+
+	if rw.ControlCharPolicy != ControlCharEscape {
+		s = rw.mapControlChars(s)
 	}
+
+	rw.rowOutBuf.Write(appendJSONString(rw.rowOutBuf.AvailableBuffer(), s, rw.EscapeHTML))
+	return nil
 }
 
-func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
+// mapControlChars strips or replaces the control characters in s according to ControlCharPolicy.
+func (rw *RowsWriter) mapControlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0x7f {
+			if rw.ControlCharPolicy == ControlCharStrip {
+				return -1
+			}
+			return utf8.RuneError
+		}
+		return r
+	}, s)
+}
 
-	defer rw.trimnl()
+// jsonSpace is the whitespace allowed around JSON values.
+const jsonSpace = " \t\r\n"
+
+// writeRawJSONValue writes the JSON text v as is, see RawJSONColumns.  Trailing whitespace
+// (e.g. the newline of a value made with json.Encoder) is dropped so it can't break lines.
+func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 
 	rw.valOutBuf.Reset()
 	rowOut := &rw.rowOutBuf
@@ -97,7 +724,7 @@ func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 
 	case string:
 
-		rowOut.WriteString(vt)
+		rowOut.WriteString(strings.TrimRight(vt, jsonSpace))
 		return nil
 
 	case *string:
@@ -105,7 +732,7 @@ func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 			rowOut.WriteString("null")
 			return nil
 		}
-		rowOut.WriteString(*vt)
+		rowOut.WriteString(strings.TrimRight(*vt, jsonSpace))
 		return nil
 
 	case *sql.NullString:
@@ -113,7 +740,7 @@ func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 			rowOut.WriteString("null")
 			return nil
 		}
-		rowOut.WriteString(vt.String)
+		rowOut.WriteString(strings.TrimRight(vt.String, jsonSpace))
 		return nil
 
 	case *[]byte:
@@ -122,7 +749,7 @@ func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 			return nil
 		}
 		vts := unsafeString(*vt)
-		rowOut.WriteString(vts)
+		rowOut.WriteString(strings.TrimRight(vts, jsonSpace))
 		return nil
 
 	case *sql.RawBytes:
@@ -134,7 +761,7 @@ func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 		if vts == "" {
 			rowOut.WriteString("[]")
 		}
-		rowOut.WriteString(vts)
+		rowOut.WriteString(strings.TrimRight(vts, jsonSpace))
 		return nil
 
 	}
@@ -143,9 +770,258 @@ func (rw *RowsWriter) writeRawJSONValue(v interface{}) error {
 
 }
 
-func (rw *RowsWriter) writeValue(v interface{}) error {
+// maxSafeInt is the largest integer n such that n and every integer below it can be exactly
+// represented as a float64, JavaScript's Number.MAX_SAFE_INTEGER (2^53-1).  2^53 itself is
+// exact but 2^53+1 rounds to it, so a client can't tell them apart.
+const maxSafeInt = 1<<53 - 1
+
+// writeLargeIntString writes v as a quoted JSON string if it is an integer outside of
+// +/- maxSafeInt.  If false is returned nothing was written and the value should be written normally.
+func (rw *RowsWriter) writeLargeIntString(v interface{}) bool {
+
+	var n int64
+	var u uint64
+	signed := true
+
+	switch vt := v.(type) {
+	case *int:
+		if vt == nil {
+			return false
+		}
+		n = int64(*vt)
+	case *int64:
+		if vt == nil {
+			return false
+		}
+		n = *vt
+	case *sql.NullInt64:
+		if vt == nil || !vt.Valid {
+			return false
+		}
+		n = vt.Int64
+	case *sql.Null[int64]:
+		if vt == nil || !vt.Valid {
+			return false
+		}
+		n = vt.V
+	case *uint:
+		if vt == nil {
+			return false
+		}
+		u, signed = uint64(*vt), false
+	case *uint64:
+		if vt == nil {
+			return false
+		}
+		u, signed = *vt, false
+	case *sql.Null[uint64]:
+		if vt == nil || !vt.Valid {
+			return false
+		}
+		u, signed = vt.V, false
+	default:
+		return false
+	}
+
+	vob := rw.valOutBytes[:0]
+	if signed {
+		if n <= maxSafeInt && n >= -maxSafeInt {
+			return false
+		}
+		vob = strconv.AppendInt(vob, n, 10)
+	} else {
+		if u <= maxSafeInt {
+			return false
+		}
+		vob = strconv.AppendUint(vob, u, 10)
+	}
+	rw.valOutBytes = vob
+
+	rw.rowOutBuf.WriteByte('"')
+	rw.rowOutBuf.Write(vob)
+	rw.rowOutBuf.WriteByte('"')
+	return true
+}
+
+// writeUint64 writes u to rowOutBuf according to Uint64Policy, using vob as scratch space.
+func (rw *RowsWriter) writeUint64(vob []byte, u uint64) ([]byte, error) {
+	switch rw.Uint64Policy {
+	case Uint64AsString:
+		vob = strconv.AppendUint(vob, u, 10)
+		rw.rowOutBuf.WriteByte('"')
+		rw.rowOutBuf.Write(vob)
+		rw.rowOutBuf.WriteByte('"')
+		return vob, nil
+	case Uint64Error:
+		if u > math.MaxInt64 {
+			return vob, fmt.Errorf("uint64 value %d exceeds int64 range", u)
+		}
+	}
+	vob = strconv.AppendUint(vob, u, 10)
+	rw.rowOutBuf.Write(vob)
+	return vob, nil
+}
+
+// writeFloat writes f to rowOutBuf with prec digits after the decimal point (-1 for as many as
+// needed), and NaN and infinity according to FloatPolicy, using vob as scratch space.
+func (rw *RowsWriter) writeFloat(vob []byte, f float64, bitSize, prec int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		switch rw.FloatPolicy {
+		case FloatSpecialString:
+			vob = strconv.AppendFloat(vob, f, 'f', -1, bitSize) // NaN, +Inf or -Inf
+			rw.rowOutBuf.WriteByte('"')
+			rw.rowOutBuf.Write(vob)
+			rw.rowOutBuf.WriteByte('"')
+			return vob, nil
+		case FloatSpecialError:
+			return vob, fmt.Errorf("float value %v can not be written as JSON", f)
+		}
+		rw.rowOutBuf.WriteString("null")
+		return vob, nil
+	}
+	vob = strconv.AppendFloat(vob, f, 'f', prec, bitSize)
+	rw.rowOutBuf.Write(vob)
+	return vob, nil
+}
+
+// writeFloatPrecision writes v with prec digits after the decimal point if it is a float scan
+// arg that is not NULL.  If false is returned nothing was written.
+func (rw *RowsWriter) writeFloatPrecision(v interface{}, prec int) (bool, error) {
+	var err error
+	vob := rw.valOutBytes[:0]
+	switch f := scanValue(v).(type) {
+	case float64:
+		vob, err = rw.writeFloat(vob, f, 64, prec)
+	case float32:
+		vob, err = rw.writeFloat(vob, float64(f), 32, prec)
+	default:
+		return false, nil
+	}
+	rw.valOutBytes = vob
+	return true, err
+}
+
+// isBoolColumn returns true if the values of the column should be written as booleans,
+// see MySQLBooleans and BooleanColumns.
+func (rw *RowsWriter) isBoolColumn(colName string, ct ColumnType) bool {
+	if containsString(rw.BooleanColumns, colName) {
+		return true
+	}
+	if !rw.MySQLBooleans {
+		return false
+	}
+	switch ct.DatabaseTypeName() {
+	case "TINYINT":
+		return true
+	case "BIT":
+		n, ok := ct.Length()
+		return !ok || n == 1
+	}
+	return false
+}
+
+// writeBoolValue writes the integer or BIT value of v as a JSON boolean if it is 0 or 1, and
+// other BIT values (up to 64 bits) as a number.  If false is returned v is NULL or not a value
+// that can be written this way and nothing was written, e.g. so writeValue writes a TINYINT of 2.
+func (rw *RowsWriter) writeBoolValue(v interface{}) bool {
+
+	val := scanValue(v)
+	if b, ok := boolValue(val); ok {
+		rw.rowOutBuf.WriteString(strconv.FormatBool(b))
+		return true
+	}
+	if n, ok := bitValue(val); ok {
+		rw.rowOutBuf.WriteString(strconv.FormatUint(n, 10))
+		return true
+	}
+	return false
+}
 
-	defer rw.trimnl()
+// boolValue returns val, a value from scanValue, as a bool if it is one or is 0 or 1 as an
+// integer, string or BIT value.
+func boolValue(val interface{}) (b, ok bool) {
+	switch vt := val.(type) {
+	case bool:
+		return vt, true
+	case string:
+		return vt == "1", vt == "0" || vt == "1"
+	}
+	if n, ok := bitValue(val); ok {
+		return n == 1, n <= 1
+	}
+	rv := reflect.ValueOf(val)
+	switch {
+	case rv.CanInt():
+		return rv.Int() == 1, rv.Int() == 0 || rv.Int() == 1
+	case rv.CanUint():
+		return rv.Uint() == 1, rv.Uint() <= 1
+	}
+	return false, false
+}
+
+// bitValue returns the number held by val if it is a BIT value of up to 64 bits, which MySQL
+// sends as big-endian bytes.
+func bitValue(val interface{}) (uint64, bool) {
+	var b []byte
+	switch vt := val.(type) {
+	case []byte:
+		b = vt
+	case sql.RawBytes:
+		b = vt
+	}
+	if len(b) == 0 || len(b) > 8 {
+		return 0, false
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, true
+}
+
+// writeBinaryValue writes v as a JSON string encoded according to BinaryEncoding.
+// If false is returned v is not a type that can be encoded this way and nothing was written.
+func (rw *RowsWriter) writeBinaryValue(v interface{}) bool {
+
+	var b []byte
+	switch vt := v.(type) {
+	case *[]byte:
+		if vt == nil || *vt == nil { // NULL scans as a nil slice
+			rw.rowOutBuf.WriteString("null")
+			return true
+		}
+		b = *vt
+	case *sql.RawBytes:
+		if vt == nil || *vt == nil {
+			rw.rowOutBuf.WriteString("null")
+			return true
+		}
+		b = *vt
+	case *sql.Null[[]byte]:
+		if vt == nil || !vt.Valid {
+			rw.rowOutBuf.WriteString("null")
+			return true
+		}
+		b = vt.V
+	default:
+		return false
+	}
+
+	vob := rw.valOutBytes[:0]
+	vob = append(vob, '"')
+	switch rw.BinaryEncoding {
+	case BinaryBase64:
+		vob = base64.StdEncoding.AppendEncode(vob, b)
+	case BinaryHex:
+		vob = hex.AppendEncode(vob, b)
+	}
+	vob = append(vob, '"')
+	rw.rowOutBuf.Write(vob)
+	rw.valOutBytes = vob
+	return true
+}
+
+func (rw *RowsWriter) writeValue(v interface{}) error {
 
 	rw.valOutBuf.Reset()
 	vob := rw.valOutBytes[:0]
@@ -162,8 +1038,8 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 	switch vt := v.(type) {
 
 	case string:
-		if stringNeedsJSONEsc(vt) {
-			return rw.rowOutEnc.Encode(vt)
+		if stringNeedsJSONEsc(vt, rw.EscapeHTML) {
+			return rw.writeEscapedString(vt)
 		}
 		rowOut.WriteByte('"')
 		rowOut.WriteString(vt)
@@ -175,8 +1051,8 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 			rowOut.WriteString("null")
 			return nil
 		}
-		if stringNeedsJSONEsc(*vt) {
-			return rw.rowOutEnc.Encode(*vt)
+		if stringNeedsJSONEsc(*vt, rw.EscapeHTML) {
+			return rw.writeEscapedString(*vt)
 		}
 		rowOut.WriteByte('"')
 		rowOut.WriteString(*vt)
@@ -188,8 +1064,8 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 			rowOut.WriteString("null")
 			return nil
 		}
-		if stringNeedsJSONEsc(vt.String) {
-			return rw.rowOutEnc.Encode(vt.String)
+		if stringNeedsJSONEsc(vt.String, rw.EscapeHTML) {
+			return rw.writeEscapedString(vt.String)
 		}
 		rowOut.WriteByte('"')
 		rowOut.WriteString(vt.String)
@@ -202,8 +1078,8 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 			return nil
 		}
 		vts := unsafeString(*vt)
-		if stringNeedsJSONEsc(vts) {
-			return rw.rowOutEnc.Encode(vts)
+		if stringNeedsJSONEsc(vts, rw.EscapeHTML) {
+			return rw.writeEscapedString(vts)
 		}
 		rowOut.WriteByte('"')
 		rowOut.WriteString(vts)
@@ -216,8 +1092,8 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 			return nil
 		}
 		vts := unsafeString(*vt)
-		if stringNeedsJSONEsc(vts) {
-			return rw.rowOutEnc.Encode(vts)
+		if stringNeedsJSONEsc(vts, rw.EscapeHTML) {
+			return rw.writeEscapedString(vts)
 		}
 		rowOut.WriteByte('"')
 		rowOut.WriteString(vts)
@@ -277,7 +1153,25 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 		rowOut.Write(vob)
 		return nil
 
+	case *int16:
+		if vt == nil {
+			rowOut.WriteString("null")
+			return nil
+		}
+		vob = strconv.AppendInt(vob, int64(*vt), 10)
+		rowOut.Write(vob)
+		return nil
+
 	case *uint:
+		if vt == nil {
+			rowOut.WriteString("null")
+			return nil
+		}
+		var err error
+		vob, err = rw.writeUint64(vob, uint64(*vt))
+		return err
+
+	case *uint8:
 		if vt == nil {
 			rowOut.WriteString("null")
 			return nil
@@ -286,7 +1180,7 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 		rowOut.Write(vob)
 		return nil
 
-	case *uint32:
+	case *uint16:
 		if vt == nil {
 			rowOut.WriteString("null")
 			return nil
@@ -295,7 +1189,7 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 		rowOut.Write(vob)
 		return nil
 
-	case *uint64:
+	case *uint32:
 		if vt == nil {
 			rowOut.WriteString("null")
 			return nil
@@ -304,6 +1198,24 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 		rowOut.Write(vob)
 		return nil
 
+	case *uint64:
+		if vt == nil {
+			rowOut.WriteString("null")
+			return nil
+		}
+		var err error
+		vob, err = rw.writeUint64(vob, *vt)
+		return err
+
+	case *sql.Null[uint64]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		var err error
+		vob, err = rw.writeUint64(vob, vt.V)
+		return err
+
 	case *bool:
 		if vt == nil {
 			rowOut.WriteString("null")
@@ -327,258 +1239,1814 @@ func (rw *RowsWriter) writeValue(v interface{}) error {
 			rowOut.WriteString("null")
 			return nil
 		}
-		vob = strconv.AppendFloat(vob, float64(*vt), 'f', -1, 32)
-		rowOut.Write(vob)
-		return nil
+		var err error
+		vob, err = rw.writeFloat(vob, float64(*vt), 32, -1)
+		return err
 
 	case *float64:
 		if vt == nil {
 			rowOut.WriteString("null")
 			return nil
 		}
-		vob = strconv.AppendFloat(vob, float64(*vt), 'f', -1, 64)
+		var err error
+		vob, err = rw.writeFloat(vob, float64(*vt), 64, -1)
+		return err
+
+	case *sql.NullFloat64:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		var err error
+		vob, err = rw.writeFloat(vob, vt.Float64, 64, -1)
+		return err
+
+	case *sql.Null[int64]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		vob = strconv.AppendInt(vob, vt.V, 10)
 		rowOut.Write(vob)
 		return nil
 
-	case *sql.NullFloat64:
+	case *sql.Null[int32]:
 		if vt == nil || !vt.Valid {
 			rowOut.WriteString("null")
 			return nil
 		}
-		vob = strconv.AppendFloat(vob, float64(vt.Float64), 'f', -1, 64)
+		vob = strconv.AppendInt(vob, int64(vt.V), 10)
 		rowOut.Write(vob)
 		return nil
 
-	case *sql.NullTime:
+	case *sql.Null[int16]:
 		if vt == nil || !vt.Valid {
 			rowOut.WriteString("null")
 			return nil
 		}
-		vob = vt.Time.AppendFormat(vob, time.RFC3339Nano)
-		rowOut.WriteByte('"')
+		vob = strconv.AppendInt(vob, int64(vt.V), 10)
 		rowOut.Write(vob)
-		rowOut.WriteByte('"')
 		return nil
 
-		// case *mysql.NullTime:
-		// 	if vt == nil || !vt.Valid {
-		// 		rowOut.WriteString("null")
-		// 		return nil
-		// 	}
-		// 	vob = vt.Time.AppendFormat(vob, time.RFC3339Nano)
-		// 	rowOut.WriteByte('"')
-		// 	rowOut.Write(vob)
-		// 	rowOut.WriteByte('"')
-		// 	return nil
+	case *sql.Null[float64]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		var err error
+		vob, err = rw.writeFloat(vob, vt.V, 64, -1)
+		return err
 
-		// TODO:
-		// *time.Time ?
+	case *sql.Null[float32]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		var err error
+		vob, err = rw.writeFloat(vob, float64(vt.V), 32, -1)
+		return err
 
-	}
+	case *sql.Null[bool]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		vob = strconv.AppendBool(vob, vt.V)
+		rowOut.Write(vob)
+		return nil
 
-	return fmt.Errorf("unknown type for writeValue %T: %#v", v, v)
+	case *sql.Null[string]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		return rw.writeValue(vt.V)
 
-	// // anything that falls through we just use json.Encoder
-	// err := rw.rowOutEnc.Encode(v)
-	// rw.trimnl()
-	// return err
+	case *sql.Null[[]byte]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		return rw.writeValue(&vt.V)
 
-}
+	case *sql.Null[time.Time]:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		vob = vt.V.AppendFormat(vob, time.RFC3339Nano)
+		rowOut.WriteByte('"')
+		rowOut.Write(vob)
+		rowOut.WriteByte('"')
+		return nil
 
-// WriteResponse writes rows as a full response of a JSON array and objects for each row.
-// It will iterate through rows until the end of the result set.
-// Each line is output as a JSON object {...} with
-// commas separating each field.  Output a [ before and ] after to make a valid JSON array.
+	case *sql.NullTime:
+		if vt == nil || !vt.Valid {
+			rowOut.WriteString("null")
+			return nil
+		}
+		vob = vt.Time.AppendFormat(vob, time.RFC3339Nano)
+		rowOut.WriteByte('"')
+		rowOut.Write(vob)
+		rowOut.WriteByte('"')
+		return nil
+
+	case time.Time:
+		vob = vt.AppendFormat(vob, time.RFC3339Nano)
+		rowOut.WriteByte('"')
+		rowOut.Write(vob)
+		rowOut.WriteByte('"')
+		return nil
+
+	case *time.Time:
+		if vt == nil {
+			rowOut.WriteString("null")
+			return nil
+		}
+		vob = vt.AppendFormat(vob, time.RFC3339Nano)
+		rowOut.WriteByte('"')
+		rowOut.Write(vob)
+		rowOut.WriteByte('"')
+		return nil
+
+		// case *mysql.NullTime:
+		// 	if vt == nil || !vt.Valid {
+		// 		rowOut.WriteString("null")
+		// 		return nil
+		// 	}
+		// 	vob = vt.Time.AppendFormat(vob, time.RFC3339Nano)
+		// 	rowOut.WriteByte('"')
+		// 	rowOut.Write(vob)
+		// 	rowOut.WriteByte('"')
+		// 	return nil
+
+	case nil:
+		rowOut.WriteString("null")
+		return nil
+
+	// the other driver.Value types, e.g. from a driver.Valuer
+	case int64:
+		vob = strconv.AppendInt(vob, vt, 10)
+		rowOut.Write(vob)
+		return nil
+
+	case float64:
+		var err error
+		vob, err = rw.writeFloat(vob, vt, 64, -1)
+		return err
+
+	case bool:
+		vob = strconv.AppendBool(vob, vt)
+		rowOut.Write(vob)
+		return nil
+
+	case []byte:
+		return rw.writeValue(&vt)
+
+	// network addresses, which are []byte or structs that would not be written usefully
+	case net.IP, net.HardwareAddr, *net.IPNet, net.IPNet, netip.Addr, netip.Prefix,
+		*net.IP, *net.HardwareAddr, *netip.Addr, *netip.Prefix:
+		return rw.writeNetValue(vt)
+
+	// custom types such as decimal.Decimal or uuid.UUID
+	case json.Marshaler:
+		return rw.writeMarshalerValue(vt)
+
+	case driver.Valuer:
+		return rw.writeValuerValue(vt)
+
+	}
+
+	if !rw.StrictTypes {
+		return rw.writeFallbackValue(v)
+	}
+
+	return fmt.Errorf("unknown type for writeValue %T: %#v", v, v)
+}
+
+// writeMarshalerValue writes the MarshalJSON output of v, checking that it is valid.
+func (rw *RowsWriter) writeMarshalerValue(v json.Marshaler) error {
+
+	if isNullValue(v) {
+		rw.rowOutBuf.WriteString("null")
+		return nil
+	}
+
+	b, err := v.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if rw.EscapeHTML {
+		rw.valOutBuf.Reset()
+		json.HTMLEscape(&rw.valOutBuf, b)
+		b = rw.valOutBuf.Bytes()
+	}
+	err = json.Compact(&rw.rowOutBuf, b)
+	if err != nil {
+		return fmt.Errorf("invalid JSON from %T.MarshalJSON: %w", v, err)
+	}
+	return nil
+}
+
+// writeValuerValue writes the driver.Value of v.
+func (rw *RowsWriter) writeValuerValue(v driver.Valuer) error {
+
+	if isNullValue(v) {
+		rw.rowOutBuf.WriteString("null")
+		return nil
+	}
+
+	dv, err := v.Value()
+	if err != nil {
+		return err
+	}
+	if _, ok := dv.(driver.Valuer); ok {
+		return fmt.Errorf("%T.Value returned a driver.Valuer %T", v, dv)
+	}
+	return rw.writeValue(dv)
+}
+
+// writeFallbackValue writes a value of a type writeValue has no case for: the element of a
+// pointer, or otherwise the same as encoding/json.
+func (rw *RowsWriter) writeFallbackValue(v interface{}) error {
+
+	if isNullValue(v) {
+		rw.rowOutBuf.WriteString("null")
+		return nil
+	}
+
+	if _, ok := v.(encoding.TextMarshaler); !ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+			return rw.writeValue(rv.Elem().Interface())
+		}
+	}
+
+	rw.valOutBuf.Reset()
+	enc := json.NewEncoder(&rw.valOutBuf)
+	enc.SetEscapeHTML(rw.EscapeHTML)
+	err := enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	rw.rowOutBuf.Write(bytes.TrimSuffix(rw.valOutBuf.Bytes(), []byte("\n")))
+	return nil
+}
+
+// WriteResponse writes rows as a full response of a JSON array and objects for each row.
+// It will iterate through rows until the end of the result set.  See also Atomic and ETag.
+// Each line is output as a JSON object {...} with
+// commas separating each field.  Output a [ before and ] after to make a valid JSON array.
 // If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
 // to see if the Content-Type header is empty and if so will set it to "application/json".
 func (rw *RowsWriter) WriteResponse() error {
 
-	rows := rw.Rows
+	if ok, err := rw.withOutput(true, rw.WriteResponse); ok {
+		return err
+	}
+
+	if rw.ETagVersion != "" && rw.notModified([]byte(rw.ETagVersion)) {
+		return nil
+	}
+
+	if rw.Atomic || rw.etagBuffered() {
+		return rw.writeAtomic(rw.writeResponse)
+	}
+
+	return rw.writeResponse()
+}
+
+func (rw *RowsWriter) writeResponse() error {
+
+	rw.setJSONContentType()
+
+	w := rw.Writer
+
+	if rw.ColumnMetadata {
+		err := rw.writeColumnMetadata("{", ",\"rows\":[\n")
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(w, "[")
+	}
+
+	start := rw.bytesWritten
+	err := rw.WriteCommaRows()
+	if err != nil && err != ErrMaxBytes {
+		if rw.ErrorPolicy != ErrorRecord {
+			rw.handleStreamError(err, "", "")
+			return err
+		}
+		rw.handleStreamError(err, rw.commaRowsErrorPrefix(start), "\n")
+	}
+
+	if rw.ColumnMetadata {
+		fmt.Fprintln(w, "]}")
+	} else {
+		fmt.Fprintln(w, "]")
+	}
+
+	return err
+}
+
+// WriteResponseContext is WriteResponse with Context set to ctx for the duration of the call.
+func (rw *RowsWriter) WriteResponseContext(ctx context.Context) error {
+	return rw.withContext(ctx, rw.WriteResponse)
+}
+
+// WriteCommaRowsContext is WriteCommaRows with Context set to ctx for the duration of the call.
+func (rw *RowsWriter) WriteCommaRowsContext(ctx context.Context) error {
+	return rw.withContext(ctx, rw.WriteCommaRows)
+}
+
+// WriteResultSetsContext is WriteResultSets with Context set to ctx for the duration of the call.
+func (rw *RowsWriter) WriteResultSetsContext(ctx context.Context, names ...string) error {
+	return rw.withContext(ctx, func() error { return rw.WriteResultSets(names...) })
+}
+
+// withContext calls f with Context set to ctx, restoring the prior value after.
+func (rw *RowsWriter) withContext(ctx context.Context, f func() error) error {
+	prev := rw.Context
+	rw.Context = ctx
+	defer func() { rw.Context = prev }()
+	return f()
+}
+
+// nextRow calls Rows.Next, first checking Context for cancellation, flushing and MaxRows.
+// Row loops should use nextRow and rowsErr instead of calling Rows directly.
+func (rw *RowsWriter) nextRow() bool {
+	if rw.Context != nil {
+		if err := rw.Context.Err(); err != nil {
+			rw.loopErr = err
+			rw.Rows.Close()
+			return false
+		}
+	}
+	if rw.FlushEvery > 0 || rw.FlushInterval > 0 {
+		rw.flushIfDue()
+	}
+	if rw.OnProgress != nil {
+		every := int64(rw.ProgressEvery)
+		if every <= 0 {
+			every = 1000
+		}
+		if rw.totalRows-rw.progressRows >= every {
+			rw.reportProgress()
+		}
+	}
+	if rw.MaxRows > 0 && rw.rowCount >= rw.MaxRows {
+		// only truncated if there actually was another row
+		rw.truncated = rw.truncated || rw.nextIncludedRow()
+		return false
+	}
+	return rw.nextIncludedRow()
+}
+
+// nextIncludedRow advances to the next row that passes RowFilterFunc, if set.
+// Rows are scanned here to call the filter, so scanRowArgs won't scan them again.
+func (rw *RowsWriter) nextIncludedRow() bool {
+
+	for rw.rowsNext() {
+
+		if rw.RowFilterFunc == nil {
+			return true
+		}
+
+		if len(rw.colNames) == 0 {
+			err := rw.setupColumns()
+			if err != nil {
+				rw.loopErr = err
+				return false
+			}
+		}
+
+		err := rw.Rows.Scan(rw.scanArgs...)
+		if err != nil {
+			rw.loopErr = err
+			return false
+		}
+
+		include, err := rw.RowFilterFunc(rw.colNames, rw.scanArgs)
+		if err != nil {
+			rw.loopErr = err
+			return false
+		}
+		if include {
+			rw.prescanned = true
+			return true
+		}
+	}
+
+	return false
+}
+
+// rowsNext calls Rows.Next, letting the heartbeat write while it waits.
+func (rw *RowsWriter) rowsNext() bool {
+	if rw.hb == nil {
+		return rw.Rows.Next()
+	}
+	rw.hb.mu.Unlock()
+	defer rw.hb.mu.Lock()
+	return rw.Rows.Next()
+}
+
+// flushIfDue flushes the Writer if it is an http.Flusher and FlushEvery or FlushInterval calls for it.
+func (rw *RowsWriter) flushIfDue() {
+
+	f, ok := rw.Writer.(http.Flusher)
+	if !ok {
+		return
+	}
+
+	due := rw.FlushEvery > 0 && rw.rowCount-rw.flushedRows >= rw.FlushEvery
+	if !due && rw.FlushInterval > 0 {
+		due = time.Since(rw.lastFlush) >= rw.FlushInterval
+	}
+	if !due {
+		return
+	}
+
+	f.Flush()
+	rw.flushedRows = rw.rowCount
+	rw.lastFlush = time.Now()
+}
+
+// reportProgress calls OnProgress with the current counts.
+func (rw *RowsWriter) reportProgress() {
+	rw.progressRows = rw.totalRows
+	rw.OnProgress(rw.totalRows, rw.BytesWritten())
+}
+
+// Truncated returns true if rows were left unwritten because of MaxRows or MaxBytes.
+func (rw *RowsWriter) Truncated() bool {
+	return rw.truncated
+}
+
+// ErrMaxBytes is returned when writing a row would exceed MaxBytes.
+var ErrMaxBytes = errors.New("sqljsonutil: MaxBytes output budget exceeded")
+
+// BytesWritten returns the number of bytes of row output and heartbeats written so far, the same count
+// MaxBytes is checked against.  It is not reset by Reset.
+func (rw *RowsWriter) BytesWritten() int64 {
+	return rw.bytesWritten + rw.heartbeatBytes
+}
+
+// writeOut writes buf to Writer, checking it with reserveBytes first.
+func (rw *RowsWriter) writeOut(buf *bytes.Buffer) error {
+	return rw.writeOutPrefix(nil, buf)
+}
+
+// writeOutPrefix writes prefix and then buf to Writer, like writeOut, checking both
+// together with reserveBytes so that neither is written if they do not fit.
+func (rw *RowsWriter) writeOutPrefix(prefix []byte, buf *bytes.Buffer) error {
+	err := rw.reserveBytes(len(prefix) + buf.Len())
+	if err != nil {
+		buf.Reset()
+		return err
+	}
+	if len(prefix) > 0 {
+		_, err = rw.Writer.Write(prefix)
+		if err != nil {
+			buf.Reset()
+			return err
+		}
+	}
+	_, err = buf.WriteTo(rw.Writer)
+	rw.trimBuffers(buf)
+	if bw, ok := rw.Writer.(*batchWriter); ok && err == nil {
+		err = bw.endRow()
+	}
+	return err
+}
+
+// reserveBytes adds n to the bytes written, unless that would exceed MaxBytes in which case ErrMaxBytes is returned.
+func (rw *RowsWriter) reserveBytes(n int) error {
+	if rw.MaxBytes > 0 && rw.BytesWritten()+int64(n) > rw.MaxBytes {
+		rw.truncated = true
+		return ErrMaxBytes
+	}
+	rw.bytesWritten += int64(n)
+	return nil
+}
+
+// rowsErr returns the error that ended the nextRow loop, if any.
+// It also reports the final progress to OnProgress.
+func (rw *RowsWriter) rowsErr() error {
+	if rw.OnProgress != nil && rw.totalRows != rw.progressRows {
+		rw.reportProgress()
+	}
+	if rw.loopErr != nil {
+		return rw.loopErr
+	}
+	return rw.Rows.Err()
+}
+
+// setJSONContentType sets the Content-Type to application/json if the Writer is an
+// http.ResponseWriter and it has not been set yet.
+func (rw *RowsWriter) setJSONContentType() {
+	rw.setContentType("application/json")
+}
+
+// setContentType sets the Content-Type to contentType if the Writer is an
+// http.ResponseWriter and it has not been set yet.
+func (rw *RowsWriter) setContentType(contentType string) {
+	if w, ok := rw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+}
+
+// writeEnvelope writes the JSON object of an envelope format (PaginatedWriter, DataTablesWriter,
+// etc.): open, the comma rows written by writeRows, and the closing returned by closing for
+// the error from writeRows.  An error stopping the rows is handled with handleStreamError,
+// and with ErrorRecord (or for ErrMaxBytes) the envelope is still closed so it is valid JSON.
+func (rw *RowsWriter) writeEnvelope(open []byte, writeRows func() error, closing func(err error) []byte) error {
+
+	_, err := rw.Writer.Write(open)
+	if err != nil {
+		return err
+	}
+
+	start := rw.bytesWritten
+	err = writeRows()
+	if err != nil && err != ErrMaxBytes {
+		if rw.ErrorPolicy != ErrorRecord {
+			rw.handleStreamError(err, "", "")
+			return err
+		}
+		rw.handleStreamError(err, rw.commaRowsErrorPrefix(start), "\n")
+	}
+
+	_, werr := rw.Writer.Write(closing(err))
+	if err == nil {
+		err = werr
+	}
+	return err
+}
+
+// WriteResultSets writes each result set of Rows (e.g. from a stored procedure or multi-statement
+// query) as a JSON array inside a JSON object, using names as the keys in order:
+// {"widgets":[...],"totals":[...]}.  Rows.NextResultSet is called between each set and the
+// column information is reinitialized for each.  If there are fewer result sets than names the
+// remaining names get empty arrays, result sets beyond len(names) are not written.
+// If the io.Writer in the Writer field is an http.ResponseWriter the Content-Type is set the
+// same as WriteResponse.
+func (rw *RowsWriter) WriteResultSets(names ...string) error {
+
+	if ok, err := rw.withOutput(true, func() error { return rw.WriteResultSets(names...) }); ok {
+		return err
+	}
+
+	rw.setJSONContentType()
+
+	w := rw.Writer
+	rows := rw.Rows
+
+	fmt.Fprint(w, "{")
+
+	more := true
+	for i, name := range names {
+
+		if i > 0 {
+			fmt.Fprint(w, ",")
+			if more {
+				more = rows.NextResultSet()
+				if more {
+					rw.Reset(rows)
+				} else if err := rows.Err(); err != nil {
+					return err
+				}
+			}
+		}
+
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		w.Write(key)
+		fmt.Fprintln(w, ":[")
+
+		if more {
+			err := rw.WriteCommaRows()
+			if err == ErrMaxBytes {
+				fmt.Fprintln(w, "]}")
+				return err
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprint(w, "]")
+	}
+
+	fmt.Fprintln(w, "}")
+
+	return nil
+}
+
+// // WriteResponseObj writes the first sql row response object.
+// // It will ignore any other rows returned
+// func (rw *RowsWriter) WriteResponseObj(w http.ResponseWriter, rows *sql.Rows) error {
+
+// 	w.Header().Set("Content-Type", "application/json")
+
+// 	for rows.Next() {
+
+// 		err := rw.WriteRow(rows)
+// 		if err != nil {
+// 			return err
+// 		}
+// 		break
+// 	}
+// 	if err := rows.Err(); err != nil {
+// 		return err
+// 	}
+
+// 	return nil
+
+// }
+
+// WriteCommaRow is like WriteRow but will prepend a comma before every row except the first.
+// Suitable for writing out multiple rows in an JSON array.
+// The same rows object must be passed each time, i.e. do not reuse an instance of this object for
+// multiple result sets.
+func (rw *RowsWriter) WriteCommaRow() error {
+
+	rw.spillRow = rw.canSpill()
+	err := rw.buildRow(true)
+	rw.spillRow = false
+	if err != nil {
+		return err
+	}
+
+	return rw.writeRowOut()
+}
+
+// WriteRow will call rows.Scan with the appropriate arguments and write the result as a JSON object.
+// The same rows object must be passed each time, i.e. do not reuse an instance of this object for
+// multiple result sets.
+func (rw *RowsWriter) WriteRow() error {
+
+	rw.spillRow = rw.canSpill()
+	err := rw.buildRow(false)
+	rw.spillRow = false
+	if err != nil {
+		return err
+	}
+
+	return rw.writeRowOut()
+}
+
+// WriteSeqRow is like WriteRow but writes the row as a record of an RFC 7464 JSON text sequence,
+// i.e. prefixed with an ASCII record separator (0x1E) and terminated by a newline.
+func (rw *RowsWriter) WriteSeqRow() error {
+
+	err := rw.buildRow(false)
+	if err != nil {
+		return err
+	}
+
+	return rw.writeOutPrefix([]byte{0x1e}, &rw.rowOutBuf)
+}
+
+// WriteJSONSeq writes all rows as an RFC 7464 JSON text sequence, one WriteSeqRow per row.
+// GroupBy is not applied.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to "application/json-seq".
+func (rw *RowsWriter) WriteJSONSeq() error {
+
+	if ok, err := rw.withOutput(true, rw.WriteJSONSeq); ok {
+		return err
+	}
+
+	if w, ok := rw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "application/json-seq")
+		}
+	}
+
+	if bw := rw.newBatchWriter(); bw != nil {
+		return rw.withBatchWriter(bw, rw.WriteJSONSeq)
+	}
+
+	if rw.ColumnMetadata {
+		err := rw.writeColumnMetadata("\x1e{", "}\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	for rw.nextRow() {
+		err := rw.WriteSeqRow()
+		if err != nil {
+			rw.handleStreamError(err, "\x1e", "\n")
+			return err
+		}
+	}
+	err := rw.rowsErr()
+	rw.handleStreamError(err, "\x1e", "\n")
+	return err
+}
+
+// WriteNDJSON writes all rows as newline delimited JSON, one WriteRow per row.
+// GroupBy is not applied and Indent should not be set, as each row must be one line.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to "application/x-ndjson".
+func (rw *RowsWriter) WriteNDJSON() error {
+
+	if ok, err := rw.withOutput(true, rw.WriteNDJSON); ok {
+		return err
+	}
+
+	if w, ok := rw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+	}
+
+	if bw := rw.newBatchWriter(); bw != nil {
+		return rw.withBatchWriter(bw, rw.WriteNDJSON)
+	}
+
+	if rw.ColumnMetadata {
+		err := rw.writeColumnMetadata("{", "}\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	for rw.nextRow() {
+		err := rw.WriteRow()
+		if err != nil {
+			rw.handleStreamError(err, "", "\n")
+			return err
+		}
+	}
+	err := rw.rowsErr()
+	rw.handleStreamError(err, "", "\n")
+	return err
+}
+
+// WriteEach calls send with the JSON object for each row, e.g. for a gRPC server-streaming
+// handler to relay rows as they are read (as bytes, or unmarshaled into a structpb.Struct).
+// The object has no trailing newline and is only valid until send returns.  GroupBy is not applied.
+// An error returned by send stops the iteration and is returned.
+func (rw *RowsWriter) WriteEach(send func(row json.RawMessage) error) error {
+
+	for rw.nextRow() {
+
+		err := rw.buildRow(false)
+		if err != nil {
+			return err
+		}
+
+		row := bytes.TrimRight(rw.rowOutBuf.Bytes(), "\n")
+		err = rw.reserveBytes(len(row))
+		if err == nil {
+			err = send(json.RawMessage(row))
+		}
+		rw.rowOutBuf.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	return rw.rowsErr()
+}
+
+// buildRow scans the next row and leaves it in rowOutBuf as a JSON object (indented if Indent is set),
+// see scanRowArgs for comma.
+func (rw *RowsWriter) buildRow(comma bool) error {
+
+	err := rw.scanRowArgs(comma)
+	if err != nil {
+		return err
+	}
+
+	return rw.buildRowObject(comma)
+}
+
+// buildRowObject appends the JSON object for the current scanned row to rowOutBuf, see buildRow.
+func (rw *RowsWriter) buildRowObject(comma bool) error {
+
+	rw.rowOutBuf.WriteByte('{')
+
+	err := rw.writeRowFields(rw.fieldPlan)
+	if err != nil {
+		return err
+	}
+
+	if rw.RowIndexField != "" {
+		rw.writeRowIndexField(int64(rw.rowCount - 1))
+	}
+
+	if rw.ExtraFieldsFunc != nil {
+		err = rw.writeExtraFields()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(rw.GroupBy) > 0 {
+		err = rw.writeRowChildren()
+		if err != nil {
+			return err
+		}
+	}
+
+	rw.rowOutBuf.WriteString("}\n")
+
+	if rw.ValidateOutput {
+		err = rw.validateRowObject()
+		if err != nil {
+			return err
+		}
+	}
+
+	if rw.RowTransform != "" {
+		err = rw.transformRow()
+		if err != nil {
+			return err
+		}
+	}
+
+	if rw.Indent != "" {
+		return rw.indentRow(comma)
+	}
+	return nil
+}
+
+// indentRow rewrites the row in rowOutBuf as indented JSON according to Indent.
+// Comma rows are indented one level, separated from the prior row by ",\n" and are
+// not newline terminated (WriteCommaRows writes the final newline).
+func (rw *RowsWriter) indentRow(comma bool) error {
+
+	obj := bytes.TrimSpace(rw.rowOutBuf.Bytes())
+	prefix := ""
+
+	rw.indentBuf.Reset()
+	if comma {
+		prefix = rw.Indent
+		if len(obj) > 0 && obj[0] == ',' {
+			obj = obj[1:]
+			rw.indentBuf.WriteString(",\n")
+		}
+	}
+	rw.indentBuf.WriteString(prefix)
+	err := json.Indent(&rw.indentBuf, obj, prefix, rw.Indent)
+	if err != nil {
+		return err
+	}
+	if !comma {
+		rw.indentBuf.WriteByte('\n')
+	}
+
+	rw.rowOutBuf.Reset()
+	rw.rowOutBuf.Write(rw.indentBuf.Bytes())
+	return nil
+}
+
+// WriteCommaRows calls WriteRow in a loop and adds a comma in between each.
+// Surround with `[`...`]` to form valid JSON.
+func (rw *RowsWriter) WriteCommaRows() error {
+
+	if bw := rw.newBatchWriter(); bw != nil {
+		return rw.withBatchWriter(bw, rw.WriteCommaRows)
+	}
+
+	defer rw.startHeartbeat(heartbeatJSON)()
+
+	if len(rw.GroupBy) > 0 {
+		return rw.writeGroupedRows()
+	}
+
+	n := 0
+	if rw.parallelRows() {
+		var err error
+		n, err = rw.writeParallelRows()
+		if err != nil {
+			return err
+		}
+	} else {
+		for rw.nextRow() {
+			err := rw.WriteCommaRow()
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		if err := rw.rowsErr(); err != nil {
+			return err
+		}
+	}
+
+	// indented comma rows are not newline terminated
+	if rw.Indent != "" && n > 0 {
+		_, err := io.WriteString(rw.Writer, "\n")
+		return err
+	}
+
+	return nil
+}
+
+// nullDefault returns the JSON to write in place of NULL for a column, according to NullDefaults
+// and falling back to the zero value for the type of v.
+func (rw *RowsWriter) nullDefault(colName string, v interface{}) []byte {
+	if d, ok := rw.NullDefaults[colName]; ok {
+		return d
+	}
+	switch v.(type) {
+	case *string, *sql.NullString, *[]byte, *sql.RawBytes, *sql.Null[string], *sql.Null[[]byte]:
+		return []byte(`""`)
+	case *int, *int8, *int16, *int32, *int64, *uint, *uint8, *uint16, *uint32, *uint64,
+		*float32, *float64, *sql.NullInt16, *sql.NullInt32, *sql.NullInt64, *sql.NullByte,
+		*sql.NullFloat64, *sql.Null[int64], *sql.Null[int32], *sql.Null[int16], *sql.Null[uint64],
+		*sql.Null[float64], *sql.Null[float32]:
+		return []byte(`0`)
+	case *bool, *sql.NullBool, *sql.Null[bool]:
+		return []byte(`false`)
+	}
+	return []byte(`null`)
+}
+
+// isNullValue returns true if v (a scan arg) holds a NULL value.
+func isNullValue(v interface{}) bool {
+	switch vt := v.(type) {
+	case *sql.RawBytes:
+		return vt == nil || *vt == nil
+	case *[]byte:
+		return vt == nil || *vt == nil
+	case *interface{}:
+		return vt == nil || *vt == nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+		return true
+	}
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer && rv.Elem().IsNil() {
+		return true // e.g. a clickhouse-go Nullable column
+	}
+	if vr, ok := v.(driver.Valuer); ok { // covers sql.NullString, sql.Null[T], etc.
+		val, err := vr.Value()
+		return err == nil && val == nil
+	}
+	return false
+}
+
+// value kinds returned by scanArgKind, used by the writers for typed output formats
+const (
+	kindText = iota
+	kindInt64
+	kindUint64
+	kindFloat64
+	kindBool
+	kindTime
+)
+
+// colKind returns the kind of value written for column i, which is kindText for masked columns.
+func (rw *RowsWriter) colKind(i int) int {
+	if rw.colMasks[i] != nil {
+		return kindText
+	}
+	return scanArgKind(rw.scanArgs[i])
+}
+
+// scanArgKind returns the kind of value the scan arg v holds.
+// Anything that is not a number, boolean or time is kindText.
+func scanArgKind(v interface{}) int {
+	switch v.(type) {
+	case *int, *int8, *int16, *int32, *int64, *sql.NullInt16, *sql.NullInt32, *sql.NullInt64,
+		*sql.Null[int64], *sql.Null[int32], *sql.Null[int16]:
+		return kindInt64
+	case *uint, *uint8, *uint16, *uint32, *uint64, *sql.NullByte, *sql.Null[uint64]:
+		return kindUint64
+	case *float32, *float64, *sql.NullFloat64, *sql.Null[float64], *sql.Null[float32]:
+		return kindFloat64
+	case *bool, *sql.NullBool, *sql.Null[bool]:
+		return kindBool
+	case *time.Time, *sql.NullTime, *sql.Null[time.Time]:
+		return kindTime
+	}
+	return kindText
+}
+
+// scanText returns the value a scan arg holds as text, "" if NULL.
+func scanText(v interface{}) string {
+	switch vt := scanValue(v).(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(vt)
+	case sql.RawBytes:
+		return string(vt)
+	case string:
+		return vt
+	case time.Time:
+		return vt.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(vt)
+	}
+}
+
+// scanValue returns the value a scan arg holds, or nil if NULL.
+func scanValue(v interface{}) interface{} {
+	if isNullValue(v) {
+		return nil
+	}
+	if u, ok := v.(*sql.Null[uint64]); ok {
+		return u.V // its Value fails above math.MaxInt64
+	}
+	if vr, ok := v.(driver.Valuer); ok {
+		val, err := vr.Value()
+		if err != nil {
+			return nil
+		}
+		return val
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.Elem().Kind() == reflect.Pointer {
+			return scanValue(rv.Elem().Interface())
+		}
+		return rv.Elem().Interface()
+	}
+	return v
+}
+
+// extraFields calls ExtraFieldsFunc and returns its fields and their keys in order.
+func (rw *RowsWriter) extraFields() ([]string, map[string]json.RawMessage, error) {
+	extra, err := rw.ExtraFieldsFunc(rw.scanArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, extra, nil
+}
+
+// writeRowIndexField writes the RowIndexField field for index after the fields already in rowOutBuf.
+func (rw *RowsWriter) writeRowIndexField(index int64) {
+	if b := rw.rowOutBuf.Bytes(); len(b) > 0 && b[len(b)-1] != '{' {
+		rw.rowOutBuf.WriteByte(',')
+	}
+	rw.writeValue(rw.RowIndexField)
+	rw.rowOutBuf.WriteByte(':')
+	rw.rowOutBuf.WriteString(strconv.FormatInt(index+rw.RowIndexOffset, 10))
+}
+
+// writeExtraFields writes the fields from ExtraFieldsFunc after the fields already in rowOutBuf.
+func (rw *RowsWriter) writeExtraFields() error {
+
+	keys, extra, err := rw.extraFields()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if b := rw.rowOutBuf.Bytes(); len(b) > 0 && b[len(b)-1] != '{' {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		rw.writeValue(k)
+		rw.rowOutBuf.WriteByte(':')
+		if len(extra[k]) == 0 {
+			rw.rowOutBuf.WriteString("null")
+		} else {
+			rw.rowOutBuf.Write(extra[k])
+		}
+	}
+
+	return nil
+}
+
+// writeRowFields will write the object fields in plan to rowOutBuf without flushing it
+func (rw *RowsWriter) writeRowFields(plan []fieldOp) error {
+
+	// output each column as JSON object entry, fast paths for specific cases
+	doneFirstCol := false
+	for _, op := range plan {
+
+		// open or close a nested object
+		if op.col < 0 {
+			if op.close {
+				rw.rowOutBuf.WriteByte('}')
+				doneFirstCol = true
+				continue
+			}
+			if doneFirstCol {
+				rw.rowOutBuf.WriteByte(',')
+			}
+			rw.rowOutBuf.Write(op.keyJSON)
+			rw.rowOutBuf.WriteByte('{')
+			doneFirstCol = false
+			continue
+		}
+
+		i := op.col
+
+		custom, skip, err := rw.customColumnValue(i)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+
+		if doneFirstCol {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		doneFirstCol = true
+
+		rw.rowOutBuf.Write(op.keyJSON)
+		start := rw.rowOutBuf.Len()
+
+		// if custom value from JSONValueFunc etc, write it here.  valueTruncated is reset for
+		// every column so a custom value after a truncated one isn't marked as truncated.
+		rw.valueTruncated = false
+		if custom != nil {
+			rw.rowOutBuf.Write(custom)
+		} else if s, ok := rw.spillText(i); ok {
+			rw.spillValue(s)
+		} else {
+			err = rw.writeColumnValue(i)
+			if err != nil {
+				return err
+			}
+		}
+
+		if rw.ValidateOutput {
+			err = rw.validateColumnValue(i, start)
+			if err != nil {
+				return err
+			}
+		}
+
+		if rw.valueTruncated && rw.TruncatedFields {
+			rw.rowOutBuf.WriteByte(',')
+			rw.rowOutBuf.Write(rw.jsonKey(op.key + "_truncated"))
+			rw.rowOutBuf.WriteString("true")
+		}
+	}
+
+	return nil
+}
+
+// writeRowValues will write the values of the columns in plan to rowOutBuf, separated by commas,
+// for use as a JSON array.  Nested objects are ignored and fields that would be skipped are written as null.
+func (rw *RowsWriter) writeRowValues(plan []fieldOp) error {
+
+	doneFirstCol := false
+	for _, op := range plan {
+
+		if op.col < 0 {
+			continue
+		}
+		i := op.col
+
+		if doneFirstCol {
+			rw.rowOutBuf.WriteByte(',')
+		}
+		doneFirstCol = true
+
+		custom, skip, err := rw.customColumnValue(i)
+		if err != nil {
+			return err
+		}
+		if skip {
+			rw.rowOutBuf.WriteString("null")
+			continue
+		}
+		start := rw.rowOutBuf.Len()
+		if custom != nil {
+			rw.rowOutBuf.Write(custom)
+		} else {
+			err = rw.writeColumnValue(i)
+			if err != nil {
+				return err
+			}
+		}
+
+		if rw.ValidateOutput {
+			err = rw.validateColumnValue(i, start)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// customColumnValue handles the JSONValueFunc, formatter and NullPolicy cases for column i.
+// If custom is not nil it is the JSON to write for the value, if skip is true the field should not be written.
+// The returned slice is only valid until the next call.
+func (rw *RowsWriter) customColumnValue(i int) (custom []byte, skip bool, err error) {
+
+	thisColName := rw.colNames[i]
+	thisScanArg := rw.scanArgs[i]
+
+	if rule := rw.colMasks[i]; rule != nil && !isNullValue(thisScanArg) {
+		return rw.maskedColumnValue(i, rule), false, nil
+	}
+
+	// the first formatter that returns ok wins
+	for _, f := range [...]ValueFormatter{rw.JSONValueFunc, rw.colFormatters[i][0], rw.colFormatters[i][1]} {
+		if f == nil {
+			continue
+		}
+		rw.customBuf.Reset()
+		ok, skip, err := f(&rw.customBuf, thisColName, i, thisScanArg)
+		if err != nil {
+			return nil, false, err
+		}
+		if skip {
+			return nil, true, nil
+		}
+		if ok {
+			// e.g. json.Encoder output ends with a newline, which would break WriteNDJSON lines
+			return bytes.TrimRight(rw.customBuf.Bytes(), jsonSpace), false, nil
+		}
+	}
+
+	if rw.NullPolicy != NullWrite && isNullValue(thisScanArg) {
+		if rw.NullPolicy == NullOmit {
+			return nil, true, nil
+		}
+		return rw.nullDefault(thisColName, thisScanArg), false, nil
+	}
+
+	return nil, false, nil
+}
+
+// writeColumnValue writes the value of column i to rowOutBuf according to the configured options,
+// using the writer chosen for the column by setupColWriters.
+func (rw *RowsWriter) writeColumnValue(i int) error {
+	return rw.colWriters[i]()
+}
+
+// writeOptionsColumnValue writes the value of column i to rowOutBuf, checking each of the
+// options that apply to column values.
+func (rw *RowsWriter) writeOptionsColumnValue(i int) error {
+
+	thisColName := rw.colNames[i]
+	thisScanArg := rw.scanArgs[i]
+
+	if rw.colRawJSON[i] {
+		return rw.writeRawJSONValue(thisScanArg)
+	}
+
+	if rw.Int64AsString || containsString(rw.Int64AsStringColumns, thisColName) {
+		if rw.writeLargeIntString(thisScanArg) {
+			return nil
+		}
+	}
+
+	if rw.colGeo[i] != 0 {
+		if ok, err := rw.writeGeoJSONValue(thisScanArg, rw.colGeo[i] == 2); ok {
+			return err
+		}
+	}
+
+	if rw.colHstore[i] && !isNullValue(thisScanArg) {
+		return rw.writeHstoreValue(scanText(thisScanArg))
+	}
+
+	if rw.colUUID[i] != 0 && rw.writeUUIDValue(thisScanArg, rw.colUUID[i] == 2) {
+		return nil
+	}
 
-	if w, ok := rw.Writer.(http.ResponseWriter); ok {
-		if w.Header().Get("Content-Type") == "" { // set content type the first time
-			w.Header().Set("Content-Type", "application/json")
+	if rw.BinaryEncoding != BinaryRawString && rw.colBinary[i] {
+		if rw.writeBinaryValue(thisScanArg) {
+			return nil
 		}
 	}
 
-	w := rw.Writer
+	if rw.colBool[i] && rw.writeBoolValue(thisScanArg) {
+		return nil
+	}
 
-	fmt.Fprintln(w, "[")
+	if m, ok := rw.ValueMaps[thisColName]; ok && !isNullValue(thisScanArg) {
+		if ok, err := rw.writeMappedValue(scanText(thisScanArg), m); ok {
+			return err
+		}
+	}
 
-	for rows.Next() {
-		err := rw.WriteCommaRow()
-		if err != nil {
+	if prec, ok := rw.FloatPrecision[thisColName]; ok {
+		if ok, err := rw.writeFloatPrecision(thisScanArg, prec); ok {
 			return err
 		}
 	}
-	if err := rows.Err(); err != nil {
-		return err
+
+	if rw.DecimalAsNumber && rw.colDecimal[i] {
+		if ns, ok := thisScanArg.(*sql.NullString); ok && (!ns.Valid || isJSONNumber(ns.String)) {
+			if ns.Valid {
+				rw.rowOutBuf.WriteString(ns.String)
+			} else {
+				rw.rowOutBuf.WriteString("null")
+			}
+			return nil
+		}
+		// driver decimal types, e.g. decimal.Decimal from clickhouse-go
+		if s := scanText(thisScanArg); isJSONNumber(s) {
+			rw.rowOutBuf.WriteString(s)
+			return nil
+		}
+	}
+
+	// // json fields are output raw
+	// if rw.jsonFieldSuffixes == nil && strings.HasSuffix(thisColName, "_json") {
+	// 	rw.writeRawJSONValue(thisScanArg)
+	// 	continue colloop
+	// } else if rw.jsonFieldSuffixes != nil {
+	// 	for _, suf := range rw.jsonFieldSuffixes {
+	// 		if strings.HasSuffix(thisColName, suf) {
+	// 			rw.writeRawJSONValue(thisScanArg)
+	// 			continue colloop
+	// 		}
+	// 	}
+	// }
+	if n := rw.maxStringLength(thisColName); n > 0 && !rw.colBinary[i] {
+		if ok, err := rw.writeTruncatedValue(thisScanArg, n); ok {
+			return err
+		}
 	}
 
-	fmt.Fprintln(w, "]")
+	if rw.colNested[i] {
+		return rw.writeNestedElem(thisScanArg)
+	}
 
-	return nil
+	// otherwise use writeValue
+	return rw.writeValue(thisScanArg)
 }
 
-// // WriteResponseObj writes the first sql row response object.
-// // It will ignore any other rows returned
-// func (rw *RowsWriter) WriteResponseObj(w http.ResponseWriter, rows *sql.Rows) error {
+// columnText returns the value of column i as text, using the same conversion as writing JSON:
+// JSON strings are returned unquoted and other JSON values as-is.  A skipped or null value returns null=true.
+// The returned slice is only valid until the next call.
+func (rw *RowsWriter) columnText(i int) (text []byte, null bool, err error) {
 
-// 	w.Header().Set("Content-Type", "application/json")
+	custom, skip, err := rw.customColumnValue(i)
+	if err != nil || skip {
+		return nil, true, err
+	}
+	b := custom
+	if b == nil {
+		rw.rowOutBuf.Reset()
+		err = rw.writeColumnValue(i)
+		if err != nil {
+			return nil, false, err
+		}
+		b = rw.rowOutBuf.Bytes()
+	}
+	b = bytes.TrimSpace(b)
+
+	switch {
+	case len(b) == 0 || string(b) == "null":
+		return nil, true, nil
+	case b[0] != '"':
+		return b, false, nil
+	case bytes.IndexByte(b, '\\') < 0:
+		return b[1 : len(b)-1], false, nil
+	}
+	var s string
+	err = json.Unmarshal(b, &s)
+	return []byte(s), false, err
+}
 
-// 	for rows.Next() {
+// fieldOp is one step in writing a row object, see setupFieldPlan.
+type fieldOp struct {
+	col     int    // index of column to write, or -1 to open or close a nested object
+	key     string // JSON key for the column or nested object
+	keyJSON []byte // key as an escaped and quoted JSON string followed by a colon
+	close   bool   // if col < 0, close the current nested object
+}
 
-// 		err := rw.WriteRow(rows)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		break
-// 	}
-// 	if err := rows.Err(); err != nil {
-// 		return err
-// 	}
+// fieldNode is used by setupFieldPlan to build the tree of nested objects.
+type fieldNode struct {
+	key      string
+	col      int
+	children []*fieldNode
+}
 
-// 	return nil
+// setupFieldPlan populates fieldPlan from colKeys, colDropped and NestSeparator.
+// Columns that belong to a child array (see Children) are not included.
+func (rw *RowsWriter) setupFieldPlan() (err error) {
+	rw.fieldPlan, err = rw.buildFieldPlan(rw.fieldPlan[:0], func(i int) (string, bool) {
+		return rw.colKeys[i], rw.childIndex(i) < 0
+	})
+	return err
+}
 
-// }
+// buildFieldPlan appends to plan the steps to write the columns for which include returns ok,
+// using the returned key, and splitting keys into nested objects according to NestSeparator.
+// An error is returned if a key is both a column and a nested object, e.g. for the columns
+// x and x__y, as the object would have the key twice.
+func (rw *RowsWriter) buildFieldPlan(plan []fieldOp, include func(i int) (key string, ok bool)) ([]fieldOp, error) {
 
-// WriteCommaRow is like WriteRow but will prepend a comma before every row except the first.
-// Suitable for writing out multiple rows in an JSON array.
-// The same rows object must be passed each time, i.e. do not reuse an instance of this object for
-// multiple result sets.
-func (rw *RowsWriter) WriteCommaRow() error {
+	if rw.NestSeparator == "" {
+		for _, i := range rw.orderedCols() {
+			if key, ok := include(i); ok && !rw.colDropped[i] {
+				plan = append(plan, fieldOp{col: i, key: key, keyJSON: rw.jsonKey(key)})
+			}
+		}
+		return plan, nil
+	}
 
-	// rows := rw.Rows
+	root := &fieldNode{col: -1}
+	for _, i := range rw.orderedCols() {
+		key, ok := include(i)
+		if !ok || rw.colDropped[i] {
+			continue
+		}
+		parts := strings.Split(key, rw.NestSeparator)
+		n := root
+	partloop:
+		for _, part := range parts[:len(parts)-1] {
+			for _, c := range n.children {
+				if c.key != part {
+					continue
+				}
+				if c.col >= 0 {
+					return plan, fmt.Errorf("column %q conflicts with the nested object of column %q (NestSeparator %q)",
+						rw.colNames[c.col], rw.colNames[i], rw.NestSeparator)
+				}
+				n = c
+				continue partloop
+			}
+			c := &fieldNode{key: part, col: -1}
+			n.children = append(n.children, c)
+			n = c
+		}
+		leaf := parts[len(parts)-1]
+		for _, c := range n.children {
+			if c.col < 0 && c.key == leaf {
+				return plan, fmt.Errorf("column %q conflicts with a nested object of the same key (NestSeparator %q)",
+					rw.colNames[i], rw.NestSeparator)
+			}
+		}
+		n.children = append(n.children, &fieldNode{key: leaf, col: i})
+	}
 
-	err := rw.scanRowArgs(true)
-	if err != nil {
-		return err
+	var walk func(n *fieldNode)
+	walk = func(n *fieldNode) {
+		for _, c := range n.children {
+			if c.col >= 0 {
+				plan = append(plan, fieldOp{col: c.col, key: c.key, keyJSON: rw.jsonKey(c.key)})
+				continue
+			}
+			plan = append(plan, fieldOp{col: -1, key: c.key, keyJSON: rw.jsonKey(c.key)})
+			walk(c)
+			plan = append(plan, fieldOp{col: -1, close: true})
+		}
 	}
+	walk(root)
 
-	rw.rowOutBuf.WriteByte('{')
+	return plan, nil
+}
 
-	err = rw.writeRowFields()
-	if err != nil {
-		return err
-	}
+// jsonKey returns key as a JSON object key: quoted, escaped according to EscapeHTML and
+// followed by a colon.
+func (rw *RowsWriter) jsonKey(key string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(rw.EscapeHTML)
+	enc.Encode(key) // a string can always be encoded
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return append(b, ':')
+}
 
-	rw.rowOutBuf.WriteString("}\n")
+// orderedCols returns the column indexes in the order they are written according to ColumnOrder.
+func (rw *RowsWriter) orderedCols() []int {
 
-	_, err = rw.rowOutBuf.WriteTo(rw.Writer)
-	return err
+	order := make([]int, 0, len(rw.colKeys))
+	used := make([]bool, len(rw.colKeys))
+	for _, name := range rw.ColumnOrder {
+		for i, key := range rw.colKeys {
+			if used[i] {
+				continue
+			}
+			if rw.colNames[i] == name || key == name || rw.NestSeparator != "" && strings.HasPrefix(key, name+rw.NestSeparator) {
+				used[i] = true
+				order = append(order, i)
+			}
+		}
+	}
+	for i := range rw.colKeys {
+		if !used[i] {
+			order = append(order, i)
+		}
+	}
+	return order
 }
 
-// WriteRow will call rows.Scan with the appropriate arguments and write the result as a JSON object.
-// The same rows object must be passed each time, i.e. do not reuse an instance of this object for
-// multiple result sets.
-func (rw *RowsWriter) WriteRow() error {
+// renameColKeys applies ColumnRenames, StripPrefixes and ColumnNameFunc to colKeys.
+func (rw *RowsWriter) renameColKeys() {
+	for i, key := range rw.colKeys {
+		if r, ok := rw.ColumnRenames[key]; ok {
+			rw.colKeys[i] = r
+			continue
+		}
+		for _, prefix := range rw.StripPrefixes {
+			if len(key) > len(prefix) && strings.HasPrefix(key, prefix) {
+				rw.colKeys[i] = key[len(prefix):]
+				break
+			}
+		}
+		if rw.ColumnNameFunc != nil {
+			rw.colKeys[i] = rw.ColumnNameFunc(rw.colKeys[i])
+		}
+	}
+}
 
-	// rows := rw.Rows
+// setupColKeys populates colKeys and colDropped from colNames according to IncludeColumns and DuplicateColumns.
+func (rw *RowsWriter) setupColKeys() error {
 
-	err := rw.scanRowArgs(false)
-	if err != nil {
-		return err
+	rw.colKeys = append(rw.colKeys[:0], rw.colNames...)
+	rw.colDropped = rw.colDropped[:0]
+	for _, name := range rw.colNames {
+		rw.colDropped = append(rw.colDropped, len(rw.IncludeColumns) > 0 && !containsString(rw.IncludeColumns, name))
 	}
 
-	rw.rowOutBuf.WriteByte('{')
+	return rw.dedupColKeys()
+}
 
-	err = rw.writeRowFields()
-	if err != nil {
-		return err
+// dedupColKeys applies DuplicateColumns to the columns in colKeys that have the same key.
+// It is called again after renameColKeys, as renaming can give columns the same key, and
+// keys that are already unique are left as they are.
+func (rw *RowsWriter) dedupColKeys() error {
+
+	if rw.DuplicateColumns == DuplicateAllow {
+		return nil
 	}
 
-	rw.rowOutBuf.WriteString("}\n")
+	// columns excluded by IncludeColumns are not output, so they are not duplicates
+	counts := make(map[string]int, len(rw.colKeys))
+	for i, key := range rw.colKeys {
+		if !rw.colDropped[i] {
+			counts[key]++
+		}
+	}
 
-	_, err = rw.rowOutBuf.WriteTo(rw.Writer)
-	return err
+	keys := make(map[string]bool, len(rw.colKeys)) // all keys before deduplication, to avoid collisions
+	for _, key := range rw.colKeys {
+		keys[key] = true
+	}
+	assigned := make(map[string]bool, len(rw.colKeys)) // keys given to duplicate columns so far
+
+	seen := make(map[string]int, len(rw.colKeys))
+	for i, dup := range rw.colKeys {
+		if rw.colDropped[i] || counts[dup] < 2 {
+			continue
+		}
+		seen[dup]++
+
+		switch rw.DuplicateColumns {
+
+		case DuplicateError:
+			if dup != rw.colNames[i] {
+				return fmt.Errorf("duplicate JSON key %q for column %q", dup, rw.colNames[i])
+			}
+			return fmt.Errorf("duplicate column name %q", dup)
+
+		case DuplicateLastWins:
+			rw.colDropped[i] = seen[dup] < counts[dup]
+
+		case DuplicateQualify:
+			if i < len(rw.ColumnTables) && rw.ColumnTables[i] != "" {
+				key := rw.ColumnTables[i] + "." + dup
+				if !assigned[key] && !keys[key] {
+					rw.colKeys[i] = key
+					assigned[key] = true
+					continue
+				}
+			}
+			fallthrough
+
+		case DuplicateSuffix:
+			if !assigned[dup] { // first one keeps its key
+				assigned[dup] = true
+				continue
+			}
+			for n := 2; ; n++ {
+				key := dup + "_" + strconv.Itoa(n)
+				if !assigned[key] && !keys[key] {
+					rw.colKeys[i] = key
+					assigned[key] = true
+					break
+				}
+			}
+		}
+	}
+
+	return nil
 }
 
-// WriteCommaRows calls WriteRow in a loop and adds a comma in between each.
-// Surround with `[`...`]` to form valid JSON.
-func (rw *RowsWriter) WriteCommaRows() error {
+// setupColumns reads the column information from Rows and sets up the stuff we need
+// for scanning each row.  It is called automatically before the first row is scanned.
+func (rw *RowsWriter) setupColumns() error {
 
 	rows := rw.Rows
 
-	for rows.Next() {
-		err := rw.WriteCommaRow()
-		if err != nil {
-			return err
+	colNames, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	rw.colNames = colNames
+
+	colTypes, err := columnTypes(rows)
+	if err != nil {
+		return err
+	}
+	rw.colTypes = colTypes
+
+	err = rw.setupColKeys()
+	if err != nil {
+		return err
+	}
+	rw.renameColKeys()
+	err = rw.dedupColKeys()
+	if err != nil {
+		return err
+	}
+	err = rw.setupFieldPlan()
+	if err != nil {
+		return err
+	}
+	err = rw.setupGroup()
+	if err != nil {
+		return err
+	}
+
+	rw.colBinary = rw.colBinary[:0]
+	rw.colDecimal = rw.colDecimal[:0]
+	rw.colBool = rw.colBool[:0]
+	rw.colUUID = rw.colUUID[:0]
+	rw.colGeo = rw.colGeo[:0]
+	rw.colHstore = rw.colHstore[:0]
+	rw.colNested = rw.colNested[:0]
+	rw.colRawJSON = rw.colRawJSON[:0]
+	rw.colWriters = rw.colWriters[:0]
+	rw.colFormatters = rw.colFormatters[:0]
+	for i, ct := range colTypes {
+		rw.colBinary = append(rw.colBinary, isBinaryType(ct.DatabaseTypeName()) || containsString(rw.BinaryColumns, colNames[i]))
+		rw.colDecimal = append(rw.colDecimal, isDecimalColumn(ct))
+		rw.colBool = append(rw.colBool, rw.isBoolColumn(colNames[i], ct))
+		var uuid int8
+		if rw.isUUIDColumn(colNames[i], ct.DatabaseTypeName()) {
+			uuid = 1
+			if rw.UUIDMixedEndian || ct.DatabaseTypeName() == "UNIQUEIDENTIFIER" {
+				uuid = 2
+			}
 		}
+		rw.colUUID = append(rw.colUUID, uuid)
+		var geo int8
+		if rw.isGeoColumn(colNames[i], ct.DatabaseTypeName()) {
+			geo = 1
+			if ct.DatabaseTypeName() == "GEOMETRY" { // as reported by the MySQL driver, and others
+				geo = 2
+			}
+		}
+		rw.colGeo = append(rw.colGeo, geo)
+		rw.colHstore = append(rw.colHstore, isHstoreType(ct.DatabaseTypeName()))
+		rw.colNested = append(rw.colNested, isClickHouseNested(ct.DatabaseTypeName()) || isDuckDBNested(ct.DatabaseTypeName()))
+		rw.colRawJSON = append(rw.colRawJSON, containsString(rw.RawJSONColumns, colNames[i]))
+		rw.colFormatters = append(rw.colFormatters, [2]ValueFormatter{rw.columnFormatters[colNames[i]], rw.typeFormatters[ct.DatabaseTypeName()]})
 	}
-	if err := rows.Err(); err != nil {
+	err = rw.setupMasks()
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	scanArgs := make([]interface{}, len(colTypes))
+	for i, ct := range colTypes {
 
-// writeRowFields will write the object fields to rowOutBuf without flushing it
-func (rw *RowsWriter) writeRowFields() error {
+		//log.Printf("coltype: %v scanArg: %v", ct, scanArgs[i])
 
-	var customJSONBuf bytes.Buffer
-	customJSONBufOk := false
+		// FIXME: this stuff is a bit of a leftover mess - we really should add in a way to customize
+		// the scanning type layer, allowing people to at least work around the oddities they might encouter.
+		// I just ran out of time while I was last working on this. -bgp
 
-	// output each column as JSON object entry, fast paths for specific cases
-	doneFirstCol := false
-colloop:
-	for i := range rw.colNames {
+		// NOTE: large integers (e.g. hashes that use the full range of a uint64) used to be hacked
+		// in here by column name, see Int64AsString for the general solution.
 
-		thisColName := rw.colNames[i]
-		thisScanArg := rw.scanArgs[i]
+		switch colNames[i] {
+		// case "change_time":
+		// 	scanArgs[i] = new(Timestamp)
+		default:
 
-		// handle the JSONValueFunc case and buffer whatever is output here
-		customJSONBufOk = false
-		if rw.JSONValueFunc != nil {
-			customJSONBuf.Reset()
-			ok, skip, err := rw.JSONValueFunc(&customJSONBuf, thisColName, i, thisScanArg)
-			if err != nil {
-				return err
+			// if colNames[i] == "updated_at" {
+			// 	log.Printf("ct.DatabaseTypeName: %q scanType.String(): %q", ct.DatabaseTypeName(), scanType.String())
+			// }
+
+			// 20230608 - TIMESTAMP sql type is not supported
+			// Error: sql: Scan error on column index 1, name "change_time": unsupported Scan, storing driver.Value type []uint8 into type *time.Time
+			// 2023/06/08 15:43:59 coltype: &{change_time true false true false 0 TIMESTAMP 0 0 0x17dc000} scanArg: <nil>
+			//scanType: sql.NullTime
+
+			// NOTE: THESE ARE ACTUALLY IMPORTANT, I JUST DIDN'T WANT TO HACK IN MYSQL-SPECIFIC STUFF FROM THE START HERE, BUT INSTEAD
+			// FOCUS ON LETTING PEOPLE CUSTOMIZE THINGS, BUT THIS LOGIC SHOULD GO SOME PLACE PERHAPS SOME MYSQL-SPECIFIC CONVERSION
+			// FUNCTION THAT PEOPLE CAN PLUG IN. -bgp
+			// if (ct.DatabaseTypeName() == "TIMESTAMP") && scanType.String() == "sql.NullTime" {
+			// 	scanArgs[i] = new(string)
+			// } else if strings.HasSuffix(colNames[i], "_id") || ((ct.DatabaseTypeName() == "DATETIME") && scanType.String() == "sql.NullTime") {
+			// 	// anything that ends with "_id" we assume is a uint64 that needs to be made a string
+			// 	scanArgs[i] = new(sql.NullString)
+			// 	// } else if scanType.ConvertibleTo(reflect.TypeOf(sql.NullTime{})) {
+			// 	// use *sql.NullTime, since the mysql driver is returning a *mysql.NullTime - so lame
+			// 	// scanArgs[i] = &sql.NullTime{}
+			// } else {
+			// allocate and get pointer using whatever the database has
+			if rw.ScanArgFunc != nil {
+				scanArgs[i] = rw.ScanArgFunc(ct)
 			}
-			if skip {
-				continue
+			if scanArgs[i] == nil && rw.colRawJSON[i] {
+				scanArgs[i] = new(sql.NullString)
 			}
-			customJSONBufOk = ok
-		}
+			if scanArgs[i] == nil {
+				scanArgs[i] = newScanArg(ct)
+			}
+			// }
 
-		if doneFirstCol {
-			rw.rowOutBuf.WriteByte(',')
 		}
-		doneFirstCol = true
 
-		rw.writeValue(thisColName)
-		rw.rowOutBuf.WriteByte(':')
+		// log.Printf("col %q: %v; %v", colNames[i], ct.ScanType(), ct.DatabaseTypeName())
 
-		// if custom value from JSONValueFunc, write it here
-		if customJSONBufOk {
-			rw.rowOutBuf.Write(customJSONBuf.Bytes())
-			continue colloop
-		}
-
-		// // json fields are output raw
-		// if rw.jsonFieldSuffixes == nil && strings.HasSuffix(thisColName, "_json") {
-		// 	rw.writeRawJSONValue(thisScanArg)
-		// 	continue colloop
-		// } else if rw.jsonFieldSuffixes != nil {
-		// 	for _, suf := range rw.jsonFieldSuffixes {
-		// 		if strings.HasSuffix(thisColName, suf) {
-		// 			rw.writeRawJSONValue(thisScanArg)
-		// 			continue colloop
-		// 		}
-		// 	}
-		// }
-		// otherwise use writeValue
-		rw.writeValue(thisScanArg)
+	}
+	rw.scanArgs = scanArgs
+	rw.setupColWriters()
+
+	rw.rowOutBuf.Grow(rw.rowBufferSize())
 
-		// if strings.HasSuffix(rw.colNames[i], "_json") {
-		// 	rw.writeRawJSONValue(rw.scanArgs[i])
-		// } else {
-		// 	// otherwise use writeValue
-		// 	rw.writeValue(rw.scanArgs[i])
-		// }
+	return nil
+}
 
+// newScanArg returns a pointer to scan the values of a column of type ct into.
+func newScanArg(ct ColumnType) interface{} {
+	scanType := ct.ScanType()
+	if isDuckDBDecimal(scanType) || isHugeIntType(ct.DatabaseTypeName()) {
+		// go-duckdb values that don't scan into a sql.NullString
+		return new(duckDBText)
+	} else if isDecimalType(ct.DatabaseTypeName()) {
+		// scan as text so the exact value is preserved regardless of the driver's scan type
+		return new(sql.NullString)
+	} else if scanType == nil {
+		return new(interface{})
+	} else if scanType == nullInt64Type && isUnsignedBigint(ct.DatabaseTypeName()) {
+		// values above the int64 range would fail to scan into a sql.NullInt64
+		return new(sql.Null[uint64])
+	} else if scanType == uint8SliceType && isClickHouseArray(ct.DatabaseTypeName()) {
+		// a list of numbers, not binary data
+		return new(uint8Array)
 	}
+	if nullable, ok := ct.Nullable(); ok && nullable {
+		// some drivers give plain scan types for nullable columns, which fail to scan NULL
+		if f := nullScanArgs[scanType]; f != nil {
+			return f()
+		}
+	} else if ok {
+		// and a plain type is simpler to scan into for NOT NULL columns
+		if t := plainScanTypes[scanType]; t != nil {
+			scanType = t
+		}
+	}
+	return reflect.New(scanType).Interface()
+}
 
-	return nil
+// plainScanTypes maps sql.Null scan types to the type they hold.
+var plainScanTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+	reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+	reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+	reflect.TypeOf(sql.NullByte{}):    reflect.TypeOf(uint8(0)),
+	reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+	reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+	reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+	reflect.TypeOf(sql.NullTime{}):    reflect.TypeOf(time.Time{}),
+}
+
+// nullScanArgs returns a new sql.Null scan arg for plain scan types that can't hold NULL.
+var nullScanArgs = map[reflect.Type]func() interface{}{
+	reflect.TypeOf(int64(0)):    func() interface{} { return new(sql.Null[int64]) },
+	reflect.TypeOf(int32(0)):    func() interface{} { return new(sql.Null[int32]) },
+	reflect.TypeOf(int16(0)):    func() interface{} { return new(sql.Null[int16]) },
+	reflect.TypeOf(int8(0)):     func() interface{} { return new(sql.Null[int16]) },
+	reflect.TypeOf(int(0)):      func() interface{} { return new(sql.Null[int64]) },
+	reflect.TypeOf(uint64(0)):   func() interface{} { return new(sql.Null[uint64]) },
+	reflect.TypeOf(uint(0)):     func() interface{} { return new(sql.Null[uint64]) },
+	reflect.TypeOf(uint32(0)):   func() interface{} { return new(sql.Null[int64]) },
+	reflect.TypeOf(uint16(0)):   func() interface{} { return new(sql.Null[int32]) },
+	reflect.TypeOf(uint8(0)):    func() interface{} { return new(sql.Null[int16]) },
+	reflect.TypeOf(float64(0)):  func() interface{} { return new(sql.Null[float64]) },
+	reflect.TypeOf(float32(0)):  func() interface{} { return new(sql.Null[float32]) },
+	reflect.TypeOf(false):       func() interface{} { return new(sql.Null[bool]) },
+	reflect.TypeOf(""):          func() interface{} { return new(sql.Null[string]) },
+	reflect.TypeOf(time.Time{}): func() interface{} { return new(sql.Null[time.Time]) },
 }
 
 func (rw *RowsWriter) scanRowArgs(comma bool) error {
@@ -586,117 +3054,84 @@ func (rw *RowsWriter) scanRowArgs(comma bool) error {
 	rows := rw.Rows
 
 	// the first time we set up the stuff we need for scanning each row
-	if rw.colNames == nil {
-
-		colNames, err := rows.Columns()
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
 		if err != nil {
 			return err
 		}
-		rw.colNames = colNames
-
-		colTypes, err := rows.ColumnTypes()
-		if err != nil {
-			return err
-		}
-		// rw.colTypes = colTypes
-
-		scanArgs := make([]interface{}, len(colTypes))
-		for i, ct := range colTypes {
-
-			//log.Printf("coltype: %v scanArg: %v", ct, scanArgs[i])
-
-			// FIXME: this stuff is a bit of a leftover mess - we really should add in a way to customize
-			// the scanning type layer, allowing people to at least work around the oddities they might encouter.
-			// I just ran out of time while I was last working on this. -bgp
-
-			// EARLIER HACK: so this is unfortunate but the MySQL driver does not send back "UNSIGNED" for unsigned ints.
-			// This is a problem for specific fields that use the full range of a uint64. Thus we just
-			// hack it by name.
+	}
 
-			switch colNames[i] {
-			// case "asin_hash", "sku_hash", "created_at": //, "change_time":
-			// 	// use strings, since uint64 is not representable in JSON
-			// 	scanArgs[i] = new(string)
-			// case "change_time":
-			// 	scanArgs[i] = new(Timestamp)
-			default:
-
-				scanType := ct.ScanType()
-				// if colNames[i] == "updated_at" {
-				// 	log.Printf("ct.DatabaseTypeName: %q scanType.String(): %q", ct.DatabaseTypeName(), scanType.String())
-				// }
-
-				// 20230608 - TIMESTAMP sql type is not supported
-				// Error: sql: Scan error on column index 1, name "change_time": unsupported Scan, storing driver.Value type []uint8 into type *time.Time
-				// 2023/06/08 15:43:59 coltype: &{change_time true false true false 0 TIMESTAMP 0 0 0x17dc000} scanArg: <nil>
-				//scanType: sql.NullTime
-
-				// NOTE: THESE ARE ACTUALLY IMPORTANT, I JUST DIDN'T WANT TO HACK IN MYSQL-SPECIFIC STUFF FROM THE START HERE, BUT INSTEAD
-				// FOCUS ON LETTING PEOPLE CUSTOMIZE THINGS, BUT THIS LOGIC SHOULD GO SOME PLACE PERHAPS SOME MYSQL-SPECIFIC CONVERSION
-				// FUNCTION THAT PEOPLE CAN PLUG IN. -bgp
-				// if (ct.DatabaseTypeName() == "TIMESTAMP") && scanType.String() == "sql.NullTime" {
-				// 	scanArgs[i] = new(string)
-				// } else if strings.HasSuffix(colNames[i], "_id") || ((ct.DatabaseTypeName() == "DATETIME") && scanType.String() == "sql.NullTime") {
-				// 	// anything that ends with "_id" we assume is a uint64 that needs to be made a string
-				// 	scanArgs[i] = new(sql.NullString)
-				// 	// } else if scanType.ConvertibleTo(reflect.TypeOf(sql.NullTime{})) {
-				// 	// use *sql.NullTime, since the mysql driver is returning a *mysql.NullTime - so lame
-				// 	// scanArgs[i] = &sql.NullTime{}
-				// } else {
-				// allocate and get pointer using whatever the database has
-				scanArgs[i] = reflect.New(scanType).Interface()
-				// }
+	// the value options may have been changed since the first row
+	if rw.colWriterOpts != rw.currentColWriterOpts() {
+		rw.setupColWriters()
+	}
 
-			}
+	// reset row buffer and write a comma to separate from prior row
+	rw.rowOutBuf.Reset()
+	rw.spills = rw.spills[:0]
+	if comma && rw.rowCount > 0 {
+		rw.rowOutBuf.WriteByte(',')
+	}
 
-			// log.Printf("col %q: %v; %v", colNames[i], ct.ScanType(), ct.DatabaseTypeName())
+	// scan row data, unless nextRow did already
+	if rw.prescanned {
+		rw.prescanned = false
+	} else {
+		err := rows.Scan(rw.scanArgs...)
+		if err != nil {
 
+			// log.Printf("error scanning args: %v", err)
+			return err
 		}
-		rw.scanArgs = scanArgs
+	}
+	rw.rowCount++
+	rw.totalRows++
 
-		rw.rowOutBuf.Grow(1024)
-		rw.rowOutEnc = json.NewEncoder(&rw.rowOutBuf)
+	return nil
+}
 
-	} else {
+// NextMap advances to the next row and returns it as a map, for when rows need to be
+// post-processed in Go before serializing.  The values are the same as the JSON that would be
+// written, decoded: nil, bool, int64, uint64, float64, string, []interface{} or
+// map[string]interface{} (for nested objects and JSON columns).  All of the RowsWriter options
+// apply.  io.EOF is returned after the last row.
+func (rw *RowsWriter) NextMap() (map[string]interface{}, error) {
 
-		// reset row buffer and write a comma to separate from prior row
-		rw.rowOutBuf.Reset()
-		if comma {
-			rw.rowOutBuf.WriteByte(',')
+	if !rw.nextRow() {
+		if err := rw.rowsErr(); err != nil {
+			return nil, err
 		}
+		return nil, io.EOF
 	}
 
-	// scan row data
-	err := rows.Scan(rw.scanArgs...)
+	err := rw.buildRow(false)
 	if err != nil {
-
-		// log.Printf("error scanning args: %v", err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	v, err := decodeJSONValue(rw.rowOutBuf.Bytes())
+	rw.rowOutBuf.Reset()
+	if err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[string]interface{})
+	return m, nil
 }
 
-// TODO: not sure if this belongs on RowsWriter, wait until a more specific case where it's needed arises
-// // ScanRowMap calls rows.Scan with the appropriate types and returns the data as a map.
-// // Individual fields can then be output with OutputFields and related functions.
-// func (rw *RowsWriter) ScanRowMap(rows *sql.Rows) (map[string]interface{}, error) {
-
-// 	err := rw.scanRowArgs(rows)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	if rw.rowMap == nil {
-// 		rw.rowMap = make(map[string]interface{}, len(rw.scanArgs))
-// 	}
-
-// 	for i, cn := range rw.colNames {
-// 		rw.rowMap[cn] = rw.scanArgs[i]
-// 	}
-
-// 	return rw.rowMap, nil
-// }
+// AllMaps reads all remaining rows with NextMap.
+func (rw *RowsWriter) AllMaps() ([]map[string]interface{}, error) {
+	var ret []map[string]interface{}
+	for {
+		m, err := rw.NextMap()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, m)
+	}
+}
 
 // FIXME: this isn't quite ready yet - it's depending on scanArgs being set, doesn't mesh with the workflow
 // func (rw *RowsWriter) WriteFields(fieldNames ...string) error {
@@ -734,9 +3169,91 @@ func (rw *RowsWriter) scanRowArgs(comma bool) error {
 
 // }
 
-// unsafeString gives a string that points to the bytes of b.
-// Only use this temporarily in a controlled area, do not assign
-// this as a value, only use it for comparison.
-func unsafeString(b []byte) string {
-	return *(*string)(unsafe.Pointer(&b))
+var nullInt64Type = reflect.TypeOf(sql.NullInt64{})
+
+// isUnsignedBigint returns true if dbTypeName (as returned by sql.ColumnType.DatabaseTypeName)
+// is an unsigned 64-bit integer type, e.g. "UNSIGNED BIGINT" from the MySQL driver.
+func isUnsignedBigint(dbTypeName string) bool {
+	return strings.Contains(dbTypeName, "UNSIGNED") && strings.Contains(dbTypeName, "BIGINT")
+}
+
+// isBinaryType returns true if dbTypeName (as returned by sql.ColumnType.DatabaseTypeName)
+// is a binary column type.
+func isBinaryType(dbTypeName string) bool {
+	switch strings.ToUpper(dbTypeName) {
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA", "IMAGE":
+		return true
+	}
+	return false
+}
+
+// isDecimalType returns true if dbTypeName (as returned by sql.ColumnType.DatabaseTypeName)
+// is an exact decimal column type.
+func isDecimalType(dbTypeName string) bool {
+	switch strings.ToUpper(dbTypeName) {
+	case "DECIMAL", "NUMERIC", "NEWDECIMAL", "UNSIGNED DECIMAL":
+		return true
+	}
+	return false
+}
+
+// isDecimalColumn returns true if ct is an exact decimal column, including those of drivers
+// with their own decimal scan type.
+func isDecimalColumn(ct ColumnType) bool {
+	return isDecimalType(ct.DatabaseTypeName()) || isClickHouseDecimal(ct.DatabaseTypeName()) || isDuckDBDecimal(ct.ScanType())
+}
+
+// isJSONNumber returns true if s is a valid JSON number.
+func isJSONNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	// integer part: 0 or [1-9][0-9]*
+	switch {
+	case i < len(s) && s[i] == '0':
+		i++
+	case i < len(s) && s[i] >= '1' && s[i] <= '9':
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	default:
+		return false
+	}
+	// fraction
+	if i < len(s) && s[i] == '.' {
+		i++
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	// exponent
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	return i == len(s)
+}
+
+// containsString returns true if s is in list.
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
 }
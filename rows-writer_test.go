@@ -2,15 +2,28 @@ package sqljsonutil
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
+	"net/netip"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -262,4 +275,2032 @@ func TestWrite(t *testing.T) {
 		}
 		t.Logf("RESPONSE: %s", resText)
 	})
+
+	t.Run("Int64AsString", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, CAST(9007199254740993 AS SIGNED) AS big_id, CAST(42 AS SIGNED) AS small_id FROM widgets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.Int64AsString = true
+		err = rw.WriteCommaRows()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(buf.String(), `"big_id":"9007199254740993"`) || !strings.Contains(buf.String(), `"small_id":42`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("Decimal", func(t *testing.T) {
+
+		for _, asNumber := range []bool{false, true} {
+
+			rows, err := db.Query("SELECT widget_id, CAST(1234.5678 AS DECIMAL(18,4)) AS price FROM widgets")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			var buf bytes.Buffer
+			rw := NewRowsWriter(&buf, rows)
+			rw.DecimalAsNumber = asNumber
+			err = rw.WriteCommaRows()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := `"price":"1234.5678"`
+			if asNumber {
+				want = `"price":1234.5678`
+			}
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("expected %s in output: %s", want, buf.String())
+			}
+		}
+	})
+
+	t.Run("Formatters", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets_data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.SetColumnFormatter("data", func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+			if v, isNS := value.(*sql.NullString); isNS && v.Valid && json.Valid([]byte(v.String)) {
+				_, err = io.WriteString(w, v.String)
+				return true, false, err
+			}
+			return
+		})
+		rw.SetColumnFormatter("widget_id", func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+			return // always decline, default behavior applies
+		})
+		err = rw.WriteCommaRows()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(buf.String(), `"data":{"description":`) || !strings.Contains(buf.String(), `"widget_id":"abc123"`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("DuplicateColumns", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT w.*, d.* FROM widgets w JOIN widgets_data d ON w.widget_id = d.widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.DuplicateColumns = DuplicateSuffix
+		err = rw.WriteCommaRows()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(buf.String(), `"widget_id":"abc123"`) || !strings.Contains(buf.String(), `"widget_id_2":"abc123"`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("JSONSeq", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		err = NewRowsWriter(&buf, rows).WriteJSONSeq()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(buf.String(), "\x1e{\"widget_id\":\"abc123\"") || strings.Count(buf.String(), "\x1e") != 2 {
+			t.Errorf("unexpected output: %q", buf.String())
+		}
+		t.Logf("OUTPUT: %q", buf.String())
+	})
+
+	t.Run("WriteEach", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var out []string
+		err = NewRowsWriter(nil, rows).WriteEach(func(row json.RawMessage) error {
+			out = append(out, string(row))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out) != 2 || out[1] != `{"widget_id":"def456","name":"Next One"}` {
+			t.Errorf("unexpected output: %q", out)
+		}
+		t.Logf("OUTPUT: %q", out)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var buf bytes.Buffer
+		err = NewRowsWriter(&buf, rows).WriteCommaRowsContext(ctx)
+		if err != context.Canceled || buf.Len() > 0 {
+			t.Errorf("expected context.Canceled and no output, got %v: %s", err, buf.String())
+		}
+	})
+
+	t.Run("MaxRows", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.MaxRows = 1
+		err = rw.WriteColumnar()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !rw.Truncated() || strings.Contains(buf.String(), "def456") || !strings.Contains(buf.String(), `"truncated":true`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.MaxBytes = 60
+		err = rw.WriteResponse()
+		if err != ErrMaxBytes {
+			t.Errorf("expected ErrMaxBytes, got %v", err)
+		}
+
+		if !rw.Truncated() || strings.Contains(buf.String(), "def456") || !strings.HasSuffix(buf.String(), "]\n") {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("FlushEvery", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		rec := httptest.NewRecorder()
+		rw := NewRowsWriter(rec, rows)
+		rw.FlushEvery = 1
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !rec.Flushed {
+			t.Errorf("expected response to be flushed")
+		}
+	})
+
+	t.Run("OnProgress", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		var calls []int64
+		rw := NewRowsWriter(&buf, rows)
+		rw.ProgressEvery = 1
+		rw.OnProgress = func(rowsWritten, bytesWritten int64) {
+			calls = append(calls, rowsWritten)
+			t.Logf("progress: %d rows, %d bytes", rowsWritten, bytesWritten)
+		}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(calls) != 2 || calls[1] != 2 {
+			t.Errorf("unexpected progress calls: %v", calls)
+		}
+	})
+
+	t.Run("RowFilterFunc", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.RowFilterFunc = func(colNames []string, values []interface{}) (bool, error) {
+			widgetID, ok := values[0].(*sql.NullString)
+			if !ok {
+				return false, fmt.Errorf("unexpected value type %T", values[0])
+			}
+			return widgetID.String != "abc123", nil
+		}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(buf.String(), "abc123") || !strings.Contains(buf.String(), "def456") {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("ExtraFieldsFunc", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ExtraFieldsFunc = func(values []interface{}) (map[string]json.RawMessage, error) {
+			return map[string]json.RawMessage{"_type": json.RawMessage(`"widget"`)}, nil
+		}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(buf.String(), `{"widget_id":"abc123","name":"First One","_type":"widget"}`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("RowIndexField", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.RowIndexField = "_row"
+		rw.RowIndexOffset = 20
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(buf.String(), `"name":"First One","_row":20}`) || !strings.Contains(buf.String(), `"name":"Next One","_row":21}`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("AllMaps", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		maps, err := NewRowsWriter(nil, rows).AllMaps()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(maps) != 2 || maps[0]["widget_id"] != "abc123" || maps[1]["name"] != "Next One" {
+			t.Errorf("unexpected maps: %v", maps)
+		}
+		t.Logf("MAPS: %v", maps)
+	})
+
+	t.Run("ColumnMetadata", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ColumnMetadata = true
+		err = rw.WriteNDJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], `{"columns":[{"name":"widget_id","databaseType":"VARCHAR"`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("ErrorPolicy", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ErrorPolicy = ErrorRecord
+		rw.JSONValueFunc = func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+			if ns, _ := value.(*sql.NullString); ns != nil && ns.String == "def456" {
+				return false, false, fmt.Errorf("failed on def456")
+			}
+			return false, false, nil
+		}
+		err = rw.WriteResponse()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		if buf.String() != "[\n{\"widget_id\":\"abc123\",\"name\":\"First One\"}\n,{\"_error\":\"failed on def456\"}\n]\n" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+		t.Logf("OUTPUT: %s", buf.String())
+	})
+
+	t.Run("Atomic", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.Atomic = true
+		rw.JSONValueFunc = func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+			if ns, _ := value.(*sql.NullString); ns != nil && ns.String == "def456" {
+				return false, false, fmt.Errorf("failed on def456")
+			}
+			return false, false, nil
+		}
+		err = rw.WriteResponse()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if buf.Len() != 0 {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+
+		rows, err = db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		rw = NewRowsWriter(&buf, rows)
+		rw.Atomic = true
+		rw.AtomicLimit = 1 << 20
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), `"Next One"`) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+
+		etag := ""
+		for i, wantCode := range []int{200, 304} {
+
+			rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			w := httptest.NewRecorder()
+			rw := NewRowsWriter(w, rows)
+			rw.ETag = true
+			rw.IfNoneMatch = etag
+			err = rw.WriteResponse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			etag = w.Header().Get("ETag")
+			if w.Code != wantCode || etag == "" || (i == 1 && w.Body.Len() != 0) {
+				t.Errorf("unexpected response %d %q: %s", w.Code, etag, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("Compress", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		w := httptest.NewRecorder()
+		rw := NewRowsWriter(w, rows)
+		rw.Compress = true
+		rw.AcceptEncoding = "br;q=1.0, gzip;q=0.8"
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("unexpected headers: %v", w.Header())
+		}
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != `[
+{"widget_id":"abc123","name":"First One"}
+,{"widget_id":"def456","name":"Next One"}
+]
+` {
+			t.Errorf("unexpected output: %s", b)
+		}
+	})
+
+	t.Run("SelectFields", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name AS `details.name` FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		if err := rw.SelectFields("details.name,nope", true); err == nil {
+			t.Errorf("expected error for unknown field")
+		}
+		err = rw.SelectFields("details.name,nope", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"details":{"name":"First One"}}
+,{"details":{"name":"Next One"}}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("RowTransform", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.RowTransform = "{id: widget_id, labels: [name, `\"widget\"`]}"
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"id":"abc123","labels":["First One","widget"]}
+,{"id":"def456","labels":["Next One","widget"]}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+
+		if _, err := compileJMESPath("widgets[?name]"); err == nil {
+			t.Errorf("expected error for unsupported filter")
+		}
+	})
+
+	t.Run("MaskRules", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name AS api_token FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.MaskRules = []MaskRule{{Pattern: "WIDGET_ID", Strategy: MaskPartial}, {Pattern: "*_token"}}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"***c123","api_token":"***"}
+,{"widget_id":"***f456","api_token":"***"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("MaskHMAC", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id FROM widgets ORDER BY widget_id LIMIT 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.MaskRules = []MaskRule{{Pattern: "widget_id", Strategy: MaskHMAC, Key: []byte("k")}}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac := hmac.New(sha256.New, []byte("k"))
+		mac.Write([]byte("abc123"))
+		if exp := "[\n{\"widget_id\":\"" + hex.EncodeToString(mac.Sum(nil)) + "\"}\n]\n"; buf.String() != exp {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("ColumnRenames", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ColumnRenames = map[string]string{"widget_id": "widgetId"}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widgetId":"abc123","name":"First One"}
+,{"widgetId":"def456","name":"Next One"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("StripPrefixes", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id AS w_id, name AS w_ FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.StripPrefixes = []string{"x_", "w_"}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"id":"abc123","w_":"First One"}
+,{"id":"def456","w_":"Next One"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("ColumnOrder", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ColumnOrder = []string{"name", "missing"}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"name":"First One","widget_id":"abc123"}
+,{"name":"Next One","widget_id":"def456"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("StrictTypes", func(t *testing.T) {
+
+		// the driver scans a NULL typed column into an interface{}, which has no built-in handling
+		query := "SELECT widget_id, NULL AS nothing FROM widgets ORDER BY widget_id LIMIT 1"
+		for _, strict := range []bool{false, true} {
+			rows, err := db.Query(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			rw := NewRowsWriter(&buf, rows)
+			rw.StrictTypes = strict
+			err = rw.WriteResponse()
+			rows.Close()
+			if strict {
+				if err == nil {
+					t.Errorf("expected error with StrictTypes")
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != "[\n{\"widget_id\":\"abc123\",\"nothing\":null}\n]\n" {
+				t.Errorf("unexpected output: %s", buf.String())
+			}
+		}
+	})
+
+	t.Run("MarshalerValuer", func(t *testing.T) {
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, nil)
+		rw.StrictTypes = true
+		for _, v := range []interface{}{testDecimal("1.50"), testUUID{0xab, 0xcd}, (*testDecimal)(nil)} {
+			err := rw.writeValue(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw.rowOutBuf.WriteByte(' ')
+		}
+		if rw.rowOutBuf.String() != `"1.50" "abcd" null ` {
+			t.Errorf("unexpected output: %s", rw.rowOutBuf.String())
+		}
+	})
+
+	t.Run("ScanArgFunc", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, 42 AS answer FROM widgets ORDER BY widget_id LIMIT 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ScanArgFunc = func(ct ColumnType) interface{} {
+			if ct.Name() == "answer" {
+				return new(sql.NullString)
+			}
+			return nil
+		}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "[\n{\"widget_id\":\"abc123\",\"answer\":\"42\"}\n]\n" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("BooleanColumns", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, widget_id = 'abc123' AS is_first FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.BooleanColumns = []string{"is_first"}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"abc123","is_first":true}
+,{"widget_id":"def456","is_first":false}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("ValueMaps", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, 'red,blue' AS colors FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ValueMaps = map[string]ValueMap{
+			"widget_id": {Labels: map[string]string{"abc123": "first"}},
+			"colors":    {Set: true},
+		}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"first","colors":["red","blue"]}
+,{"widget_id":"def456","colors":["red","blue"]}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("UUIDColumns", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, UNHEX('6ba7b8109dad11d180b400c04fd430c8') AS id FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.UUIDColumns = []string{"id"}
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"abc123","id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}
+,{"widget_id":"def456","id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("GeoJSON", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, ST_GeomFromText('POINT(1.5 2)') AS location, ST_GeomFromText('LINESTRING(0 0,10 10)') AS route FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.GeoJSON = true
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"abc123","location":{"type":"Point","coordinates":[1.5,2]},"route":{"type":"LineString","coordinates":[[0,0],[10,10]]}}
+,{"widget_id":"def456","location":{"type":"Point","coordinates":[1.5,2]},"route":{"type":"LineString","coordinates":[[0,0],[10,10]]}}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("UTF8Policy", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, UNHEX('636166E9') AS name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.UTF8Policy = UTF8Base64
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"abc123","name":"Y2Fm6Q=="}
+,{"widget_id":"def456","name":"Y2Fm6Q=="}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("ControlCharPolicy", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, CONCAT(name, UNHEX('00'), '!') AS name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ControlCharPolicy = ControlCharStrip
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"abc123","name":"First One!"}
+,{"widget_id":"def456","name":"Next One!"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("TruncateStrings", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.TruncateStrings = map[string]int{"name": 5}
+		rw.TruncateMarker = "..."
+		rw.TruncatedFields = true
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"widget_id":"abc123","name":"First...","name_truncated":true}
+,{"widget_id":"def456","name":"Next ...","name_truncated":true}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("ValidateOutput", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.ValidateOutput = true
+		rw.JSONValueFunc = func(w io.Writer, colName string, colIndex int, value interface{}) (bool, bool, error) {
+			if colName != "name" {
+				return false, false, nil
+			}
+			_, err := io.WriteString(w, `{"broken"`)
+			return true, false, err
+		}
+		err = rw.WriteResponse()
+		oerr, ok := err.(*InvalidOutputError)
+		if !ok {
+			t.Fatalf("expected *InvalidOutputError, got %v", err)
+		}
+		if oerr.Row != 1 || oerr.Column != "name" {
+			t.Errorf("unexpected error: %v", oerr)
+		}
+	})
+
+	t.Run("EscapedKeys", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id AS `we\"ird\\id`, name AS `näme` FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		err = NewRowsWriter(&buf, rows).WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != `[
+{"we\"ird\\id":"abc123","näme":"First One"}
+,{"we\"ird\\id":"def456","näme":"Next One"}
+]
+` {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("SpillThreshold", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, REPEAT(CONCAT(name, '\"'), 10000) AS description FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.SpillThreshold = 1000
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[
+{"widget_id":"abc123","description":"` + strings.Repeat(`First One\"`, 10000) + `"}
+,{"widget_id":"def456","description":"` + strings.Repeat(`Next One\"`, 10000) + `"}
+]
+`
+		if buf.String() != want {
+			t.Errorf("unexpected output: %.200s", buf.String())
+		}
+	})
+
+	t.Run("EncodeWorkers", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.EncodeWorkers = 4
+		rw.RowIndexField = "_row"
+		err = rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[
+{"widget_id":"abc123","name":"First One","_row":0}
+,{"widget_id":"def456","name":"Next One","_row":1}
+]
+`
+		if buf.String() != want {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("BatchRows", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.BatchRows = 10
+		err = rw.WriteNDJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"widget_id":"abc123","name":"First One"}
+{"widget_id":"def456","name":"Next One"}
+`
+		if buf.String() != want {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("TeeWriters", func(t *testing.T) {
+
+		rows, err := db.Query("SELECT widget_id, name FROM widgets ORDER BY widget_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var buf, audit bytes.Buffer
+		rw := NewRowsWriter(nil, rows)
+		rw.TeeWriters = []io.Writer{&audit}
+		n, err := rw.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[
+{"widget_id":"abc123","name":"First One"}
+,{"widget_id":"def456","name":"Next One"}
+]
+`
+		if buf.String() != want || audit.String() != want || n != int64(len(want)) {
+			t.Errorf("unexpected output (%d bytes): %s, copy: %s", n, buf.String(), audit.String())
+		}
+	})
+}
+
+func TestWriteGenericNull(t *testing.T) {
+
+	rw := NewRowsWriter(nil, nil)
+	rw.StrictTypes = true
+	for _, v := range []interface{}{
+		&sql.Null[int64]{V: 1, Valid: true},
+		&sql.Null[string]{V: "a", Valid: true},
+		&sql.Null[time.Time]{V: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Valid: true},
+		&sql.Null[float32]{},
+	} {
+		err := rw.writeValue(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw.rowOutBuf.WriteByte(' ')
+	}
+	if rw.rowOutBuf.String() != `1 "a" "2024-01-02T00:00:00Z" null ` {
+		t.Errorf("unexpected output: %s", rw.rowOutBuf.String())
+	}
+}
+
+func TestInt64AsStringRange(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"n", "BIGINT", reflect.TypeOf(int64(0))},
+			{"u", "BIGINT UNSIGNED", reflect.TypeOf(uint64(0))},
+		},
+		rows: [][]interface{}{
+			{int64(1<<53 - 1), uint64(1<<53 - 1)},
+			{int64(-(1<<53 - 1)), uint64(0)},
+			{int64(1 << 53), uint64(1 << 53)},
+			{int64(-(1 << 53)), uint64(1<<53 + 1)},
+		},
+	}
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.Int64AsString = true
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2^53 is a string, since 2^53+1 would be read as the same number
+	want := `[
+{"n":9007199254740991,"u":9007199254740991}
+,{"n":-9007199254740991,"u":0}
+,{"n":"9007199254740992","u":"9007199254740992"}
+,{"n":"-9007199254740992","u":"9007199254740993"}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestNestSeparator(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "INT", reflect.TypeOf(int64(0))},
+			{"address__city", "VARCHAR", reflect.TypeOf("")},
+			{"name", "VARCHAR", reflect.TypeOf("")},
+			{"address__geo__lat", "DOUBLE", reflect.TypeOf(float64(0))},
+		},
+		rows: [][]interface{}{{int64(1), "Oslo", "a", 59.9}},
+	}
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.NestSeparator = "__"
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[\n{\"id\":1,\"address\":{\"city\":\"Oslo\",\"geo\":{\"lat\":59.9}},\"name\":\"a\"}\n]\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// a column that is also the prefix of another would write the key twice
+	for _, names := range [][2]string{{"address", "address__city"}, {"address__city", "address"}} {
+		rows := &memRows{
+			cols: []memColumn{
+				{names[0], "VARCHAR", reflect.TypeOf("")},
+				{names[1], "VARCHAR", reflect.TypeOf("")},
+			},
+			rows: [][]interface{}{{"a", "b"}},
+		}
+		rw := NewRowsWriter(io.Discard, rows)
+		rw.NestSeparator = "__"
+		err := rw.WriteResponse()
+		if err == nil || !strings.Contains(err.Error(), "conflicts with") {
+			t.Errorf("%v: expected a conflict error, got %v", names, err)
+		}
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+
+	for _, escapeHTML := range []bool{false, true} {
+		rows := &memRows{
+			cols: []memColumn{
+				{"a", "VARCHAR", reflect.TypeOf("")},
+				{"b", "VARCHAR", reflect.TypeOf(sql.NullString{})},
+			},
+			rows: [][]interface{}{{"<a>&", "<é>"}},
+		}
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.EscapeHTML = escapeHTML
+		err := rw.WriteResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the plain ASCII value and the one escaped by json.Encoder are written the same way
+		want := "[\n{\"a\":\"<a>&\",\"b\":\"<é>\"}\n]\n"
+		if escapeHTML {
+			want = "[\n{\"a\":\"\\u003ca\\u003e\\u0026\",\"b\":\"\\u003cé\\u003e\"}\n]\n"
+		}
+		if buf.String() != want {
+			t.Errorf("EscapeHTML=%v: unexpected output: %s", escapeHTML, buf.String())
+		}
+	}
+}
+
+func TestWriteFloatPolicy(t *testing.T) {
+
+	for _, tc := range []struct {
+		policy FloatPolicy
+		out    string
+	}{
+		{FloatSpecialNull, `1.5 null null `},
+		{FloatSpecialString, `1.5 "NaN" "-Inf" `},
+	} {
+		rw := NewRowsWriter(nil, nil)
+		rw.FloatPolicy = tc.policy
+		for _, f := range []float64{1.5, math.NaN(), math.Inf(-1)} {
+			err := rw.writeValue(&f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw.rowOutBuf.WriteByte(' ')
+		}
+		if rw.rowOutBuf.String() != tc.out {
+			t.Errorf("unexpected output: %s", rw.rowOutBuf.String())
+		}
+	}
+
+	rw := NewRowsWriter(nil, nil)
+	rw.FloatPolicy = FloatSpecialError
+	f := math.Inf(1)
+	if err := rw.writeValue(&f); err == nil {
+		t.Errorf("expected error for infinity")
+	}
+}
+
+func TestWriteNetValue(t *testing.T) {
+
+	_, ipNet, _ := net.ParseCIDR("10.1.0.0/16")
+	mac, _ := net.ParseMAC("08:00:2B:01:02:03")
+
+	rw := NewRowsWriter(nil, nil)
+	rw.StrictTypes = true
+	for _, v := range []interface{}{
+		net.ParseIP("192.168.0.1"),
+		ipNet,
+		&mac,
+		netip.MustParseAddr("fe80::1"),
+		net.IP(nil),
+	} {
+		err := rw.writeValue(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw.rowOutBuf.WriteByte(' ')
+	}
+	if rw.rowOutBuf.String() != `"192.168.0.1" "10.1.0.0/16" "08:00:2b:01:02:03" "fe80::1" null ` {
+		t.Errorf("unexpected output: %s", rw.rowOutBuf.String())
+	}
+}
+
+func TestWriteHstoreValue(t *testing.T) {
+
+	rw := NewRowsWriter(nil, nil)
+	err := rw.writeHstoreValue(`"a"=>"1", "b"=>NULL, "c d"=>"x\"y", k=>v`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rw.rowOutBuf.String() != `{"a":"1","b":null,"c d":"x\"y","k":"v"}` {
+		t.Errorf("unexpected output: %s", rw.rowOutBuf.String())
+	}
+
+	if err := rw.writeHstoreValue(`"a"=>`); err == nil {
+		t.Errorf("expected error for invalid hstore")
+	}
+}
+
+func TestRowsWriterRelease(t *testing.T) {
+
+	rw := GetRowsWriter(io.Discard, nil)
+	rw.EscapeHTML = true
+	rw.colNames = append(rw.colNames, "widget_id")
+	rw.rowOutBuf.WriteString(`{"widget_id":"abc123"}`)
+	rw.Release()
+
+	if rw.Writer != nil || rw.EscapeHTML || len(rw.colNames) != 0 || rw.rowOutBuf.Len() != 0 {
+		t.Errorf("Release did not clear the RowsWriter: %+v", rw)
+	}
+	if cap(rw.colNames) == 0 || rw.rowOutBuf.Cap() == 0 {
+		t.Errorf("Release did not keep the buffers")
+	}
+}
+
+func TestRowsWriterMaxRetainedBuffer(t *testing.T) {
+
+	rw := NewRowsWriter(io.Discard, nil)
+	WithBufferSizes(256, 4096)(rw)
+	rw.valOutBuf.Grow(8192)
+	rw.rowOutBuf.WriteString(`{"widget_id":"` + strings.Repeat("a", 8192) + `"}`)
+	err := rw.writeOut(&rw.rowOutBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rw.rowOutBuf.Cap() > 4096 || rw.valOutBuf.Cap() > 4096 {
+		t.Errorf("buffers were retained: %d, %d", rw.rowOutBuf.Cap(), rw.valOutBuf.Cap())
+	}
+	if rw.rowOutBuf.Cap() < 256 {
+		t.Errorf("row buffer was not regrown to RowBufferSize: %d", rw.rowOutBuf.Cap())
+	}
+}
+
+func TestRowsWriterMaxRetainedBufferReset(t *testing.T) {
+
+	rw := NewRowsWriterOpts(io.Discard, nil, WithBufferSizes(256, 4096))
+	rw.rowOutBuf.Grow(8192)
+	rw.customBuf.Grow(8192)
+	rw.valOutBytes = make([]byte, 0, 8192)
+	rw.Reset(nil)
+
+	if rw.rowOutBuf.Cap() > 4096 || rw.customBuf.Cap() > 4096 || cap(rw.valOutBytes) > 4096 {
+		t.Errorf("buffers were retained after Reset: %d, %d, %d", rw.rowOutBuf.Cap(), rw.customBuf.Cap(), cap(rw.valOutBytes))
+	}
+
+	// without MaxRetainedBuffer the memory is reused
+	rw = NewRowsWriter(io.Discard, nil)
+	rw.rowOutBuf.Grow(8192)
+	rw.Reset(nil)
+	if rw.rowOutBuf.Cap() < 8192 {
+		t.Errorf("row buffer was dropped by Reset: %d", rw.rowOutBuf.Cap())
+	}
+}
+
+func TestNewRowsWriterOpts(t *testing.T) {
+
+	rw := NewRowsWriterOpts(io.Discard, nil, WithMaxRows(10), WithNullPolicy(NullOmit), WithIncludeColumns("widget_id"),
+		func(rw *RowsWriter) { rw.EscapeHTML = true })
+
+	if rw.Writer != io.Discard || rw.MaxRows != 10 || rw.NullPolicy != NullOmit ||
+		len(rw.IncludeColumns) != 1 || !rw.EscapeHTML {
+		t.Errorf("options not applied: %+v", rw)
+	}
+}
+
+func TestRawJSONColumnsAndColumnNameFunc(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"widget_id", "VARCHAR", reflect.TypeOf("")},
+			{"widget_attrs", "JSON", reflect.TypeOf([]byte(nil))},
+		},
+		rows: [][]interface{}{{"abc123", []byte(`{"color":"red","sizes":[1,2]}`)}, {"def456", nil}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriterOpts(&buf, rows, WithRawJSONColumns("widget_attrs"), WithColumnNameFunc(strings.ToUpper))
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+{"WIDGET_ID":"abc123","WIDGET_ATTRS":{"color":"red","sizes":[1,2]}}
+,{"WIDGET_ID":"def456","WIDGET_ATTRS":null}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestRawJSONTrailingNewline(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"attrs", "JSON", reflect.TypeOf([]byte(nil))},
+			{"tags", "TEXT", reflect.TypeOf("")},
+		},
+		rows: [][]interface{}{{[]byte("{\"color\":\"red\"}\n"), "a,b"}, {[]byte("[1]\r\n"), "c"}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriterOpts(&buf, rows, WithRawJSONColumns("attrs"),
+		WithColumnFormatter("tags", func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+			return true, false, json.NewEncoder(w).Encode(strings.Split(*value.(*string), ","))
+		}))
+	err := rw.WriteNDJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"attrs":{"color":"red"},"tags":["a","b"]}
+{"attrs":[1],"tags":["c"]}
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestTruncatedFieldsCustomValue(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"name", "TEXT", reflect.TypeOf("")},
+			{"api_token", "TEXT", reflect.TypeOf("")},
+			{"label", "TEXT", reflect.TypeOf("")},
+		},
+		rows: [][]interface{}{{"First One", "abcdefgh", "Big"}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.MaxStringLength = 5
+	rw.TruncatedFields = true
+	rw.MaskRules = []MaskRule{{Pattern: "*_token"}}
+	rw.SetColumnFormatter("label", func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+		_, err = io.WriteString(w, `"custom"`)
+		return true, false, err
+	})
+	err := rw.WriteNDJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only name was truncated, the masked and formatted columns after it are not marked
+	want := `{"name":"First","name_truncated":true,"api_token":"***","label":"custom"}
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestSpillThresholdRowError(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"description", "TEXT", reflect.TypeOf("")},
+			{"name", "TEXT", reflect.TypeOf("")},
+		},
+		rows: [][]interface{}{
+			{strings.Repeat("a\"", 50000), "First One"},
+			{strings.Repeat("b", 50000), "Next One"},
+		},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.SpillThreshold = 1000
+	rw.SetColumnFormatter("name", func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+		if *value.(*string) == "Next One" {
+			return false, false, fmt.Errorf("bad name")
+		}
+		return false, false, nil
+	})
+	err := rw.WriteResponse()
+	if err == nil || err.Error() != "bad name" {
+		t.Fatalf("expected the formatter error, got %v", err)
+	}
+
+	// the first row is written whole and nothing of the second, which failed after its spilled value
+	want := "[\n{\"description\":\"" + strings.Repeat(`a\"`, 50000) + "\",\"name\":\"First One\"}\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output: %.200s...%s", buf.String(), buf.String()[max(0, buf.Len()-50):])
+	}
+}
+
+func TestEncodeWorkersOrder(t *testing.T) {
+
+	newRows := func() *memRows {
+		rows := &memRows{cols: []memColumn{
+			{"id", "BIGINT", reflect.TypeOf(int64(0))},
+			{"name", "VARCHAR", reflect.TypeOf("")},
+		}}
+		for i := 0; i < 1000; i++ {
+			rows.rows = append(rows.rows, []interface{}{int64(i), fmt.Sprintf("row %d", i)})
+		}
+		return rows
+	}
+	write := func(workers int, f ValueFormatter) (string, error) {
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, newRows())
+		rw.EncodeWorkers = workers
+		rw.RowIndexField = "_row"
+		if f != nil {
+			rw.SetColumnFormatter("name", f)
+		}
+		err := rw.WriteResponse()
+		return buf.String(), err
+	}
+
+	want, err := write(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 3, 8} {
+		got, err := write(workers, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("output with %d workers differs from sequential output", workers)
+		}
+	}
+
+	// errors at rows 500 and 700: the first in row order is returned every time, with the
+	// rows before it written
+	f := func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+		switch v := *value.(*string); v {
+		case "row 500", "row 700":
+			return false, false, fmt.Errorf("bad %s", v)
+		}
+		return false, false, nil
+	}
+	wantPrefix := want[:strings.Index(want, `,{"id":500,`)]
+	for run := 0; run < 20; run++ {
+		got, err := write(4, f)
+		if err == nil || err.Error() != "bad row 500" {
+			t.Fatalf("run %d: expected the error at row 500, got %v", run, err)
+		}
+		if got != wantPrefix {
+			t.Fatalf("run %d: unexpected output ending %q", run, got[max(0, len(got)-60):])
+		}
+	}
+}
+
+func TestMySQLBooleans(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"is_active", "TINYINT", reflect.TypeOf(int64(0))},
+			{"flag", "BIT", reflect.TypeOf([]byte(nil))},
+		},
+		rows: [][]interface{}{
+			{int64(1), []byte{1}},
+			{int64(0), []byte{0}},
+			{int64(2), []byte{2}},
+			{int64(-1), []byte{1, 0}},
+		},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.MySQLBooleans = true
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only 0 and 1 are booleans, other values are written as numbers
+	want := `[
+{"is_active":true,"flag":true}
+,{"is_active":false,"flag":false}
+,{"is_active":2,"flag":2}
+,{"is_active":-1,"flag":256}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// BIT columns with a known length other than 1 are left alone
+	for _, c := range []struct {
+		ct   ColumnType
+		want bool
+	}{
+		{lengthColumn{memColumn{"flag", "BIT", nil}, 1}, true},
+		{lengthColumn{memColumn{"flags", "BIT", nil}, 8}, false},
+		{memColumn{"flag", "BIT", nil}, true},
+		{memColumn{"n", "INT", nil}, false},
+	} {
+		if got := rw.isBoolColumn(c.ct.Name(), c.ct); got != c.want {
+			t.Errorf("isBoolColumn(%s) = %v, want %v", c.ct.Name(), got, c.want)
+		}
+	}
+}
+
+// lengthColumn is a memColumn with a Length.
+type lengthColumn struct {
+	memColumn
+	length int64
+}
+
+func (ct lengthColumn) Length() (length int64, ok bool) { return ct.length, true }
+
+func TestSharedConfig(t *testing.T) {
+
+	f := func(w io.Writer, colName string, colIndex int, value interface{}) (ok, skip bool, err error) {
+		return false, false, nil
+	}
+	cfg := Config{MaxRows: 10}
+	cfg.SetColumnFormatter("widget_id", f)
+
+	rw := NewRowsWriterOpts(io.Discard, nil, WithConfig(&cfg))
+	rw.MaxRows = 20
+	rw.SetColumnFormatter("name", f)
+
+	if cfg.MaxRows != 10 || len(cfg.columnFormatters) != 1 || len(rw.columnFormatters) != 2 {
+		t.Errorf("shared Config was modified: %+v", cfg)
+	}
+}
+
+func TestWriteRowsLike(t *testing.T) {
+
+	rows := &testRows{
+		cols: []string{"widget_id", "name", "price"},
+		rows: [][]interface{}{{"abc123", "First One", 1.5}, {"def456", nil, int64(2)}},
+	}
+
+	var buf bytes.Buffer
+	err := NewRowsWriter(&buf, rows).WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+{"widget_id":"abc123","name":"First One","price":1.5}
+,{"widget_id":"def456","name":null,"price":2}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestScanArgFuncRowsLike(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{{"widget_id", "TEXT", reflect.TypeOf("")}, {"answer", "INT", reflect.TypeOf(int64(0))}},
+		rows: [][]interface{}{{"abc123", int64(42)}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.ScanArgFunc = func(ct ColumnType) interface{} {
+		if ct.DatabaseTypeName() == "INT" {
+			return new(sql.NullString)
+		}
+		return nil
+	}
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[\n{\"widget_id\":\"abc123\",\"answer\":\"42\"}\n]\n" {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+// testRows is an in-memory RowsLike with columns of unknown type.
+type testRows struct {
+	cols []string
+	rows [][]interface{}
+	next int
+}
+
+func (r *testRows) Columns() ([]string, error)              { return r.cols, nil }
+func (r *testRows) ColumnTypes() ([]*sql.ColumnType, error) { return nil, nil }
+func (r *testRows) Next() bool                              { r.next++; return r.next <= len(r.rows) }
+func (r *testRows) Err() error                              { return nil }
+func (r *testRows) NextResultSet() bool                     { return false }
+func (r *testRows) Close() error                            { return nil }
+
+func (r *testRows) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.next-1] {
+		*dest[i].(*interface{}) = v
+	}
+	return nil
+}
+
+func (r *testRows) ColumnTypeInfo() ([]ColumnType, error) {
+	cts := make([]ColumnType, len(r.cols))
+	for i, name := range r.cols {
+		cts[i] = testColumnType(name)
+	}
+	return cts, nil
+}
+
+// testColumnType is a ColumnType of unknown type.
+type testColumnType string
+
+func (ct testColumnType) Name() string                                   { return string(ct) }
+func (ct testColumnType) DatabaseTypeName() string                       { return "" }
+func (ct testColumnType) ScanType() reflect.Type                         { return nil }
+func (ct testColumnType) Nullable() (nullable, ok bool)                  { return false, false }
+func (ct testColumnType) Length() (length int64, ok bool)                { return 0, false }
+func (ct testColumnType) DecimalSize() (precision, scale int64, ok bool) { return 0, 0, false }
+
+// testDecimal implements json.Marshaler like decimal.Decimal
+type testDecimal string
+
+func (d testDecimal) MarshalJSON() ([]byte, error) { return json.Marshal(string(d)) }
+
+// testUUID implements driver.Valuer like uuid.UUID
+type testUUID [2]byte
+
+func (u testUUID) Value() (driver.Value, error) { return fmt.Sprintf("%x", u[:]), nil }
+
+func TestCheckUnmasked(t *testing.T) {
+
+	defer func(rules []MaskRule) { DefaultMaskRules = rules }(DefaultMaskRules)
+	DefaultMaskRules = []MaskRule{{Pattern: "*_TOKEN"}}
+
+	if err := CheckUnmasked("id", "name"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckUnmasked("id", "api_token"); err == nil || !strings.Contains(err.Error(), `"api_token"`) {
+		t.Errorf("expected a masked column error, got %v", err)
+	}
+}
+
+func TestNullPolicy(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "INT", reflect.TypeOf(int64(0))},
+			{"name", "TEXT", reflect.TypeOf(sql.NullString{})},
+			{"count", "INT", reflect.TypeOf(sql.NullInt64{})},
+			{"ok", "BOOL", reflect.TypeOf(sql.NullBool{})},
+			{"tags", "JSON", reflect.TypeOf(sql.NullString{})},
+		},
+		rows: [][]interface{}{
+			{int64(1), nil, nil, nil, nil},
+			{int64(2), "x", int64(3), true, "[1]"},
+		},
+	}
+
+	for _, tc := range []struct {
+		policy NullPolicy
+		want   string
+	}{
+		{NullWrite, `{"id":1,"name":null,"count":null,"ok":null,"tags":null}
+{"id":2,"name":"x","count":3,"ok":true,"tags":"[1]"}
+`},
+		{NullOmit, `{"id":1}
+{"id":2,"name":"x","count":3,"ok":true,"tags":"[1]"}
+`},
+		{NullDefault, `{"id":1,"name":"","count":0,"ok":false,"tags":[]}
+{"id":2,"name":"x","count":3,"ok":true,"tags":"[1]"}
+`},
+	} {
+		rows.next = 0
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.NullPolicy = tc.policy
+		rw.NullDefaults = map[string]json.RawMessage{"tags": json.RawMessage(`[]`)}
+		err := rw.WriteNDJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("policy %d: unexpected output: %s", tc.policy, buf.String())
+		}
+	}
+}
+
+func TestIndent(t *testing.T) {
+
+	newRows := func() *memRows {
+		return &memRows{
+			cols: []memColumn{
+				{"widget_id", "TEXT", reflect.TypeOf("")},
+				{"sizes", "JSON", reflect.TypeOf("")},
+			},
+			rows: [][]interface{}{{"abc123", `[1,{"a":2}]`}, {"def456", `[]`}},
+		}
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, newRows())
+	rw.Indent = "  "
+	rw.RawJSONColumns = []string{"sizes"}
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "widget_id": "abc123",
+    "sizes": [
+      1,
+      {
+        "a": 2
+      }
+    ]
+  },
+  {
+    "widget_id": "def456",
+    "sizes": []
+  }
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// the output is the same JSON as without Indent
+	var plain bytes.Buffer
+	rw = NewRowsWriter(&plain, newRows())
+	rw.RawJSONColumns = []string{"sizes"}
+	err = rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	err = json.Compact(&compact, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compactPlain bytes.Buffer
+	json.Compact(&compactPlain, plain.Bytes())
+	if compact.String() != compactPlain.String() {
+		t.Errorf("indented output %s is not the same JSON as %s", compact.String(), compactPlain.String())
+	}
+
+	// with WriteCommaRow rows are indented one level
+	buf.Reset()
+	rw = NewRowsWriter(&buf, newRows())
+	rw.Indent = "\t"
+	for rw.Rows.Next() {
+		err = rw.WriteCommaRow()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want = "\t{\n\t\t\"widget_id\": \"abc123\",\n\t\t\"sizes\": \"[1,{\\\"a\\\":2}]\"\n\t},\n\t{\n\t\t\"widget_id\": \"def456\",\n\t\t\"sizes\": \"[]\"\n\t}"
+	if buf.String() != want {
+		t.Errorf("unexpected WriteCommaRow output: %q", buf.String())
+	}
+}
+
+// memResultSets is a RowsLike with several result sets, see WriteResultSets.
+type memResultSets struct {
+	*memRows
+	sets []*memRows
+}
+
+func (r *memResultSets) NextResultSet() bool {
+	if len(r.sets) == 0 {
+		return false
+	}
+	r.memRows, r.sets = r.sets[0], r.sets[1:]
+	return true
+}
+
+func TestWriteResultSets(t *testing.T) {
+
+	rows := &memResultSets{
+		memRows: &memRows{
+			cols: []memColumn{{"widget_id", "TEXT", reflect.TypeOf("")}, {"name", "TEXT", reflect.TypeOf("")}},
+			rows: [][]interface{}{{"abc123", "First One"}, {"def456", "Next One"}},
+		},
+		sets: []*memRows{{
+			cols: []memColumn{{"total", "INT", reflect.TypeOf(int64(0))}},
+			rows: [][]interface{}{{int64(2)}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	err := rw.WriteResultSets("widgets", "totals", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each set has its own columns, and names with no result set get an empty array
+	want := `{"widgets":[
+{"widget_id":"abc123","name":"First One"}
+,{"widget_id":"def456","name":"Next One"}
+],"totals":[
+{"total":2}
+],"missing":[
+]}
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestJSONSeqMaxBytes(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+		rows: [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}},
+	}
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.MaxBytes = 25 // each record is 10 bytes
+	err := rw.WriteJSONSeq()
+	if err != ErrMaxBytes {
+		t.Errorf("expected ErrMaxBytes, got %v", err)
+	}
+
+	// no record separator without its record
+	want := "\x1e{\"id\":1}\n\x1e{\"id\":2}\n"
+	if buf.String() != want || rw.BytesWritten() != int64(len(want)) {
+		t.Errorf("unexpected output (%d bytes): %q", rw.BytesWritten(), buf.String())
+	}
+}
+
+func TestIncludeColumnsDuplicates(t *testing.T) {
+
+	rows := &memRows{
+		cols: []memColumn{
+			{"id", "INT", reflect.TypeOf(int64(0))},
+			{"name", "VARCHAR", reflect.TypeOf("")},
+			{"id", "INT", reflect.TypeOf(int64(0))},
+		},
+		rows: [][]interface{}{{int64(1), "a", int64(2)}},
+	}
+	var buf bytes.Buffer
+	rw := NewRowsWriter(&buf, rows)
+	rw.IncludeColumns = []string{"name"}
+	rw.DuplicateColumns = DuplicateError // the id columns are not output, so they are not duplicates
+	err := rw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[\n{\"name\":\"a\"}\n]\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestETagVersionStreams(t *testing.T) {
+
+	newRows := func() RowsLike {
+		return &failingRows{
+			memRows: &memRows{
+				cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}},
+				rows: [][]interface{}{{int64(1)}},
+			},
+			err: errors.New("connection lost"),
+		}
+	}
+
+	// the output is not buffered, so the row is written before the error
+	w := httptest.NewRecorder()
+	rw := NewRowsWriter(w, newRows())
+	rw.ETag = true
+	rw.ETagVersion = "v1"
+	err := rw.WriteResponse()
+	etag := w.Header().Get("ETag")
+	if err == nil || etag == "" || !strings.Contains(w.Body.String(), `{"id":1}`) {
+		t.Errorf("unexpected response %v %q: %s", err, etag, w.Body.String())
+	}
+
+	// and the version is checked before reading any rows
+	w = httptest.NewRecorder()
+	rw = NewRowsWriter(w, newRows())
+	rw.ETag = true
+	rw.ETagVersion = "v1"
+	rw.IfNoneMatch = etag
+	err = rw.WriteResponse()
+	if err != nil || w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("unexpected response %v %d: %s", err, w.Code, w.Body.String())
+	}
+}
+
+func TestNewScanArgNullable(t *testing.T) {
+
+	int64Type, nullInt64Type := reflect.TypeOf(int64(0)), reflect.TypeOf(sql.NullInt64{})
+	cts := testColumnTypes(t, []testDriverColumn{
+		{name: "null_nullable", dbType: "BIGINT", scanType: nullInt64Type, nullable: true},
+		{name: "null_not_null", dbType: "BIGINT", scanType: nullInt64Type},
+		{name: "null_unknown", dbType: "BIGINT", scanType: nullInt64Type, noNullable: true},
+		{name: "plain_nullable", dbType: "BIGINT", scanType: int64Type, nullable: true},
+		{name: "plain_not_null", dbType: "BIGINT", scanType: int64Type},
+		{name: "plain_unknown", dbType: "BIGINT", scanType: int64Type, noNullable: true},
+	})
+	want := []interface{}{
+		new(sql.NullInt64), // a nullable column keeps its Null scan type
+		new(int64),
+		new(sql.NullInt64),
+		new(sql.Null[int64]),
+		new(int64),
+		new(int64),
+	}
+	for i, ct := range cts {
+		if got := newScanArg(ct); reflect.TypeOf(got) != reflect.TypeOf(want[i]) {
+			t.Errorf("%s: got %T, want %T", ct.Name(), got, want[i])
+		}
+	}
+
+	// and NULLs scan into it
+	db := testDB(t, &testDriverResult{
+		cols: []testDriverColumn{{name: "n", dbType: "BIGINT", scanType: nullInt64Type, nullable: true}},
+		rows: [][]driver.Value{{nil}, {int64(5)}},
+	})
+	rows, err := db.Query("SELECT n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var buf bytes.Buffer
+	err = NewRowsWriter(&buf, rows).WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[\n{\"n\":null}\n,{\"n\":5}\n]\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestRenameDuplicates(t *testing.T) {
+
+	for _, tc := range []struct {
+		policy  DuplicatePolicy
+		renames map[string]string
+		want    string
+	}{
+		{DuplicateAllow, nil, `{"name":"a","name":"b","id":1}`},
+		{DuplicateSuffix, nil, `{"name":"a","name_2":"b","id":1}`},
+		{DuplicateLastWins, nil, `{"name":"b","id":1}`},
+		{DuplicateError, nil, `duplicate JSON key "name" for column "w_name"`},
+		{DuplicateSuffix, map[string]string{"id": "name"}, `{"name":"a","name_2":"b","name_3":1}`},
+	} {
+		rows := &memRows{
+			cols: []memColumn{
+				{"w_name", "VARCHAR", reflect.TypeOf("")},
+				{"o_name", "VARCHAR", reflect.TypeOf("")},
+				{"id", "INT", reflect.TypeOf(int64(0))},
+			},
+			rows: [][]interface{}{{"a", "b", int64(1)}},
+		}
+		var buf bytes.Buffer
+		rw := NewRowsWriter(&buf, rows)
+		rw.DuplicateColumns = tc.policy
+		rw.ColumnRenames = tc.renames
+		rw.StripPrefixes = []string{"w_", "o_"}
+		err := rw.WriteResponse()
+		got := strings.TrimSpace(strings.Trim(strings.TrimSpace(buf.String()), "[]"))
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("policy %d, renames %v: got %s, want %s", tc.policy, tc.renames, got, tc.want)
+		}
+	}
 }
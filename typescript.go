@@ -0,0 +1,98 @@
+package sqljsonutil
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// TypeScriptInterface returns a TypeScript interface declaration named name for the row objects
+// written for the current result set of Rows, so frontend types can be generated from what is
+// actually written.  The options that change the keys and types are taken into account:
+// DuplicateColumns, NestSeparator, GroupBy and Children, RowIndexField, NullPolicy and the
+// integer, binary and decimal options.  Values from JSONValueFunc and formatters cannot be known
+// and are typed from the column, and ExtraFieldsFunc adds an index signature.
+// The column information is read from Rows, no rows are read.
+func (rw *RowsWriter) TypeScriptInterface(name string) (string, error) {
+
+	if len(rw.colNames) == 0 {
+		err := rw.setupColumns()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("export interface " + name + " {\n")
+
+	rw.writeTypeScriptFields(&sb, rw.fieldPlan, "  ")
+
+	if len(rw.GroupBy) > 0 {
+		for ci, c := range rw.Children {
+			sb.WriteString("  " + typeScriptKey(c.Key) + ": {\n")
+			rw.writeTypeScriptFields(&sb, rw.group.childPlans[ci], "    ")
+			sb.WriteString("  }[];\n")
+		}
+	}
+	if rw.RowIndexField != "" {
+		sb.WriteString("  " + typeScriptKey(rw.RowIndexField) + ": number;\n")
+	}
+	if rw.ExtraFieldsFunc != nil {
+		sb.WriteString("  [key: string]: unknown;\n")
+	}
+
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// writeTypeScriptFields writes the TypeScript fields for the columns and nested objects of plan.
+func (rw *RowsWriter) writeTypeScriptFields(sb *strings.Builder, plan []fieldOp, indent string) {
+
+	for _, op := range plan {
+
+		if op.col < 0 {
+			if op.close {
+				indent = indent[2:]
+				sb.WriteString(indent + "};\n")
+				continue
+			}
+			sb.WriteString(indent + typeScriptKey(op.key) + ": {\n")
+			indent += "  "
+			continue
+		}
+
+		p := rw.columnSchema(rw.colTypes[op.col])
+		types, ok := p.Type.([]string)
+		if !ok {
+			types = []string{p.Type.(string)}
+		}
+		for i, t := range types {
+			if t == "integer" {
+				types[i] = "number"
+			}
+		}
+
+		optional := ""
+		if rw.NullPolicy == NullOmit {
+			optional = "?"
+		}
+		sb.WriteString(indent + typeScriptKey(op.key) + optional + ": " + strings.Join(types, " | ") + ";\n")
+		if rw.truncatedField(rw.colTypes[op.col]) {
+			sb.WriteString(indent + typeScriptKey(op.key+"_truncated") + "?: true;\n")
+		}
+	}
+}
+
+// typeScriptKey returns key as-is if it is a valid identifier, otherwise quoted.
+func typeScriptKey(key string) string {
+	for i, c := range key {
+		if c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		b, _ := json.Marshal(key)
+		return string(b)
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
@@ -0,0 +1,27 @@
+package sqljsonutil
+
+import (
+	"testing"
+)
+
+func TestTypeScriptInterface(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	rw := NewRowsWriter(nil, rows)
+	rw.NullPolicy = NullOmit
+	s, err := rw.TypeScriptInterface("Widget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "export interface Widget {\n  widget_id?: string;\n  name?: string;\n}\n" {
+		t.Errorf("unexpected output: %s", s)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build sqljsonutil_safe
+
+package sqljsonutil
+
+// unsafeString returns the bytes of b as a string.  This is the copying version for the
+// sqljsonutil_safe build tag, for deployments that don't allow the unsafe package.
+func unsafeString(b []byte) string {
+	return string(b)
+}
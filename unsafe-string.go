@@ -0,0 +1,13 @@
+//go:build !sqljsonutil_safe
+
+package sqljsonutil
+
+import "unsafe"
+
+// unsafeString gives a string that points to the bytes of b.
+// Only use this temporarily in a controlled area, do not assign
+// this as a value, only use it for comparison.
+// Build with -tags sqljsonutil_safe to copy the bytes instead.
+func unsafeString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
@@ -0,0 +1,20 @@
+package sqljsonutil
+
+import (
+	"go/build"
+	"slices"
+	"testing"
+)
+
+func TestSafeBuildImports(t *testing.T) {
+
+	ctx := build.Default
+	ctx.BuildTags = append(ctx.BuildTags, "sqljsonutil_safe")
+	pkg, err := ctx.ImportDir(".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(pkg.Imports, "unsafe") {
+		t.Errorf("the sqljsonutil_safe build imports unsafe")
+	}
+}
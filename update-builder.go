@@ -0,0 +1,118 @@
+package sqljsonutil
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UpdateBuilder makes parameterized UPDATE statements from partial JSON objects, setting only
+// the columns present in the object, e.g. for a PATCH endpoint:
+//
+//	b := &sqljsonutil.UpdateBuilder{Table: "widgets", Keys: []string{"widget_id"}, Columns: []string{"name"}}
+//	query, args, err := b.Build([]byte(`{"name":"New Name"}`), r.PathValue("widget_id"))
+//	// UPDATE `widgets` SET `name`=? WHERE `widget_id`=?
+//	_, err = db.Exec(query, args...)
+//
+// Values are converted the same as InsertBuilder.
+type UpdateBuilder struct {
+	Table   string   // table name, may be qualified e.g. "myschema.widgets"
+	Dialect Dialect  // placeholder style and identifier quoting, DialectMySQL if not set
+	Keys    []string // columns of the WHERE clause, required
+
+	// Columns, if set, is the whitelist of columns that may be updated and the order they
+	// are written in.  Keys of the object not in Columns or Keys are ignored, or are an error
+	// if Strict is set.  If not set, every key of the object that is not in Keys is used as a
+	// column in sorted order; only do this if the input is trusted.
+	Columns []string
+
+	Strict bool // return an error for object keys that are not in Columns or Keys
+}
+
+// Build returns the UPDATE statement and arguments for the JSON object obj.  The values for
+// Keys are keyArgs if given, one for each key in order (e.g. from the request path), otherwise
+// they are taken from obj.  Keys are never updated.
+func (b *UpdateBuilder) Build(obj []byte, keyArgs ...interface{}) (query string, args []interface{}, err error) {
+
+	if len(b.Keys) == 0 {
+		return "", nil, fmt.Errorf("UpdateBuilder requires Keys")
+	}
+	if len(keyArgs) > 0 && len(keyArgs) != len(b.Keys) {
+		return "", nil, fmt.Errorf("got %d key arguments for %d Keys", len(keyArgs), len(b.Keys))
+	}
+
+	m, err := decodeJSONObject(obj)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cols := b.Columns
+	if len(cols) == 0 {
+		cols = make([]string, 0, len(m))
+		for k := range m {
+			if !containsString(b.Keys, k) {
+				cols = append(cols, k)
+			}
+		}
+		sort.Strings(cols)
+	} else if b.Strict {
+		for k := range m {
+			if !containsString(cols, k) && !containsString(b.Keys, k) {
+				return "", nil, fmt.Errorf("unknown column %q", k)
+			}
+		}
+	}
+
+	d := b.Dialect
+
+	var sb strings.Builder
+	sb.WriteString("UPDATE ")
+	sb.WriteString(d.quoteIdent(b.Table))
+	sb.WriteString(" SET ")
+	for _, col := range cols {
+		v, ok := m[col]
+		if !ok || containsString(b.Keys, col) {
+			continue
+		}
+		arg, err := jsonArgValue(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("column %q: %w", col, err)
+		}
+		if len(args) > 0 {
+			sb.WriteByte(',')
+		}
+		args = append(args, arg)
+		sb.WriteString(d.quoteIdent(col))
+		sb.WriteByte('=')
+		sb.WriteString(d.placeholder(len(args)))
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("no columns to update")
+	}
+
+	sb.WriteString(" WHERE ")
+	for i, key := range b.Keys {
+		var arg interface{}
+		if len(keyArgs) > 0 {
+			arg = keyArgs[i]
+		} else {
+			v, ok := m[key]
+			if !ok {
+				return "", nil, fmt.Errorf("missing key %q", key)
+			}
+			arg, err = jsonArgValue(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("key %q: %w", key, err)
+			}
+		}
+		if i > 0 {
+			sb.WriteString(" AND ")
+		}
+		args = append(args, arg)
+		sb.WriteString(d.quoteIdent(key))
+		sb.WriteByte('=')
+		sb.WriteString(d.placeholder(len(args)))
+	}
+
+	return sb.String(), args, nil
+}
@@ -0,0 +1,39 @@
+package sqljsonutil
+
+import (
+	"testing"
+)
+
+func TestUpdateBuilder(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	b := &UpdateBuilder{Table: "widgets", Keys: []string{"widget_id"}, Columns: []string{"name"}, Strict: true}
+
+	query, args, err := b.Build([]byte(`{"name":"Renamed"}`), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "UPDATE `widgets` SET `name`=? WHERE `widget_id`=?" || len(args) != 2 {
+		t.Errorf("unexpected query: %s %v", query, args)
+	}
+	_, err = db.Exec(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	err = db.QueryRow("SELECT name FROM widgets WHERE widget_id='abc123'").Scan(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Renamed" {
+		t.Errorf("unexpected name: %q", name)
+	}
+
+	_, _, err = b.Build([]byte(`{"name":"Renamed","unknown":1}`), "abc123")
+	if err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+}
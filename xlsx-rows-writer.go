@@ -0,0 +1,337 @@
+package sqljsonutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// XLSXRowsWriter writes a sql.Rows to a stream as an Excel (.xlsx) spreadsheet with a single
+// worksheet and a header row of column names.  Rows are streamed into the worksheet as they are
+// read, nothing is buffered other than the current row.
+//
+// Like CSVRowsWriter, it embeds RowsWriter and uses the same value conversion, then maps the
+// result to a cell type: JSON numbers become numeric cells, booleans become boolean cells,
+// date/time columns become date cells and everything else becomes a text cell.
+//
+// Close must be called after the last row to finish the file (WriteResponse does this).
+type XLSXRowsWriter struct {
+	RowsWriter
+
+	SheetName string // name of the worksheet, "Sheet1" if empty
+	NoHeader  bool   // do not write the header row
+
+	zw       *zip.Writer
+	sheet    io.Writer
+	xbuf     bytes.Buffer
+	closed   bool  // Close was called
+	closeErr error // returned by Close
+}
+
+// NewXLSXRowsWriter is the same as: return &XLSXRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+func NewXLSXRowsWriter(w io.Writer, rows RowsLike) *XLSXRowsWriter {
+	return &XLSXRowsWriter{RowsWriter: RowsWriter{Writer: w, Rows: rows}}
+}
+
+// Reset clears the internal state, the same as RowsWriter.Reset, so the next result set is
+// written as a new file.
+func (xw *XLSXRowsWriter) Reset(rows RowsLike) {
+	xw.RowsWriter.Reset(rows)
+	xw.zw = nil
+	xw.sheet = nil
+	xw.xbuf.Reset()
+	xw.closed = false
+	xw.closeErr = nil
+}
+
+// WriteTo writes the rows to w with WriteResponse instead of to Writer, see RowsWriter.WriteTo.
+func (xw *XLSXRowsWriter) WriteTo(w io.Writer) (int64, error) {
+	return xw.writeTo(w, xw.WriteResponse)
+}
+
+// WriteResponse writes the complete spreadsheet: the header row (unless NoHeader is set),
+// all rows, and then calls Close.
+// If the io.Writer in the Writer field is an http.ResponseWriter, then it will check
+// to see if the Content-Type header is empty and if so will set it to the .xlsx MIME type.
+func (xw *XLSXRowsWriter) WriteResponse() error {
+
+	if ok, err := xw.withOutput(false, xw.WriteResponse); ok {
+		return err
+	}
+
+	if w, ok := xw.Writer.(http.ResponseWriter); ok {
+		if w.Header().Get("Content-Type") == "" { // set content type the first time
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		}
+	}
+
+	if !xw.NoHeader {
+		err := xw.WriteHeader()
+		if err != nil {
+			return err
+		}
+	}
+
+	for xw.nextRow() {
+		err := xw.WriteRow()
+		if err != nil {
+			return err
+		}
+	}
+	if err := xw.rowsErr(); err != nil {
+		return err
+	}
+
+	return xw.Close()
+}
+
+// WriteHeader writes a row of column names.
+func (xw *XLSXRowsWriter) WriteHeader() error {
+
+	err := xw.start()
+	if err != nil {
+		return err
+	}
+
+	xw.xbuf.Reset()
+	xw.xbuf.WriteString("<row>")
+	for _, op := range xw.fieldPlan {
+		if op.col >= 0 {
+			xw.writeStringCell(xw.colKeys[op.col])
+		}
+	}
+	xw.xbuf.WriteString("</row>\n")
+
+	_, err = xw.xbuf.WriteTo(xw.sheet)
+	return err
+}
+
+// WriteRow will call rows.Scan with the appropriate arguments and write the result as a worksheet row.
+func (xw *XLSXRowsWriter) WriteRow() error {
+
+	err := xw.start()
+	if err != nil {
+		return err
+	}
+
+	err = xw.scanRowArgs(false)
+	if err != nil {
+		return err
+	}
+
+	xw.xbuf.Reset()
+	xw.xbuf.WriteString("<row>")
+	for _, op := range xw.fieldPlan {
+		if op.col < 0 {
+			continue
+		}
+
+		custom, skip, err := xw.customColumnValue(op.col)
+		if err != nil {
+			return err
+		}
+		if skip {
+			xw.xbuf.WriteString("<c/>")
+			continue
+		}
+		if custom != nil {
+			xw.writeJSONCell(custom, false)
+			continue
+		}
+
+		xw.rowOutBuf.Reset()
+		err = xw.writeColumnValue(op.col)
+		if err != nil {
+			return err
+		}
+		xw.writeJSONCell(xw.rowOutBuf.Bytes(), isTimeValue(xw.scanArgs[op.col]))
+	}
+	xw.rowOutBuf.Reset()
+	xw.xbuf.WriteString("</row>\n")
+
+	_, err = xw.xbuf.WriteTo(xw.sheet)
+	return err
+}
+
+// Close finishes the worksheet and writes the remaining parts of the file.
+// It does not close the underlying Writer.  Calling it again returns the same result
+// without writing anything.
+func (xw *XLSXRowsWriter) Close() error {
+	if !xw.closed {
+		xw.closed = true
+		xw.closeErr = xw.close()
+	}
+	return xw.closeErr
+}
+
+func (xw *XLSXRowsWriter) close() error {
+
+	err := xw.start()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(xw.sheet, "</sheetData></worksheet>")
+	if err != nil {
+		return err
+	}
+
+	sheetName := xw.SheetName
+	if sheetName == "" {
+		sheetName = "Sheet1"
+	}
+	var nameBuf bytes.Buffer
+	xml.EscapeText(&nameBuf, []byte(sheetName))
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, nameBuf.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		w, err := xw.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, p.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return xw.zw.Close()
+}
+
+// start creates the zip file and begins the worksheet if not done yet.
+func (xw *XLSXRowsWriter) start() error {
+
+	if xw.zw != nil {
+		return nil
+	}
+
+	if len(xw.colNames) == 0 {
+		err := xw.setupColumns()
+		if err != nil {
+			return err
+		}
+	}
+
+	xw.zw = zip.NewWriter(xw.Writer)
+	sheet, err := xw.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	xw.sheet = sheet
+
+	_, err = io.WriteString(sheet, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`+"\n")
+	return err
+}
+
+// writeJSONCell writes a cell for the JSON value b to xbuf.
+func (xw *XLSXRowsWriter) writeJSONCell(b []byte, isTime bool) {
+
+	b = bytes.TrimSpace(b)
+
+	switch {
+	case len(b) == 0 || string(b) == "null":
+		xw.xbuf.WriteString("<c/>")
+		return
+
+	case string(b) == "true" || string(b) == "false":
+		xw.xbuf.WriteString(`<c t="b"><v>`)
+		if b[0] == 't' {
+			xw.xbuf.WriteByte('1')
+		} else {
+			xw.xbuf.WriteByte('0')
+		}
+		xw.xbuf.WriteString("</v></c>")
+		return
+
+	case isJSONNumber(string(b)):
+		xw.xbuf.WriteString("<c><v>")
+		xw.xbuf.Write(b)
+		xw.xbuf.WriteString("</v></c>")
+		return
+
+	case b[0] == '"':
+		var s string
+		if err := json.Unmarshal(b, &s); err == nil {
+			if isTime {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					xw.xbuf.WriteString(`<c s="1"><v>`)
+					xw.xbuf.WriteString(strconv.FormatFloat(excelSerialDate(t), 'f', -1, 64))
+					xw.xbuf.WriteString("</v></c>")
+					return
+				}
+			}
+			xw.writeStringCell(s)
+			return
+		}
+	}
+
+	// objects, arrays, etc. are written as their JSON text
+	xw.writeStringCell(string(b))
+}
+
+// writeStringCell writes an inline string cell to xbuf.
+func (xw *XLSXRowsWriter) writeStringCell(s string) {
+	xw.xbuf.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(&xw.xbuf, []byte(s))
+	xw.xbuf.WriteString("</t></is></c>")
+}
+
+// isTimeValue returns true if v is a scan arg for a date/time value.
+func isTimeValue(v interface{}) bool {
+	switch v.(type) {
+	case *time.Time, *sql.NullTime, *sql.Null[time.Time]:
+		return true
+	}
+	return false
+}
+
+// excelSerialDate converts t to an Excel serial date (days since 1899-12-30), using the wall clock time of t.
+func excelSerialDate(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return float64(wall.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC))) / float64(24*time.Hour)
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// style index 1 is a date/time format for date cells
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
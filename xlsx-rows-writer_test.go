@@ -0,0 +1,104 @@
+package sqljsonutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXLSXRowsWriter(t *testing.T) {
+
+	db := mustDbSetup(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM widgets ORDER BY widget_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	err = NewXLSXRowsWriter(&buf, rows).WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), ">First One<") || strings.Count(string(b), "<row>") != 3 {
+			t.Errorf("unexpected worksheet: %s", b)
+		}
+		return
+	}
+	t.Errorf("worksheet not found")
+}
+
+func TestXLSXRowsWriterReset(t *testing.T) {
+
+	sheet := func(b []byte) string {
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := zr.Open("xl/worksheets/sheet1.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		s, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(s)
+	}
+
+	var buf bytes.Buffer
+	xw := NewXLSXRowsWriter(&buf, &memRows{
+		cols: []memColumn{{"name", "VARCHAR", reflect.TypeOf("")}},
+		rows: [][]interface{}{{"first"}},
+	})
+	err := xw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := buf.Len()
+	err = xw.Close() // again
+	if err != nil || buf.Len() != n {
+		t.Errorf("second Close wrote %d bytes: %v", buf.Len()-n, err)
+	}
+	if s := sheet(buf.Bytes()); !strings.Contains(s, ">first<") {
+		t.Errorf("unexpected worksheet: %s", s)
+	}
+
+	// the next result set is a new file with its own columns
+	var buf2 bytes.Buffer
+	xw.Reset(&memRows{
+		cols: []memColumn{{"id", "INT", reflect.TypeOf(int64(0))}, {"title", "VARCHAR", reflect.TypeOf("")}},
+		rows: [][]interface{}{{int64(2), "second"}},
+	})
+	xw.Writer = &buf2
+	err = xw.WriteResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := sheet(buf2.Bytes()); !strings.Contains(s, ">title<") || !strings.Contains(s, ">second<") || strings.Contains(s, "first") {
+		t.Errorf("unexpected worksheet: %s", s)
+	}
+}